@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// ParseTimeout parses the timeout of blocking commands given in seconds,
+// zero means blocking forever
+func ParseTimeout(input string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(input, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, fmt.Errorf("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, fmt.Errorf("ERR timeout is negative")
+	}
+	if seconds > math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("ERR timeout is out of range")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// blockForKeys calls serve until it produces a reply, retrying every time one
+// of the keys is written. It returns nil when the timeout expires or the
+// client disconnects first. The memory lock held by the command is released
+// while waiting, commands run by EXEC never wait.
+func blockForKeys(client *Client, memory *Memory, keys []string, timeout time.Duration, serve func() (*RESP, bool)) *RESP {
+	if client.Has(ClientExecuting) {
+		output, _ := serve()
+		return output
+	}
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	client.block(keys)
+	defer client.unblock()
+	for {
+		// register before serving so that a write in between is not missed
+		signal, cancel := memory.BlockOnKeys(keys)
+		output, ok := serve()
+		if ok {
+			cancel()
+			return output
+		}
+
+		memory.Unlock()
+		select {
+		case <-signal:
+			memory.Lock()
+			cancel()
+		case <-deadline:
+			memory.Lock()
+			cancel()
+			return nil
+		case <-client.Context().Done():
+			memory.Lock()
+			cancel()
+			return nil
+		}
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	BloomDefaultErrorRate = 0.01
+	BloomDefaultCapacity  = 100
+	BloomDefaultExpansion = 2
+	// bounds the bits of a layer so a command can not exhaust the memory
+	BloomMaxBits = 1 << 30
+
+	// every new layer tightens the error rate so that the compound error
+	// of the scalable filter stays below the requested one
+	bloomTighteningRatio = 0.5
+	bloomHashSeed        = 0xc6a4a7935bd1e995
+	bloomDumpChunkSize   = 1 << 20
+	bloomHeaderLayerSize = 5 * 8
+)
+
+// bloomLayer is a fixed size bloom filter using double hashing on top of
+// two MurmurHash64A hashes
+type bloomLayer struct {
+	capacity  int
+	errorRate float64
+	hashes    int
+	nbits     uint64
+	bits      []byte
+	items     int
+}
+
+// BloomFilter is a scalable bloom filter, a new and larger layer is stacked
+// each time the top layer reaches its capacity
+type BloomFilter struct {
+	layers     []*bloomLayer
+	expansion  int
+	nonScaling bool
+}
+
+func bloomBitsPerEntry(errorRate float64) float64 {
+	return -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+}
+
+// bloomLayerFits tells whether a layer for capacity items at the error rate
+// stays within BloomMaxBits
+func bloomLayerFits(capacity float64, errorRate float64) bool {
+	return math.Ceil(capacity*bloomBitsPerEntry(errorRate)) <= BloomMaxBits
+}
+
+func newBloomLayer(capacity int, errorRate float64) *bloomLayer {
+	bitsPerEntry := bloomBitsPerEntry(errorRate)
+	nbits := uint64(math.Ceil(float64(capacity) * bitsPerEntry))
+	// round up to whole 64 bit words
+	nbits = max((nbits+63)/64*64, 64)
+	return &bloomLayer{
+		capacity:  capacity,
+		errorRate: errorRate,
+		hashes:    int(math.Ceil(math.Ln2 * bitsPerEntry)),
+		nbits:     nbits,
+		bits:      make([]byte, nbits/8),
+	}
+}
+
+func bloomHash(item []byte) (uint64, uint64) {
+	h1 := MurmurHash64A(item, bloomHashSeed)
+	return h1, MurmurHash64A(item, h1)
+}
+
+func (l *bloomLayer) contains(h1, h2 uint64) bool {
+	for i := 0; i < l.hashes; i++ {
+		pos := (h1 + uint64(i)*h2) % l.nbits
+		if l.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) add(h1, h2 uint64) {
+	for i := 0; i < l.hashes; i++ {
+		pos := (h1 + uint64(i)*h2) % l.nbits
+		l.bits[pos/8] |= 1 << (pos % 8)
+	}
+	l.items++
+}
+
+func NewBloomFilter(capacity int, errorRate float64, expansion int, nonScaling bool) *BloomFilter {
+	return &BloomFilter{
+		layers:     []*bloomLayer{newBloomLayer(capacity, errorRate)},
+		expansion:  expansion,
+		nonScaling: nonScaling,
+	}
+}
+
+func (bf *BloomFilter) Exists(item []byte) bool {
+	h1, h2 := bloomHash(item)
+	for _, layer := range bf.layers {
+		if layer.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add returns false when the item may already be in the filter
+func (bf *BloomFilter) Add(item []byte) (bool, error) {
+	h1, h2 := bloomHash(item)
+	for _, layer := range bf.layers {
+		if layer.contains(h1, h2) {
+			return false, nil
+		}
+	}
+
+	top := bf.layers[len(bf.layers)-1]
+	if top.items >= top.capacity {
+		if bf.nonScaling {
+			return false, fmt.Errorf("ERR non scaling filter is full")
+		}
+		if !bloomLayerFits(float64(top.capacity)*float64(bf.expansion), top.errorRate*bloomTighteningRatio) {
+			return false, fmt.Errorf("ERR filter is full and can not grow further")
+		}
+		top = newBloomLayer(top.capacity*bf.expansion, top.errorRate*bloomTighteningRatio)
+		bf.layers = append(bf.layers, top)
+	}
+	top.add(h1, h2)
+	return true, nil
+}
+
+func (bf *BloomFilter) Capacity() int {
+	capacity := 0
+	for _, layer := range bf.layers {
+		capacity += layer.capacity
+	}
+	return capacity
+}
+
+func (bf *BloomFilter) Items() int {
+	items := 0
+	for _, layer := range bf.layers {
+		items += layer.items
+	}
+	return items
+}
+
+// Size is the memory used by the filter in bytes
+func (bf *BloomFilter) Size() int {
+	size := 0
+	for _, layer := range bf.layers {
+		size += len(layer.bits) + bloomHeaderLayerSize
+	}
+	return size
+}
+
+// header encodes everything but the bits, it is the first chunk of
+// BF.SCANDUMP:
+//
+//	expansion | non scaling | layers | (capacity | nbits | hashes | items | error rate)...
+//
+// as 64 bit little endian words.
+func (bf *BloomFilter) header() []byte {
+	buf := make([]byte, 0, 3*8+len(bf.layers)*bloomHeaderLayerSize)
+	nonScaling := uint64(0)
+	if bf.nonScaling {
+		nonScaling = 1
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(bf.expansion))
+	buf = binary.LittleEndian.AppendUint64(buf, nonScaling)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(bf.layers)))
+	for _, layer := range bf.layers {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(layer.capacity))
+		buf = binary.LittleEndian.AppendUint64(buf, layer.nbits)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(layer.hashes))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(layer.items))
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(layer.errorRate))
+	}
+	return buf
+}
+
+// bloomFromHeader builds an empty filter from a header, the bits are loaded
+// by the following chunks
+func bloomFromHeader(data []byte) (*BloomFilter, bool) {
+	if len(data) < 3*8 {
+		return nil, false
+	}
+	word := func(i int) uint64 {
+		return binary.LittleEndian.Uint64(data[i*8:])
+	}
+	numLayers := int(word(2))
+	if numLayers <= 0 || numLayers > len(data)/bloomHeaderLayerSize || len(data) != 3*8+numLayers*bloomHeaderLayerSize {
+		return nil, false
+	}
+
+	// the header comes from the client, every field is checked so that the
+	// filter can neither allocate nor loop without bounds
+	expansion, nonScaling := word(0), word(1)
+	if nonScaling > 1 || expansion > math.MaxInt64 || (expansion == 0 && nonScaling == 0) {
+		return nil, false
+	}
+	bf := &BloomFilter{
+		layers:     make([]*bloomLayer, 0, numLayers),
+		expansion:  int(expansion),
+		nonScaling: nonScaling == 1,
+	}
+	for i := 0; i < numLayers; i++ {
+		base := 3 + i*5
+		capacity, nbits, hashes, items := word(base), word(base+1), word(base+2), word(base+3)
+		errorRate := math.Float64frombits(word(base + 4))
+		if nbits == 0 || nbits%64 != 0 || nbits > BloomMaxBits {
+			return nil, false
+		}
+		if capacity == 0 || capacity > math.MaxInt64 || items > capacity || hashes < 1 || hashes > 64 {
+			return nil, false
+		}
+		if !(errorRate > 0 && errorRate < 1) {
+			return nil, false
+		}
+		bf.layers = append(bf.layers, &bloomLayer{
+			capacity:  int(capacity),
+			nbits:     nbits,
+			hashes:    int(hashes),
+			items:     int(items),
+			errorRate: errorRate,
+			bits:      make([]byte, nbits/8),
+		})
+	}
+	return bf, true
+}
+
+// chunk returns the bits starting at offset, the bits of all layers are
+// treated as one contiguous buffer
+func (bf *BloomFilter) chunk(offset int) []byte {
+	for _, layer := range bf.layers {
+		if offset < len(layer.bits) {
+			end := min(offset+bloomDumpChunkSize, len(layer.bits))
+			return layer.bits[offset:end]
+		}
+		offset -= len(layer.bits)
+	}
+	return nil
+}
+
+func (bf *BloomFilter) loadChunk(offset int, data []byte) bool {
+	for _, layer := range bf.layers {
+		if offset < len(layer.bits) {
+			if offset+len(data) > len(layer.bits) {
+				return false
+			}
+			copy(layer.bits[offset:], data)
+			return true
+		}
+		offset -= len(layer.bits)
+	}
+	return false
+}
+
+// getBloom returns nil filter when the key does not exist and an error
+// response when the key holds another type
+func getBloom(memory *Memory, key string) (*BloomFilter, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "MBbloom--" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*BloomFilter), nil
+}
+
+func putBloom(memory *Memory, key string, bf *BloomFilter) {
+	memory.Put(key, Entry{Type: "MBbloom--", Value: bf}, Option{})
+}
+
+func bfReserve(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for BF.RESERVE")
+		}
+		key := string(resp.Nested[1].Data)
+		errorRate, err := strconv.ParseFloat(string(resp.Nested[2].Data), 64)
+		if err != nil || errorRate <= 0 || errorRate >= 1 {
+			return SimpleErrorResp("ERR (0 < error rate range < 1)"), nil
+		}
+		capacity, err := strconv.Atoi(string(resp.Nested[3].Data))
+		if err != nil || capacity <= 0 {
+			return SimpleErrorResp("ERR (capacity should be larger than 0)"), nil
+		}
+
+		expansion, nonScaling := BloomDefaultExpansion, false
+		args := resp.Nested[4:]
+		for i := 0; i < len(args); i++ {
+			switch strings.ToUpper(string(args[i].Data)) {
+			case "NONSCALING":
+				nonScaling = true
+			case "EXPANSION":
+				if i+1 >= len(args) {
+					return SimpleErrorResp("ERR syntax error"), nil
+				}
+				expansion, err = strconv.Atoi(string(args[i+1].Data))
+				if err != nil || expansion < 1 {
+					return SimpleErrorResp("ERR (expansion should be greater or equal to 1)"), nil
+				}
+				i++
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+
+		if !bloomLayerFits(float64(capacity), errorRate) {
+			return SimpleErrorResp("ERR (capacity is too large for the error rate)"), nil
+		}
+		if memory.Get(key).Type != "none" {
+			return SimpleErrorResp("ERR item exists"), nil
+		}
+		putBloom(memory, key, NewBloomFilter(capacity, errorRate, expansion, nonScaling))
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+// bfAddGeneric adds the items creating the filter with the default settings
+func bfAddGeneric(memory *Memory, key string, items []*RESP) ([]*RESP, *RESP) {
+	bf, errResp := getBloom(memory, key)
+	if errResp != nil {
+		return nil, errResp
+	}
+	if bf == nil {
+		bf = NewBloomFilter(BloomDefaultCapacity, BloomDefaultErrorRate, BloomDefaultExpansion, false)
+	}
+
+	output := make([]*RESP, 0, len(items))
+	for _, item := range items {
+		added, err := bf.Add(item.Data)
+		if err != nil {
+			output = append(output, SimpleErrorResp(err.Error()))
+			continue
+		}
+		output = append(output, BoolIntegerResp(added))
+	}
+	putBloom(memory, key, bf)
+	return output, nil
+}
+
+func bfAdd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for BF.ADD")
+		}
+		output, errResp := bfAddGeneric(memory, string(resp.Nested[1].Data), resp.Nested[2:3])
+		if errResp != nil {
+			return errResp, nil
+		}
+		return output[0], nil
+	}
+}
+
+func bfMadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for BF.MADD")
+		}
+		output, errResp := bfAddGeneric(memory, string(resp.Nested[1].Data), resp.Nested[2:])
+		if errResp != nil {
+			return errResp, nil
+		}
+		return ArrayResp(output...), nil
+	}
+}
+
+func bfExistsGeneric(memory *Memory, key string, items []*RESP) ([]*RESP, *RESP) {
+	bf, errResp := getBloom(memory, key)
+	if errResp != nil {
+		return nil, errResp
+	}
+	output := make([]*RESP, 0, len(items))
+	for _, item := range items {
+		output = append(output, BoolIntegerResp(bf != nil && bf.Exists(item.Data)))
+	}
+	return output, nil
+}
+
+func bfExists(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for BF.EXISTS")
+		}
+		output, errResp := bfExistsGeneric(memory, string(resp.Nested[1].Data), resp.Nested[2:3])
+		if errResp != nil {
+			return errResp, nil
+		}
+		return output[0], nil
+	}
+}
+
+func bfMexists(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for BF.MEXISTS")
+		}
+		output, errResp := bfExistsGeneric(memory, string(resp.Nested[1].Data), resp.Nested[2:])
+		if errResp != nil {
+			return errResp, nil
+		}
+		return ArrayResp(output...), nil
+	}
+}
+
+func bfCard(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for BF.CARD")
+		}
+		bf, errResp := getBloom(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if bf == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(bf.Items()), nil
+	}
+}
+
+func bfInfo(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for BF.INFO")
+		}
+		bf, errResp := getBloom(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if bf == nil {
+			return SimpleErrorResp("ERR not found"), nil
+		}
+
+		expansion := IntegerResp(bf.expansion)
+		if bf.nonScaling {
+			expansion = BulkStringResp("")
+		}
+		fields := []struct {
+			option string
+			name   string
+			value  *RESP
+		}{
+			{"CAPACITY", "Capacity", IntegerResp(bf.Capacity())},
+			{"SIZE", "Size", IntegerResp(bf.Size())},
+			{"FILTERS", "Number of filters", IntegerResp(len(bf.layers))},
+			{"ITEMS", "Number of items inserted", IntegerResp(bf.Items())},
+			{"EXPANSION", "Expansion rate", expansion},
+		}
+
+		if len(resp.Nested) > 2 {
+			option := strings.ToUpper(string(resp.Nested[2].Data))
+			for _, field := range fields {
+				if field.option == option {
+					return ArrayResp(field.value), nil
+				}
+			}
+			return SimpleErrorResp("ERR Invalid information value"), nil
+		}
+		output := ArrayResp()
+		for _, field := range fields {
+			output.Nested = append(output.Nested, BulkStringResp(field.name), field.value)
+		}
+		return output, nil
+	}
+}
+
+// bfScandump iterates the filter in chunks, iterator 0 starts with the
+// header and the following iterators are offsets into the bits, plus one.
+// An iterator of 0 in the reply marks the end.
+func bfScandump(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for BF.SCANDUMP")
+		}
+		iterator, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || iterator < 0 {
+			return SimpleErrorResp("ERR invalid iterator"), nil
+		}
+		bf, errResp := getBloom(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if bf == nil {
+			return SimpleErrorResp("ERR not found"), nil
+		}
+
+		if iterator == 0 {
+			return ArrayResp(IntegerResp(1), BulkStringResp(string(bf.header()))), nil
+		}
+		chunk := bf.chunk(iterator - 1)
+		if len(chunk) == 0 {
+			return ArrayResp(IntegerResp(0), BulkStringResp("")), nil
+		}
+		return ArrayResp(IntegerResp(iterator+len(chunk)), BulkStringResp(string(chunk))), nil
+	}
+}
+
+// bfLoadchunk restores the chunks of BF.SCANDUMP, given along with the
+// iterator returned for them
+func bfLoadchunk(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for BF.LOADCHUNK")
+		}
+		key := string(resp.Nested[1].Data)
+		iterator, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || iterator <= 0 {
+			return SimpleErrorResp("ERR invalid iterator"), nil
+		}
+		data := resp.Nested[3].Data
+
+		bf, errResp := getBloom(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		if iterator == 1 {
+			bf, ok := bloomFromHeader(data)
+			if !ok {
+				return SimpleErrorResp("ERR received bad data"), nil
+			}
+			putBloom(memory, key, bf)
+			return SimpleStringResp("OK"), nil
+		}
+		if bf == nil {
+			return SimpleErrorResp("ERR not found"), nil
+		}
+		offset := iterator - 1 - len(data)
+		if offset < 0 || !bf.loadChunk(offset, data) {
+			return SimpleErrorResp("ERR invalid offset - no link in chain"), nil
+		}
+		putBloom(memory, key, bf)
+		return SimpleStringResp("OK"), nil
+	}
+}
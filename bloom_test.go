@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestBloomFilter_ErrorRate(t *testing.T) {
+	bf := NewBloomFilter(1000, 0.01, 2, false)
+	for i := 0; i < 10000; i++ {
+		bf.Add([]byte(fmt.Sprintf("item:%d", i)))
+	}
+	if len(bf.layers) < 2 {
+		t.Errorf("expected the filter to scale, layers: %v", len(bf.layers))
+	}
+	for i := 0; i < 10000; i++ {
+		if !bf.Exists([]byte(fmt.Sprintf("item:%d", i))) {
+			t.Fatalf("false negative for item:%d", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if bf.Exists([]byte(fmt.Sprintf("other:%d", i))) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.02 {
+		t.Errorf("false positive rate too high: %v", rate)
+	}
+}
+
+func TestBloomFilter_NonScaling(t *testing.T) {
+	bf := NewBloomFilter(2, 0.01, 2, true)
+	bf.Add([]byte("a"))
+	bf.Add([]byte("b"))
+	if _, err := bf.Add([]byte("c")); err == nil {
+		t.Errorf("expected non scaling filter to be full")
+	}
+}
+
+func TestProcessor_BloomScandump(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+
+	source := NewBloomFilter(100, 0.001, 2, false)
+	for i := 0; i < 300; i++ {
+		source.Add([]byte(fmt.Sprintf("item:%d", i)))
+	}
+	putBloom(memory, "src", source)
+
+	iterator := "0"
+	for {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp([]string{"BF.SCANDUMP", "src", iterator})))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// the last reply carries a nil chunk
+		if string(output) == "*2\r\n:0\r\n$-1\r\n" {
+			break
+		}
+		reply, err := respParser.Deserialize(output)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		iterator = string(reply.Nested[0].Data)
+		output, _ = processor.Accept(client, respParser.Serialize(BulkStringArrayResp([]string{"BF.LOADCHUNK", "dst", iterator, string(reply.Nested[1].Data)})))
+		if string(output) != "+OK\r\n" {
+			t.Fatalf("loadchunk failed: %q", output)
+		}
+	}
+
+	restored, _ := getBloom(memory, "dst")
+	if restored == nil || restored.Items() != source.Items() || len(restored.layers) != len(source.layers) {
+		t.Fatalf("restored filter differs from the source")
+	}
+	for i := 0; i < 300; i++ {
+		if !restored.Exists([]byte(fmt.Sprintf("item:%d", i))) {
+			t.Fatalf("restored filter misses item:%d", i)
+		}
+	}
+}
+
+func TestProcessor_Bloom(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "reserve",
+			args:     []string{"BF.RESERVE", "bf", "0.01", "1000", "EXPANSION", "4"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "reserve existing",
+			args:     []string{"BF.RESERVE", "bf", "0.01", "1000"},
+			expected: "-ERR item exists\r\n",
+		},
+		{
+			name:     "reserve invalid error rate",
+			args:     []string{"BF.RESERVE", "other", "1.5", "1000"},
+			expected: "-ERR (0 < error rate range < 1)\r\n",
+		},
+		{
+			name:     "reserve capacity too large",
+			args:     []string{"BF.RESERVE", "other", "0.0001", "9223372036854775807"},
+			expected: "-ERR (capacity is too large for the error rate)\r\n",
+		},
+		{
+			name:     "add",
+			args:     []string{"BF.ADD", "bf", "a"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "add again",
+			args:     []string{"BF.ADD", "bf", "a"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "madd",
+			args:     []string{"BF.MADD", "bf", "a", "b", "c"},
+			expected: "*3\r\n:0\r\n:1\r\n:1\r\n",
+		},
+		{
+			name:     "exists",
+			args:     []string{"BF.EXISTS", "bf", "b"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "mexists",
+			args:     []string{"BF.MEXISTS", "bf", "a", "z"},
+			expected: "*2\r\n:1\r\n:0\r\n",
+		},
+		{
+			name:     "exists missing key",
+			args:     []string{"BF.EXISTS", "missing", "a"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "card",
+			args:     []string{"BF.CARD", "bf"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "info field",
+			args:     []string{"BF.INFO", "bf", "EXPANSION"},
+			expected: "*1\r\n:4\r\n",
+		},
+		{
+			name:     "info items",
+			args:     []string{"BF.INFO", "bf", "ITEMS"},
+			expected: "*1\r\n:3\r\n",
+		},
+		{
+			name:     "add creates filter",
+			args:     []string{"BF.ADD", "auto", "a"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "type",
+			args:     []string{"TYPE", "auto"},
+			expected: "+MBbloom--\r\n",
+		},
+		{
+			name:     "info missing key",
+			args:     []string{"BF.INFO", "missing"},
+			expected: "-ERR not found\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
+
+func TestBloomFilter_HeaderValidation(t *testing.T) {
+	valid := NewBloomFilter(100, 0.01, 2, false).header()
+	if _, ok := bloomFromHeader(valid); !ok {
+		t.Fatalf("valid header rejected")
+	}
+
+	// word of the first layer, after expansion, non scaling and layers
+	layerWord := func(i int) int { return (3 + i) * 8 }
+	testcases := []struct {
+		name  string
+		word  int
+		value uint64
+	}{
+		{name: "zero expansion", word: 0, value: 0},
+		{name: "invalid non scaling", word: 8, value: 2},
+		{name: "zero capacity", word: layerWord(0), value: 0},
+		{name: "negative capacity", word: layerWord(0), value: uint64(1) << 63},
+		{name: "zero hashes", word: layerWord(2), value: 0},
+		{name: "too many hashes", word: layerWord(2), value: 1 << 40},
+		{name: "items over capacity", word: layerWord(3), value: 101},
+		{name: "negative items", word: layerWord(3), value: ^uint64(2)},
+		{name: "error rate of 1", word: layerWord(4), value: math.Float64bits(1)},
+		{name: "nan error rate", word: layerWord(4), value: math.Float64bits(math.NaN())},
+	}
+	for _, tt := range testcases {
+		header := append([]byte{}, valid...)
+		binary.LittleEndian.PutUint64(header[tt.word:], tt.value)
+		if _, ok := bloomFromHeader(header); ok {
+			t.Errorf("test: %v - header accepted", tt.name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ClientFlag uint32
+
+const (
+	// inside MULTI, commands are queued
+	ClientMulti ClientFlag = 1 << iota
+	// running the queued commands of EXEC, commands never block
+	ClientExecuting
+	// a command was rejected while queuing, EXEC discards the transaction
+	ClientDirtyExec
+	// waiting on keys in a blocking command
+	ClientBlocked
+	// disconnected, the client must not be used anymore
+	ClientClosed
+)
+
+// Client is the state of a connection, from its connection to its
+// disconnection
+type Client struct {
+	ID        int64
+	Addr      string
+	Name      string
+	DB        int
+	Protocol  int
+	Flags     ClientFlag
+	CreatedAt time.Time
+
+	// commands queued by MULTI
+	tx *TxUnit
+	// watched keys with their version when watched
+	watched map[string]uint64
+	// channels and patterns subscribed to
+	subscriptions map[string]struct{}
+	patterns      map[string]struct{}
+	// keys waited on while blocked
+	blockedKeys []string
+
+	// canceled on disconnection, releasing a blocked command
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func NewClient(id int64, addr string) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Client{
+		ID:            id,
+		Addr:          addr,
+		Protocol:      2,
+		CreatedAt:     time.Now(),
+		watched:       make(map[string]uint64),
+		subscriptions: make(map[string]struct{}),
+		patterns:      make(map[string]struct{}),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+func (c *Client) Context() context.Context {
+	return c.ctx
+}
+
+func (c *Client) Has(flag ClientFlag) bool {
+	return c.Flags&flag != 0
+}
+
+// block records the keys the client waits on until unblock
+func (c *Client) block(keys []string) {
+	c.Flags |= ClientBlocked
+	c.blockedKeys = keys
+}
+
+func (c *Client) unblock() {
+	c.Flags &^= ClientBlocked
+	c.blockedKeys = nil
+}
+
+// Close drops the transaction, the watched keys and the subscriptions of the
+// client and releases the command it is blocked in
+func (c *Client) Close() {
+	c.Discard()
+	c.Unwatch()
+	clear(c.subscriptions)
+	clear(c.patterns)
+	c.Flags |= ClientClosed
+	c.cancel()
+}
+
+// Info describes the client the way CLIENT INFO and CLIENT LIST do
+func (c *Client) Info() string {
+	flags := ""
+	for _, flag := range []struct {
+		flag ClientFlag
+		code string
+	}{{ClientMulti, "x"}, {ClientBlocked, "b"}} {
+		if c.Has(flag.flag) {
+			flags += flag.code
+		}
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	multi := -1
+	if c.tx != nil {
+		multi = len(c.tx.Queued)
+	}
+	return fmt.Sprintf("id=%d addr=%v name=%v age=%d db=%d flags=%v multi=%d watch=%d sub=%d psub=%d resp=%d",
+		c.ID, c.Addr, c.Name, int(time.Since(c.CreatedAt).Seconds()), c.DB, flags, multi,
+		len(c.watched), len(c.subscriptions), len(c.patterns), c.Protocol)
+}
+
+// clientCmd runs the ID, GETNAME, SETNAME, INFO and LIST subcommands
+func clientCmd(processor *Processor) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		subcommand := strings.ToUpper(string(resp.Nested[1].Data))
+		switch {
+		case subcommand == "ID" && len(resp.Nested) == 2:
+			return IntegerResp(int(client.ID)), nil
+		case subcommand == "GETNAME" && len(resp.Nested) == 2:
+			return BulkStringResp(client.Name), nil
+		case subcommand == "SETNAME" && len(resp.Nested) == 3:
+			name := string(resp.Nested[2].Data)
+			if strings.ContainsAny(name, " \n") {
+				return SimpleErrorResp("ERR Client names cannot contain spaces, newlines or special characters."), nil
+			}
+			client.Name = name
+			return SimpleStringResp("OK"), nil
+		case subcommand == "INFO" && len(resp.Nested) == 2:
+			return BulkStringResp(client.Info() + "\n"), nil
+		case subcommand == "LIST" && len(resp.Nested) == 2:
+			clients := make([]*Client, 0, len(processor.clients))
+			for _, other := range processor.clients {
+				clients = append(clients, other)
+			}
+			sort.Slice(clients, func(i, j int) bool {
+				return clients[i].ID < clients[j].ID
+			})
+			list := ""
+			for _, other := range clients {
+				list += other.Info() + "\n"
+			}
+			return BulkStringResp(list), nil
+		}
+		return SimpleErrorResp(fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%v'. Try CLIENT HELP.", string(resp.Nested[1].Data))), nil
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessor_Client(t *testing.T) {
+	respParser := NewRESP()
+	processor := NewProcessor(respParser, NewMemory())
+	client := processor.Connect("10.0.0.1:5000")
+	other := processor.Connect("10.0.0.2:5000")
+
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "client id", args: []string{"CLIENT", "ID"}, expected: ":1\r\n"},
+		{name: "client getname unset", args: []string{"CLIENT", "GETNAME"}, expected: "$-1\r\n"},
+		{name: "client setname", args: []string{"client", "setname", "worker"}, expected: "+OK\r\n"},
+		{name: "client setname with space", args: []string{"CLIENT", "SETNAME", "a b"}, expected: "-ERR Client names cannot contain spaces, newlines or special characters.\r\n"},
+		{name: "client getname", args: []string{"CLIENT", "GETNAME"}, expected: "$6\r\nworker\r\n"},
+		{name: "client unknown subcommand", args: []string{"CLIENT", "KILL"}, expected: "-ERR unknown subcommand or wrong number of arguments for 'KILL'. Try CLIENT HELP.\r\n"},
+	}
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+
+	output, _ := processor.Accept(other, respParser.Serialize(BulkStringArrayResp([]string{"CLIENT", "LIST"})))
+	list, err := respParser.Deserialize(output)
+	if err != nil {
+		t.Fatalf("client list - unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(list.Data), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "id=1 addr=10.0.0.1:5000 name=worker ") || !strings.HasPrefix(lines[1], "id=2 addr=10.0.0.2:5000 name= ") {
+		t.Errorf("client list - actual: %q", string(output))
+	}
+}
+
+func TestProcessor_Disconnect(t *testing.T) {
+	respParser := NewRESP()
+	processor := NewProcessor(respParser, NewMemory())
+	client := processor.Connect("10.0.0.1:5000")
+	accept := func(args ...string) string {
+		output, _ := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(args)))
+		return string(output)
+	}
+
+	accept("WATCH", "k")
+	accept("MULTI")
+	if output := accept("SET", "k", "v"); output != "+QUEUED\r\n" {
+		t.Fatalf("queue - actual: %q", output)
+	}
+	if info := client.Info(); !strings.Contains(info, "flags=x multi=1 watch=1") {
+		t.Errorf("client info in multi - actual: %q", info)
+	}
+
+	processor.Disconnect(client)
+	if client.GetTx() != nil || client.InMulti() || len(client.watched) != 0 {
+		t.Errorf("transaction left after disconnection")
+	}
+	if !client.Has(ClientClosed) || client.Context().Err() == nil {
+		t.Errorf("client not closed")
+	}
+	if _, ok := processor.clients[client.ID]; ok {
+		t.Errorf("client still registered")
+	}
+}
+
+func TestServer_DisconnectWhileBlocked(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if conn, err := listener.Accept(); err == nil {
+			handle(conn, processor)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.Write(respParser.Serialize(BulkStringArrayResp([]string{"BZPOPMIN", "jobs", "0"})))
+
+	blocked := func() bool {
+		memory.Lock()
+		defer memory.Unlock()
+		for _, client := range processor.clients {
+			return client.Has(ClientBlocked)
+		}
+		return false
+	}
+	for start := time.Now(); !blocked(); time.Sleep(5 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("client never blocked")
+		}
+	}
+
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("blocked command not released by the disconnection")
+	}
+
+	memory.Lock()
+	defer memory.Unlock()
+	if len(processor.clients) != 0 {
+		t.Errorf("client still registered")
+	}
+	memory.waitersLock.Lock()
+	defer memory.waitersLock.Unlock()
+	if len(memory.waiters) != 0 {
+		t.Errorf("key waiters left: %v", memory.waiters)
+	}
+}
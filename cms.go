@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CMSMaxCounters bounds width*depth of a sketch so a single command can not
+// exhaust the memory
+const CMSMaxCounters = 1 << 24
+
+// CountMinSketch keeps depth rows of width counters, an item increments one
+// counter per row and its count is estimated by the smallest of them
+type CountMinSketch struct {
+	width    int
+	depth    int
+	counters []int
+	count    int
+}
+
+func NewCountMinSketch(width, depth int) *CountMinSketch {
+	return &CountMinSketch{
+		width:    width,
+		depth:    depth,
+		counters: make([]int, width*depth),
+	}
+}
+
+// cmsDimensionsByProb returns the dimensions for an overestimation of error
+// times the total count with the given probability of exceeding it
+func cmsDimensionsByProb(errorRate, probability float64) (int, int) {
+	width := int(math.Ceil(2 / errorRate))
+	depth := int(math.Ceil(math.Log10(probability) / math.Log10(0.5)))
+	return width, depth
+}
+
+func (cms *CountMinSketch) index(item []byte, row int) int {
+	return row*cms.width + int(MurmurHash64A(item, uint64(row))%uint64(cms.width))
+}
+
+// IncrBy returns false, leaving the sketch untouched, when a counter would
+// overflow
+func (cms *CountMinSketch) IncrBy(item []byte, incr int) (int, bool) {
+	if cms.count > math.MaxInt-incr {
+		return 0, false
+	}
+	for row := 0; row < cms.depth; row++ {
+		if cms.counters[cms.index(item, row)] > math.MaxInt-incr {
+			return 0, false
+		}
+	}
+	estimate := math.MaxInt
+	for row := 0; row < cms.depth; row++ {
+		i := cms.index(item, row)
+		cms.counters[i] += incr
+		estimate = min(estimate, cms.counters[i])
+	}
+	cms.count += incr
+	return estimate, true
+}
+
+// cmsAddWeighted returns sum+value*weight, false when it overflows
+func cmsAddWeighted(sum, value, weight int) (int, bool) {
+	product := value * weight
+	if value != 0 && (product/value != weight || (value == -1 && weight == math.MinInt)) {
+		return 0, false
+	}
+	total := sum + product
+	if (total > sum) != (product > 0) && product != 0 {
+		return 0, false
+	}
+	return total, true
+}
+
+func (cms *CountMinSketch) Query(item []byte) int {
+	estimate := math.MaxInt
+	for row := 0; row < cms.depth; row++ {
+		estimate = min(estimate, cms.counters[cms.index(item, row)])
+	}
+	return estimate
+}
+
+// getCMS returns nil sketch when the key does not exist and an error
+// response when the key holds another type
+func getCMS(memory *Memory, key string) (*CountMinSketch, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "CMSk-TYPE" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*CountMinSketch), nil
+}
+
+func putCMS(memory *Memory, key string, cms *CountMinSketch) {
+	memory.Put(key, Entry{Type: "CMSk-TYPE", Value: cms}, Option{})
+}
+
+func cmsInitGeneric(memory *Memory, key string, width, depth int) *RESP {
+	if width > CMSMaxCounters/depth {
+		return SimpleErrorResp("ERR CMS: width*depth is too large")
+	}
+	if memory.Get(key).Type != "none" {
+		return SimpleErrorResp("ERR CMS: key already exists")
+	}
+	putCMS(memory, key, NewCountMinSketch(width, depth))
+	return SimpleStringResp("OK")
+}
+
+func cmsInitbydim(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for CMS.INITBYDIM")
+		}
+		width, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || width < 1 {
+			return SimpleErrorResp("ERR CMS: invalid width"), nil
+		}
+		depth, err := strconv.Atoi(string(resp.Nested[3].Data))
+		if err != nil || depth < 1 {
+			return SimpleErrorResp("ERR CMS: invalid depth"), nil
+		}
+		return cmsInitGeneric(memory, string(resp.Nested[1].Data), width, depth), nil
+	}
+}
+
+func cmsInitbyprob(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for CMS.INITBYPROB")
+		}
+		errorRate, err := strconv.ParseFloat(string(resp.Nested[2].Data), 64)
+		// a width beyond the bound would also overflow the conversion to int
+		if err != nil || errorRate <= 0 || errorRate >= 1 || 2/errorRate > CMSMaxCounters {
+			return SimpleErrorResp("ERR CMS: invalid overestimation value"), nil
+		}
+		probability, err := strconv.ParseFloat(string(resp.Nested[3].Data), 64)
+		if err != nil || probability <= 0 || probability >= 1 {
+			return SimpleErrorResp("ERR CMS: invalid prob value"), nil
+		}
+		width, depth := cmsDimensionsByProb(errorRate, probability)
+		return cmsInitGeneric(memory, string(resp.Nested[1].Data), width, depth), nil
+	}
+}
+
+func cmsIncrby(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 || len(resp.Nested)%2 != 0 {
+			return nil, fmt.Errorf("insufficient arguments for CMS.INCRBY")
+		}
+		key := string(resp.Nested[1].Data)
+		cms, errResp := getCMS(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if cms == nil {
+			return SimpleErrorResp("ERR CMS: key does not exist"), nil
+		}
+
+		// validate every increment before touching the counters
+		increments := make([]int, 0, len(resp.Nested)/2-1)
+		for i := 3; i < len(resp.Nested); i += 2 {
+			incr, err := strconv.Atoi(string(resp.Nested[i].Data))
+			if err != nil || incr < 0 {
+				return SimpleErrorResp("ERR CMS: Cannot parse number"), nil
+			}
+			increments = append(increments, incr)
+		}
+
+		output := ArrayResp()
+		for i, incr := range increments {
+			estimate, ok := cms.IncrBy(resp.Nested[2+i*2].Data, incr)
+			if !ok {
+				putCMS(memory, key, cms)
+				return SimpleErrorResp("ERR CMS: INCRBY overflow"), nil
+			}
+			output.Nested = append(output.Nested, IntegerResp(estimate))
+		}
+		putCMS(memory, key, cms)
+		return output, nil
+	}
+}
+
+func cmsQuery(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for CMS.QUERY")
+		}
+		cms, errResp := getCMS(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if cms == nil {
+			return SimpleErrorResp("ERR CMS: key does not exist"), nil
+		}
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			output.Nested = append(output.Nested, IntegerResp(cms.Query(arg.Data)))
+		}
+		return output, nil
+	}
+}
+
+// cmsMerge merges "numkeys source [source ...] [WEIGHTS weight [weight ...]]"
+// into an existing destination with the same dimensions
+func cmsMerge(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for CMS.MERGE")
+		}
+		key := string(resp.Nested[1].Data)
+		numKeys, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || numKeys < 1 || numKeys > len(resp.Nested)-3 {
+			return SimpleErrorResp("ERR CMS: invalid numkeys"), nil
+		}
+
+		weights := make([]int, numKeys)
+		for i := range weights {
+			weights[i] = 1
+		}
+		args := resp.Nested[3+numKeys:]
+		if len(args) > 0 {
+			if strings.ToUpper(string(args[0].Data)) != "WEIGHTS" || len(args) != numKeys+1 {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			for i, arg := range args[1:] {
+				weights[i], err = strconv.Atoi(string(arg.Data))
+				if err != nil {
+					return SimpleErrorResp("ERR CMS: invalid weight value"), nil
+				}
+			}
+		}
+
+		dest, errResp := getCMS(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if dest == nil {
+			return SimpleErrorResp("ERR CMS: key does not exist"), nil
+		}
+		sources := make([]*CountMinSketch, 0, numKeys)
+		for _, arg := range resp.Nested[3 : 3+numKeys] {
+			src, errResp := getCMS(memory, string(arg.Data))
+			if errResp != nil {
+				return errResp, nil
+			}
+			if src == nil {
+				return SimpleErrorResp("ERR CMS: key does not exist"), nil
+			}
+			if src.width != dest.width || src.depth != dest.depth {
+				return SimpleErrorResp("ERR CMS: width/depth is not equal"), nil
+			}
+			sources = append(sources, src)
+		}
+
+		// the destination may be one of the sources, sum into a new table
+		counters := make([]int, len(dest.counters))
+		count := 0
+		for i, src := range sources {
+			ok := true
+			for j, counter := range src.counters {
+				if counters[j], ok = cmsAddWeighted(counters[j], counter, weights[i]); !ok {
+					return SimpleErrorResp("ERR CMS: MERGE overflow"), nil
+				}
+			}
+			if count, ok = cmsAddWeighted(count, src.count, weights[i]); !ok {
+				return SimpleErrorResp("ERR CMS: MERGE overflow"), nil
+			}
+		}
+		dest.counters, dest.count = counters, count
+		putCMS(memory, key, dest)
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+func cmsInfo(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for CMS.INFO")
+		}
+		cms, errResp := getCMS(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if cms == nil {
+			return SimpleErrorResp("ERR CMS: key does not exist"), nil
+		}
+		return ArrayResp(
+			BulkStringResp("width"), IntegerResp(cms.width),
+			BulkStringResp("depth"), IntegerResp(cms.depth),
+			BulkStringResp("count"), IntegerResp(cms.count),
+		), nil
+	}
+}
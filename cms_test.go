@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCountMinSketch_Overestimation(t *testing.T) {
+	width, depth := cmsDimensionsByProb(0.001, 0.01)
+	cms := NewCountMinSketch(width, depth)
+	for i := 0; i < 1000; i++ {
+		cms.IncrBy([]byte(fmt.Sprintf("item:%d", i)), i%10+1)
+	}
+	for i := 0; i < 1000; i++ {
+		estimate := cms.Query([]byte(fmt.Sprintf("item:%d", i)))
+		if estimate < i%10+1 {
+			t.Fatalf("underestimated item:%d - %v", i, estimate)
+		}
+		// error * total count, total is 5500
+		if estimate > i%10+1+6 {
+			t.Errorf("overestimated item:%d - %v", i, estimate)
+		}
+	}
+}
+
+func TestProcessor_CountMinSketch(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "init by dim",
+			args:     []string{"CMS.INITBYDIM", "a", "1000", "5"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "init by prob",
+			args:     []string{"CMS.INITBYPROB", "b", "0.001", "0.01"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "init by dim too large",
+			args:     []string{"CMS.INITBYDIM", "big", "100000000000", "100000000000"},
+			expected: "-ERR CMS: width*depth is too large\r\n",
+		},
+		{
+			name:     "init by prob too large",
+			args:     []string{"CMS.INITBYPROB", "big", "0.0000000001", "0.01"},
+			expected: "-ERR CMS: invalid overestimation value\r\n",
+		},
+		{
+			name:     "info",
+			args:     []string{"CMS.INFO", "b"},
+			expected: "*6\r\n$5\r\nwidth\r\n:2000\r\n$5\r\ndepth\r\n:7\r\n$5\r\ncount\r\n:0\r\n",
+		},
+		{
+			name:     "init existing",
+			args:     []string{"CMS.INITBYDIM", "a", "10", "5"},
+			expected: "-ERR CMS: key already exists\r\n",
+		},
+		{
+			name:     "incrby",
+			args:     []string{"CMS.INCRBY", "a", "x", "5", "y", "2"},
+			expected: "*2\r\n:5\r\n:2\r\n",
+		},
+		{
+			name:     "incrby invalid number",
+			args:     []string{"CMS.INCRBY", "a", "x", "-1"},
+			expected: "-ERR CMS: Cannot parse number\r\n",
+		},
+		{
+			name:     "init c",
+			args:     []string{"CMS.INITBYDIM", "c", "1000", "5"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "incrby c",
+			args:     []string{"CMS.INCRBY", "c", "x", "1"},
+			expected: "*1\r\n:1\r\n",
+		},
+		{
+			name:     "merge with weights",
+			args:     []string{"CMS.MERGE", "c", "2", "a", "c", "WEIGHTS", "2", "3"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "query merged",
+			args:     []string{"CMS.QUERY", "c", "x", "y", "z"},
+			expected: "*3\r\n:13\r\n:4\r\n:0\r\n",
+		},
+		{
+			name:     "merge different dimensions",
+			args:     []string{"CMS.MERGE", "c", "1", "b"},
+			expected: "-ERR CMS: width/depth is not equal\r\n",
+		},
+		{
+			name:     "query missing key",
+			args:     []string{"CMS.QUERY", "missing", "x"},
+			expected: "-ERR CMS: key does not exist\r\n",
+		},
+		{
+			name:     "merge huge numkeys",
+			args:     []string{"CMS.MERGE", "c", "9223372036854775807", "c"},
+			expected: "-ERR CMS: invalid numkeys\r\n",
+		},
+		{
+			name:     "init d",
+			args:     []string{"CMS.INITBYDIM", "d", "10", "2"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "incrby max",
+			args:     []string{"CMS.INCRBY", "d", "a", "9223372036854775807"},
+			expected: "*1\r\n:9223372036854775807\r\n",
+		},
+		{
+			name:     "incrby overflow",
+			args:     []string{"CMS.INCRBY", "d", "a", "1"},
+			expected: "-ERR CMS: INCRBY overflow\r\n",
+		},
+		{
+			name:     "query after overflow",
+			args:     []string{"CMS.QUERY", "d", "a"},
+			expected: "*1\r\n:9223372036854775807\r\n",
+		},
+		{
+			name:     "merge overflow",
+			args:     []string{"CMS.MERGE", "d", "1", "d", "WEIGHTS", "2"},
+			expected: "-ERR CMS: MERGE overflow\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
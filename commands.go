@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// commandArity is the number of arguments of every command, its name
+// included. A negative arity -N means at least N arguments, as in the
+// redis command table.
+var commandArity = map[string]int{
+	"PING":       -1,
+	"ECHO":       2,
+	"GET":        2,
+	"SET":        -3,
+	"INFO":       -1,
+	"REPLCONF":   -1,
+	"PSYNC":      -3,
+	"TYPE":       2,
+	"XADD":       -5,
+	"XRANGE":     -4,
+	"XREVRANGE":  -4,
+	"XREAD":      -4,
+	"XLEN":       2,
+	"XDEL":       -3,
+	"XTRIM":      -4,
+	"XSETID":     -3,
+	"XGROUP":     -4,
+	"XREADGROUP": -7,
+	"XACK":       -4,
+	"XPENDING":   -3,
+	"XCLAIM":     -6,
+	"XAUTOCLAIM": -6,
+	"XINFO":      -3,
+	"INCR":       2,
+	"MULTI":      1,
+	"EXEC":       1,
+	"DISCARD":    1,
+	"WATCH":      -2,
+	"UNWATCH":    1,
+	"FLUSHALL":   -1,
+	"FLUSHDB":    -1,
+	"CLIENT":     -2,
+
+	// hashes
+	"HSET":    -4,
+	"HGET":    3,
+	"HMGET":   -3,
+	"HGETALL": 2,
+	"HDEL":    -3,
+	"HLEN":    2,
+
+	// sets
+	"SADD":        -3,
+	"SREM":        -3,
+	"SISMEMBER":   3,
+	"SMISMEMBER":  -3,
+	"SMEMBERS":    2,
+	"SCARD":       2,
+	"SPOP":        -2,
+	"SRANDMEMBER": -2,
+	"SMOVE":       4,
+	"SINTER":      -2,
+	"SUNION":      -2,
+	"SDIFF":       -2,
+	"SINTERSTORE": -3,
+	"SUNIONSTORE": -3,
+	"SDIFFSTORE":  -3,
+	"SINTERCARD":  -3,
+	"SSCAN":       -3,
+
+	// sorted sets
+	"ZADD":        -4,
+	"ZINCRBY":     4,
+	"ZREM":        -3,
+	"ZSCORE":      3,
+	"ZMSCORE":     -3,
+	"ZCARD":       2,
+	"ZCOUNT":      4,
+	"ZLEXCOUNT":   4,
+	"ZRANK":       -3,
+	"ZREVRANK":    -3,
+	"ZRANGE":      -4,
+	"ZRANGESTORE": -5,
+	"ZUNION":      -3,
+	"ZINTER":      -3,
+	"ZDIFF":       -3,
+	"ZUNIONSTORE": -4,
+	"ZINTERSTORE": -4,
+	"ZDIFFSTORE":  -4,
+	"ZINTERCARD":  -3,
+	"ZPOPMIN":     -2,
+	"ZPOPMAX":     -2,
+	"ZMPOP":       -4,
+	"BZPOPMIN":    -3,
+	"BZPOPMAX":    -3,
+	"BZMPOP":      -5,
+
+	// hyperloglog
+	"PFADD":   -2,
+	"PFCOUNT": -2,
+	"PFMERGE": -2,
+
+	// geospatial
+	"GEOADD":         -5,
+	"GEODIST":        -4,
+	"GEOPOS":         -2,
+	"GEOHASH":        -2,
+	"GEOSEARCH":      -6,
+	"GEOSEARCHSTORE": -7,
+
+	// lists
+	"LPUSH":  -3,
+	"RPUSH":  -3,
+	"LRANGE": 4,
+	"LLEN":   2,
+
+	// sort
+	"SORT":    -2,
+	"SORT_RO": -2,
+
+	// json
+	"JSON.SET":       -4,
+	"JSON.GET":       -2,
+	"JSON.MGET":      -3,
+	"JSON.DEL":       -2,
+	"JSON.FORGET":    -2,
+	"JSON.TYPE":      -2,
+	"JSON.STRLEN":    -2,
+	"JSON.ARRAPPEND": -4,
+	"JSON.ARRINDEX":  -4,
+	"JSON.ARRINSERT": -5,
+	"JSON.ARRLEN":    -2,
+	"JSON.ARRPOP":    -2,
+	"JSON.ARRTRIM":   -5,
+	"JSON.NUMINCRBY": -4,
+
+	// bloom
+	"BF.RESERVE":   -4,
+	"BF.ADD":       -3,
+	"BF.MADD":      -3,
+	"BF.EXISTS":    -3,
+	"BF.MEXISTS":   -3,
+	"BF.CARD":      -2,
+	"BF.INFO":      -2,
+	"BF.SCANDUMP":  -3,
+	"BF.LOADCHUNK": -4,
+
+	// cuckoo
+	"CF.RESERVE": -3,
+	"CF.ADD":     -3,
+	"CF.ADDNX":   -3,
+	"CF.EXISTS":  -3,
+	"CF.MEXISTS": -3,
+	"CF.COUNT":   -3,
+	"CF.DEL":     -3,
+	"CF.INFO":    -2,
+
+	// cms
+	"CMS.INITBYDIM":  -4,
+	"CMS.INITBYPROB": -4,
+	"CMS.INCRBY":     -4,
+	"CMS.QUERY":      -3,
+	"CMS.MERGE":      -4,
+	"CMS.INFO":       -2,
+
+	// topk
+	"TOPK.RESERVE": -3,
+	"TOPK.ADD":     -3,
+	"TOPK.INCRBY":  -4,
+	"TOPK.QUERY":   -3,
+	"TOPK.LIST":    -2,
+	"TOPK.INFO":    -2,
+
+	// time series
+	"TS.CREATE":     -2,
+	"TS.ADD":        -4,
+	"TS.MADD":       -4,
+	"TS.INCRBY":     -3,
+	"TS.DECRBY":     -3,
+	"TS.GET":        -2,
+	"TS.RANGE":      -4,
+	"TS.REVRANGE":   -4,
+	"TS.MRANGE":     -4,
+	"TS.MREVRANGE":  -4,
+	"TS.CREATERULE": -6,
+	"TS.DELETERULE": -3,
+	"TS.INFO":       -2,
+
+	// search
+	"FT.CREATE":    -5,
+	"FT.SEARCH":    -3,
+	"FT.AGGREGATE": -3,
+	"FT.INFO":      -2,
+	"FT.DROPINDEX": -2,
+	"FT._LIST":     1,
+
+	// vector sets
+	"VADD":     -5,
+	"VSIM":     -4,
+	"VREM":     -3,
+	"VCARD":    -2,
+	"VDIM":     -2,
+	"VEMB":     -3,
+	"VSETATTR": -4,
+	"VGETATTR": -3,
+}
+
+// checkArity returns the error replied when the number of arguments does
+// not match the arity of the command
+func checkArity(resp *RESP) *RESP {
+	name := string(resp.Nested[0].Data)
+	arity, ok := commandArity[strings.ToUpper(name)]
+	if !ok {
+		return nil
+	}
+	if (arity > 0 && len(resp.Nested) != arity) || (arity < 0 && len(resp.Nested) < -arity) {
+		return SimpleErrorResp(fmt.Sprintf("ERR wrong number of arguments for '%v' command", strings.ToLower(name)))
+	}
+	return nil
+}
+
+// unknownCommandErr replies the name of the command and the beginning of
+// its arguments
+func unknownCommandErr(resp *RESP) *RESP {
+	args := make([]string, 0, len(resp.Nested)-1)
+	for _, arg := range resp.Nested[1:] {
+		args = append(args, fmt.Sprintf("'%v' ", string(arg.Data)))
+	}
+	return SimpleErrorResp(fmt.Sprintf("ERR unknown command '%v', with args beginning with: %v", string(resp.Nested[0].Data), strings.Join(args, "")))
+}
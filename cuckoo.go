@@ -0,0 +1,424 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+const (
+	CuckooDefaultCapacity      = 1024
+	CuckooDefaultBucketSize    = 2
+	CuckooDefaultMaxIterations = 20
+	CuckooDefaultExpansion     = 1
+	// bounds the slots of a sub filter so a command can not exhaust the memory
+	CuckooMaxSlots = 1 << 28
+
+	cuckooHashSeed = 0xc6a4a7935bd1e995
+	// odd multiplier mixing a fingerprint into the alternate bucket index
+	cuckooAltMultiplier = 0x5bd1e995
+)
+
+// cuckooSubFilter stores 8 bit fingerprints, 0 marks an empty slot. The
+// number of buckets is a power of two so that the alternate index of the
+// alternate index is the original one.
+type cuckooSubFilter struct {
+	numBuckets uint64
+	bucketSize int
+	slots      []uint8
+}
+
+// CuckooFilter stacks sub filters like the scalable bloom filter, a new one
+// is added when an insertion can't find room after maxIterations kicks
+type CuckooFilter struct {
+	filters       []*cuckooSubFilter
+	bucketSize    int
+	maxIterations int
+	expansion     int
+	items         int
+	deleted       int
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	power := uint64(1)
+	for power < n {
+		power <<= 1
+	}
+	return power
+}
+
+func newCuckooSubFilter(numBuckets uint64, bucketSize int) *cuckooSubFilter {
+	return &cuckooSubFilter{
+		numBuckets: numBuckets,
+		bucketSize: bucketSize,
+		slots:      make([]uint8, numBuckets*uint64(bucketSize)),
+	}
+}
+
+// cuckooBuckets returns the number of buckets of a filter for capacity items
+func cuckooBuckets(capacity, bucketSize int) uint64 {
+	return nextPowerOfTwo(uint64(max(capacity/bucketSize, 1)))
+}
+
+func NewCuckooFilter(capacity, bucketSize, maxIterations, expansion int) *CuckooFilter {
+	numBuckets := cuckooBuckets(capacity, bucketSize)
+	return &CuckooFilter{
+		filters:       []*cuckooSubFilter{newCuckooSubFilter(numBuckets, bucketSize)},
+		bucketSize:    bucketSize,
+		maxIterations: maxIterations,
+		expansion:     expansion,
+	}
+}
+
+func cuckooHash(item []byte) (uint64, uint8) {
+	hash := MurmurHash64A(item, cuckooHashSeed)
+	return hash, uint8(hash%255 + 1)
+}
+
+func (f *cuckooSubFilter) indexes(hash uint64, fp uint8) (uint64, uint64) {
+	index := hash % f.numBuckets
+	return index, f.altIndex(index, fp)
+}
+
+func (f *cuckooSubFilter) altIndex(index uint64, fp uint8) uint64 {
+	return (index ^ (uint64(fp) * cuckooAltMultiplier)) % f.numBuckets
+}
+
+func (f *cuckooSubFilter) bucket(index uint64) []uint8 {
+	start := index * uint64(f.bucketSize)
+	return f.slots[start : start+uint64(f.bucketSize)]
+}
+
+func (f *cuckooSubFilter) insertInto(index uint64, fp uint8) bool {
+	bucket := f.bucket(index)
+	for i := range bucket {
+		if bucket[i] == 0 {
+			bucket[i] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (f *cuckooSubFilter) count(hash uint64, fp uint8) int {
+	i1, i2 := f.indexes(hash, fp)
+	count := 0
+	for _, slot := range f.bucket(i1) {
+		if slot == fp {
+			count++
+		}
+	}
+	if i2 != i1 {
+		for _, slot := range f.bucket(i2) {
+			if slot == fp {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (f *cuckooSubFilter) remove(hash uint64, fp uint8) bool {
+	i1, i2 := f.indexes(hash, fp)
+	for _, index := range []uint64{i1, i2} {
+		bucket := f.bucket(index)
+		for i := range bucket {
+			if bucket[i] == fp {
+				bucket[i] = 0
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insert relocates fingerprints to make room, the relocations are undone
+// when no room is found so that no fingerprint gets lost
+func (f *cuckooSubFilter) insert(hash uint64, fp uint8, maxIterations int) bool {
+	i1, i2 := f.indexes(hash, fp)
+	if f.insertInto(i1, fp) || f.insertInto(i2, fp) {
+		return true
+	}
+
+	type kick struct {
+		slot   *uint8
+		victim uint8
+	}
+	kicks := make([]kick, 0, maxIterations)
+	index := i1
+	if rand.Intn(2) == 1 {
+		index = i2
+	}
+	for i := 0; i < maxIterations; i++ {
+		slot := &f.bucket(index)[rand.Intn(f.bucketSize)]
+		kicks = append(kicks, kick{slot: slot, victim: *slot})
+		fp, *slot = *slot, fp
+		index = f.altIndex(index, fp)
+		if f.insertInto(index, fp) {
+			return true
+		}
+	}
+	for i := len(kicks) - 1; i >= 0; i-- {
+		*kicks[i].slot = kicks[i].victim
+	}
+	return false
+}
+
+func (cf *CuckooFilter) Count(item []byte) int {
+	hash, fp := cuckooHash(item)
+	count := 0
+	for _, f := range cf.filters {
+		count += f.count(hash, fp)
+	}
+	return count
+}
+
+func (cf *CuckooFilter) Exists(item []byte) bool {
+	return cf.Count(item) > 0
+}
+
+// Add inserts the item even if it may already be in the filter
+func (cf *CuckooFilter) Add(item []byte) error {
+	hash, fp := cuckooHash(item)
+	top := cf.filters[len(cf.filters)-1]
+	if !top.insert(hash, fp, cf.maxIterations) {
+		if cf.expansion == 0 {
+			return fmt.Errorf("ERR Filter is full")
+		}
+		numBuckets := top.numBuckets * nextPowerOfTwo(uint64(cf.expansion))
+		if numBuckets*uint64(cf.bucketSize) > CuckooMaxSlots {
+			return fmt.Errorf("ERR Filter is full")
+		}
+		top = newCuckooSubFilter(numBuckets, cf.bucketSize)
+		cf.filters = append(cf.filters, top)
+		top.insert(hash, fp, cf.maxIterations)
+	}
+	cf.items++
+	return nil
+}
+
+// Remove deletes one occurrence of the item, newest filters first
+func (cf *CuckooFilter) Remove(item []byte) bool {
+	hash, fp := cuckooHash(item)
+	for i := len(cf.filters) - 1; i >= 0; i-- {
+		if cf.filters[i].remove(hash, fp) {
+			cf.items--
+			cf.deleted++
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *CuckooFilter) NumBuckets() int {
+	buckets := 0
+	for _, f := range cf.filters {
+		buckets += int(f.numBuckets)
+	}
+	return buckets
+}
+
+// Size is the memory used by the fingerprints in bytes
+func (cf *CuckooFilter) Size() int {
+	size := 0
+	for _, f := range cf.filters {
+		size += len(f.slots)
+	}
+	return size
+}
+
+// getCuckoo returns nil filter when the key does not exist and an error
+// response when the key holds another type
+func getCuckoo(memory *Memory, key string) (*CuckooFilter, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "MBbloomCF" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*CuckooFilter), nil
+}
+
+func putCuckoo(memory *Memory, key string, cf *CuckooFilter) {
+	memory.Put(key, Entry{Type: "MBbloomCF", Value: cf}, Option{})
+}
+
+func cfReserve(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for CF.RESERVE")
+		}
+		key := string(resp.Nested[1].Data)
+		capacity, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || capacity <= 0 {
+			return SimpleErrorResp("ERR (capacity should be larger than 0)"), nil
+		}
+
+		bucketSize, maxIterations, expansion := CuckooDefaultBucketSize, CuckooDefaultMaxIterations, CuckooDefaultExpansion
+		args := resp.Nested[3:]
+		for i := 0; i < len(args); i += 2 {
+			if i+1 >= len(args) {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			value, err := strconv.Atoi(string(args[i+1].Data))
+			switch strings.ToUpper(string(args[i].Data)) {
+			case "BUCKETSIZE":
+				if err != nil || value < 1 || value > 255 {
+					return SimpleErrorResp("ERR (bucket size should be between 1 and 255)"), nil
+				}
+				bucketSize = value
+			case "MAXITERATIONS":
+				if err != nil || value < 1 || value > 65535 {
+					return SimpleErrorResp("ERR (max iterations should be between 1 and 65535)"), nil
+				}
+				maxIterations = value
+			case "EXPANSION":
+				if err != nil || value < 0 || value > 32768 {
+					return SimpleErrorResp("ERR (expansion should be between 0 and 32768)"), nil
+				}
+				expansion = value
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+
+		// bound the capacity first so the number of slots can't overflow
+		if capacity > CuckooMaxSlots || cuckooBuckets(capacity, bucketSize)*uint64(bucketSize) > CuckooMaxSlots {
+			return SimpleErrorResp("ERR (capacity is too large)"), nil
+		}
+		if memory.Get(key).Type != "none" {
+			return SimpleErrorResp("ERR item exists"), nil
+		}
+		putCuckoo(memory, key, NewCuckooFilter(capacity, bucketSize, maxIterations, expansion))
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+// cfAddGeneric adds the item creating the filter with the default settings,
+// with nx the item is only added when it's not already in the filter
+func cfAddGeneric(memory *Memory, name string, nx bool) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		key := string(resp.Nested[1].Data)
+		item := resp.Nested[2].Data
+		cf, errResp := getCuckoo(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if cf == nil {
+			cf = NewCuckooFilter(CuckooDefaultCapacity, CuckooDefaultBucketSize, CuckooDefaultMaxIterations, CuckooDefaultExpansion)
+		} else if nx && cf.Exists(item) {
+			return IntegerResp(0), nil
+		}
+
+		if err := cf.Add(item); err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		putCuckoo(memory, key, cf)
+		return IntegerResp(1), nil
+	}
+}
+
+func cfAdd(memory *Memory) Executor {
+	return cfAddGeneric(memory, "CF.ADD", false)
+}
+
+func cfAddnx(memory *Memory) Executor {
+	return cfAddGeneric(memory, "CF.ADDNX", true)
+}
+
+func cfExists(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for CF.EXISTS")
+		}
+		cf, errResp := getCuckoo(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		return BoolIntegerResp(cf != nil && cf.Exists(resp.Nested[2].Data)), nil
+	}
+}
+
+func cfMexists(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for CF.MEXISTS")
+		}
+		cf, errResp := getCuckoo(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			output.Nested = append(output.Nested, BoolIntegerResp(cf != nil && cf.Exists(arg.Data)))
+		}
+		return output, nil
+	}
+}
+
+func cfCount(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for CF.COUNT")
+		}
+		cf, errResp := getCuckoo(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if cf == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(cf.Count(resp.Nested[2].Data)), nil
+	}
+}
+
+func cfDel(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for CF.DEL")
+		}
+		key := string(resp.Nested[1].Data)
+		cf, errResp := getCuckoo(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if cf == nil {
+			return SimpleErrorResp("ERR not found"), nil
+		}
+		if !cf.Remove(resp.Nested[2].Data) {
+			return IntegerResp(0), nil
+		}
+		putCuckoo(memory, key, cf)
+		return IntegerResp(1), nil
+	}
+}
+
+func cfInfo(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for CF.INFO")
+		}
+		cf, errResp := getCuckoo(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if cf == nil {
+			return SimpleErrorResp("ERR not found"), nil
+		}
+		return ArrayResp(
+			BulkStringResp("Size"), IntegerResp(cf.Size()),
+			BulkStringResp("Number of buckets"), IntegerResp(cf.NumBuckets()),
+			BulkStringResp("Number of filters"), IntegerResp(len(cf.filters)),
+			BulkStringResp("Number of items inserted"), IntegerResp(cf.items),
+			BulkStringResp("Number of items deleted"), IntegerResp(cf.deleted),
+			BulkStringResp("Bucket size"), IntegerResp(cf.bucketSize),
+			BulkStringResp("Expansion rate"), IntegerResp(cf.expansion),
+			BulkStringResp("Max iterations"), IntegerResp(cf.maxIterations),
+		), nil
+	}
+}
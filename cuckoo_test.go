@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCuckooFilter_AddRemove(t *testing.T) {
+	cf := NewCuckooFilter(1000, 2, 20, 1)
+	for i := 0; i < 5000; i++ {
+		if err := cf.Add([]byte(fmt.Sprintf("item:%d", i))); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if len(cf.filters) < 2 {
+		t.Errorf("expected the filter to expand, filters: %v", len(cf.filters))
+	}
+	for i := 0; i < 5000; i++ {
+		if !cf.Exists([]byte(fmt.Sprintf("item:%d", i))) {
+			t.Fatalf("false negative for item:%d", i)
+		}
+	}
+
+	for i := 0; i < 5000; i += 2 {
+		if !cf.Remove([]byte(fmt.Sprintf("item:%d", i))) {
+			t.Fatalf("failed to remove item:%d", i)
+		}
+	}
+	for i := 1; i < 5000; i += 2 {
+		if !cf.Exists([]byte(fmt.Sprintf("item:%d", i))) {
+			t.Fatalf("false negative after deletes for item:%d", i)
+		}
+	}
+	if cf.items != 2500 || cf.deleted != 2500 {
+		t.Errorf("unexpected counters, items: %v, deleted: %v", cf.items, cf.deleted)
+	}
+}
+
+func TestCuckooFilter_Full(t *testing.T) {
+	cf := NewCuckooFilter(4, 2, 5, 0)
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = cf.Add([]byte(fmt.Sprintf("item:%d", i)))
+	}
+	if err == nil {
+		t.Errorf("expected a filter without expansion to get full")
+	}
+}
+
+func TestProcessor_Cuckoo(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "reserve",
+			args:     []string{"CF.RESERVE", "cf", "1000", "BUCKETSIZE", "4"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "reserve invalid bucket size",
+			args:     []string{"CF.RESERVE", "other", "1000", "BUCKETSIZE", "0"},
+			expected: "-ERR (bucket size should be between 1 and 255)\r\n",
+		},
+		{
+			name:     "reserve capacity too large",
+			args:     []string{"CF.RESERVE", "other", "9223372036854775807"},
+			expected: "-ERR (capacity is too large)\r\n",
+		},
+		{
+			name:     "add",
+			args:     []string{"CF.ADD", "cf", "a"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "add duplicate",
+			args:     []string{"CF.ADD", "cf", "a"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "addnx",
+			args:     []string{"CF.ADDNX", "cf", "a"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "count",
+			args:     []string{"CF.COUNT", "cf", "a"},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "mexists",
+			args:     []string{"CF.MEXISTS", "cf", "a", "b"},
+			expected: "*2\r\n:1\r\n:0\r\n",
+		},
+		{
+			name:     "del",
+			args:     []string{"CF.DEL", "cf", "a"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "del again",
+			args:     []string{"CF.DEL", "cf", "a"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "del absent",
+			args:     []string{"CF.DEL", "cf", "a"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "exists after del",
+			args:     []string{"CF.EXISTS", "cf", "a"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "del missing key",
+			args:     []string{"CF.DEL", "missing", "a"},
+			expected: "-ERR not found\r\n",
+		},
+		{
+			name:     "info",
+			args:     []string{"CF.INFO", "cf"},
+			expected: "*16\r\n$4\r\nSize\r\n:1024\r\n$17\r\nNumber of buckets\r\n:256\r\n$17\r\nNumber of filters\r\n:1\r\n$24\r\nNumber of items inserted\r\n:0\r\n$23\r\nNumber of items deleted\r\n:2\r\n$11\r\nBucket size\r\n:4\r\n$14\r\nExpansion rate\r\n:1\r\n$14\r\nMax iterations\r\n:20\r\n",
+		},
+		{
+			name:     "type",
+			args:     []string{"TYPE", "cf"},
+			expected: "+MBbloomCF\r\n",
+		},
+		{
+			name:     "wrong type",
+			args:     []string{"BF.ADD", "cf", "a"},
+			expected: "-" + WrongTypeErr + "\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
@@ -0,0 +1,758 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the same constants as redis so that scores and distances match
+const (
+	GeoStepMax       = 26
+	GeoLatMin        = -85.05112878
+	GeoLatMax        = 85.05112878
+	GeoLongMin       = -180.0
+	GeoLongMax       = 180.0
+	GeoEarthRadius   = 6372797.560856
+	GeoMercatorMax   = 20037726.37
+	geohashAlphabets = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+type geoHashBits struct {
+	bits uint64
+	step uint
+}
+
+type geoHashRange struct {
+	min, max float64
+}
+
+type geoHashArea struct {
+	hash      geoHashBits
+	longitude geoHashRange
+	latitude  geoHashRange
+}
+
+type geoPoint struct {
+	member    string
+	longitude float64
+	latitude  float64
+	dist      float64
+	score     float64
+}
+
+// interleave64 spreads x on the even bits and y on the odd bits
+func interleave64(x, y uint32) uint64 {
+	var output uint64
+	for i := 0; i < 32; i++ {
+		output |= uint64((x>>i)&1) << (2 * i)
+		output |= uint64((y>>i)&1) << (2*i + 1)
+	}
+	return output
+}
+
+func deinterleave64(interleaved uint64) (uint32, uint32) {
+	var x, y uint32
+	for i := 0; i < 32; i++ {
+		x |= uint32((interleaved>>(2*i))&1) << i
+		y |= uint32((interleaved>>(2*i+1))&1) << i
+	}
+	return x, y
+}
+
+func geohashEncode(longRange, latRange geoHashRange, longitude, latitude float64, step uint) geoHashBits {
+	latOffset := (latitude - latRange.min) / (latRange.max - latRange.min)
+	longOffset := (longitude - longRange.min) / (longRange.max - longRange.min)
+	latOffset *= float64(uint64(1) << step)
+	longOffset *= float64(uint64(1) << step)
+	return geoHashBits{
+		bits: interleave64(uint32(latOffset), uint32(longOffset)),
+		step: step,
+	}
+}
+
+func geohashEncodeWGS84(longitude, latitude float64, step uint) geoHashBits {
+	return geohashEncode(geoHashRange{GeoLongMin, GeoLongMax}, geoHashRange{GeoLatMin, GeoLatMax}, longitude, latitude, step)
+}
+
+func geohashDecode(longRange, latRange geoHashRange, hash geoHashBits) geoHashArea {
+	ilato, ilono := deinterleave64(hash.bits)
+	latScale := latRange.max - latRange.min
+	longScale := longRange.max - longRange.min
+	cells := float64(uint64(1) << hash.step)
+	return geoHashArea{
+		hash: hash,
+		latitude: geoHashRange{
+			min: latRange.min + (float64(ilato)/cells)*latScale,
+			max: latRange.min + ((float64(ilato)+1)/cells)*latScale,
+		},
+		longitude: geoHashRange{
+			min: longRange.min + (float64(ilono)/cells)*longScale,
+			max: longRange.min + ((float64(ilono)+1)/cells)*longScale,
+		},
+	}
+}
+
+func geohashDecodeWGS84(hash geoHashBits) geoHashArea {
+	return geohashDecode(geoHashRange{GeoLongMin, GeoLongMax}, geoHashRange{GeoLatMin, GeoLatMax}, hash)
+}
+
+// geohashDecodeToLongLat returns the center of the area of the 52 bit score
+func geohashDecodeToLongLat(score float64) (float64, float64) {
+	area := geohashDecodeWGS84(geoHashBits{bits: uint64(score), step: GeoStepMax})
+	longitude := (area.longitude.min + area.longitude.max) / 2
+	latitude := (area.latitude.min + area.latitude.max) / 2
+	longitude = math.Max(GeoLongMin, math.Min(GeoLongMax, longitude))
+	latitude = math.Max(GeoLatMin, math.Min(GeoLatMax, latitude))
+	return longitude, latitude
+}
+
+func geohashMoveX(hash geoHashBits, d int) geoHashBits {
+	if d == 0 {
+		return hash
+	}
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0x5555555555555555) >> (64 - hash.step*2)
+	if d > 0 {
+		x = x + (zz + 1)
+	} else {
+		x = x | zz
+		x = x - (zz + 1)
+	}
+	x &= uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.step*2)
+	return geoHashBits{bits: x | y, step: hash.step}
+}
+
+func geohashMoveY(hash geoHashBits, d int) geoHashBits {
+	if d == 0 {
+		return hash
+	}
+	x := hash.bits & 0xaaaaaaaaaaaaaaaa
+	y := hash.bits & 0x5555555555555555
+	zz := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - hash.step*2)
+	if d > 0 {
+		y = y + (zz + 1)
+	} else {
+		y = y | zz
+		y = y - (zz + 1)
+	}
+	y &= uint64(0x5555555555555555) >> (64 - hash.step*2)
+	return geoHashBits{bits: x | y, step: hash.step}
+}
+
+// geohashNeighbors returns the hash itself followed by its 8 neighbors
+func geohashNeighbors(hash geoHashBits) []geoHashBits {
+	return []geoHashBits{
+		hash,
+		geohashMoveY(hash, 1),                   // north
+		geohashMoveY(hash, -1),                  // south
+		geohashMoveX(hash, 1),                   // east
+		geohashMoveX(hash, -1),                  // west
+		geohashMoveY(geohashMoveX(hash, 1), 1),  // north east
+		geohashMoveY(geohashMoveX(hash, -1), 1), // north west
+		geohashMoveY(geohashMoveX(hash, 1), -1), // south east
+		geohashMoveY(geohashMoveX(hash, -1), -1),
+	}
+}
+
+func degRad(deg float64) float64 {
+	return deg * (math.Pi / 180)
+}
+
+func radDeg(rad float64) float64 {
+	return rad / (math.Pi / 180)
+}
+
+// GeohashDistance is the haversine distance in meters
+func GeohashDistance(lon1d, lat1d, lon2d, lat2d float64) float64 {
+	lat1r, lon1r := degRad(lat1d), degRad(lon1d)
+	lat2r, lon2r := degRad(lat2d), degRad(lon2d)
+	v := math.Sin((lon2r - lon1r) / 2)
+	// on the same meridian the latitude distance is enough
+	if v == 0 {
+		return GeoEarthRadius * math.Abs(lat2r-lat1r)
+	}
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * GeoEarthRadius * math.Asin(math.Sqrt(a))
+}
+
+func geohashEstimateStepsByRadius(rangeMeters, latitude float64) uint {
+	if rangeMeters == 0 {
+		return GeoStepMax
+	}
+	step := 1
+	for rangeMeters < GeoMercatorMax {
+		rangeMeters *= 2
+		step++
+	}
+	// make sure the nine search boxes cover the whole area
+	step -= 2
+
+	// wider range towards the poles
+	if latitude > 66 || latitude < -66 {
+		step--
+		if latitude > 80 || latitude < -80 {
+			step--
+		}
+	}
+	return uint(max(1, min(step, GeoStepMax)))
+}
+
+type geoShape struct {
+	longitude, latitude float64
+	// radius for BYRADIUS, width and height for BYBOX, all in meters
+	isBox         bool
+	radius        float64
+	width, height float64
+	// conversion factor of the requested unit
+	conversion float64
+}
+
+// boundingBox returns min longitude, min latitude, max longitude and max latitude
+func (shape geoShape) boundingBox() (float64, float64, float64, float64) {
+	height, width := shape.radius, shape.radius
+	if shape.isBox {
+		height, width = shape.height/2, shape.width/2
+	}
+	latDelta := radDeg(height / GeoEarthRadius)
+	longDeltaTop := radDeg(width / GeoEarthRadius / math.Cos(degRad(shape.latitude+latDelta)))
+	longDeltaBottom := radDeg(width / GeoEarthRadius / math.Cos(degRad(shape.latitude-latDelta)))
+
+	// the widest longitude delta is on the side closer to the equator
+	if shape.latitude < 0 {
+		return shape.longitude - longDeltaBottom, shape.latitude - latDelta,
+			shape.longitude + longDeltaBottom, shape.latitude + latDelta
+	}
+	return shape.longitude - longDeltaTop, shape.latitude - latDelta,
+		shape.longitude + longDeltaTop, shape.latitude + latDelta
+}
+
+// searchAreas returns the geohash boxes to scan for the shape
+func (shape geoShape) searchAreas() []geoHashBits {
+	minLon, minLat, maxLon, maxLat := shape.boundingBox()
+	radius := shape.radius
+	if shape.isBox {
+		radius = math.Sqrt((shape.width/2)*(shape.width/2) + (shape.height/2)*(shape.height/2))
+	}
+	steps := geohashEstimateStepsByRadius(radius, shape.latitude)
+
+	var neighbors []geoHashBits
+	for {
+		hash := geohashEncodeWGS84(shape.longitude, shape.latitude, steps)
+		neighbors = geohashNeighbors(hash)
+
+		// the estimated step can be too big near the edges of the box, in
+		// that case the neighbors don't cover the whole bounding box
+		if steps <= 1 {
+			break
+		}
+		north := geohashDecodeWGS84(neighbors[1])
+		south := geohashDecodeWGS84(neighbors[2])
+		east := geohashDecodeWGS84(neighbors[3])
+		west := geohashDecodeWGS84(neighbors[4])
+		if north.latitude.max < maxLat || south.latitude.min > minLat ||
+			east.longitude.max < maxLon || west.longitude.min > minLon {
+			steps--
+			continue
+		}
+		break
+	}
+
+	// neighbors wrap around the poles and the antimeridian, don't scan twice
+	areas := make([]geoHashBits, 0, len(neighbors))
+	seen := make(map[uint64]bool)
+	for _, neighbor := range neighbors {
+		if seen[neighbor.bits] {
+			continue
+		}
+		seen[neighbor.bits] = true
+		areas = append(areas, neighbor)
+	}
+	return areas
+}
+
+// contains checks the point against the exact shape and returns its distance
+func (shape geoShape) contains(longitude, latitude float64) (float64, bool) {
+	if !shape.isBox {
+		dist := GeohashDistance(shape.longitude, shape.latitude, longitude, latitude)
+		return dist, dist <= shape.radius
+	}
+	latDistance := GeoEarthRadius * math.Abs(degRad(latitude)-degRad(shape.latitude))
+	if latDistance > shape.height/2 {
+		return 0, false
+	}
+	lonDistance := GeohashDistance(longitude, latitude, shape.longitude, latitude)
+	if lonDistance > shape.width/2 {
+		return 0, false
+	}
+	return GeohashDistance(shape.longitude, shape.latitude, longitude, latitude), true
+}
+
+// search scans the sorted set members in the areas of the shape, stopping
+// early once limit points are found (limit 0 means no limit)
+func (shape geoShape) search(zset *SortedSet, limit int) []geoPoint {
+	points := make([]geoPoint, 0)
+	for _, area := range shape.searchAreas() {
+		shift := 52 - area.step*2
+		spec := zRangeSpec{
+			min:   float64(area.bits << shift),
+			max:   float64((area.bits + 1) << shift),
+			maxex: true,
+		}
+		for _, m := range zset.RangeByScore(spec, false, 0, -1) {
+			longitude, latitude := geohashDecodeToLongLat(m.Score)
+			dist, ok := shape.contains(longitude, latitude)
+			if !ok {
+				continue
+			}
+			points = append(points, geoPoint{
+				member:    m.Member,
+				longitude: longitude,
+				latitude:  latitude,
+				dist:      dist,
+				score:     m.Score,
+			})
+			if limit > 0 && len(points) >= limit {
+				return points
+			}
+		}
+	}
+	return points
+}
+
+// ParseGeoUnit returns the meters of the unit
+func ParseGeoUnit(unit string) (float64, error) {
+	switch ToLowerCase(unit) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, fmt.Errorf("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+func parseLongLat(longArg, latArg string) (float64, float64, error) {
+	longitude, err := strconv.ParseFloat(longArg, 64)
+	if err != nil || math.IsNaN(longitude) {
+		return 0, 0, fmt.Errorf("ERR value is not a valid float")
+	}
+	latitude, err := strconv.ParseFloat(latArg, 64)
+	if err != nil || math.IsNaN(latitude) {
+		return 0, 0, fmt.Errorf("ERR value is not a valid float")
+	}
+	if longitude < GeoLongMin || longitude > GeoLongMax || latitude < GeoLatMin || latitude > GeoLatMax {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %.6f,%.6f", longitude, latitude)
+	}
+	return longitude, latitude, nil
+}
+
+// formatGeoCoord formats coordinates like redis does with long doubles:
+// 17 decimals of the exact binary value with the trailing zeros removed
+func formatGeoCoord(coord float64) string {
+	output := strconv.FormatFloat(coord, 'f', 17, 64)
+	output = strings.TrimRight(output, "0")
+	return strings.TrimSuffix(output, ".")
+}
+
+func formatGeoDist(dist float64) string {
+	return strconv.FormatFloat(dist, 'f', 4, 64)
+}
+
+// geohashString returns the standard 11 characters geohash, which uses the
+// [-90, 90] latitude range instead of the mercator one
+func geohashString(score float64) string {
+	longitude, latitude := geohashDecodeToLongLat(score)
+	hash := geohashEncode(geoHashRange{-180, 180}, geoHashRange{-90, 90}, longitude, latitude, GeoStepMax)
+
+	output := make([]byte, 11)
+	for i := 0; i < 11; i++ {
+		idx := 0
+		// 52 bits only fill 10 characters and a half
+		if i != 10 {
+			idx = int((hash.bits >> (52 - (i+1)*5)) & 0x1f)
+		}
+		output[i] = geohashAlphabets[idx]
+	}
+	return string(output)
+}
+
+func geoadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for GEOADD")
+		}
+		key := string(resp.Nested[1].Data)
+
+		flags := zaddFlags{}
+		i := 2
+	options:
+		for i < len(resp.Nested) {
+			switch strings.ToUpper(string(resp.Nested[i].Data)) {
+			case "NX":
+				flags.nx = true
+			case "XX":
+				flags.xx = true
+			case "CH":
+				flags.ch = true
+			default:
+				break options
+			}
+			i++
+		}
+		if flags.nx && flags.xx {
+			return SimpleErrorResp("ERR XX and NX options at the same time are not compatible"), nil
+		}
+
+		triples := resp.Nested[i:]
+		if len(triples) == 0 || len(triples)%3 != 0 {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		scores := make([]float64, 0, len(triples)/3)
+		for j := 0; j < len(triples); j += 3 {
+			longitude, latitude, err := parseLongLat(string(triples[j].Data), string(triples[j+1].Data))
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			scores = append(scores, float64(geohashEncodeWGS84(longitude, latitude, GeoStepMax).bits))
+		}
+
+		zset, errResp := getSortedSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			zset = NewSortedSet()
+		}
+
+		added, updated := 0, 0
+		for j, score := range scores {
+			_, result, _ := zsetAdd(zset, string(triples[j*3+2].Data), score, flags)
+			switch result {
+			case zaddAdded:
+				added++
+			case zaddUpdated:
+				updated++
+			}
+		}
+		putSortedSet(memory, key, zset)
+
+		if flags.ch {
+			return IntegerResp(added + updated), nil
+		}
+		return IntegerResp(added), nil
+	}
+}
+
+func geodist(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for GEODIST")
+		}
+		conversion := 1.0
+		if len(resp.Nested) > 4 {
+			var err error
+			conversion, err = ParseGeoUnit(string(resp.Nested[4].Data))
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+		}
+
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			return BulkStringResp(""), nil
+		}
+		score1, ok1 := zset.Score(string(resp.Nested[2].Data))
+		score2, ok2 := zset.Score(string(resp.Nested[3].Data))
+		if !ok1 || !ok2 {
+			return BulkStringResp(""), nil
+		}
+		lon1, lat1 := geohashDecodeToLongLat(score1)
+		lon2, lat2 := geohashDecodeToLongLat(score2)
+		return BulkStringResp(formatGeoDist(GeohashDistance(lon1, lat1, lon2, lat2) / conversion)), nil
+	}
+}
+
+func geopos(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for GEOPOS")
+		}
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			if zset == nil {
+				output.Nested = append(output.Nested, BulkStringResp(""))
+				continue
+			}
+			score, ok := zset.Score(string(arg.Data))
+			if !ok {
+				output.Nested = append(output.Nested, BulkStringResp(""))
+				continue
+			}
+			longitude, latitude := geohashDecodeToLongLat(score)
+			output.Nested = append(output.Nested, ArrayResp(
+				BulkStringResp(formatGeoCoord(longitude)),
+				BulkStringResp(formatGeoCoord(latitude)),
+			))
+		}
+		return output, nil
+	}
+}
+
+func geohash(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for GEOHASH")
+		}
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			if zset == nil {
+				output.Nested = append(output.Nested, BulkStringResp(""))
+				continue
+			}
+			score, ok := zset.Score(string(arg.Data))
+			if !ok {
+				output.Nested = append(output.Nested, BulkStringResp(""))
+				continue
+			}
+			output.Nested = append(output.Nested, BulkStringResp(geohashString(score)))
+		}
+		return output, nil
+	}
+}
+
+type geoSearchRequest struct {
+	fromMember    string
+	hasFromMember bool
+	hasFromLonLat bool
+	hasShape      bool
+	shape         geoShape
+	sort          int // 0 unsorted, 1 ASC, -1 DESC
+	count         int
+	any           bool
+	withCoord     bool
+	withDist      bool
+	withHash      bool
+	storeDist     bool
+}
+
+// parseGeoSearchRequest parses the options of GEOSEARCH and GEOSEARCHSTORE
+func parseGeoSearchRequest(name string, args []*RESP, store bool) (*geoSearchRequest, *RESP) {
+	req := &geoSearchRequest{}
+	cmdName := ToLowerCase(name)
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i].Data))
+		remaining := len(args) - i - 1
+		switch {
+		case opt == "FROMMEMBER" && remaining >= 1:
+			if req.hasFromLonLat || req.hasFromMember {
+				return nil, SimpleErrorResp(fmt.Sprintf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for '%v' command", cmdName))
+			}
+			req.fromMember, req.hasFromMember = string(args[i+1].Data), true
+			i++
+		case opt == "FROMLONLAT" && remaining >= 2:
+			if req.hasFromLonLat || req.hasFromMember {
+				return nil, SimpleErrorResp(fmt.Sprintf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for '%v' command", cmdName))
+			}
+			longitude, latitude, err := parseLongLat(string(args[i+1].Data), string(args[i+2].Data))
+			if err != nil {
+				return nil, SimpleErrorResp(err.Error())
+			}
+			req.shape.longitude, req.shape.latitude, req.hasFromLonLat = longitude, latitude, true
+			i += 2
+		case opt == "BYRADIUS" && remaining >= 2:
+			if req.hasShape {
+				return nil, SimpleErrorResp(fmt.Sprintf("ERR exactly one of BYRADIUS and BYBOX arguments must be provided for '%v' command", cmdName))
+			}
+			radius, err := strconv.ParseFloat(string(args[i+1].Data), 64)
+			if err != nil || radius < 0 {
+				return nil, SimpleErrorResp("ERR radius cannot be negative")
+			}
+			conversion, err := ParseGeoUnit(string(args[i+2].Data))
+			if err != nil {
+				return nil, SimpleErrorResp(err.Error())
+			}
+			req.shape.radius, req.shape.conversion, req.hasShape = radius*conversion, conversion, true
+			i += 2
+		case opt == "BYBOX" && remaining >= 3:
+			if req.hasShape {
+				return nil, SimpleErrorResp(fmt.Sprintf("ERR exactly one of BYRADIUS and BYBOX arguments must be provided for '%v' command", cmdName))
+			}
+			width, err := strconv.ParseFloat(string(args[i+1].Data), 64)
+			if err != nil || width < 0 {
+				return nil, SimpleErrorResp("ERR width or height cannot be negative")
+			}
+			height, err := strconv.ParseFloat(string(args[i+2].Data), 64)
+			if err != nil || height < 0 {
+				return nil, SimpleErrorResp("ERR width or height cannot be negative")
+			}
+			conversion, err := ParseGeoUnit(string(args[i+3].Data))
+			if err != nil {
+				return nil, SimpleErrorResp(err.Error())
+			}
+			req.shape.isBox, req.shape.conversion, req.hasShape = true, conversion, true
+			req.shape.width, req.shape.height = width*conversion, height*conversion
+			i += 3
+		case opt == "ASC":
+			req.sort = 1
+		case opt == "DESC":
+			req.sort = -1
+		case opt == "COUNT" && remaining >= 1:
+			count, err := strconv.Atoi(string(args[i+1].Data))
+			if err != nil || count <= 0 {
+				return nil, SimpleErrorResp("ERR COUNT must be > 0")
+			}
+			req.count = count
+			i++
+			if remaining >= 2 && strings.ToUpper(string(args[i+1].Data)) == "ANY" {
+				req.any = true
+				i++
+			}
+		case opt == "WITHCOORD" && !store:
+			req.withCoord = true
+		case opt == "WITHDIST" && !store:
+			req.withDist = true
+		case opt == "WITHHASH" && !store:
+			req.withHash = true
+		case opt == "STOREDIST" && store:
+			req.storeDist = true
+		default:
+			return nil, SimpleErrorResp("ERR syntax error")
+		}
+	}
+
+	if !req.hasFromMember && !req.hasFromLonLat {
+		return nil, SimpleErrorResp(fmt.Sprintf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for '%v' command", cmdName))
+	}
+	if !req.hasShape {
+		return nil, SimpleErrorResp(fmt.Sprintf("ERR exactly one of BYRADIUS and BYBOX arguments must be provided for '%v' command", cmdName))
+	}
+	// without ANY, COUNT keeps the closest ones
+	if req.count > 0 && !req.any && req.sort == 0 {
+		req.sort = 1
+	}
+	return req, nil
+}
+
+func geoSearchGeneric(memory *Memory, key string, req *geoSearchRequest) ([]geoPoint, *RESP) {
+	zset, errResp := getSortedSet(memory, key)
+	if errResp != nil {
+		return nil, errResp
+	}
+	if zset == nil {
+		return []geoPoint{}, nil
+	}
+	if req.hasFromMember {
+		score, ok := zset.Score(req.fromMember)
+		if !ok {
+			return nil, SimpleErrorResp("ERR could not decode requested zset member")
+		}
+		req.shape.longitude, req.shape.latitude = geohashDecodeToLongLat(score)
+	}
+
+	limit := 0
+	if req.any {
+		limit = req.count
+	}
+	points := req.shape.search(zset, limit)
+
+	switch req.sort {
+	case 1:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist < points[j].dist })
+	case -1:
+		sort.SliceStable(points, func(i, j int) bool { return points[i].dist > points[j].dist })
+	}
+	if req.count > 0 && len(points) > req.count {
+		points = points[:req.count]
+	}
+	return points, nil
+}
+
+func geosearch(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 6 {
+			return nil, fmt.Errorf("insufficient arguments for GEOSEARCH")
+		}
+		req, errResp := parseGeoSearchRequest("GEOSEARCH", resp.Nested[2:], false)
+		if errResp != nil {
+			return errResp, nil
+		}
+		points, errResp := geoSearchGeneric(memory, string(resp.Nested[1].Data), req)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		output := ArrayResp()
+		for _, point := range points {
+			if !req.withDist && !req.withHash && !req.withCoord {
+				output.Nested = append(output.Nested, BulkStringResp(point.member))
+				continue
+			}
+			item := ArrayResp(BulkStringResp(point.member))
+			if req.withDist {
+				item.Nested = append(item.Nested, BulkStringResp(formatGeoDist(point.dist/req.shape.conversion)))
+			}
+			if req.withHash {
+				item.Nested = append(item.Nested, IntegerResp(int(point.score)))
+			}
+			if req.withCoord {
+				item.Nested = append(item.Nested, ArrayResp(
+					BulkStringResp(formatGeoCoord(point.longitude)),
+					BulkStringResp(formatGeoCoord(point.latitude)),
+				))
+			}
+			output.Nested = append(output.Nested, item)
+		}
+		return output, nil
+	}
+}
+
+func geosearchstore(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 7 {
+			return nil, fmt.Errorf("insufficient arguments for GEOSEARCHSTORE")
+		}
+		dstKey := string(resp.Nested[1].Data)
+		req, errResp := parseGeoSearchRequest("GEOSEARCHSTORE", resp.Nested[3:], true)
+		if errResp != nil {
+			return errResp, nil
+		}
+		points, errResp := geoSearchGeneric(memory, string(resp.Nested[2].Data), req)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		result := NewSortedSet()
+		for _, point := range points {
+			if req.storeDist {
+				result.Add(point.dist/req.shape.conversion, point.member)
+			} else {
+				result.Add(point.score, point.member)
+			}
+		}
+		memory.Delete(dstKey)
+		putSortedSet(memory, dstKey, result)
+
+		return IntegerResp(result.Len()), nil
+	}
+}
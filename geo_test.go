@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestProcessor_Geo(t *testing.T) {
+	respParser := NewRESP()
+	// outputs taken from the redis documentation examples
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "geoadd",
+			args:     []string{"GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "score is the 52 bit geohash",
+			args:     []string{"ZSCORE", "Sicily", "Palermo"},
+			expected: "$16\r\n3479099956230698\r\n",
+		},
+		{
+			name:     "geodist",
+			args:     []string{"GEODIST", "Sicily", "Palermo", "Catania"},
+			expected: "$11\r\n166274.1516\r\n",
+		},
+		{
+			name:     "geodist km",
+			args:     []string{"GEODIST", "Sicily", "Palermo", "Catania", "km"},
+			expected: "$8\r\n166.2742\r\n",
+		},
+		{
+			name:     "geopos",
+			args:     []string{"GEOPOS", "Sicily", "Palermo", "NonExisting"},
+			expected: "*2\r\n*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n$-1\r\n",
+		},
+		{
+			name:     "geohash",
+			args:     []string{"GEOHASH", "Sicily", "Palermo", "Catania"},
+			expected: "*2\r\n$11\r\nsqc8b49rny0\r\n$11\r\nsqdtr74hyu0\r\n",
+		},
+		{
+			name: "geosearch radius",
+			args: []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC", "WITHCOORD", "WITHDIST"},
+			expected: "*2\r\n" +
+				"*3\r\n$7\r\nCatania\r\n$7\r\n56.4413\r\n*2\r\n$20\r\n15.08726745843887329\r\n$20\r\n37.50266842333162032\r\n" +
+				"*3\r\n$7\r\nPalermo\r\n$8\r\n190.4424\r\n*2\r\n$20\r\n13.36138933897018433\r\n$20\r\n38.11555639549629859\r\n",
+		},
+		{
+			name:     "geosearch box count",
+			args:     []string{"GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYBOX", "400", "400", "km", "DESC", "COUNT", "1"},
+			expected: "*1\r\n$7\r\nCatania\r\n",
+		},
+		{
+			name:     "geosearch radius excludes far members",
+			args:     []string{"GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km"},
+			expected: "*1\r\n$7\r\nCatania\r\n",
+		},
+		{
+			name:     "geosearchstore storedist",
+			args:     []string{"GEOSEARCHSTORE", "dst", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST"},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "invalid pair",
+			args:     []string{"GEOADD", "Sicily", "181", "10", "x"},
+			expected: "-ERR invalid longitude,latitude pair 181.000000,10.000000\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
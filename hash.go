@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Hash is a minimal hash type keeping the insertion order of its fields,
+// enough for SORT to read fields through the ->field patterns
+type Hash struct {
+	fields []string
+	values map[string]string
+}
+
+func NewHash() *Hash {
+	return &Hash{
+		fields: make([]string, 0),
+		values: make(map[string]string),
+	}
+}
+
+func (h *Hash) Len() int {
+	return len(h.fields)
+}
+
+// Set returns true when the field is new
+func (h *Hash) Set(field, value string) bool {
+	_, ok := h.values[field]
+	if !ok {
+		h.fields = append(h.fields, field)
+	}
+	h.values[field] = value
+	return !ok
+}
+
+func (h *Hash) Get(field string) (string, bool) {
+	value, ok := h.values[field]
+	return value, ok
+}
+
+func (h *Hash) Delete(field string) bool {
+	if _, ok := h.values[field]; !ok {
+		return false
+	}
+	delete(h.values, field)
+	for i, f := range h.fields {
+		if f == field {
+			h.fields = append(h.fields[:i], h.fields[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Pairs returns every field followed by its value
+func (h *Hash) Pairs() []string {
+	pairs := make([]string, 0, len(h.fields)*2)
+	for _, field := range h.fields {
+		pairs = append(pairs, field, h.values[field])
+	}
+	return pairs
+}
+
+// getHash returns nil hash when the key does not exist and an error response
+// when the key holds another type
+func getHash(memory *Memory, key string) (*Hash, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "hash" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*Hash), nil
+}
+
+func putHash(memory *Memory, key string, hash *Hash) {
+	if hash.Len() == 0 {
+		memory.Delete(key)
+		return
+	}
+	memory.Put(key, Entry{Type: "hash", Value: hash}, Option{})
+}
+
+func hset(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 || len(resp.Nested)%2 != 0 {
+			return nil, fmt.Errorf("insufficient arguments for HSET")
+		}
+		key := string(resp.Nested[1].Data)
+		hash, errResp := getHash(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if hash == nil {
+			hash = NewHash()
+		}
+		added := 0
+		for i := 2; i < len(resp.Nested); i += 2 {
+			if hash.Set(string(resp.Nested[i].Data), string(resp.Nested[i+1].Data)) {
+				added++
+			}
+		}
+		putHash(memory, key, hash)
+		return IntegerResp(added), nil
+	}
+}
+
+func hget(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for HGET")
+		}
+		hash, errResp := getHash(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if hash == nil {
+			return BulkStringResp(""), nil
+		}
+		value, _ := hash.Get(string(resp.Nested[2].Data))
+		return BulkStringResp(value), nil
+	}
+}
+
+func hmget(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for HMGET")
+		}
+		hash, errResp := getHash(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			value := ""
+			if hash != nil {
+				value, _ = hash.Get(string(arg.Data))
+			}
+			output.Nested = append(output.Nested, BulkStringResp(value))
+		}
+		return output, nil
+	}
+}
+
+func hgetall(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for HGETALL")
+		}
+		hash, errResp := getHash(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if hash == nil {
+			return ArrayResp(), nil
+		}
+		return BulkStringArrayResp(hash.Pairs()), nil
+	}
+}
+
+func hdel(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for HDEL")
+		}
+		key := string(resp.Nested[1].Data)
+		hash, errResp := getHash(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if hash == nil {
+			return IntegerResp(0), nil
+		}
+		deleted := 0
+		for _, arg := range resp.Nested[2:] {
+			if hash.Delete(string(arg.Data)) {
+				deleted++
+			}
+		}
+		if deleted > 0 {
+			putHash(memory, key, hash)
+		}
+		return IntegerResp(deleted), nil
+	}
+}
+
+func hlen(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for HLEN")
+		}
+		hash, errResp := getHash(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if hash == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(hash.Len()), nil
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+const (
+	HNSWDefaultM              = 16
+	HNSWDefaultEFConstruction = 200
+	HNSWMaxLevel              = 16
+	// bounds of the options, the links of a node are counted in ints
+	HNSWMaxM  = 2048
+	HNSWMaxEF = 1000000
+)
+
+// hnswNode is an element of the graph. Vectors are kept normalized so that
+// the cosine similarity is their dot product, quantized nodes keep int8
+// components and the scale to map them back instead of the float vector.
+type hnswNode struct {
+	element   string
+	vector    []float32
+	quantized []int8
+	scale     float32
+	norm      float32
+	// raw JSON attributes, parsed when they are an object to be filtered on
+	attributes string
+	object     *jsonObject
+	// neighbors per level, the length is the level of the node plus one
+	neighbors [][]*hnswNode
+}
+
+func newHNSWNode(element string, vector []float32, quantize bool) *hnswNode {
+	node := &hnswNode{element: element}
+	sum := 0.0
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	node.norm = float32(math.Sqrt(sum))
+
+	normalized := make([]float32, len(vector))
+	for i, v := range vector {
+		if node.norm > 0 {
+			normalized[i] = v / node.norm
+		}
+	}
+	if !quantize {
+		node.vector = normalized
+		return node
+	}
+
+	maxAbs := float32(0)
+	for _, v := range normalized {
+		maxAbs = max(maxAbs, float32(math.Abs(float64(v))))
+	}
+	node.scale = maxAbs / 127
+	node.quantized = make([]int8, len(normalized))
+	for i, v := range normalized {
+		if node.scale > 0 {
+			node.quantized[i] = int8(math.Round(float64(v / node.scale)))
+		}
+	}
+	return node
+}
+
+func (n *hnswNode) level() int {
+	return len(n.neighbors) - 1
+}
+
+// embedding maps the stored vector back to its original magnitude, values
+// of quantized nodes are approximated
+func (n *hnswNode) embedding() []float32 {
+	if n.quantized == nil {
+		vector := make([]float32, len(n.vector))
+		for i, v := range n.vector {
+			vector[i] = float32(float64(v) * float64(n.norm))
+		}
+		return vector
+	}
+	vector := make([]float32, len(n.quantized))
+	for i, q := range n.quantized {
+		vector[i] = float32(float64(q) * float64(n.scale) * float64(n.norm))
+	}
+	return vector
+}
+
+func formatVectorComponent(v float32) string {
+	return strconv.FormatFloat(float64(v), 'g', -1, 32)
+}
+
+// hnswDistance is the cosine distance, from 0 for vectors pointing the same
+// way to 2 for opposite ones
+func hnswDistance(a, b *hnswNode) float64 {
+	if a.quantized != nil && b.quantized != nil {
+		dot := int64(0)
+		for i := range a.quantized {
+			dot += int64(a.quantized[i]) * int64(b.quantized[i])
+		}
+		return 1 - float64(dot)*float64(a.scale)*float64(b.scale)
+	}
+	dot := 0.0
+	for i := range a.vector {
+		dot += float64(a.vector[i]) * float64(b.vector[i])
+	}
+	return 1 - dot
+}
+
+type hnswCandidate struct {
+	node     *hnswNode
+	distance float64
+}
+
+// hnswQueue is a heap of candidates, the closest first or the furthest
+// first when furthest is set
+type hnswQueue struct {
+	items    []hnswCandidate
+	furthest bool
+}
+
+func (q *hnswQueue) Len() int { return len(q.items) }
+func (q *hnswQueue) Less(i, j int) bool {
+	if q.furthest {
+		return q.items[i].distance > q.items[j].distance
+	}
+	return q.items[i].distance < q.items[j].distance
+}
+func (q *hnswQueue) Swap(i, j int)       { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *hnswQueue) Push(x any)          { q.items = append(q.items, x.(hnswCandidate)) }
+func (q *hnswQueue) peek() hnswCandidate { return q.items[0] }
+func (q *hnswQueue) Pop() any {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
+
+// HNSW is a hierarchical navigable small world graph: every element is
+// linked to its closest elements on each of its levels, the upper levels
+// being sparser so that searches quickly get close to the query before
+// exploring the dense bottom level.
+type HNSW struct {
+	m              int
+	efConstruction int
+	levelMult      float64
+	nodes          map[string]*hnswNode
+	entry          *hnswNode
+}
+
+func NewHNSW(m, efConstruction int) *HNSW {
+	return &HNSW{
+		m:              m,
+		efConstruction: efConstruction,
+		levelMult:      1 / math.Log(float64(m)),
+		nodes:          make(map[string]*hnswNode),
+	}
+}
+
+func (h *HNSW) Len() int {
+	return len(h.nodes)
+}
+
+func (h *HNSW) Get(element string) *hnswNode {
+	return h.nodes[element]
+}
+
+// maxLinks is the number of neighbors kept per node, twice as many on the
+// bottom level
+func (h *HNSW) maxLinks(level int) int {
+	if level == 0 {
+		return h.m * 2
+	}
+	return h.m
+}
+
+func (h *HNSW) randomLevel() int {
+	level := int(math.Floor(-math.Log(1-rand.Float64()) * h.levelMult))
+	return min(level, HNSWMaxLevel)
+}
+
+// searchLayer is a best-first search of one level from the entries, keeping
+// the ef closest nodes accepted by the filter. Rejected nodes are still
+// followed to reach the accepted ones, maxVisits bounds the search when
+// few nodes are accepted.
+func (h *HNSW) searchLayer(query *hnswNode, entries []hnswCandidate, ef, level int, accept func(*hnswNode) bool, maxVisits int) []hnswCandidate {
+	visited := make(map[*hnswNode]bool)
+	candidates := &hnswQueue{}
+	results := &hnswQueue{furthest: true}
+	for _, entry := range entries {
+		visited[entry.node] = true
+		heap.Push(candidates, entry)
+		if accept == nil || accept(entry.node) {
+			heap.Push(results, entry)
+		}
+	}
+	for results.Len() > ef {
+		heap.Pop(results)
+	}
+
+	for candidates.Len() > 0 {
+		closest := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && closest.distance > results.peek().distance {
+			break
+		}
+		if maxVisits > 0 && len(visited) >= maxVisits {
+			break
+		}
+		for _, neighbor := range closest.node.neighbors[level] {
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+			distance := hnswDistance(query, neighbor)
+			if results.Len() >= ef && distance >= results.peek().distance {
+				continue
+			}
+			candidate := hnswCandidate{node: neighbor, distance: distance}
+			heap.Push(candidates, candidate)
+			if accept == nil || accept(neighbor) {
+				heap.Push(results, candidate)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sortHNSWCandidates(results.items)
+	return results.items
+}
+
+func sortHNSWCandidates(candidates []hnswCandidate) {
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].node.element < candidates[j].node.element
+	})
+}
+
+// Insert links the node to its closest nodes on every level up to a random
+// one, the node becomes the entry point when it reaches a new top level
+func (h *HNSW) Insert(node *hnswNode) {
+	level := h.randomLevel()
+	node.neighbors = make([][]*hnswNode, level+1)
+	h.nodes[node.element] = node
+	if h.entry == nil {
+		h.entry = node
+		return
+	}
+
+	top := h.entry.level()
+	entries := []hnswCandidate{{node: h.entry, distance: hnswDistance(node, h.entry)}}
+	for l := top; l > level; l-- {
+		entries = h.searchLayer(node, entries, 1, l, nil, 0)
+	}
+	for l := min(level, top); l >= 0; l-- {
+		found := h.searchLayer(node, entries, h.efConstruction, l, nil, 0)
+		for _, candidate := range found[:min(h.maxLinks(l), len(found))] {
+			node.neighbors[l] = append(node.neighbors[l], candidate.node)
+			h.link(candidate.node, node, l)
+		}
+		entries = found
+	}
+	if level > top {
+		h.entry = node
+	}
+}
+
+// link adds a neighbor to the node, dropping the furthest one when the node
+// has too many
+func (h *HNSW) link(node, neighbor *hnswNode, level int) {
+	node.neighbors[level] = append(node.neighbors[level], neighbor)
+	if len(node.neighbors[level]) <= h.maxLinks(level) {
+		return
+	}
+	h.relink(node, node.neighbors[level], level)
+}
+
+// relink keeps the closest of the candidates as the neighbors of the node
+func (h *HNSW) relink(node *hnswNode, candidates []*hnswNode, level int) {
+	seen := make(map[*hnswNode]bool)
+	ranked := make([]hnswCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate == node || seen[candidate] {
+			continue
+		}
+		seen[candidate] = true
+		ranked = append(ranked, hnswCandidate{node: candidate, distance: hnswDistance(node, candidate)})
+	}
+	sortHNSWCandidates(ranked)
+
+	neighbors := make([]*hnswNode, 0, h.maxLinks(level))
+	for _, candidate := range ranked[:min(h.maxLinks(level), len(ranked))] {
+		neighbors = append(neighbors, candidate.node)
+	}
+	node.neighbors[level] = neighbors
+}
+
+// Delete unlinks the node and reconnects the nodes that pointed to it to
+// the neighbors of the deleted node. Links are not always mutual, so every
+// node of the levels is checked.
+func (h *HNSW) Delete(element string) bool {
+	node, ok := h.nodes[element]
+	if !ok {
+		return false
+	}
+	delete(h.nodes, element)
+
+	for _, other := range h.nodes {
+		for l := 0; l <= min(other.level(), node.level()); l++ {
+			for _, neighbor := range other.neighbors[l] {
+				if neighbor != node {
+					continue
+				}
+				candidates := append(append([]*hnswNode{}, other.neighbors[l]...), node.neighbors[l]...)
+				h.relink(other, removeHNSWNode(candidates, node), l)
+				break
+			}
+		}
+	}
+
+	if h.entry == node {
+		h.entry = nil
+		for _, other := range h.nodes {
+			if h.entry == nil || other.level() > h.entry.level() {
+				h.entry = other
+			}
+		}
+	}
+	return true
+}
+
+func removeHNSWNode(nodes []*hnswNode, node *hnswNode) []*hnswNode {
+	kept := nodes[:0]
+	for _, n := range nodes {
+		if n != node {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+// Search returns the k nodes closest to the query accepted by the filter,
+// descending the levels greedily before searching the bottom one with ef
+// candidates
+func (h *HNSW) Search(query *hnswNode, k, ef int, accept func(*hnswNode) bool, maxVisits int) []hnswCandidate {
+	if h.entry == nil {
+		return []hnswCandidate{}
+	}
+	entries := []hnswCandidate{{node: h.entry, distance: hnswDistance(query, h.entry)}}
+	for l := h.entry.level(); l > 0; l-- {
+		entries = h.searchLayer(query, entries, 1, l, nil, 0)
+	}
+	results := h.searchLayer(query, entries, max(ef, k), 0, accept, maxVisits)
+	return results[:min(k, len(results))]
+}
+
+// SearchExact compares the query with every node
+func (h *HNSW) SearchExact(query *hnswNode, k int, accept func(*hnswNode) bool) []hnswCandidate {
+	results := make([]hnswCandidate, 0, len(h.nodes))
+	for _, node := range h.nodes {
+		if accept == nil || accept(node) {
+			results = append(results, hnswCandidate{node: node, distance: hnswDistance(query, node)})
+		}
+	}
+	sortHNSWCandidates(results)
+	return results[:min(k, len(results))]
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// The layout follows the redis implementation so that the string values
+// are interchangeable with real redis:
+//
+//	+------+---+-----+----------+
+//	| HYLL | E | N/U | Cardin.  |
+//	+------+---+-----+----------+
+//
+// 4 bytes magic, 1 byte encoding, 3 bytes unused and the cached cardinality
+// as 64 bit little endian, the most significant bit marks the cache invalid.
+// The header is followed by either 16384 6-bit registers (dense) or by
+// ZERO / XZERO / VAL opcodes describing runs of registers (sparse).
+const (
+	HllP              = 14
+	HllQ              = 64 - HllP
+	HllRegisters      = 1 << HllP
+	HllPMask          = HllRegisters - 1
+	HllBits           = 6
+	HllRegisterMax    = (1 << HllBits) - 1
+	HllHeaderSize     = 16
+	HllDenseSize      = HllHeaderSize + (HllRegisters*HllBits+7)/8
+	HllDense          = 0
+	HllSparse         = 1
+	HllSparseMaxBytes = 3000
+	HllAlphaInf       = 0.721347520444481703680
+
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllSparseXZeroMaxLen = 16384
+	hllHashSeed          = 0xadc83b19
+)
+
+const HllInvalidErr = "WRONGTYPE Key is not a valid HyperLogLog string value."
+
+// MurmurHash64A is the hash function used by redis for HyperLogLog
+func MurmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ (uint64(len(key)) * m)
+	nblocks := len(key) / 8
+	for i := 0; i < nblocks; i++ {
+		k := binary.LittleEndian.Uint64(key[i*8:])
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+	}
+
+	tail := key[nblocks*8:]
+	switch len(tail) {
+	case 7:
+		h ^= uint64(tail[6]) << 48
+		fallthrough
+	case 6:
+		h ^= uint64(tail[5]) << 40
+		fallthrough
+	case 5:
+		h ^= uint64(tail[4]) << 32
+		fallthrough
+	case 4:
+		h ^= uint64(tail[3]) << 24
+		fallthrough
+	case 3:
+		h ^= uint64(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint64(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint64(tail[0])
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+// hllPatLen returns the register index of the element and the length of
+// the 000..1 pattern of the remaining hash bits
+func hllPatLen(element []byte) (int, uint8) {
+	hash := MurmurHash64A(element, hllHashSeed)
+	index := int(hash & HllPMask)
+	hash >>= HllP
+	// make sure the loop terminates
+	hash |= 1 << HllQ
+	bit, count := uint64(1), uint8(1)
+	for hash&bit == 0 {
+		count++
+		bit <<= 1
+	}
+	return index, count
+}
+
+func hllDenseGetRegister(registers []byte, regnum int) uint8 {
+	byteIdx := regnum * HllBits / 8
+	fb := uint(regnum * HllBits & 7)
+	fb8 := 8 - fb
+	b0 := uint(registers[byteIdx])
+	b1 := uint(0)
+	if byteIdx+1 < len(registers) {
+		b1 = uint(registers[byteIdx+1])
+	}
+	return uint8(((b0 >> fb) | (b1 << fb8)) & HllRegisterMax)
+}
+
+func hllDenseSetRegister(registers []byte, regnum int, val uint8) {
+	byteIdx := regnum * HllBits / 8
+	fb := uint(regnum * HllBits & 7)
+	fb8 := 8 - fb
+	v := uint(val)
+	registers[byteIdx] &= ^byte(HllRegisterMax << fb)
+	registers[byteIdx] |= byte(v << fb)
+	if byteIdx+1 < len(registers) {
+		registers[byteIdx+1] &= ^byte(HllRegisterMax >> fb8)
+		registers[byteIdx+1] |= byte(v >> fb8)
+	}
+}
+
+func hllNewHeader(encoding byte) []byte {
+	header := make([]byte, HllHeaderSize)
+	copy(header, "HYLL")
+	header[4] = encoding
+	return header
+}
+
+// NewHyperLogLog returns an empty sparse HyperLogLog
+func NewHyperLogLog() []byte {
+	registers := make([]uint8, HllRegisters)
+	hll, _ := hllEncodeSparse(registers)
+	return hll
+}
+
+func hllIsValid(hll []byte) bool {
+	if len(hll) < HllHeaderSize || string(hll[:4]) != "HYLL" {
+		return false
+	}
+	switch hll[4] {
+	case HllDense:
+		return len(hll) == HllDenseSize
+	case HllSparse:
+		_, ok := hllDecodeSparse(hll)
+		return ok
+	}
+	return false
+}
+
+func hllInvalidateCache(hll []byte) {
+	hll[15] |= 1 << 7
+}
+
+func hllCachedCount(hll []byte) (uint64, bool) {
+	if hll[15]&(1<<7) != 0 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(hll[8:16]), true
+}
+
+func hllSetCachedCount(hll []byte, count uint64) {
+	binary.LittleEndian.PutUint64(hll[8:16], count)
+}
+
+// hllRegisters returns one byte per register whatever the encoding is
+func hllRegisters(hll []byte) ([]uint8, bool) {
+	if hll[4] == HllSparse {
+		return hllDecodeSparse(hll)
+	}
+	registers := make([]uint8, HllRegisters)
+	dense := hll[HllHeaderSize:]
+	for i := range registers {
+		registers[i] = hllDenseGetRegister(dense, i)
+	}
+	return registers, true
+}
+
+func hllDecodeSparse(hll []byte) ([]uint8, bool) {
+	registers := make([]uint8, HllRegisters)
+	idx := 0
+	p := hll[HllHeaderSize:]
+	for i := 0; i < len(p); i++ {
+		op := p[i]
+		switch {
+		case op&0xc0 == 0x00: // ZERO 00xxxxxx
+			idx += int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO 01xxxxxx yyyyyyyy
+			if i+1 >= len(p) {
+				return nil, false
+			}
+			idx += (int(op&0x3f)<<8 | int(p[i+1])) + 1
+			i++
+		default: // VAL 1vvvvvxx
+			runLen := int(op&0x3) + 1
+			val := ((op >> 2) & 0x1f) + 1
+			if idx+runLen > HllRegisters {
+				return nil, false
+			}
+			for j := 0; j < runLen; j++ {
+				registers[idx+j] = val
+			}
+			idx += runLen
+		}
+		if idx > HllRegisters {
+			return nil, false
+		}
+	}
+	return registers, idx == HllRegisters
+}
+
+// hllEncodeSparse returns false when the registers can't be represented
+// with the sparse encoding within the size limit
+func hllEncodeSparse(registers []uint8) ([]byte, bool) {
+	hll := hllNewHeader(HllSparse)
+	for i := 0; i < len(registers); {
+		val := registers[i]
+		if val > hllSparseValMaxValue {
+			return nil, false
+		}
+		runLen := 1
+		for i+runLen < len(registers) && registers[i+runLen] == val {
+			runLen++
+		}
+		i += runLen
+
+		if val == 0 {
+			for runLen > 0 {
+				if runLen > hllSparseZeroMaxLen {
+					chunk := min(runLen, hllSparseXZeroMaxLen)
+					hll = append(hll, byte(0x40|((chunk-1)>>8)), byte((chunk-1)&0xff))
+					runLen -= chunk
+				} else {
+					hll = append(hll, byte(runLen-1))
+					runLen = 0
+				}
+			}
+		} else {
+			for runLen > 0 {
+				chunk := min(runLen, hllSparseValMaxLen)
+				hll = append(hll, 0x80|((val-1)<<2)|byte(chunk-1))
+				runLen -= chunk
+			}
+		}
+		if len(hll) > HllHeaderSize+HllSparseMaxBytes {
+			return nil, false
+		}
+	}
+	return hll, true
+}
+
+func hllEncodeDense(registers []uint8) []byte {
+	hll := make([]byte, HllDenseSize)
+	copy(hll, hllNewHeader(HllDense))
+	dense := hll[HllHeaderSize:]
+	for i, val := range registers {
+		hllDenseSetRegister(dense, i, val)
+	}
+	return hll
+}
+
+// hllEncode keeps the sparse encoding as long as it fits, the cached
+// cardinality is always invalidated
+func hllEncode(registers []uint8, sparse bool) []byte {
+	var hll []byte
+	ok := false
+	if sparse {
+		hll, ok = hllEncodeSparse(registers)
+	}
+	if !ok {
+		hll = hllEncodeDense(registers)
+	}
+	hllInvalidateCache(hll)
+	return hll
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrime == z {
+			return z / 3
+		}
+	}
+}
+
+// HllCount estimates the cardinality with the improved estimator from
+// Otmar Ertl "New cardinality estimation algorithms for HyperLogLog sketches"
+func HllCount(registers []uint8) uint64 {
+	m := float64(HllRegisters)
+	var histogram [64]int
+	for _, val := range registers {
+		histogram[val]++
+	}
+
+	z := m * hllTau((m-float64(histogram[HllQ+1]))/m)
+	for j := HllQ; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histogram[0])/m)
+	return uint64(math.Round(HllAlphaInf * m * m / z))
+}
+
+// getHyperLogLog returns nil when the key does not exist and an error
+// response when the key is not holding a valid HyperLogLog
+func getHyperLogLog(memory *Memory, key string) ([]byte, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "string" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	hll := []byte((entry.Value).(string))
+	if !hllIsValid(hll) {
+		return nil, SimpleErrorResp(HllInvalidErr)
+	}
+	return hll, nil
+}
+
+func putHyperLogLog(memory *Memory, key string, hll []byte) {
+	memory.Put(key, Entry{Type: "string", Value: string(hll)}, Option{})
+}
+
+func pfadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for PFADD")
+		}
+		key := string(resp.Nested[1].Data)
+		hll, errResp := getHyperLogLog(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		updated := false
+		if hll == nil {
+			hll = NewHyperLogLog()
+			updated = true
+		}
+
+		// dense registers are updated in place, sparse ones are decoded and
+		// encoded again since a single update can reshape the opcodes
+		if hll[4] == HllDense {
+			dense := hll[HllHeaderSize:]
+			for _, arg := range resp.Nested[2:] {
+				index, count := hllPatLen(arg.Data)
+				if count > hllDenseGetRegister(dense, index) {
+					hllDenseSetRegister(dense, index, count)
+					updated = true
+				}
+			}
+			if updated {
+				hllInvalidateCache(hll)
+			}
+		} else if len(resp.Nested) > 2 {
+			registers, _ := hllDecodeSparse(hll)
+			changed := false
+			for _, arg := range resp.Nested[2:] {
+				index, count := hllPatLen(arg.Data)
+				if count > registers[index] {
+					registers[index] = count
+					changed = true
+				}
+			}
+			if changed {
+				hll = hllEncode(registers, true)
+				updated = true
+			}
+		}
+
+		if !updated {
+			return IntegerResp(0), nil
+		}
+		putHyperLogLog(memory, key, hll)
+		return IntegerResp(1), nil
+	}
+}
+
+func pfcount(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for PFCOUNT")
+		}
+
+		// single key, the cardinality is cached in the header
+		if len(resp.Nested) == 2 {
+			key := string(resp.Nested[1].Data)
+			hll, errResp := getHyperLogLog(memory, key)
+			if errResp != nil {
+				return errResp, nil
+			}
+			if hll == nil {
+				return IntegerResp(0), nil
+			}
+			if count, ok := hllCachedCount(hll); ok {
+				return IntegerResp(int(count)), nil
+			}
+			registers, _ := hllRegisters(hll)
+			count := HllCount(registers)
+			hllSetCachedCount(hll, count)
+			putHyperLogLog(memory, key, hll)
+			return IntegerResp(int(count)), nil
+		}
+
+		// multiple keys, count the union of them
+		merged := make([]uint8, HllRegisters)
+		for _, arg := range resp.Nested[1:] {
+			hll, errResp := getHyperLogLog(memory, string(arg.Data))
+			if errResp != nil {
+				return errResp, nil
+			}
+			if hll == nil {
+				continue
+			}
+			registers, _ := hllRegisters(hll)
+			for i, val := range registers {
+				merged[i] = max(merged[i], val)
+			}
+		}
+		return IntegerResp(int(HllCount(merged))), nil
+	}
+}
+
+func pfmerge(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for PFMERGE")
+		}
+		dstKey := string(resp.Nested[1].Data)
+
+		// the destination takes part in the union
+		merged := make([]uint8, HllRegisters)
+		sparse := true
+		for _, arg := range resp.Nested[1:] {
+			hll, errResp := getHyperLogLog(memory, string(arg.Data))
+			if errResp != nil {
+				return errResp, nil
+			}
+			if hll == nil {
+				continue
+			}
+			if hll[4] == HllDense {
+				sparse = false
+			}
+			registers, _ := hllRegisters(hll)
+			for i, val := range registers {
+				merged[i] = max(merged[i], val)
+			}
+		}
+
+		putHyperLogLog(memory, dstKey, hllEncode(merged, sparse))
+		return SimpleStringResp("OK"), nil
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog_Encoding(t *testing.T) {
+	registers := make([]uint8, HllRegisters)
+	registers[0], registers[100], registers[HllRegisters-1] = 3, 32, 51
+
+	dense := hllEncodeDense(registers)
+	if len(dense) != HllDenseSize || !hllIsValid(dense) {
+		t.Fatalf("expected a valid dense HyperLogLog of %v bytes", HllDenseSize)
+	}
+	decoded, _ := hllRegisters(dense)
+	for i := range registers {
+		if decoded[i] != registers[i] {
+			t.Fatalf("dense register %v - expected: %v - actual: %v", i, registers[i], decoded[i])
+		}
+	}
+
+	// 51 doesn't fit in a sparse VAL opcode
+	if _, ok := hllEncodeSparse(registers); ok {
+		t.Errorf("expected sparse encoding to be rejected")
+	}
+	registers[HllRegisters-1] = 1
+	sparse, ok := hllEncodeSparse(registers)
+	if !ok || !hllIsValid(sparse) {
+		t.Fatalf("expected a valid sparse HyperLogLog")
+	}
+	decoded, _ = hllRegisters(sparse)
+	for i := range registers {
+		if decoded[i] != registers[i] {
+			t.Fatalf("sparse register %v - expected: %v - actual: %v", i, registers[i], decoded[i])
+		}
+	}
+
+	// empty HyperLogLog is a single XZERO covering all the registers
+	empty := NewHyperLogLog()
+	if len(empty) != HllHeaderSize+2 || empty[16] != 0x7f || empty[17] != 0xff {
+		t.Errorf("unexpected empty sparse representation: %v", empty[HllHeaderSize:])
+	}
+}
+
+func TestProcessor_HyperLogLog(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+
+	// add in batches to stay within the read buffer of a command
+	total := 100000
+	for i := 0; i < total; i += 10 {
+		cmd := &RESP{Type: Arrays, Nested: []*RESP{BulkStringResp("PFADD"), BulkStringResp(fmt.Sprintf("hll%v", i%2))}}
+		for j := i; j < i+10; j++ {
+			cmd.Nested = append(cmd.Nested, BulkStringResp(fmt.Sprintf("element:%v", j)))
+		}
+		if _, err := processor.Accept(client, respParser.Serialize(cmd)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	entry := memory.Get("hll0")
+	if value := entry.Value.(string); len(value) != HllDenseSize {
+		t.Errorf("expected HyperLogLog to be promoted to dense, size: %v", len(value))
+	}
+
+	output, _ := processor.Accept(client, []byte("*3\r\n$7\r\nPFCOUNT\r\n$4\r\nhll0\r\n$4\r\nhll1\r\n"))
+	resp, _ := respParser.Deserialize(output)
+	var count int
+	fmt.Sscan(string(resp.Data), &count)
+	if errRate := math.Abs(float64(count-total)) / float64(total); errRate > 0.0081*3 {
+		t.Errorf("expected count close to %v, but got: %v", total, count)
+	}
+
+	output, _ = processor.Accept(client, []byte("*4\r\n$7\r\nPFMERGE\r\n$3\r\ndst\r\n$4\r\nhll0\r\n$4\r\nhll1\r\n"))
+	if string(output) != "+OK\r\n" {
+		t.Errorf("unexpected PFMERGE output: %q", output)
+	}
+	merged, _ := processor.Accept(client, []byte("*2\r\n$7\r\nPFCOUNT\r\n$3\r\ndst\r\n"))
+	if string(merged) != ":"+string(resp.Data)+"\r\n" {
+		t.Errorf("expected merged count %v, but got: %q", string(resp.Data), merged)
+	}
+
+	small := []string{
+		"*9\r\n$5\r\nPFADD\r\n$1\r\ns\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n$1\r\ne\r\n$1\r\nf\r\n$1\r\ng\r\n",
+		"*3\r\n$5\r\nPFADD\r\n$1\r\ns\r\n$1\r\na\r\n",
+		"*2\r\n$7\r\nPFCOUNT\r\n$1\r\ns\r\n",
+	}
+	expected := []string{":1\r\n", ":0\r\n", ":7\r\n"}
+	for i, cmd := range small {
+		output, _ := processor.Accept(client, []byte(cmd))
+		if string(output) != expected[i] {
+			t.Errorf("command %q - expected: %q - actual: %q", cmd, expected[i], output)
+		}
+	}
+}
@@ -0,0 +1,992 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// JSON values are nil, bool, int64, float64, string, *jsonArray or
+// *jsonObject. Containers are pointers so that matched locations can be
+// modified in place, objects keep the insertion order of their members.
+type jsonObject struct {
+	keys   []string
+	fields map[string]any
+}
+
+type jsonArray struct {
+	items []any
+}
+
+// JSONDocument is the value of the ReJSON-RL type, the root itself can be
+// replaced by JSON.SET
+type JSONDocument struct {
+	root any
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{
+		keys:   make([]string, 0),
+		fields: make(map[string]any),
+	}
+}
+
+func (o *jsonObject) set(key string, value any) {
+	if _, ok := o.fields[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.fields[key] = value
+}
+
+func (o *jsonObject) remove(key string) {
+	if _, ok := o.fields[key]; !ok {
+		return
+	}
+	delete(o.fields, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// ParseJSON parses a JSON text keeping the order of object members and the
+// distinction between integers and floating point numbers
+func ParseJSON(input string) (any, error) {
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.UseNumber()
+	value, err := parseJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("ERR invalid JSON: trailing characters")
+	}
+	return value, nil
+}
+
+func parseJSONValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("ERR invalid JSON: %v", err)
+	}
+	switch t := token.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := newJSONObject()
+			for decoder.More() {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, fmt.Errorf("ERR invalid JSON: %v", err)
+				}
+				value, err := parseJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				obj.set(keyToken.(string), value)
+			}
+			if _, err := decoder.Token(); err != nil {
+				return nil, fmt.Errorf("ERR invalid JSON: %v", err)
+			}
+			return obj, nil
+		case '[':
+			arr := &jsonArray{items: make([]any, 0)}
+			for decoder.More() {
+				value, err := parseJSONValue(decoder)
+				if err != nil {
+					return nil, err
+				}
+				arr.items = append(arr.items, value)
+			}
+			if _, err := decoder.Token(); err != nil {
+				return nil, fmt.Errorf("ERR invalid JSON: %v", err)
+			}
+			return arr, nil
+		}
+		return nil, fmt.Errorf("ERR invalid JSON: unexpected %v", t)
+	case json.Number:
+		if num, err := strconv.ParseInt(string(t), 10, 64); err == nil {
+			return num, nil
+		}
+		num, err := t.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("ERR invalid JSON: %v", err)
+		}
+		return num, nil
+	}
+	// string, bool and nil
+	return token, nil
+}
+
+type jsonFormat struct {
+	indent  string
+	newline string
+	space   string
+}
+
+func SerializeJSON(value any, format jsonFormat) string {
+	var builder strings.Builder
+	writeJSON(&builder, value, format, 0)
+	return builder.String()
+}
+
+func writeJSON(builder *strings.Builder, value any, format jsonFormat, level int) {
+	writeNewline := func(level int) {
+		builder.WriteString(format.newline)
+		for i := 0; i < level; i++ {
+			builder.WriteString(format.indent)
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		builder.WriteString("null")
+	case bool:
+		builder.WriteString(strconv.FormatBool(v))
+	case int64:
+		builder.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		builder.WriteString(formatJSONFloat(v))
+	case string:
+		builder.WriteString(quoteJSONString(v))
+	case *jsonArray:
+		if len(v.items) == 0 {
+			builder.WriteString("[]")
+			return
+		}
+		builder.WriteByte('[')
+		for i, item := range v.items {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			writeNewline(level + 1)
+			writeJSON(builder, item, format, level+1)
+		}
+		writeNewline(level)
+		builder.WriteByte(']')
+	case *jsonObject:
+		if len(v.keys) == 0 {
+			builder.WriteString("{}")
+			return
+		}
+		builder.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				builder.WriteByte(',')
+			}
+			writeNewline(level + 1)
+			builder.WriteString(quoteJSONString(key))
+			builder.WriteByte(':')
+			builder.WriteString(format.space)
+			writeJSON(builder, v.fields[key], format, level+1)
+		}
+		writeNewline(level)
+		builder.WriteByte('}')
+	}
+}
+
+func quoteJSONString(str string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(str)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// formatJSONFloat always keeps a fraction or an exponent so that floats stay
+// floats when parsed again, e.g. 3.0 instead of 3
+func formatJSONFloat(num float64) string {
+	abs := math.Abs(num)
+	if abs != 0 && (abs < 1e-5 || abs >= 1e16) {
+		return strconv.FormatFloat(num, 'e', -1, 64)
+	}
+	output := strconv.FormatFloat(num, 'f', -1, 64)
+	if !strings.Contains(output, ".") {
+		output += ".0"
+	}
+	return output
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *jsonArray:
+		return "array"
+	}
+	return "object"
+}
+
+func jsonToFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func jsonEqual(a, b any) bool {
+	if fa, ok := jsonToFloat(a); ok {
+		fb, ok := jsonToFloat(b)
+		return ok && fa == fb
+	}
+	switch a.(type) {
+	case *jsonArray, *jsonObject:
+		return jsonTypeName(a) == jsonTypeName(b) && SerializeJSON(a, jsonFormat{}) == SerializeJSON(b, jsonFormat{})
+	}
+	return a == b
+}
+
+func jsonDeepCopy(value any) any {
+	switch v := value.(type) {
+	case *jsonArray:
+		arr := &jsonArray{items: make([]any, 0, len(v.items))}
+		for _, item := range v.items {
+			arr.items = append(arr.items, jsonDeepCopy(item))
+		}
+		return arr
+	case *jsonObject:
+		obj := newJSONObject()
+		for _, key := range v.keys {
+			obj.set(key, jsonDeepCopy(v.fields[key]))
+		}
+		return obj
+	}
+	return value
+}
+
+// jsonReplace stores the value at the location
+func (doc *JSONDocument) jsonReplace(loc jsonLocation, value any) {
+	switch parent := loc.parent.(type) {
+	case nil:
+		doc.root = value
+	case *jsonObject:
+		parent.fields[loc.key] = value
+	case *jsonArray:
+		parent.items[loc.index] = value
+	}
+}
+
+// getJSON returns nil document when the key does not exist and an error
+// response when the key holds another type
+func getJSON(memory *Memory, key string) (*JSONDocument, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "ReJSON-RL" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*JSONDocument), nil
+}
+
+func putJSON(memory *Memory, key string, doc *JSONDocument) {
+	memory.Put(key, Entry{Type: "ReJSON-RL", Value: doc}, Option{})
+}
+
+func jsonPathNotExistErr(path *JSONPath) *RESP {
+	return SimpleErrorResp(fmt.Sprintf("ERR Path '%v' does not exist", path.raw))
+}
+
+func jsonWrongTypeErr(expected string, value any) *RESP {
+	return SimpleErrorResp(fmt.Sprintf("ERR wrong type of path value - expected %v but found %v", expected, jsonTypeName(value)))
+}
+
+// parseJSONCmdPath parses the path argument, defaulting to the legacy root
+func parseJSONCmdPath(args []*RESP, i int) (*JSONPath, *RESP) {
+	raw := "."
+	if i < len(args) {
+		raw = string(args[i].Data)
+	}
+	path, err := ParseJSONPath(raw)
+	if err != nil {
+		return nil, SimpleErrorResp(err.Error())
+	}
+	return path, nil
+}
+
+// jsonMatches evaluates the path, legacy paths fail when nothing matches and
+// only keep their first match
+func jsonMatches(doc *JSONDocument, path *JSONPath) ([]jsonLocation, *RESP) {
+	matches := path.Evaluate(doc.root)
+	if path.legacy {
+		if len(matches) == 0 {
+			return nil, jsonPathNotExistErr(path)
+		}
+		return matches[:1], nil
+	}
+	return matches, nil
+}
+
+func jsonSet(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.SET")
+		}
+		key := string(resp.Nested[1].Data)
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		value, err := ParseJSON(string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+
+		nx, xx := false, false
+		for _, arg := range resp.Nested[4:] {
+			switch strings.ToUpper(string(arg.Data)) {
+			case "NX":
+				nx = true
+			case "XX":
+				xx = true
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+		if nx && xx {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+
+		doc, errResp := getJSON(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if doc == nil {
+			if !path.IsRoot() {
+				return SimpleErrorResp("ERR new objects must be created at the root"), nil
+			}
+			if xx {
+				return BulkStringResp(""), nil
+			}
+			putJSON(memory, key, &JSONDocument{root: value})
+			return SimpleStringResp("OK"), nil
+		}
+
+		matches := path.Evaluate(doc.root)
+		if len(matches) > 0 {
+			if nx {
+				return BulkStringResp(""), nil
+			}
+			if path.legacy {
+				matches = matches[:1]
+			}
+			for _, loc := range matches {
+				doc.jsonReplace(loc, jsonDeepCopy(value))
+			}
+			putJSON(memory, key, doc)
+			return SimpleStringResp("OK"), nil
+		}
+
+		// only the last member of the path can be created
+		if xx {
+			return BulkStringResp(""), nil
+		}
+		parentPath, name, ok := path.parent()
+		if !ok {
+			return BulkStringResp(""), nil
+		}
+		created := false
+		for _, loc := range parentPath.Evaluate(doc.root) {
+			if obj, ok := loc.value.(*jsonObject); ok {
+				obj.set(name, jsonDeepCopy(value))
+				created = true
+			}
+		}
+		if !created {
+			if path.legacy {
+				return jsonPathNotExistErr(path), nil
+			}
+			return BulkStringResp(""), nil
+		}
+		putJSON(memory, key, doc)
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+func jsonGet(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.GET")
+		}
+		key := string(resp.Nested[1].Data)
+
+		// formatting options come before the paths
+		format := jsonFormat{}
+		rawPaths := make([]string, 0)
+		for i := 2; i < len(resp.Nested); i++ {
+			arg := string(resp.Nested[i].Data)
+			opt := strings.ToUpper(arg)
+			if (opt == "INDENT" || opt == "NEWLINE" || opt == "SPACE") && i+1 < len(resp.Nested) {
+				value := string(resp.Nested[i+1].Data)
+				switch opt {
+				case "INDENT":
+					format.indent = value
+				case "NEWLINE":
+					format.newline = value
+				case "SPACE":
+					format.space = value
+				}
+				i++
+				continue
+			}
+			rawPaths = append(rawPaths, arg)
+		}
+		if len(rawPaths) == 0 {
+			rawPaths = append(rawPaths, ".")
+		}
+
+		paths := make([]*JSONPath, 0, len(rawPaths))
+		allLegacy := true
+		for _, raw := range rawPaths {
+			path, err := ParseJSONPath(raw)
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			allLegacy = allLegacy && path.legacy
+			paths = append(paths, path)
+		}
+
+		doc, errResp := getJSON(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if doc == nil {
+			return BulkStringResp(""), nil
+		}
+
+		// legacy paths reply the value itself, JSONPath an array of matches
+		results := make([]any, 0, len(paths))
+		for _, path := range paths {
+			matches := path.Evaluate(doc.root)
+			if allLegacy {
+				if len(matches) == 0 {
+					return jsonPathNotExistErr(path), nil
+				}
+				results = append(results, matches[0].value)
+				continue
+			}
+			arr := &jsonArray{items: make([]any, 0, len(matches))}
+			for _, loc := range matches {
+				arr.items = append(arr.items, loc.value)
+			}
+			results = append(results, arr)
+		}
+
+		if len(paths) == 1 {
+			return BulkStringResp(SerializeJSON(results[0], format)), nil
+		}
+		output := newJSONObject()
+		for i, path := range paths {
+			output.set(path.raw, results[i])
+		}
+		return BulkStringResp(SerializeJSON(output, format)), nil
+	}
+}
+
+func jsonMget(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.MGET")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, len(resp.Nested)-1)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		output := ArrayResp()
+		for _, arg := range resp.Nested[1 : len(resp.Nested)-1] {
+			entry := memory.Get(string(arg.Data))
+			if entry.Type != "ReJSON-RL" {
+				output.Nested = append(output.Nested, BulkStringResp(""))
+				continue
+			}
+			matches := path.Evaluate((entry.Value).(*JSONDocument).root)
+			if path.legacy {
+				if len(matches) == 0 {
+					output.Nested = append(output.Nested, BulkStringResp(""))
+				} else {
+					output.Nested = append(output.Nested, BulkStringResp(SerializeJSON(matches[0].value, jsonFormat{})))
+				}
+				continue
+			}
+			arr := &jsonArray{items: make([]any, 0, len(matches))}
+			for _, loc := range matches {
+				arr.items = append(arr.items, loc.value)
+			}
+			output.Nested = append(output.Nested, BulkStringResp(SerializeJSON(arr, jsonFormat{})))
+		}
+		return output, nil
+	}
+}
+
+func jsonDel(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.DEL")
+		}
+		key := string(resp.Nested[1].Data)
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		doc, errResp := getJSON(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if doc == nil {
+			return IntegerResp(0), nil
+		}
+
+		if path.IsRoot() {
+			memory.Delete(key)
+			return IntegerResp(1), nil
+		}
+
+		matches := path.Evaluate(doc.root)
+		if path.legacy && len(matches) > 1 {
+			matches = matches[:1]
+		}
+		// remove array items from the highest index so the others stay valid
+		arrayIndexes := make(map[*jsonArray][]int)
+		deleted := 0
+		for _, loc := range matches {
+			switch parent := loc.parent.(type) {
+			case *jsonObject:
+				if _, ok := parent.fields[loc.key]; ok {
+					parent.remove(loc.key)
+					deleted++
+				}
+			case *jsonArray:
+				arrayIndexes[parent] = append(arrayIndexes[parent], loc.index)
+			}
+		}
+		for arr, indexes := range arrayIndexes {
+			removed := make(map[int]bool)
+			for _, index := range indexes {
+				removed[index] = true
+			}
+			items := make([]any, 0, len(arr.items)-len(removed))
+			for i, item := range arr.items {
+				if !removed[i] {
+					items = append(items, item)
+				}
+			}
+			deleted += len(removed)
+			arr.items = items
+		}
+		if deleted > 0 {
+			putJSON(memory, key, doc)
+		}
+		return IntegerResp(deleted), nil
+	}
+}
+
+func jsonType(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.TYPE")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		doc, errResp := getJSON(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if doc == nil {
+			return BulkStringResp(""), nil
+		}
+
+		matches := path.Evaluate(doc.root)
+		if path.legacy {
+			if len(matches) == 0 {
+				return BulkStringResp(""), nil
+			}
+			return SimpleStringResp(jsonTypeName(matches[0].value)), nil
+		}
+		output := ArrayResp()
+		for _, loc := range matches {
+			output.Nested = append(output.Nested, BulkStringResp(jsonTypeName(loc.value)))
+		}
+		return output, nil
+	}
+}
+
+// jsonPerMatch runs fn on every match of the path and builds the reply:
+// an array for JSONPath and a single value for legacy paths. fn returns nil
+// when the value has the wrong type, which is an error for legacy paths.
+func jsonPerMatch(memory *Memory, key string, path *JSONPath, expected string, write bool, fn func(doc *JSONDocument, loc jsonLocation) *RESP) *RESP {
+	doc, errResp := getJSON(memory, key)
+	if errResp != nil {
+		return errResp
+	}
+	if doc == nil {
+		if path.legacy {
+			return BulkStringResp("")
+		}
+		return SimpleErrorResp("ERR could not perform this operation on a key that doesn't exist")
+	}
+	matches, errResp := jsonMatches(doc, path)
+	if errResp != nil {
+		return errResp
+	}
+
+	output := ArrayResp()
+	for _, loc := range matches {
+		result := fn(doc, loc)
+		if result == nil {
+			if path.legacy {
+				return jsonWrongTypeErr(expected, loc.value)
+			}
+			result = BulkStringResp("")
+		}
+		output.Nested = append(output.Nested, result)
+	}
+	if write {
+		putJSON(memory, key, doc)
+	}
+	if path.legacy {
+		return output.Nested[0]
+	}
+	return output
+}
+
+func jsonStrlen(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.STRLEN")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		return jsonPerMatch(memory, string(resp.Nested[1].Data), path, "string", false, func(doc *JSONDocument, loc jsonLocation) *RESP {
+			str, ok := loc.value.(string)
+			if !ok {
+				return nil
+			}
+			return IntegerResp(len(str))
+		}), nil
+	}
+}
+
+func jsonArrappend(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.ARRAPPEND")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		values := make([]any, 0, len(resp.Nested)-3)
+		for _, arg := range resp.Nested[3:] {
+			value, err := ParseJSON(string(arg.Data))
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			values = append(values, value)
+		}
+		return jsonPerMatch(memory, string(resp.Nested[1].Data), path, "array", true, func(doc *JSONDocument, loc jsonLocation) *RESP {
+			arr, ok := loc.value.(*jsonArray)
+			if !ok {
+				return nil
+			}
+			for _, value := range values {
+				arr.items = append(arr.items, jsonDeepCopy(value))
+			}
+			return IntegerResp(len(arr.items))
+		}), nil
+	}
+}
+
+func jsonArrindex(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.ARRINDEX")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		value, err := ParseJSON(string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		// stop is exclusive, 0 means the end of the array
+		bounds := []int{0, 0}
+		for i, arg := range resp.Nested[4:min(len(resp.Nested), 6)] {
+			bounds[i], err = strconv.Atoi(string(arg.Data))
+			if err != nil {
+				return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+			}
+		}
+
+		return jsonPerMatch(memory, string(resp.Nested[1].Data), path, "array", false, func(doc *JSONDocument, loc jsonLocation) *RESP {
+			arr, ok := loc.value.(*jsonArray)
+			if !ok {
+				return nil
+			}
+			start, stop := bounds[0], bounds[1]
+			length := len(arr.items)
+			if start < 0 {
+				start = max(0, start+length)
+			}
+			if stop < 0 {
+				stop += length
+			}
+			if stop == 0 || stop > length {
+				stop = length
+			}
+			for i := start; i < stop; i++ {
+				if jsonEqual(arr.items[i], value) {
+					return IntegerResp(i)
+				}
+			}
+			return IntegerResp(-1)
+		}), nil
+	}
+}
+
+func jsonArrinsert(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.ARRINSERT")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		index, err := strconv.Atoi(string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+		}
+		values := make([]any, 0, len(resp.Nested)-4)
+		for _, arg := range resp.Nested[4:] {
+			value, err := ParseJSON(string(arg.Data))
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			values = append(values, value)
+		}
+
+		var outOfBounds bool
+		output := jsonPerMatch(memory, string(resp.Nested[1].Data), path, "array", true, func(doc *JSONDocument, loc jsonLocation) *RESP {
+			arr, ok := loc.value.(*jsonArray)
+			if !ok {
+				return nil
+			}
+			at := index
+			if at < 0 {
+				at += len(arr.items)
+			}
+			if at < 0 || at > len(arr.items) {
+				outOfBounds = true
+				return IntegerResp(len(arr.items))
+			}
+			inserted := make([]any, 0, len(arr.items)+len(values))
+			inserted = append(inserted, arr.items[:at]...)
+			for _, value := range values {
+				inserted = append(inserted, jsonDeepCopy(value))
+			}
+			arr.items = append(inserted, arr.items[at:]...)
+			return IntegerResp(len(arr.items))
+		})
+		if outOfBounds {
+			return SimpleErrorResp("ERR index out of bounds"), nil
+		}
+		return output, nil
+	}
+}
+
+func jsonArrlen(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.ARRLEN")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		return jsonPerMatch(memory, string(resp.Nested[1].Data), path, "array", false, func(doc *JSONDocument, loc jsonLocation) *RESP {
+			arr, ok := loc.value.(*jsonArray)
+			if !ok {
+				return nil
+			}
+			return IntegerResp(len(arr.items))
+		}), nil
+	}
+}
+
+func jsonArrpop(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.ARRPOP")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		index := -1
+		if len(resp.Nested) > 3 {
+			var err error
+			index, err = strconv.Atoi(string(resp.Nested[3].Data))
+			if err != nil {
+				return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+			}
+		}
+
+		return jsonPerMatch(memory, string(resp.Nested[1].Data), path, "array", true, func(doc *JSONDocument, loc jsonLocation) *RESP {
+			arr, ok := loc.value.(*jsonArray)
+			if !ok {
+				return nil
+			}
+			if len(arr.items) == 0 {
+				return BulkStringResp("")
+			}
+			// out of range indexes pop the nearest end
+			at := index
+			if at < 0 {
+				at += len(arr.items)
+			}
+			at = max(0, min(at, len(arr.items)-1))
+			popped := arr.items[at]
+			arr.items = append(arr.items[:at], arr.items[at+1:]...)
+			return BulkStringResp(SerializeJSON(popped, jsonFormat{}))
+		}), nil
+	}
+}
+
+func jsonArrtrim(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.ARRTRIM")
+		}
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		start, err := strconv.Atoi(string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+		}
+		stop, err := strconv.Atoi(string(resp.Nested[4].Data))
+		if err != nil {
+			return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+		}
+
+		return jsonPerMatch(memory, string(resp.Nested[1].Data), path, "array", true, func(doc *JSONDocument, loc jsonLocation) *RESP {
+			arr, ok := loc.value.(*jsonArray)
+			if !ok {
+				return nil
+			}
+			from, to := start, stop
+			length := len(arr.items)
+			if from < 0 {
+				from = max(0, from+length)
+			}
+			if to < 0 {
+				to += length
+			}
+			to = min(to, length-1)
+			if from > to || from >= length {
+				arr.items = make([]any, 0)
+			} else {
+				arr.items = append([]any{}, arr.items[from:to+1]...)
+			}
+			return IntegerResp(len(arr.items))
+		}), nil
+	}
+}
+
+func jsonNumincrby(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for JSON.NUMINCRBY")
+		}
+		key := string(resp.Nested[1].Data)
+		path, errResp := parseJSONCmdPath(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		incr, err := ParseJSON(string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		if _, ok := jsonToFloat(incr); !ok {
+			return SimpleErrorResp("ERR expected a number value"), nil
+		}
+
+		doc, errResp := getJSON(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if doc == nil {
+			return SimpleErrorResp("ERR could not perform this operation on a key that doesn't exist"), nil
+		}
+		matches, errResp := jsonMatches(doc, path)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		results := &jsonArray{items: make([]any, 0, len(matches))}
+		for _, loc := range matches {
+			if _, ok := jsonToFloat(loc.value); !ok {
+				if path.legacy {
+					return jsonWrongTypeErr("a number", loc.value), nil
+				}
+				results.items = append(results.items, nil)
+				continue
+			}
+			result, ok := jsonAddNumbers(loc.value, incr)
+			if !ok {
+				return SimpleErrorResp("ERR result is not a number"), nil
+			}
+			doc.jsonReplace(loc, result)
+			results.items = append(results.items, result)
+		}
+		putJSON(memory, key, doc)
+
+		if path.legacy {
+			return BulkStringResp(SerializeJSON(results.items[0], jsonFormat{})), nil
+		}
+		return BulkStringResp(SerializeJSON(results, jsonFormat{})), nil
+	}
+}
+
+// jsonAddNumbers keeps integers as integers unless the sum overflows
+func jsonAddNumbers(a, b any) (any, bool) {
+	ia, okA := a.(int64)
+	ib, okB := b.(int64)
+	if okA && okB {
+		sum := ia + ib
+		if (sum > ia) == (ib > 0) {
+			return sum, true
+		}
+	}
+	fa, _ := jsonToFloat(a)
+	fb, _ := jsonToFloat(b)
+	sum := fa + fb
+	if math.IsInf(sum, 0) || math.IsNaN(sum) {
+		return nil, false
+	}
+	return sum, true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJSON_ParseAndSerialize(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected string
+	}{
+		{input: `{"b":1,"a":[true,null,"x"]}`, expected: `{"b":1,"a":[true,null,"x"]}`},
+		{input: ` [ 1.0, 2.5, -3, 1e20 ] `, expected: `[1.0,2.5,-3,1e+20]`},
+		{input: `"<tag>"`, expected: `"<tag>"`},
+		{input: `{}`, expected: `{}`},
+	}
+	for _, tt := range testcases {
+		value, err := ParseJSON(tt.input)
+		if err != nil {
+			t.Errorf("input: %v - unexpected error: %v", tt.input, err)
+			continue
+		}
+		if output := SerializeJSON(value, jsonFormat{}); output != tt.expected {
+			t.Errorf("input: %v - expected: %v - actual: %v", tt.input, tt.expected, output)
+		}
+	}
+
+	for _, input := range []string{`{"a":}`, `[1,2`, `1 2`, ``} {
+		if _, err := ParseJSON(input); err == nil {
+			t.Errorf("input: %q - expected an error", input)
+		}
+	}
+}
+
+func TestJSON_Path(t *testing.T) {
+	doc, _ := ParseJSON(`{"store":{"book":[{"title":"a","price":8},{"title":"b","price":12}],"bike":{"price":20}}}`)
+	testcases := []struct {
+		path     string
+		expected string
+	}{
+		{path: "$", expected: `[{"store":{"book":[{"title":"a","price":8},{"title":"b","price":12}],"bike":{"price":20}}}]`},
+		{path: "$.store.book[*].title", expected: `["a","b"]`},
+		{path: "$..price", expected: `[8,12,20]`},
+		{path: "$.store.book[-1]", expected: `[{"title":"b","price":12}]`},
+		{path: "$.store.book[0:1].title", expected: `["a"]`},
+		{path: "$.store.book[?(@.price > 10)].title", expected: `["b"]`},
+		{path: `$.store["bike"].price`, expected: `[20]`},
+		{path: "$.missing", expected: `[]`},
+		{path: ".store.bike", expected: `[{"price":20}]`},
+	}
+	for _, tt := range testcases {
+		path, err := ParseJSONPath(tt.path)
+		if err != nil {
+			t.Errorf("path: %v - unexpected error: %v", tt.path, err)
+			continue
+		}
+		values := &jsonArray{}
+		for _, loc := range path.Evaluate(doc) {
+			values.items = append(values.items, loc.value)
+		}
+		if output := SerializeJSON(values, jsonFormat{}); output != tt.expected {
+			t.Errorf("path: %v - expected: %v - actual: %v", tt.path, tt.expected, output)
+		}
+	}
+}
+
+func TestProcessor_JSON(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "set root",
+			args:     []string{"JSON.SET", "doc", "$", `{"a":2,"arr":[1,2],"nested":{"a":true}}`},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "new key must start at root",
+			args:     []string{"JSON.SET", "other", "$.a", "1"},
+			expected: "-ERR new objects must be created at the root\r\n",
+		},
+		{
+			name:     "set nx existing",
+			args:     []string{"JSON.SET", "doc", "$.a", "3", "NX"},
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "set new member",
+			args:     []string{"JSON.SET", "doc", "$.b", `"x"`},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "get legacy",
+			args:     []string{"JSON.GET", "doc", ".b"},
+			expected: "$3\r\n\"x\"\r\n",
+		},
+		{
+			name:     "get recursive",
+			args:     []string{"JSON.GET", "doc", "$..a"},
+			expected: "$8\r\n[2,true]\r\n",
+		},
+		{
+			name:     "get with format",
+			args:     []string{"JSON.GET", "doc", "INDENT", " ", "NEWLINE", "\n", "$.arr"},
+			expected: "$18\r\n[\n [\n  1,\n  2\n ]\n]\r\n",
+		},
+		{
+			name:     "type",
+			args:     []string{"JSON.TYPE", "doc", "$.nested"},
+			expected: "*1\r\n$6\r\nobject\r\n",
+		},
+		{
+			name:     "arrappend",
+			args:     []string{"JSON.ARRAPPEND", "doc", "$.arr", "3", `"four"`},
+			expected: "*1\r\n:4\r\n",
+		},
+		{
+			name:     "arrappend on non array",
+			args:     []string{"JSON.ARRAPPEND", "doc", "$.a", "1"},
+			expected: "*1\r\n$-1\r\n",
+		},
+		{
+			name:     "arrindex",
+			args:     []string{"JSON.ARRINDEX", "doc", "$.arr", `"four"`},
+			expected: "*1\r\n:3\r\n",
+		},
+		{
+			name:     "arrpop",
+			args:     []string{"JSON.ARRPOP", "doc", ".arr"},
+			expected: "$6\r\n\"four\"\r\n",
+		},
+		{
+			name:     "numincrby",
+			args:     []string{"JSON.NUMINCRBY", "doc", "$.a", "1.5"},
+			expected: "$5\r\n[3.5]\r\n",
+		},
+		{
+			name:     "numincrby legacy wrong type",
+			args:     []string{"JSON.NUMINCRBY", "doc", ".b", "1"},
+			expected: "-ERR wrong type of path value - expected a number but found string\r\n",
+		},
+		{
+			name:     "legacy missing path",
+			args:     []string{"JSON.GET", "doc", ".missing"},
+			expected: "-ERR Path '.missing' does not exist\r\n",
+		},
+		{
+			name:     "del member",
+			args:     []string{"JSON.DEL", "doc", "$.nested"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "get root",
+			args:     []string{"JSON.GET", "doc"},
+			expected: "$31\r\n{\"a\":3.5,\"arr\":[1,2,3],\"b\":\"x\"}\r\n",
+		},
+		{
+			name:     "missing key",
+			args:     []string{"JSON.GET", "str"},
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "del root",
+			args:     []string{"JSON.DEL", "doc"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "deleted",
+			args:     []string{"TYPE", "doc"},
+			expected: "+none\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type jsonSelectorKind int
+
+const (
+	jsonSelectName jsonSelectorKind = iota
+	jsonSelectWildcard
+	jsonSelectIndex
+	jsonSelectSlice
+	jsonSelectFilter
+)
+
+type jsonPathSegment struct {
+	kind jsonSelectorKind
+	// recursive applies the selector to the node and all its descendants (..)
+	recursive bool
+	names     []string
+	indexes   []int
+	// slice bounds, nil means unbounded
+	start, end *int
+	step       int
+	filter     jsonFilterExpr
+}
+
+// JSONPath is either a JSONPath starting with "$" or a legacy path like
+// ".a.b", legacy paths only ever resolve to their first match
+type JSONPath struct {
+	raw      string
+	legacy   bool
+	segments []jsonPathSegment
+}
+
+// jsonLocation is a matched value with enough information to replace or
+// remove it from its parent, parent is nil for the root
+type jsonLocation struct {
+	value  any
+	parent any
+	key    string
+	index  int
+}
+
+func ParseJSONPath(path string) (*JSONPath, error) {
+	normalized := path
+	legacy := !strings.HasPrefix(path, "$")
+	if legacy {
+		switch {
+		case path == "." || path == "":
+			normalized = "$"
+		case strings.HasPrefix(path, "."), strings.HasPrefix(path, "["):
+			normalized = "$" + path
+		default:
+			normalized = "$." + path
+		}
+	}
+
+	segments, err := parseJSONPathSegments(normalized[1:])
+	if err != nil {
+		return nil, err
+	}
+	return &JSONPath{
+		raw:      path,
+		legacy:   legacy,
+		segments: segments,
+	}, nil
+}
+
+func (p *JSONPath) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// parent splits a path ending with a plain name into the parent path and the
+// name, which is how JSON.SET creates new object members
+func (p *JSONPath) parent() (*JSONPath, string, bool) {
+	if len(p.segments) == 0 {
+		return nil, "", false
+	}
+	last := p.segments[len(p.segments)-1]
+	if last.kind != jsonSelectName || last.recursive || len(last.names) != 1 {
+		return nil, "", false
+	}
+	return &JSONPath{
+		raw:      p.raw,
+		legacy:   p.legacy,
+		segments: p.segments[:len(p.segments)-1],
+	}, last.names[0], true
+}
+
+func parseJSONPathSegments(path string) ([]jsonPathSegment, error) {
+	segments := make([]jsonPathSegment, 0)
+	i := 0
+	for i < len(path) {
+		recursive := false
+		switch path[i] {
+		case '.':
+			i++
+			if i < len(path) && path[i] == '.' {
+				recursive = true
+				i++
+			}
+			if i >= len(path) {
+				return nil, fmt.Errorf("ERR invalid path: unexpected end")
+			}
+			if path[i] == '[' {
+				segment, next, err := parseJSONPathBracket(path, i)
+				if err != nil {
+					return nil, err
+				}
+				segment.recursive = recursive
+				segments = append(segments, segment)
+				i = next
+				continue
+			}
+			if path[i] == '*' {
+				segments = append(segments, jsonPathSegment{kind: jsonSelectWildcard, recursive: recursive})
+				i++
+				continue
+			}
+			start := i
+			for i < len(path) && path[i] != '.' && path[i] != '[' {
+				i++
+			}
+			segments = append(segments, jsonPathSegment{
+				kind:      jsonSelectName,
+				recursive: recursive,
+				names:     []string{path[start:i]},
+			})
+		case '[':
+			segment, next, err := parseJSONPathBracket(path, i)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+			i = next
+		default:
+			return nil, fmt.Errorf("ERR invalid path: unexpected character '%c'", path[i])
+		}
+	}
+	return segments, nil
+}
+
+// findClosing returns the index of the bracket closing the one at start,
+// skipping quoted strings and nested brackets
+func findClosing(path string, start int, open, close byte) int {
+	depth := 0
+	for i := start; i < len(path); i++ {
+		switch path[i] {
+		case '\'', '"':
+			quote := path[i]
+			for i++; i < len(path) && path[i] != quote; i++ {
+				if path[i] == '\\' {
+					i++
+				}
+			}
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits on sep outside of quotes
+func splitTopLevel(input string, sep byte) []string {
+	parts := make([]string, 0)
+	start := 0
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case '\'', '"':
+			quote := input[i]
+			for i++; i < len(input) && input[i] != quote; i++ {
+				if input[i] == '\\' {
+					i++
+				}
+			}
+		case sep:
+			parts = append(parts, input[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, input[start:])
+}
+
+func unquoteJSONPathString(input string) (string, bool) {
+	if len(input) < 2 || (input[0] != '\'' && input[0] != '"') || input[len(input)-1] != input[0] {
+		return "", false
+	}
+	return strings.ReplaceAll(input[1:len(input)-1], "\\"+string(input[0]), string(input[0])), true
+}
+
+func parseJSONPathBracket(path string, start int) (jsonPathSegment, int, error) {
+	end := findClosing(path, start, '[', ']')
+	if end < 0 {
+		return jsonPathSegment{}, 0, fmt.Errorf("ERR invalid path: missing ']'")
+	}
+	content := strings.TrimSpace(path[start+1 : end])
+	next := end + 1
+
+	switch {
+	case content == "*":
+		return jsonPathSegment{kind: jsonSelectWildcard}, next, nil
+	case strings.HasPrefix(content, "?"):
+		expr := strings.TrimSpace(content[1:])
+		filter, err := parseJSONFilter(expr)
+		if err != nil {
+			return jsonPathSegment{}, 0, err
+		}
+		return jsonPathSegment{kind: jsonSelectFilter, filter: filter}, next, nil
+	case strings.HasPrefix(content, "'") || strings.HasPrefix(content, "\""):
+		names := make([]string, 0)
+		for _, part := range splitTopLevel(content, ',') {
+			name, ok := unquoteJSONPathString(strings.TrimSpace(part))
+			if !ok {
+				return jsonPathSegment{}, 0, fmt.Errorf("ERR invalid path: bad member name %v", part)
+			}
+			names = append(names, name)
+		}
+		return jsonPathSegment{kind: jsonSelectName, names: names}, next, nil
+	case strings.Contains(content, ":"):
+		parts := strings.Split(content, ":")
+		if len(parts) > 3 {
+			return jsonPathSegment{}, 0, fmt.Errorf("ERR invalid path: bad slice %v", content)
+		}
+		segment := jsonPathSegment{kind: jsonSelectSlice, step: 1}
+		bounds := []**int{&segment.start, &segment.end}
+		for j, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			num, err := strconv.Atoi(part)
+			if err != nil {
+				return jsonPathSegment{}, 0, fmt.Errorf("ERR invalid path: bad slice %v", content)
+			}
+			if j == 2 {
+				if num == 0 {
+					return jsonPathSegment{}, 0, fmt.Errorf("ERR invalid path: slice step can't be 0")
+				}
+				segment.step = num
+				continue
+			}
+			*bounds[j] = &num
+		}
+		return segment, next, nil
+	}
+
+	indexes := make([]int, 0)
+	for _, part := range strings.Split(content, ",") {
+		num, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return jsonPathSegment{}, 0, fmt.Errorf("ERR invalid path: bad index %v", part)
+		}
+		indexes = append(indexes, num)
+	}
+	return jsonPathSegment{kind: jsonSelectIndex, indexes: indexes}, next, nil
+}
+
+// Evaluate returns all the locations matched by the path
+func (p *JSONPath) Evaluate(root any) []jsonLocation {
+	current := []jsonLocation{{value: root}}
+	for _, segment := range p.segments {
+		next := make([]jsonLocation, 0)
+		for _, loc := range current {
+			if segment.recursive {
+				for _, descendant := range jsonDescendants(loc) {
+					next = append(next, segment.apply(root, descendant)...)
+				}
+			} else {
+				next = append(next, segment.apply(root, loc)...)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// jsonDescendants returns the location itself followed by all its
+// descendants in document order
+func jsonDescendants(loc jsonLocation) []jsonLocation {
+	output := []jsonLocation{loc}
+	switch v := loc.value.(type) {
+	case *jsonObject:
+		for _, key := range v.keys {
+			output = append(output, jsonDescendants(jsonLocation{value: v.fields[key], parent: v, key: key})...)
+		}
+	case *jsonArray:
+		for i, item := range v.items {
+			output = append(output, jsonDescendants(jsonLocation{value: item, parent: v, index: i})...)
+		}
+	}
+	return output
+}
+
+func (segment jsonPathSegment) apply(root any, loc jsonLocation) []jsonLocation {
+	output := make([]jsonLocation, 0)
+	switch segment.kind {
+	case jsonSelectName:
+		if obj, ok := loc.value.(*jsonObject); ok {
+			for _, name := range segment.names {
+				if value, ok := obj.fields[name]; ok {
+					output = append(output, jsonLocation{value: value, parent: obj, key: name})
+				}
+			}
+		}
+	case jsonSelectWildcard:
+		output = append(output, jsonChildren(loc)...)
+	case jsonSelectIndex:
+		if arr, ok := loc.value.(*jsonArray); ok {
+			for _, index := range segment.indexes {
+				if index < 0 {
+					index += len(arr.items)
+				}
+				if index >= 0 && index < len(arr.items) {
+					output = append(output, jsonLocation{value: arr.items[index], parent: arr, index: index})
+				}
+			}
+		}
+	case jsonSelectSlice:
+		if arr, ok := loc.value.(*jsonArray); ok {
+			for _, index := range segment.sliceIndexes(len(arr.items)) {
+				output = append(output, jsonLocation{value: arr.items[index], parent: arr, index: index})
+			}
+		}
+	case jsonSelectFilter:
+		for _, child := range jsonChildren(loc) {
+			if segment.filter.eval(root, child.value) {
+				output = append(output, child)
+			}
+		}
+	}
+	return output
+}
+
+func jsonChildren(loc jsonLocation) []jsonLocation {
+	output := make([]jsonLocation, 0)
+	switch v := loc.value.(type) {
+	case *jsonObject:
+		for _, key := range v.keys {
+			output = append(output, jsonLocation{value: v.fields[key], parent: v, key: key})
+		}
+	case *jsonArray:
+		for i, item := range v.items {
+			output = append(output, jsonLocation{value: item, parent: v, index: i})
+		}
+	}
+	return output
+}
+
+// sliceIndexes follows python slicing semantics
+func (segment jsonPathSegment) sliceIndexes(length int) []int {
+	normalize := func(bound *int, def int) int {
+		if bound == nil {
+			return def
+		}
+		index := *bound
+		if index < 0 {
+			index += length
+		}
+		if segment.step > 0 {
+			return max(0, min(index, length))
+		}
+		return max(-1, min(index, length-1))
+	}
+
+	output := make([]int, 0)
+	if segment.step > 0 {
+		for i := normalize(segment.start, 0); i < normalize(segment.end, length); i += segment.step {
+			output = append(output, i)
+		}
+		return output
+	}
+	for i := normalize(segment.start, length-1); i > normalize(segment.end, -1); i += segment.step {
+		output = append(output, i)
+	}
+	return output
+}
+
+// filter expressions, e.g. ?(@.price < 10 && @.tags)
+
+type jsonFilterExpr interface {
+	eval(root, current any) bool
+}
+
+type jsonFilterAnd struct {
+	left, right jsonFilterExpr
+}
+
+type jsonFilterOr struct {
+	left, right jsonFilterExpr
+}
+
+type jsonFilterNot struct {
+	expr jsonFilterExpr
+}
+
+// jsonFilterCompare without op checks the existence of the left operand
+type jsonFilterCompare struct {
+	left, right jsonFilterOperand
+	op          string
+}
+
+type jsonFilterOperand struct {
+	path     *JSONPath
+	relative bool
+	literal  any
+}
+
+func (e jsonFilterAnd) eval(root, current any) bool {
+	return e.left.eval(root, current) && e.right.eval(root, current)
+}
+
+func (e jsonFilterOr) eval(root, current any) bool {
+	return e.left.eval(root, current) || e.right.eval(root, current)
+}
+
+func (e jsonFilterNot) eval(root, current any) bool {
+	return !e.expr.eval(root, current)
+}
+
+func (o jsonFilterOperand) value(root, current any) (any, bool) {
+	if o.path == nil {
+		return o.literal, true
+	}
+	start := root
+	if o.relative {
+		start = current
+	}
+	matches := o.path.Evaluate(start)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	return matches[0].value, true
+}
+
+func (e jsonFilterCompare) eval(root, current any) bool {
+	left, ok := e.left.value(root, current)
+	if !ok {
+		return false
+	}
+	if e.op == "" {
+		return true
+	}
+	right, ok := e.right.value(root, current)
+	if !ok {
+		return false
+	}
+
+	switch e.op {
+	case "==":
+		return jsonEqual(left, right)
+	case "!=":
+		return !jsonEqual(left, right)
+	case "=~":
+		str, ok1 := left.(string)
+		pattern, ok2 := right.(string)
+		if !ok1 || !ok2 {
+			return false
+		}
+		matched, err := regexp.MatchString(pattern, str)
+		return err == nil && matched
+	}
+
+	cmp, ok := jsonOrder(left, right)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// jsonOrder compares numbers with numbers and strings with strings
+func jsonOrder(a, b any) (int, bool) {
+	if fa, ok := jsonToFloat(a); ok {
+		fb, ok := jsonToFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	sa, ok1 := a.(string)
+	sb, ok2 := b.(string)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return strings.Compare(sa, sb), true
+}
+
+type jsonFilterParser struct {
+	input string
+	pos   int
+}
+
+func parseJSONFilter(input string) (jsonFilterExpr, error) {
+	// the expression is usually wrapped as ?(...)
+	parser := &jsonFilterParser{input: input}
+	expr, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	parser.skipSpaces()
+	if parser.pos != len(parser.input) {
+		return nil, fmt.Errorf("ERR invalid filter expression: %v", input)
+	}
+	return expr, nil
+}
+
+func (p *jsonFilterParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *jsonFilterParser) consume(token string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *jsonFilterParser) parseOr() (jsonFilterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = jsonFilterOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *jsonFilterParser) parseAnd() (jsonFilterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = jsonFilterAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *jsonFilterParser) parseUnary() (jsonFilterExpr, error) {
+	if p.consume("!") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return jsonFilterNot{expr: expr}, nil
+	}
+	if p.consume("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, fmt.Errorf("ERR invalid filter expression: missing ')'")
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "=~", "<", ">"} {
+		if p.consume(op) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return jsonFilterCompare{left: left, right: right, op: op}, nil
+		}
+	}
+	return jsonFilterCompare{left: left}, nil
+}
+
+func (p *jsonFilterParser) parseOperand() (jsonFilterOperand, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return jsonFilterOperand{}, fmt.Errorf("ERR invalid filter expression: unexpected end")
+	}
+
+	switch c := p.input[p.pos]; {
+	case c == '@' || c == '$':
+		start := p.pos
+		p.pos++
+		for p.pos < len(p.input) {
+			ch := p.input[p.pos]
+			if ch == '[' {
+				end := findClosing(p.input, p.pos, '[', ']')
+				if end < 0 {
+					return jsonFilterOperand{}, fmt.Errorf("ERR invalid filter expression: missing ']'")
+				}
+				p.pos = end + 1
+				continue
+			}
+			if strings.IndexByte(" =!<>&|)", ch) >= 0 {
+				break
+			}
+			p.pos++
+		}
+		segments, err := parseJSONPathSegments(p.input[start+1 : p.pos])
+		if err != nil {
+			return jsonFilterOperand{}, err
+		}
+		return jsonFilterOperand{path: &JSONPath{segments: segments}, relative: c == '@'}, nil
+	case c == '\'' || c == '"':
+		end := p.pos + 1
+		for end < len(p.input) && p.input[end] != c {
+			if p.input[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.input) {
+			return jsonFilterOperand{}, fmt.Errorf("ERR invalid filter expression: unterminated string")
+		}
+		str, _ := unquoteJSONPathString(p.input[p.pos : end+1])
+		p.pos = end + 1
+		return jsonFilterOperand{literal: str}, nil
+	}
+
+	// true, false, null and numbers
+	start := p.pos
+	for p.pos < len(p.input) && strings.IndexByte(" =!<>&|)", p.input[p.pos]) < 0 {
+		p.pos++
+	}
+	literal, err := ParseJSON(p.input[start:p.pos])
+	if err != nil {
+		return jsonFilterOperand{}, fmt.Errorf("ERR invalid filter expression: bad literal %v", p.input[start:p.pos])
+	}
+	return jsonFilterOperand{literal: literal}, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// List is a minimal list type, enough to hold the output of SORT STORE
+type List struct {
+	items []string
+}
+
+func NewList() *List {
+	return &List{
+		items: make([]string, 0),
+	}
+}
+
+func (l *List) Len() int {
+	return len(l.items)
+}
+
+func (l *List) PushFront(item string) {
+	l.items = append([]string{item}, l.items...)
+}
+
+func (l *List) PushBack(item string) {
+	l.items = append(l.items, item)
+}
+
+// Range returns the items between start and stop, negative indexes count
+// from the tail
+func (l *List) Range(start, stop int) []string {
+	length := len(l.items)
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	start = max(start, 0)
+	stop = min(stop, length-1)
+	if start > stop || start >= length {
+		return []string{}
+	}
+	return l.items[start : stop+1]
+}
+
+// getList returns nil list when the key does not exist and an error response
+// when the key holds another type
+func getList(memory *Memory, key string) (*List, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "list" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*List), nil
+}
+
+func putList(memory *Memory, key string, list *List) {
+	if list.Len() == 0 {
+		memory.Delete(key)
+		return
+	}
+	memory.Put(key, Entry{Type: "list", Value: list}, Option{})
+}
+
+func pushGeneric(memory *Memory, name string, front bool) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		key := string(resp.Nested[1].Data)
+		list, errResp := getList(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if list == nil {
+			list = NewList()
+		}
+		for _, arg := range resp.Nested[2:] {
+			if front {
+				list.PushFront(string(arg.Data))
+			} else {
+				list.PushBack(string(arg.Data))
+			}
+		}
+		putList(memory, key, list)
+
+		return IntegerResp(list.Len()), nil
+	}
+}
+
+func lpush(memory *Memory) Executor {
+	return pushGeneric(memory, "LPUSH", true)
+}
+
+func rpush(memory *Memory) Executor {
+	return pushGeneric(memory, "RPUSH", false)
+}
+
+func lrange(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for LRANGE")
+		}
+		start, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil {
+			return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+		}
+		stop, err := strconv.Atoi(string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+		}
+		list, errResp := getList(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if list == nil {
+			return ArrayResp(), nil
+		}
+		return BulkStringArrayResp(list.Range(start, stop)), nil
+	}
+}
+
+func llen(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for LLEN")
+		}
+		list, errResp := getList(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if list == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(list.Len()), nil
+	}
+}
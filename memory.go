@@ -1,19 +1,35 @@
 package main
 
 import (
+	"sync"
 	"time"
 )
 
-type StreamEntry map[string]map[string]string
-
 type Entry struct {
 	Type  string
 	Value interface{}
 }
 
 type Memory struct {
+	// held by every command while it runs so that commands, and whole
+	// transactions, never interleave
+	lock sync.Mutex
+
 	store  map[string]Entry
 	expiry chan string
+
+	// version of every key, taken from a counter bumped on every write so
+	// that a key deleted and written again never gets an old version back
+	versions map[string]uint64
+	counter  uint64
+
+	// clients blocked on keys, signaled whenever one of the keys is written
+	waitersLock sync.Mutex
+	waiters     map[string]map[chan struct{}]struct{}
+
+	// called with the key after every write or delete, e.g. to keep the
+	// search indexes up to date
+	listeners []func(key string)
 }
 
 type Option struct {
@@ -22,8 +38,10 @@ type Option struct {
 
 func NewMemory() *Memory {
 	memory := &Memory{
-		store:  make(map[string]Entry),
-		expiry: make(chan string),
+		store:    make(map[string]Entry),
+		expiry:   make(chan string),
+		versions: make(map[string]uint64),
+		waiters:  make(map[string]map[chan struct{}]struct{}),
 	}
 
 	// watch expiry event asynchronously
@@ -32,6 +50,15 @@ func NewMemory() *Memory {
 	return memory
 }
 
+// Lock gives the caller exclusive access to the store until Unlock
+func (m *Memory) Lock() {
+	m.lock.Lock()
+}
+
+func (m *Memory) Unlock() {
+	m.lock.Unlock()
+}
+
 func (m *Memory) Get(key string) *Entry {
 	val, ok := m.store[key]
 	if !ok {
@@ -42,6 +69,10 @@ func (m *Memory) Get(key string) *Entry {
 
 func (m *Memory) Put(key string, val Entry, opts Option) {
 	m.store[key] = val
+	m.counter++
+	m.versions[key] = m.counter
+	m.signalKey(key)
+	m.notifyKey(key)
 
 	// TODO: need to move this to passive expiry + sweep actively
 	// px is set
@@ -53,8 +84,96 @@ func (m *Memory) Put(key string, val Entry, opts Option) {
 	}
 }
 
+func (m *Memory) Delete(key string) bool {
+	_, ok := m.store[key]
+	if ok {
+		delete(m.store, key)
+		// the version is kept as a tombstone, a key watched while missing
+		// must look changed once written and deleted again
+		m.counter++
+		m.versions[key] = m.counter
+		m.notifyKey(key)
+	}
+	return ok
+}
+
+// Flush deletes every key
+func (m *Memory) Flush() {
+	for _, key := range m.Keys() {
+		m.Delete(key)
+	}
+}
+
+// Version changes whenever the key is written, deleted or expires, it is
+// zero for a key never written
+func (m *Memory) Version(key string) uint64 {
+	return m.versions[key]
+}
+
+// Keys returns every key of the store in no particular order
+func (m *Memory) Keys() []string {
+	keys := make([]string, 0, len(m.store))
+	for key := range m.store {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// BlockOnKeys registers interest in the keys, the returned channel receives
+// a signal when any of them is written and cancel must be called once done
+func (m *Memory) BlockOnKeys(keys []string) (<-chan struct{}, func()) {
+	signal := make(chan struct{}, 1)
+
+	m.waitersLock.Lock()
+	defer m.waitersLock.Unlock()
+	for _, key := range keys {
+		if _, ok := m.waiters[key]; !ok {
+			m.waiters[key] = make(map[chan struct{}]struct{})
+		}
+		m.waiters[key][signal] = struct{}{}
+	}
+
+	cancel := func() {
+		m.waitersLock.Lock()
+		defer m.waitersLock.Unlock()
+		for _, key := range keys {
+			delete(m.waiters[key], signal)
+			if len(m.waiters[key]) == 0 {
+				delete(m.waiters, key)
+			}
+		}
+	}
+	return signal, cancel
+}
+
+func (m *Memory) signalKey(key string) {
+	m.waitersLock.Lock()
+	defer m.waitersLock.Unlock()
+	for signal := range m.waiters[key] {
+		// never block the writer, one pending signal is enough to wake up
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// OnKeyChange registers a listener called whenever a key is written or
+// deleted
+func (m *Memory) OnKeyChange(listener func(key string)) {
+	m.listeners = append(m.listeners, listener)
+}
+
+func (m *Memory) notifyKey(key string) {
+	for _, listener := range m.listeners {
+		listener(key)
+	}
+}
+
 func (m *Memory) expiryWatcher() {
 	for expiredKey := range m.expiry {
-		delete(m.store, expiredKey)
+		m.Lock()
+		m.Delete(expiredKey)
+		m.Unlock()
 	}
 }
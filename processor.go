@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -9,29 +8,61 @@ import (
 	"time"
 )
 
-type Executor func(ctx context.Context, resp *RESP) (*RESP, error)
+type Executor func(client *Client, resp *RESP) (*RESP, error)
 
 type Processor struct {
-	parser      RespParser
-	memory      *Memory
-	transaction *Transaction
-	executors   map[string]Executor
+	parser    RespParser
+	memory    *Memory
+	executors map[string]Executor
+
+	// connected clients by ID
+	clients      map[int64]*Client
+	nextClientID int64
 }
 
-func NewProcessor(respParser RespParser, memory *Memory, transaction *Transaction) *Processor {
+func NewProcessor(respParser RespParser, memory *Memory) *Processor {
 	processor := &Processor{
-		parser:      respParser,
-		memory:      memory,
-		transaction: transaction,
+		parser:  respParser,
+		memory:  memory,
+		clients: make(map[int64]*Client),
 	}
 
-	executorFactory := initExecutors(processor, memory, transaction)
+	executorFactory := initExecutors(processor, memory)
 	processor.executors = executorFactory
 
 	return processor
 }
 
-func (p *Processor) Accept(txContext context.Context, cmd []byte) ([]byte, error) {
+// Connect registers a new client connected from the address
+func (p *Processor) Connect(addr string) *Client {
+	p.memory.Lock()
+	defer p.memory.Unlock()
+	p.nextClientID++
+	client := NewClient(p.nextClientID, addr)
+	p.clients[client.ID] = client
+	return client
+}
+
+// Disconnect tears the client down, a command it is blocked in returns
+func (p *Processor) Disconnect(client *Client) {
+	// released first, the blocked command holds the lock again to return
+	client.cancel()
+
+	p.memory.Lock()
+	defer p.memory.Unlock()
+	client.Close()
+	delete(p.clients, client.ID)
+}
+
+// Accept runs the command, one command at a time across every connection
+func (p *Processor) Accept(client *Client, cmd []byte) ([]byte, error) {
+	p.memory.Lock()
+	defer p.memory.Unlock()
+	return p.accept(client, cmd)
+}
+
+// accept runs the command, the caller holding the memory lock
+func (p *Processor) accept(client *Client, cmd []byte) ([]byte, error) {
 	resp, err := p.parser.Deserialize(cmd)
 	if err != nil {
 		return nil, err
@@ -44,26 +75,33 @@ func (p *Processor) Accept(txContext context.Context, cmd []byte) ([]byte, error
 	}
 
 	query := strings.ToUpper(string(resp.Nested[0].Data))
+	inMulti := client.InMulti()
+
+	// commands which cannot run are rejected before being queued and abort
+	// the transaction
 	executor, ok := p.executors[query]
+	errResp := checkArity(resp)
 	if !ok {
-		return nil, fmt.Errorf("command not supported")
+		errResp = unknownCommandErr(resp)
+	}
+	if errResp != nil {
+		if inMulti {
+			client.Flag()
+		}
+		return p.parser.Serialize(errResp), nil
 	}
 
 	var output *RESP
-	txId := txContext.Value("txId").(string)
-
-	if p.transaction.IsExisted(txId) &&
-		p.transaction.GetTx(txId).Status == TxActive && (query != "EXEC" && query != "DISCARD") {
-
+	if inMulti && query != "EXEC" && query != "DISCARD" && query != "WATCH" && query != "MULTI" {
 		// queue the cmd waiting for execution
-		p.transaction.Enqueue(txId, cmd)
+		client.Enqueue(cmd)
 
 		output = &RESP{
 			Type: SimpleString,
 			Data: []byte("QUEUED"),
 		}
 	} else {
-		output, err = executor(txContext, resp)
+		output, err = executor(client, resp)
 		if err != nil {
 			return nil, err
 		}
@@ -72,28 +110,210 @@ func (p *Processor) Accept(txContext context.Context, cmd []byte) ([]byte, error
 	return p.parser.Serialize(output), nil
 }
 
-func initExecutors(processor *Processor, memory *Memory, transaction *Transaction) map[string]Executor {
+func initExecutors(processor *Processor, memory *Memory) map[string]Executor {
+	search := NewSearchEngine(memory)
+
 	return map[string]Executor{
-		"PING":     ping(),
-		"ECHO":     echo(),
-		"GET":      get(memory),
-		"SET":      set(memory),
-		"INFO":     info(),
-		"REPLCONF": replConf(),
-		"PSYNC":    psync(),
-		"TYPE":     typeCmd(memory),
-		"XADD":     xadd(memory),
-		"XRANGE":   xrange(memory),
-		"XREAD":    xread(memory),
-		"INCR":     incr(memory),
-		"MULTI":    multi(transaction),
-		"EXEC":     exec(processor, transaction),
-		"DISCARD":  discard(transaction),
+		"PING":       ping(),
+		"ECHO":       echo(),
+		"GET":        get(memory),
+		"SET":        set(memory),
+		"INFO":       info(),
+		"REPLCONF":   replConf(),
+		"PSYNC":      psync(),
+		"TYPE":       typeCmd(memory),
+		"XADD":       xadd(memory),
+		"XRANGE":     xrange(memory),
+		"XREVRANGE":  xrevrange(memory),
+		"XREAD":      xread(memory),
+		"XLEN":       xlen(memory),
+		"XDEL":       xdel(memory),
+		"XTRIM":      xtrim(memory),
+		"XSETID":     xsetid(memory),
+		"XGROUP":     xgroup(memory),
+		"XREADGROUP": xreadgroup(memory),
+		"XACK":       xack(memory),
+		"XPENDING":   xpending(memory),
+		"XCLAIM":     xclaim(memory),
+		"XAUTOCLAIM": xautoclaim(memory),
+		"XINFO":      xinfo(memory),
+		"INCR":       incr(memory),
+		"MULTI":      multi(),
+		"EXEC":       exec(processor, memory),
+		"DISCARD":    discard(),
+		"WATCH":      watch(memory),
+		"UNWATCH":    unwatch(),
+		"CLIENT":     clientCmd(processor),
+		"FLUSHALL":   flushall(memory),
+		"FLUSHDB":    flushall(memory),
+
+		// hashes
+		"HSET":    hset(memory),
+		"HGET":    hget(memory),
+		"HMGET":   hmget(memory),
+		"HGETALL": hgetall(memory),
+		"HDEL":    hdel(memory),
+		"HLEN":    hlen(memory),
+
+		// sets
+		"SADD":        sadd(memory),
+		"SREM":        srem(memory),
+		"SISMEMBER":   sismember(memory),
+		"SMISMEMBER":  smismember(memory),
+		"SMEMBERS":    smembers(memory),
+		"SCARD":       scard(memory),
+		"SPOP":        spop(memory),
+		"SRANDMEMBER": srandmember(memory),
+		"SMOVE":       smove(memory),
+		"SINTER":      sinter(memory),
+		"SUNION":      sunion(memory),
+		"SDIFF":       sdiff(memory),
+		"SINTERSTORE": sinterstore(memory),
+		"SUNIONSTORE": sunionstore(memory),
+		"SDIFFSTORE":  sdiffstore(memory),
+		"SINTERCARD":  sintercard(memory),
+		"SSCAN":       sscan(memory),
+
+		// sorted sets
+		"ZADD":        zadd(memory),
+		"ZINCRBY":     zincrby(memory),
+		"ZREM":        zrem(memory),
+		"ZSCORE":      zscore(memory),
+		"ZMSCORE":     zmscore(memory),
+		"ZCARD":       zcard(memory),
+		"ZCOUNT":      zcount(memory),
+		"ZLEXCOUNT":   zlexcount(memory),
+		"ZRANK":       zrank(memory),
+		"ZREVRANK":    zrevrank(memory),
+		"ZRANGE":      zrange(memory),
+		"ZRANGESTORE": zrangestore(memory),
+		"ZUNION":      zunion(memory),
+		"ZINTER":      zinter(memory),
+		"ZDIFF":       zdiff(memory),
+		"ZUNIONSTORE": zunionstore(memory),
+		"ZINTERSTORE": zinterstore(memory),
+		"ZDIFFSTORE":  zdiffstore(memory),
+		"ZINTERCARD":  zintercard(memory),
+		"ZPOPMIN":     zpopmin(memory),
+		"ZPOPMAX":     zpopmax(memory),
+		"ZMPOP":       zmpop(memory),
+		"BZPOPMIN":    bzpopmin(memory),
+		"BZPOPMAX":    bzpopmax(memory),
+		"BZMPOP":      bzmpop(memory),
+
+		// hyperloglog
+		"PFADD":   pfadd(memory),
+		"PFCOUNT": pfcount(memory),
+		"PFMERGE": pfmerge(memory),
+
+		// geospatial
+		"GEOADD":         geoadd(memory),
+		"GEODIST":        geodist(memory),
+		"GEOPOS":         geopos(memory),
+		"GEOHASH":        geohash(memory),
+		"GEOSEARCH":      geosearch(memory),
+		"GEOSEARCHSTORE": geosearchstore(memory),
+
+		// lists
+		"LPUSH":  lpush(memory),
+		"RPUSH":  rpush(memory),
+		"LRANGE": lrange(memory),
+		"LLEN":   llen(memory),
+
+		// sort
+		"SORT":    sortCmd(memory),
+		"SORT_RO": sortRo(memory),
+
+		// json
+		"JSON.SET":       jsonSet(memory),
+		"JSON.GET":       jsonGet(memory),
+		"JSON.MGET":      jsonMget(memory),
+		"JSON.DEL":       jsonDel(memory),
+		"JSON.FORGET":    jsonDel(memory),
+		"JSON.TYPE":      jsonType(memory),
+		"JSON.STRLEN":    jsonStrlen(memory),
+		"JSON.ARRAPPEND": jsonArrappend(memory),
+		"JSON.ARRINDEX":  jsonArrindex(memory),
+		"JSON.ARRINSERT": jsonArrinsert(memory),
+		"JSON.ARRLEN":    jsonArrlen(memory),
+		"JSON.ARRPOP":    jsonArrpop(memory),
+		"JSON.ARRTRIM":   jsonArrtrim(memory),
+		"JSON.NUMINCRBY": jsonNumincrby(memory),
+
+		// bloom filters
+		"BF.RESERVE":   bfReserve(memory),
+		"BF.ADD":       bfAdd(memory),
+		"BF.MADD":      bfMadd(memory),
+		"BF.EXISTS":    bfExists(memory),
+		"BF.MEXISTS":   bfMexists(memory),
+		"BF.CARD":      bfCard(memory),
+		"BF.INFO":      bfInfo(memory),
+		"BF.SCANDUMP":  bfScandump(memory),
+		"BF.LOADCHUNK": bfLoadchunk(memory),
+
+		// cuckoo filters
+		"CF.RESERVE": cfReserve(memory),
+		"CF.ADD":     cfAdd(memory),
+		"CF.ADDNX":   cfAddnx(memory),
+		"CF.EXISTS":  cfExists(memory),
+		"CF.MEXISTS": cfMexists(memory),
+		"CF.COUNT":   cfCount(memory),
+		"CF.DEL":     cfDel(memory),
+		"CF.INFO":    cfInfo(memory),
+
+		// count-min sketch
+		"CMS.INITBYDIM":  cmsInitbydim(memory),
+		"CMS.INITBYPROB": cmsInitbyprob(memory),
+		"CMS.INCRBY":     cmsIncrby(memory),
+		"CMS.QUERY":      cmsQuery(memory),
+		"CMS.MERGE":      cmsMerge(memory),
+		"CMS.INFO":       cmsInfo(memory),
+
+		// top-k
+		"TOPK.RESERVE": topkReserve(memory),
+		"TOPK.ADD":     topkAdd(memory),
+		"TOPK.INCRBY":  topkIncrby(memory),
+		"TOPK.QUERY":   topkQuery(memory),
+		"TOPK.LIST":    topkList(memory),
+		"TOPK.INFO":    topkInfo(memory),
+
+		// time series
+		"TS.CREATE":     tsCreate(memory),
+		"TS.ADD":        tsAdd(memory),
+		"TS.MADD":       tsMadd(memory),
+		"TS.INCRBY":     tsIncrby(memory),
+		"TS.DECRBY":     tsDecrby(memory),
+		"TS.GET":        tsGet(memory),
+		"TS.RANGE":      tsRange(memory),
+		"TS.REVRANGE":   tsRevrange(memory),
+		"TS.MRANGE":     tsMrange(memory),
+		"TS.MREVRANGE":  tsMrevrange(memory),
+		"TS.CREATERULE": tsCreaterule(memory),
+		"TS.DELETERULE": tsDeleterule(memory),
+		"TS.INFO":       tsInfo(memory),
+
+		// search
+		"FT.CREATE":    ftCreate(memory, search),
+		"FT.SEARCH":    ftSearch(memory, search),
+		"FT.AGGREGATE": ftAggregate(memory, search),
+		"FT.INFO":      ftInfo(search),
+		"FT.DROPINDEX": ftDropindex(memory, search),
+		"FT._LIST":     ftList(search),
+
+		// vector sets
+		"VADD":     vadd(memory),
+		"VSIM":     vsim(memory),
+		"VREM":     vrem(memory),
+		"VCARD":    vcard(memory),
+		"VDIM":     vdim(memory),
+		"VEMB":     vemb(memory),
+		"VSETATTR": vsetattr(memory),
+		"VGETATTR": vgetattr(memory),
 	}
 }
 
 func ping() Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		return &RESP{
 			Type: SimpleString,
 			Data: []byte("PONG"),
@@ -102,7 +322,7 @@ func ping() Executor {
 }
 
 func echo() Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		if len(resp.Nested) < 2 {
 			return nil, fmt.Errorf("ECHO command error: input insufficient")
 		}
@@ -114,7 +334,7 @@ func echo() Executor {
 }
 
 func set(memory *Memory) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		if len(resp.Nested) < 3 {
 			return nil, fmt.Errorf("insufficient arguments for SET")
 		}
@@ -154,7 +374,7 @@ func set(memory *Memory) Executor {
 }
 
 func get(memory *Memory) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		if len(resp.Nested) < 2 {
 			return nil, fmt.Errorf("insufficient arguments for GET")
 		}
@@ -162,6 +382,9 @@ func get(memory *Memory) Executor {
 		key := string(argKey.Data)
 
 		val := memory.Get(key)
+		if val.Type != "none" && val.Type != "string" {
+			return SimpleErrorResp(WrongTypeErr), nil
+		}
 
 		return &RESP{
 			Type: BulkString,
@@ -171,7 +394,7 @@ func get(memory *Memory) Executor {
 }
 
 func info() Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		v := reflect.ValueOf(ReplicationServerInfo)
 		t := reflect.TypeOf(ReplicationServerInfo)
 		replInfo := ""
@@ -188,7 +411,7 @@ func info() Executor {
 }
 
 func replConf() Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		return &RESP{
 			Type: SimpleString,
 			Data: []byte("OK"),
@@ -197,7 +420,7 @@ func replConf() Executor {
 }
 
 func psync() Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		return &RESP{
 			Type: SimpleString,
 			Data: []byte(fmt.Sprintf("+FULLRESYNC %v %v", ReplicationServerInfo.MasterReplid, ReplicationServerInfo.MasterReplOffset)),
@@ -206,7 +429,7 @@ func psync() Executor {
 }
 
 func typeCmd(memory *Memory) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		if len(resp.Nested) < 2 {
 			return nil, fmt.Errorf("insufficient arguments for GET")
 		}
@@ -221,264 +444,8 @@ func typeCmd(memory *Memory) Executor {
 	}
 }
 
-func xadd(memory *Memory) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
-		if len(resp.Nested) < 3 {
-			return nil, fmt.Errorf("insufficient arguments for XADD")
-		}
-		argStreamKey := resp.Nested[1]
-		key := string(argStreamKey.Data)
-		entry := memory.Get(key)
-
-		if entry.Type == "none" {
-			var newEntry StreamEntry = make(map[string]map[string]string)
-			entry = &Entry{
-				Type:  "stream",
-				Value: newEntry,
-			}
-		}
-
-		stream := (entry.Value).(StreamEntry)
-		id := string(resp.Nested[2].Data)
-
-		if id == "*" || id[len(id)-1] == '*' {
-			id = GenerateNextSeq(stream, id)
-		} else {
-			err := ValidateStreamId(stream, id)
-			if err != nil {
-				return &RESP{
-					Type: SimpleError,
-					Data: []byte(err.Error()),
-				}, nil
-			}
-		}
-
-		stream[id] = make(map[string]string)
-
-		for i := 3; i < len(resp.Nested); i += 2 {
-			key, value := string(resp.Nested[i].Data), string(resp.Nested[i+1].Data)
-			stream[id][key] = value
-		}
-
-		memory.Put(key, *entry, Option{})
-
-		return &RESP{
-			Type: BulkString,
-			Data: []byte(id),
-		}, nil
-	}
-}
-
-func xrange(memory *Memory) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
-		if len(resp.Nested) < 4 {
-			return nil, fmt.Errorf("insufficient arguments for XRANGE")
-		}
-
-		argStreamKey := resp.Nested[1]
-		key := string(argStreamKey.Data)
-
-		entry := memory.Get(key)
-
-		if entry.Type == "none" {
-			return nil, fmt.Errorf("stream with key %v not found", key)
-		}
-
-		startArg, endArg := resp.Nested[2], resp.Nested[3]
-		start, end := string(startArg.Data), string(endArg.Data)
-
-		result := &RESP{
-			Type:   Arrays,
-			Nested: make([]*RESP, 0),
-		}
-		stream := (entry.Value).(StreamEntry)
-		keyRange := QueryStreamKeysByRange(stream, start, end, true)
-
-		for _, key := range keyRange {
-			// for the item key
-			itemKeyResp := &RESP{
-				Type: BulkString,
-				Data: []byte(key),
-			}
-			itemValueResp := &RESP{
-				Type:   Arrays,
-				Nested: make([]*RESP, 0),
-			}
-
-			// for the item values
-			item := stream[key]
-			for k, v := range item {
-				keyResp := &RESP{
-					Type: BulkString,
-					Data: []byte(k),
-				}
-				valueResp := &RESP{
-					Type: BulkString,
-					Data: []byte(v),
-				}
-				itemValueResp.Nested = append(itemValueResp.Nested, keyResp, valueResp)
-			}
-
-			itemResp := &RESP{
-				Type: Arrays,
-				Nested: []*RESP{
-					itemKeyResp,
-					itemValueResp,
-				},
-			}
-			result.Nested = append(result.Nested, itemResp)
-		}
-
-		return result, nil
-	}
-}
-
-func xread(memory *Memory) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
-		if len(resp.Nested) < 4 {
-			return nil, fmt.Errorf("insufficient arguments for XREAD")
-		}
-
-		// process options
-		isBlocking, blockingTime := false, 0
-		i := 1
-		for i < len(resp.Nested) {
-			if string(resp.Nested[i].Data) == "streams" {
-				i += 1
-				break
-			}
-			if string(resp.Nested[i].Data) == "block" {
-				isBlocking = true
-				blockingTime, _ = strconv.Atoi(string(resp.Nested[i+1].Data))
-				i += 2
-				continue
-			}
-			i += 1
-		}
-
-		streams := make(map[string]string)
-		numStream := int((len(resp.Nested) - i) / 2)
-
-		for j := i; j < len(resp.Nested)-numStream; j++ {
-			streams[string(resp.Nested[j].Data)] = string(resp.Nested[j+numStream].Data)
-		}
-
-		if isBlocking {
-			if blockingTime > 0 {
-				<-time.After(time.Duration(blockingTime) * time.Millisecond)
-			} else {
-				// block until there is update from the querying streams
-				waitCtx, cancel := context.WithCancel(context.Background())
-				updated, check := make(chan bool, 10), make(chan bool, 10)
-				for streamId := range streams {
-					entry := memory.Get(streamId)
-					stream := (entry.Value).(StreamEntry)
-
-					// for each stream, continuing check if there is any updates
-					go func(ctx context.Context, stream StreamEntry, check chan bool, updated chan bool, oldLen int) {
-						for {
-							select {
-							case <-ctx.Done():
-								return
-							case <-time.After(time.Duration(10) * time.Millisecond):
-								check <- true
-							case <-check:
-								if len(stream) > oldLen {
-									updated <- true
-								}
-							}
-						}
-					}(waitCtx, stream, check, updated, len(stream))
-				}
-
-				// wait until there is any update signal
-				<-updated
-				// cancel all the goroutine
-				cancel()
-			}
-		}
-
-		output := &RESP{
-			Type:   Arrays,
-			Nested: make([]*RESP, 0),
-		}
-
-		// build output
-		for streamId, boundId := range streams {
-			entry := memory.Get(streamId)
-			stream := (entry.Value).(StreamEntry)
-			keyRange := QueryStreamKeysByRange(stream, boundId, "+", false)
-
-			streamItemResp := &RESP{
-				Type:   Arrays,
-				Nested: make([]*RESP, 0),
-			}
-
-			// for every item in stream
-			for _, key := range keyRange {
-				// for the item key
-				itemKeyResp := &RESP{
-					Type: BulkString,
-					Data: []byte(key),
-				}
-				itemValueResp := &RESP{
-					Type:   Arrays,
-					Nested: make([]*RESP, 0),
-				}
-
-				// for the item values
-				item := stream[key]
-				for k, v := range item {
-					keyResp := &RESP{
-						Type: BulkString,
-						Data: []byte(k),
-					}
-					valueResp := &RESP{
-						Type: BulkString,
-						Data: []byte(v),
-					}
-					itemValueResp.Nested = append(itemValueResp.Nested, keyResp, valueResp)
-				}
-
-				streamItemResp.Nested = append(streamItemResp.Nested, &RESP{
-					Type: Arrays,
-					Nested: []*RESP{
-						itemKeyResp,
-						itemValueResp,
-					},
-				})
-			}
-
-			// build output
-			streamIdResp := &RESP{
-				Type: BulkString,
-				Data: []byte(streamId),
-			}
-			streamQueryResp := &RESP{
-				Type: Arrays,
-				Nested: []*RESP{
-					streamIdResp,
-					streamItemResp,
-				},
-			}
-			if len(streamItemResp.Nested) > 0 {
-				output.Nested = append(output.Nested, streamQueryResp)
-			}
-		}
-
-		if len(output.Nested) == 0 {
-			return &RESP{
-				Type: BulkString,
-				Data: []byte(""),
-			}, nil
-		}
-
-		return output, nil
-	}
-}
-
 func incr(memory *Memory) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		if len(resp.Nested) < 2 {
 			return nil, fmt.Errorf("insufficient arguments for INCR")
 		}
@@ -497,6 +464,9 @@ func incr(memory *Memory) Executor {
 				Data: []byte(newNumStr),
 			}, nil
 		}
+		if entry.Type != "string" {
+			return SimpleErrorResp(WrongTypeErr), nil
+		}
 
 		num, err := strconv.ParseInt((entry.Value).(string), 10, 64)
 		if err != nil {
@@ -519,10 +489,12 @@ func incr(memory *Memory) Executor {
 	}
 }
 
-func multi(transaction *Transaction) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
-		txId := ctx.Value("txId").(string)
-		transaction.Start(txId)
+func multi() Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if client.IsExisted() {
+			return SimpleErrorResp("ERR MULTI calls can not be nested"), nil
+		}
+		client.Multi()
 
 		return &RESP{
 			Type: SimpleString,
@@ -531,25 +503,34 @@ func multi(transaction *Transaction) Executor {
 	}
 }
 
-func exec(processor *Processor, transaction *Transaction) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
-		txId := ctx.Value("txId").(string)
-
+func exec(processor *Processor, memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		// exec nil transaction
-		if !transaction.IsExisted(txId) {
+		if !client.IsExisted() {
 			return &RESP{
 				Type: SimpleError,
 				Data: []byte("ERR EXEC without MULTI"),
 			}, nil
 		}
 
-		// inactive transaction
-		defer transaction.Inactive(txId)
+		// inactive transaction, keys are watched for one transaction only
+		defer client.Discard()
+		defer client.Unwatch()
 
-		transaction.ChangeTxStatus(txId, TxExecuting)
+		// a queued command was rejected, nothing is executed
+		if client.Has(ClientDirtyExec) {
+			return SimpleErrorResp("EXECABORT Transaction discarded because of previous errors."), nil
+		}
+
+		// a watched key changed, nothing is executed
+		if client.IsDirty(memory) {
+			return NullArrayResp(), nil
+		}
+
+		client.ChangeTxStatus(TxExecuting)
 
 		// current transaction unit
-		txUnit := transaction.GetTx(txId)
+		txUnit := client.GetTx()
 
 		// empty transaction
 		if len(txUnit.Queued) == 0 {
@@ -559,11 +540,16 @@ func exec(processor *Processor, transaction *Transaction) Executor {
 			}, nil
 		}
 
-		// TODO: executing the queued commands
 		txResult := make([]*RESP, 0)
 
+		// the lock is held for the whole queue, so that no other client sees
+		// the transaction half done, and queued commands never block
 		for _, cmd := range txUnit.Queued {
-			cmdOutput, _ := processor.Accept(ctx, cmd)
+			cmdOutput, err := processor.accept(client, cmd)
+			if err != nil {
+				txResult = append(txResult, SimpleErrorResp(fmt.Sprintf("ERR %v", err)))
+				continue
+			}
 			cmdResp, _ := processor.parser.Deserialize(cmdOutput)
 			txResult = append(txResult, cmdResp)
 		}
@@ -575,12 +561,10 @@ func exec(processor *Processor, transaction *Transaction) Executor {
 	}
 }
 
-func discard(transaction *Transaction) Executor {
-	return func(ctx context.Context, resp *RESP) (*RESP, error) {
-		txId := ctx.Value("txId").(string)
-
+func discard() Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
 		// exec nil transaction
-		if !transaction.IsExisted(txId) {
+		if !client.IsExisted() {
 			return &RESP{
 				Type: SimpleError,
 				Data: []byte("ERR DISCARD without MULTI"),
@@ -588,7 +572,8 @@ func discard(transaction *Transaction) Executor {
 		}
 
 		// inactive transaction
-		transaction.Inactive(txId)
+		client.Discard()
+		client.Unwatch()
 
 		return &RESP{
 			Type: SimpleString,
@@ -596,3 +581,44 @@ func discard(transaction *Transaction) Executor {
 		}, nil
 	}
 }
+
+func watch(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for WATCH")
+		}
+		if client.IsExisted() {
+			return SimpleErrorResp("ERR WATCH inside MULTI is not allowed"), nil
+		}
+
+		for _, key := range resp.Nested[1:] {
+			client.Watch(string(key.Data), memory.Version(string(key.Data)))
+		}
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+func unwatch() Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		client.Unwatch()
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+// flushall deletes every key, the ASYNC and SYNC modes are accepted and
+// both flush synchronously
+func flushall(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) > 2 {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		if len(resp.Nested) == 2 {
+			mode := strings.ToUpper(string(resp.Nested[1].Data))
+			if mode != "ASYNC" && mode != "SYNC" {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+		memory.Flush()
+		return SimpleStringResp("OK"), nil
+	}
+}
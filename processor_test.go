@@ -1,8 +1,9 @@
 package main
 
 import (
-	"context"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestProcessor_Accept(t *testing.T) {
@@ -38,13 +39,12 @@ func TestProcessor_Accept(t *testing.T) {
 		},
 	}
 
-	txContext := context.WithValue(context.Background(), "txId", "id")
 	respParser := NewRESP()
 	memory := NewMemory()
-	transaction := NewTransaction()
-	processor := NewProcessor(respParser, memory, transaction)
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
 	for _, tt := range testcases {
-		output, err := processor.Accept(txContext, []byte(tt.args))
+		output, err := processor.Accept(client, []byte(tt.args))
 		if err != nil {
 			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
 		}
@@ -53,3 +53,202 @@ func TestProcessor_Accept(t *testing.T) {
 		}
 	}
 }
+
+func TestProcessor_Watch(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+
+	// steps of two connections, a watching keys and b writing them
+	testcases := []struct {
+		name     string
+		conn     string
+		args     []string
+		expected string
+	}{
+		{name: "set", conn: "a", args: []string{"SET", "k", "1"}, expected: "+OK\r\n"},
+		{name: "watch", conn: "a", args: []string{"WATCH", "k"}, expected: "+OK\r\n"},
+		{name: "write watched key", conn: "b", args: []string{"SET", "k", "2"}, expected: "+OK\r\n"},
+		{name: "multi", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "watch inside multi", conn: "a", args: []string{"WATCH", "k"}, expected: "-ERR WATCH inside MULTI is not allowed\r\n"},
+		{name: "queue", conn: "a", args: []string{"SET", "k", "3"}, expected: "+QUEUED\r\n"},
+		{name: "exec aborted", conn: "a", args: []string{"EXEC"}, expected: "*-1\r\n"},
+		{name: "get after abort", conn: "a", args: []string{"GET", "k"}, expected: "$1\r\n2\r\n"},
+
+		{name: "exec clears watched keys", conn: "a", args: []string{"WATCH", "k"}, expected: "+OK\r\n"},
+		{name: "multi untouched", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "queue incr", conn: "a", args: []string{"INCR", "k"}, expected: "+QUEUED\r\n"},
+		{name: "exec untouched", conn: "a", args: []string{"EXEC"}, expected: "*1\r\n:3\r\n"},
+		{name: "write after exec", conn: "b", args: []string{"SET", "k", "4"}, expected: "+OK\r\n"},
+		{name: "multi after exec", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "exec no longer watching", conn: "a", args: []string{"EXEC"}, expected: "*0\r\n"},
+
+		{name: "watch then unwatch", conn: "a", args: []string{"WATCH", "k"}, expected: "+OK\r\n"},
+		{name: "unwatch", conn: "a", args: []string{"UNWATCH"}, expected: "+OK\r\n"},
+		{name: "write after unwatch", conn: "b", args: []string{"SET", "k", "5"}, expected: "+OK\r\n"},
+		{name: "multi after unwatch", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "queue get", conn: "a", args: []string{"GET", "k"}, expected: "+QUEUED\r\n"},
+		{name: "exec after unwatch", conn: "a", args: []string{"EXEC"}, expected: "*1\r\n$1\r\n5\r\n"},
+
+		{name: "watch missing key", conn: "a", args: []string{"WATCH", "missing"}, expected: "+OK\r\n"},
+		{name: "create watched key", conn: "b", args: []string{"SET", "missing", "1"}, expected: "+OK\r\n"},
+		{name: "multi created", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "exec created", conn: "a", args: []string{"EXEC"}, expected: "*-1\r\n"},
+
+		{name: "watch before flush", conn: "a", args: []string{"WATCH", "k"}, expected: "+OK\r\n"},
+		{name: "flushall", conn: "b", args: []string{"FLUSHALL"}, expected: "+OK\r\n"},
+		{name: "multi flushed", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "exec flushed", conn: "a", args: []string{"EXEC"}, expected: "*-1\r\n"},
+		{name: "get flushed", conn: "a", args: []string{"GET", "k"}, expected: "$-1\r\n"},
+
+		{name: "watch missing before add and delete", conn: "a", args: []string{"WATCH", "gone"}, expected: "+OK\r\n"},
+		{name: "add watched missing key", conn: "b", args: []string{"SADD", "gone", "x"}, expected: ":1\r\n"},
+		{name: "delete watched missing key", conn: "b", args: []string{"SREM", "gone", "x"}, expected: ":1\r\n"},
+		{name: "multi add and delete", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "exec add and delete", conn: "a", args: []string{"EXEC"}, expected: "*-1\r\n"},
+
+		{name: "watch missing before set and flush", conn: "a", args: []string{"WATCH", "gone"}, expected: "+OK\r\n"},
+		{name: "set watched key again", conn: "b", args: []string{"SET", "gone", "1"}, expected: "+OK\r\n"},
+		{name: "flushall watched key", conn: "b", args: []string{"FLUSHALL"}, expected: "+OK\r\n"},
+		{name: "multi set and flush", conn: "a", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "exec set and flush", conn: "a", args: []string{"EXEC"}, expected: "*-1\r\n"},
+	}
+
+	clients := map[string]*Client{"a": processor.Connect("a"), "b": processor.Connect("b")}
+	for _, tt := range testcases {
+		output, err := processor.Accept(clients[tt.conn], respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+
+	// a watched key expiring aborts the transaction too
+	accept := func(args ...string) string {
+		output, _ := processor.Accept(clients["a"], respParser.Serialize(BulkStringArrayResp(args)))
+		return string(output)
+	}
+	accept("SET", "e", "v", "px", "10")
+	accept("WATCH", "e")
+	time.Sleep(50 * time.Millisecond)
+	accept("MULTI")
+	if output := accept("EXEC"); output != "*-1\r\n" {
+		t.Errorf("exec after expiry - actual: %q", output)
+	}
+}
+
+func TestProcessor_ExecIsolation(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	clients := map[string]*Client{"reader": processor.Connect("reader"), "writer": processor.Connect("writer")}
+	accept := func(conn string, args ...string) string {
+		output, _ := processor.Accept(clients[conn], respParser.Serialize(BulkStringArrayResp(args)))
+		return string(output)
+	}
+
+	// transactions always increment twice, readers never see an odd value
+	accept("reader", "SET", "c", "0")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			accept("writer", "MULTI")
+			accept("writer", "INCR", "c")
+			accept("writer", "INCR", "c")
+			accept("writer", "EXEC")
+		}
+	}()
+	reading := true
+	for reading {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		output := accept("reader", "GET", "c")
+		resp, err := respParser.Deserialize([]byte(output))
+		if err != nil {
+			t.Fatalf("unexpected reply: %q", output)
+		}
+		if value, _ := strconv.Atoi(string(resp.Data)); value%2 != 0 {
+			t.Fatalf("transaction observed half done: %v", value)
+		}
+	}
+	if output := accept("reader", "GET", "c"); output != "$3\r\n400\r\n" {
+		t.Errorf("final value - actual: %q", output)
+	}
+
+	// blocking commands queued in a transaction do not wait
+	accept("writer", "MULTI")
+	accept("writer", "XREAD", "BLOCK", "0", "STREAMS", "s", "$")
+	accept("writer", "BZPOPMIN", "z", "0")
+	result := make(chan string)
+	go func() {
+		result <- accept("writer", "EXEC")
+	}()
+	select {
+	case output := <-result:
+		if output != "*2\r\n*-1\r\n*-1\r\n" {
+			t.Errorf("exec of blocking commands - actual: %q", output)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("EXEC blocked on a queued blocking command")
+	}
+	if output := accept("reader", "PING"); output != "+PONG\r\n" {
+		t.Errorf("ping after exec - actual: %q", output)
+	}
+}
+
+func TestProcessor_CommandArity(t *testing.T) {
+	processor := NewProcessor(NewRESP(), NewMemory())
+	for name := range processor.executors {
+		if _, ok := commandArity[name]; !ok {
+			t.Errorf("command %v has no arity", name)
+		}
+	}
+	for name := range commandArity {
+		if _, ok := processor.executors[name]; !ok {
+			t.Errorf("arity of unknown command %v", name)
+		}
+	}
+}
+
+func TestProcessor_MultiErrors(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "unknown command", args: []string{"NOPE", "a", "b"}, expected: "-ERR unknown command 'NOPE', with args beginning with: 'a' 'b' \r\n"},
+		{name: "wrong arity", args: []string{"GET", "a", "b"}, expected: "-ERR wrong number of arguments for 'get' command\r\n"},
+		{name: "multi", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "nested multi", args: []string{"MULTI"}, expected: "-ERR MULTI calls can not be nested\r\n"},
+		{name: "queue set", args: []string{"SET", "k", "v"}, expected: "+QUEUED\r\n"},
+		{name: "queue runtime error", args: []string{"INCR", "k"}, expected: "+QUEUED\r\n"},
+		{name: "queue get", args: []string{"GET", "k"}, expected: "+QUEUED\r\n"},
+		{name: "exec with runtime error", args: []string{"EXEC"}, expected: "*3\r\n+OK\r\n-ERR value is not an integer or out of range\r\n$1\r\nv\r\n"},
+		{name: "multi aborted", args: []string{"MULTI"}, expected: "+OK\r\n"},
+		{name: "queue before error", args: []string{"SET", "k", "w"}, expected: "+QUEUED\r\n"},
+		{name: "queue wrong arity", args: []string{"SET", "k"}, expected: "-ERR wrong number of arguments for 'set' command\r\n"},
+		{name: "queue unknown command", args: []string{"NOPE"}, expected: "-ERR unknown command 'NOPE', with args beginning with: \r\n"},
+		{name: "exec aborted", args: []string{"EXEC"}, expected: "-EXECABORT Transaction discarded because of previous errors.\r\n"},
+		{name: "nothing executed", args: []string{"GET", "k"}, expected: "$1\r\nv\r\n"},
+		{name: "exec after abort", args: []string{"EXEC"}, expected: "-ERR EXEC without MULTI\r\n"},
+	}
+
+	processor := NewProcessor(respParser, NewMemory())
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+// raxNode is a node of a compressed radix tree, prefix is the label of the
+// edge from the parent and children are ordered by their first byte
+type raxNode struct {
+	prefix   []byte
+	children []*raxNode
+	isKey    bool
+	value    any
+}
+
+// Rax is an ordered map of byte string keys, keys sharing a prefix share
+// the nodes of the prefix. Lookups and seeks walk at most one node per byte
+// of the key whatever the number of keys.
+type Rax struct {
+	root *raxNode
+	size int
+}
+
+func NewRax() *Rax {
+	return &Rax{root: &raxNode{}}
+}
+
+func (t *Rax) Len() int {
+	return t.size
+}
+
+// Nodes counts the nodes of the tree, the root included
+func (t *Rax) Nodes() int {
+	var count func(n *raxNode) int
+	count = func(n *raxNode) int {
+		total := 1
+		for _, child := range n.children {
+			total += count(child)
+		}
+		return total
+	}
+	return count(t.root)
+}
+
+func (n *raxNode) childIndex(b byte) int {
+	return sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= b
+	})
+}
+
+func commonPrefixLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// Insert sets the value of the key, it returns true when the key is new
+func (t *Rax) Insert(key []byte, value any) bool {
+	n, rest := t.root, key
+	for {
+		if len(rest) == 0 {
+			added := !n.isKey
+			n.isKey, n.value = true, value
+			if added {
+				t.size++
+			}
+			return added
+		}
+
+		i := n.childIndex(rest[0])
+		if i == len(n.children) || n.children[i].prefix[0] != rest[0] {
+			leaf := &raxNode{prefix: append([]byte{}, rest...), isKey: true, value: value}
+			n.children = append(n.children, nil)
+			copy(n.children[i+1:], n.children[i:])
+			n.children[i] = leaf
+			t.size++
+			return true
+		}
+
+		child := n.children[i]
+		common := commonPrefixLen(child.prefix, rest)
+		if common < len(child.prefix) {
+			// split the edge where the key diverges
+			split := &raxNode{prefix: append([]byte{}, child.prefix[:common]...), children: []*raxNode{child}}
+			child.prefix = append([]byte{}, child.prefix[common:]...)
+			n.children[i] = split
+			child = split
+		}
+		n, rest = child, rest[common:]
+	}
+}
+
+func (t *Rax) Find(key []byte) (any, bool) {
+	n, rest := t.root, key
+	for len(rest) > 0 {
+		i := n.childIndex(rest[0])
+		if i == len(n.children) || !bytes.HasPrefix(rest, n.children[i].prefix) {
+			return nil, false
+		}
+		n, rest = n.children[i], rest[len(n.children[i].prefix):]
+	}
+	if !n.isKey {
+		return nil, false
+	}
+	return n.value, true
+}
+
+// Remove deletes the key and merges the nodes left with a single child
+func (t *Rax) Remove(key []byte) bool {
+	path := []*raxNode{t.root}
+	n, rest := t.root, key
+	for len(rest) > 0 {
+		i := n.childIndex(rest[0])
+		if i == len(n.children) || !bytes.HasPrefix(rest, n.children[i].prefix) {
+			return false
+		}
+		n, rest = n.children[i], rest[len(n.children[i].prefix):]
+		path = append(path, n)
+	}
+	if !n.isKey {
+		return false
+	}
+	n.isKey, n.value = false, nil
+	t.size--
+
+	for depth := len(path) - 1; depth > 0; depth-- {
+		node, parent := path[depth], path[depth-1]
+		if node.isKey {
+			break
+		}
+		if len(node.children) == 0 {
+			i := parent.childIndex(node.prefix[0])
+			parent.children = append(parent.children[:i], parent.children[i+1:]...)
+			continue
+		}
+		if len(node.children) == 1 {
+			child := node.children[0]
+			node.prefix = append(node.prefix, child.prefix...)
+			node.children, node.isKey, node.value = child.children, child.isKey, child.value
+		}
+		break
+	}
+	return true
+}
+
+func (n *raxNode) first(path []byte) ([]byte, any, bool) {
+	for !n.isKey {
+		if len(n.children) == 0 {
+			return nil, nil, false
+		}
+		n = n.children[0]
+		path = append(path, n.prefix...)
+	}
+	return path, n.value, true
+}
+
+func (n *raxNode) last(path []byte) ([]byte, any, bool) {
+	for len(n.children) > 0 {
+		n = n.children[len(n.children)-1]
+		path = append(path, n.prefix...)
+	}
+	if !n.isKey {
+		return nil, nil, false
+	}
+	return path, n.value, true
+}
+
+// seekGE finds the smallest key of the subtree greater than path+rest, or
+// equal unless strict, path being the key of n
+func (n *raxNode) seekGE(path, rest []byte, strict bool) ([]byte, any, bool) {
+	if len(rest) == 0 {
+		if n.isKey && !strict {
+			return path, n.value, true
+		}
+		for _, child := range n.children {
+			if key, value, ok := child.first(append(append([]byte{}, path...), child.prefix...)); ok {
+				return key, value, true
+			}
+		}
+		return nil, nil, false
+	}
+	for _, child := range n.children {
+		l := min(len(child.prefix), len(rest))
+		cmp := bytes.Compare(child.prefix[:l], rest[:l])
+		if cmp < 0 {
+			continue
+		}
+		childPath := append(append([]byte{}, path...), child.prefix...)
+		if cmp > 0 || len(child.prefix) > len(rest) {
+			return child.first(childPath)
+		}
+		if key, value, ok := child.seekGE(childPath, rest[l:], strict); ok {
+			return key, value, true
+		}
+	}
+	return nil, nil, false
+}
+
+// seekLE finds the greatest key of the subtree less than path+rest, or
+// equal unless strict, path being the key of n
+func (n *raxNode) seekLE(path, rest []byte, strict bool) ([]byte, any, bool) {
+	if len(rest) == 0 {
+		if n.isKey && !strict {
+			return path, n.value, true
+		}
+		return nil, nil, false
+	}
+	for i := len(n.children) - 1; i >= 0; i-- {
+		child := n.children[i]
+		l := min(len(child.prefix), len(rest))
+		cmp := bytes.Compare(child.prefix[:l], rest[:l])
+		if cmp > 0 || (cmp == 0 && len(child.prefix) > len(rest)) {
+			continue
+		}
+		childPath := append(append([]byte{}, path...), child.prefix...)
+		if cmp < 0 {
+			return child.last(childPath)
+		}
+		if key, value, ok := child.seekLE(childPath, rest[l:], strict); ok {
+			return key, value, true
+		}
+	}
+	// n is a prefix of the key, so smaller
+	if n.isKey {
+		return path, n.value, true
+	}
+	return nil, nil, false
+}
+
+func (t *Rax) First() ([]byte, any, bool) {
+	return t.root.first([]byte{})
+}
+
+func (t *Rax) Last() ([]byte, any, bool) {
+	return t.root.last([]byte{})
+}
+
+// SeekGE returns the first key greater than or equal to the key
+func (t *Rax) SeekGE(key []byte) ([]byte, any, bool) {
+	return t.root.seekGE([]byte{}, key, false)
+}
+
+// SeekLE returns the last key less than or equal to the key
+func (t *Rax) SeekLE(key []byte) ([]byte, any, bool) {
+	return t.root.seekLE([]byte{}, key, false)
+}
+
+// Next returns the first key strictly greater than the key
+func (t *Rax) Next(key []byte) ([]byte, any, bool) {
+	return t.root.seekGE([]byte{}, key, true)
+}
+
+// Prev returns the last key strictly less than the key
+func (t *Rax) Prev(key []byte) ([]byte, any, bool) {
+	return t.root.seekLE([]byte{}, key, true)
+}
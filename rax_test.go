@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestRax_MatchesSortedKeys(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := NewRax()
+	present := make(map[string]bool)
+	randomKey := func() []byte {
+		// short keys over few bytes so that prefixes are shared a lot
+		key := make([]byte, r.Intn(4))
+		for i := range key {
+			key[i] = byte(r.Intn(3))
+		}
+		return key
+	}
+
+	for i := 0; i < 5000; i++ {
+		key := randomKey()
+		if r.Intn(3) == 0 {
+			if tree.Remove(key) != present[string(key)] {
+				t.Fatalf("remove %v - expected: %v", key, present[string(key)])
+			}
+			delete(present, string(key))
+		} else {
+			if tree.Insert(key, string(key)) == present[string(key)] {
+				t.Fatalf("insert %v - expected new: %v", key, !present[string(key)])
+			}
+			present[string(key)] = true
+		}
+		if tree.Len() != len(present) {
+			t.Fatalf("len - expected: %v - actual: %v", len(present), tree.Len())
+		}
+
+		sorted := make([]string, 0, len(present))
+		for k := range present {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		probe := randomKey()
+		checkSeek := func(name string, expected int, found []byte, value any, ok bool) {
+			if expected < 0 || expected >= len(sorted) {
+				if ok {
+					t.Fatalf("%v %v - expected none - actual: %v", name, probe, found)
+				}
+				return
+			}
+			if !ok || !bytes.Equal(found, []byte(sorted[expected])) || value.(string) != sorted[expected] {
+				t.Fatalf("%v %v - expected: %v - actual: %v", name, probe, []byte(sorted[expected]), found)
+			}
+		}
+		ge := sort.SearchStrings(sorted, string(probe))
+		gt := sort.Search(len(sorted), func(i int) bool { return sorted[i] > string(probe) })
+		key, value, ok := tree.SeekGE(probe)
+		checkSeek("seek ge", ge, key, value, ok)
+		key, value, ok = tree.Next(probe)
+		checkSeek("next", gt, key, value, ok)
+		key, value, ok = tree.SeekLE(probe)
+		checkSeek("seek le", gt-1, key, value, ok)
+		key, value, ok = tree.Prev(probe)
+		checkSeek("prev", ge-1, key, value, ok)
+		_, found := tree.Find(probe)
+		if found != present[string(probe)] {
+			t.Fatalf("find %v - expected: %v", probe, present[string(probe)])
+		}
+	}
+}
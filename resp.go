@@ -26,6 +26,8 @@ type RESP struct {
 	Nested []*RESP
 	Data   []byte
 	Origin []byte
+	// null array, told apart from the empty one by -1 as size
+	Null bool
 }
 
 func NewRESP() RespParser {
@@ -89,6 +91,11 @@ func (resp *RespParser) serialize_bulkString(input *RESP) []byte {
 func (resp *RespParser) serialize_arrays(input *RESP) []byte {
 	builder := make([]byte, 0)
 	builder = append(builder, byte(Arrays))
+	if input.Null {
+		builder = append(builder, []byte("-1")...)
+		builder = append(builder, CR, LF)
+		return builder
+	}
 	builder = append(builder, []byte(fmt.Sprintf("%v", len(input.Nested)))...)
 	builder = append(builder, CR, LF)
 	for _, nested := range input.Nested {
@@ -190,7 +197,16 @@ func (resp *RespParser) deserialize_bulkString(input []byte) (*RESP, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(input[read:]) < size+2 {
+	// null bulk string, without data nor trailing CRLF
+	if size == -1 {
+		return &RESP{
+			Type:   BulkString,
+			Nested: nil,
+			Data:   []byte{},
+			Origin: input[:read-2],
+		}, nil
+	}
+	if size < 0 || len(input[read:]) < size+2 {
 		return nil, fmt.Errorf("invalid format for bulk string type - size mismatched")
 	}
 	return &RESP{
@@ -211,6 +227,16 @@ func (resp *RespParser) deserialize_arrays(input []byte) (*RESP, error) {
 	if err != nil {
 		return nil, err
 	}
+	// null array, without elements
+	if size == -1 {
+		return &RESP{
+			Type:   Arrays,
+			Nested: nil,
+			Data:   []byte{},
+			Origin: input[:read-2],
+			Null:   true,
+		}, nil
+	}
 	nested := make([]*RESP, 0)
 	for size > 0 {
 		respEle, err := resp.Deserialize(input[read:])
@@ -35,6 +35,16 @@ func TestRespParser_Deserialize(t *testing.T) {
 			args:     []byte("-ERR value is not an integer or out of range\r\n"),
 			expected: SimpleError,
 		},
+		{
+			name:     "Deserialize null bulk string",
+			args:     []byte("*2\r\n$-1\r\n:1\r\n"),
+			expected: Arrays,
+		},
+		{
+			name:     "Deserialize null array",
+			args:     []byte("*2\r\n*-1\r\n:1\r\n"),
+			expected: Arrays,
+		},
 	}
 
 	respParser := NewRESP()
@@ -92,6 +102,11 @@ func TestRespParser_Serialize(t *testing.T) {
 			},
 			expected: "$17\r\nPONGPING-PINGPONG\r\n",
 		},
+		{
+			name:     "Serialize null array",
+			args:     NullArrayResp(),
+			expected: "*-1\r\n",
+		},
 	}
 
 	respParser := NewRESP()
@@ -0,0 +1,878 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type searchField struct {
+	name      string
+	typ       string
+	sortable  bool
+	separator string
+}
+
+type searchDoc struct {
+	numbers map[string]float64
+}
+
+// SearchIndex indexes the hashes whose key starts with one of the prefixes:
+// text fields in an inverted index of terms, tag fields per tag and numeric
+// fields per document
+type SearchIndex struct {
+	name     string
+	prefixes []string
+	fields   []searchField
+	docs     map[string]*searchDoc
+	// term -> key -> field -> frequency
+	terms map[string]map[string]map[string]int
+	// field -> tag -> keys
+	tags map[string]map[string]map[string]struct{}
+}
+
+// SearchEngine keeps the indexes up to date with every write to the memory
+type SearchEngine struct {
+	memory  *Memory
+	indexes map[string]*SearchIndex
+}
+
+func NewSearchEngine(memory *Memory) *SearchEngine {
+	engine := &SearchEngine{
+		memory:  memory,
+		indexes: make(map[string]*SearchIndex),
+	}
+	memory.OnKeyChange(engine.onKeyChange)
+	return engine
+}
+
+func NewSearchIndex(name string, prefixes []string, fields []searchField) *SearchIndex {
+	return &SearchIndex{
+		name:     name,
+		prefixes: prefixes,
+		fields:   fields,
+		docs:     make(map[string]*searchDoc),
+		terms:    make(map[string]map[string]map[string]int),
+		tags:     make(map[string]map[string]map[string]struct{}),
+	}
+}
+
+func (e *SearchEngine) onKeyChange(key string) {
+	for _, idx := range e.indexes {
+		e.reindex(idx, key)
+	}
+}
+
+func (e *SearchEngine) reindex(idx *SearchIndex, key string) {
+	if !idx.matches(key) {
+		return
+	}
+	idx.remove(key)
+	entry := e.memory.Get(key)
+	if entry.Type == "hash" {
+		idx.add(key, (entry.Value).(*Hash))
+	}
+}
+
+func (idx *SearchIndex) matches(key string) bool {
+	if len(idx.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range idx.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *SearchIndex) field(name string) (searchField, bool) {
+	for _, field := range idx.fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return searchField{}, false
+}
+
+func (idx *SearchIndex) add(key string, hash *Hash) {
+	doc := &searchDoc{numbers: make(map[string]float64)}
+	for _, field := range idx.fields {
+		value, ok := hash.Get(field.name)
+		if !ok {
+			continue
+		}
+		switch field.typ {
+		case "TEXT":
+			for _, term := range searchTokenize(value) {
+				if _, ok := idx.terms[term]; !ok {
+					idx.terms[term] = make(map[string]map[string]int)
+				}
+				if _, ok := idx.terms[term][key]; !ok {
+					idx.terms[term][key] = make(map[string]int)
+				}
+				idx.terms[term][key][field.name]++
+			}
+		case "NUMERIC":
+			// values that are not numbers are left out of the index
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				doc.numbers[field.name] = number
+			}
+		case "TAG":
+			if _, ok := idx.tags[field.name]; !ok {
+				idx.tags[field.name] = make(map[string]map[string]struct{})
+			}
+			for _, tag := range strings.Split(value, field.separator) {
+				tag = normalizeSearchTag(tag)
+				if tag == "" {
+					continue
+				}
+				if _, ok := idx.tags[field.name][tag]; !ok {
+					idx.tags[field.name][tag] = make(map[string]struct{})
+				}
+				idx.tags[field.name][tag][key] = struct{}{}
+			}
+		}
+	}
+	idx.docs[key] = doc
+}
+
+func (idx *SearchIndex) remove(key string) {
+	if _, ok := idx.docs[key]; !ok {
+		return
+	}
+	delete(idx.docs, key)
+	for term, postings := range idx.terms {
+		delete(postings, key)
+		if len(postings) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+	for _, tags := range idx.tags {
+		for tag, keys := range tags {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(tags, tag)
+			}
+		}
+	}
+}
+
+// score is the TF-IDF of the query terms in the document
+func (idx *SearchIndex) score(key string, terms []string) float64 {
+	score := 0.0
+	for _, term := range terms {
+		postings := idx.terms[term]
+		frequency := 0
+		for _, count := range postings[key] {
+			frequency += count
+		}
+		if frequency > 0 {
+			score += float64(frequency) * math.Log(1+float64(len(idx.docs))/float64(len(postings)))
+		}
+	}
+	return score
+}
+
+func (e *SearchEngine) getIndex(name string) (*SearchIndex, *RESP) {
+	idx, ok := e.indexes[name]
+	if !ok {
+		return nil, SimpleErrorResp("ERR Unknown index name")
+	}
+	return idx, nil
+}
+
+// parseSearchSchema parses "field type [SORTABLE] [SEPARATOR sep] ..."
+func parseSearchSchema(args []*RESP) ([]searchField, *RESP) {
+	fields := make([]searchField, 0)
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return nil, SimpleErrorResp("ERR Field `" + string(args[i].Data) + "` does not have a type")
+		}
+		field := searchField{name: string(args[i].Data), typ: strings.ToUpper(string(args[i+1].Data)), separator: ","}
+		if field.typ != "TEXT" && field.typ != "NUMERIC" && field.typ != "TAG" {
+			return nil, SimpleErrorResp(fmt.Sprintf("ERR Invalid field type for field `%v`", field.name))
+		}
+		i++
+		for i+1 < len(args) {
+			opt := strings.ToUpper(string(args[i+1].Data))
+			if opt == "SORTABLE" {
+				field.sortable = true
+				i++
+			} else if opt == "SEPARATOR" && field.typ == "TAG" && i+2 < len(args) {
+				field.separator = string(args[i+2].Data)
+				if len(field.separator) != 1 {
+					return nil, SimpleErrorResp("ERR Tag separator must be a single character")
+				}
+				i += 2
+			} else {
+				break
+			}
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, SimpleErrorResp("ERR Fields arguments are missing")
+	}
+	return fields, nil
+}
+
+// ftCreate parses "index [ON HASH] [PREFIX count prefix ...] SCHEMA field
+// type ..." and indexes the existing hashes right away
+func ftCreate(memory *Memory, engine *SearchEngine) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for FT.CREATE")
+		}
+		name := string(resp.Nested[1].Data)
+		prefixes := make([]string, 0)
+		args := resp.Nested[2:]
+		i := 0
+		for ; i < len(args); i++ {
+			opt := strings.ToUpper(string(args[i].Data))
+			if opt == "SCHEMA" {
+				break
+			}
+			switch {
+			case opt == "ON" && i+1 < len(args):
+				if strings.ToUpper(string(args[i+1].Data)) != "HASH" {
+					return SimpleErrorResp("ERR Only HASH indexes are supported"), nil
+				}
+				i++
+			case opt == "PREFIX" && i+1 < len(args):
+				count, err := strconv.Atoi(string(args[i+1].Data))
+				if err != nil || count < 0 || count >= len(args)-i-1 {
+					return SimpleErrorResp("ERR Bad arguments for PREFIX"), nil
+				}
+				for _, arg := range args[i+2 : i+2+count] {
+					prefixes = append(prefixes, string(arg.Data))
+				}
+				i += 1 + count
+			default:
+				return SimpleErrorResp(fmt.Sprintf("ERR Unknown argument `%v`", string(args[i].Data))), nil
+			}
+		}
+		if i >= len(args) {
+			return SimpleErrorResp("ERR No schema found"), nil
+		}
+		fields, errResp := parseSearchSchema(args[i+1:])
+		if errResp != nil {
+			return errResp, nil
+		}
+		if _, ok := engine.indexes[name]; ok {
+			return SimpleErrorResp("ERR Index already exists"), nil
+		}
+
+		idx := NewSearchIndex(name, prefixes, fields)
+		engine.indexes[name] = idx
+		for _, key := range memory.Keys() {
+			engine.reindex(idx, key)
+		}
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+// searchSortValue compares numeric fields as numbers and others as
+// lower case strings, documents without the field come last
+type searchSortValue struct {
+	number  float64
+	text    string
+	missing bool
+}
+
+func searchCompareValues(a, b searchSortValue, numeric bool) int {
+	switch {
+	case a.missing && b.missing:
+		return 0
+	case a.missing:
+		return 1
+	case b.missing:
+		return -1
+	}
+	if numeric {
+		switch {
+		case a.number < b.number:
+			return -1
+		case a.number > b.number:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a.text, b.text)
+}
+
+// ftSearch parses "index query [NOCONTENT] [WITHSCORES] [RETURN count field
+// ...] [SORTBY field [ASC|DESC]] [LIMIT offset num]"
+func ftSearch(memory *Memory, engine *SearchEngine) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for FT.SEARCH")
+		}
+		idx, errResp := engine.getIndex(string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		noContent, withScores := false, false
+		var returnFields []string
+		sortBy, desc := "", false
+		offset, num := 0, 10
+		args := resp.Nested[3:]
+		for i := 0; i < len(args); i++ {
+			opt := strings.ToUpper(string(args[i].Data))
+			remaining := len(args) - i - 1
+			switch {
+			case opt == "NOCONTENT":
+				noContent = true
+			case opt == "WITHSCORES":
+				withScores = true
+			case opt == "RETURN" && remaining >= 1:
+				count, err := strconv.Atoi(string(args[i+1].Data))
+				if err != nil || count < 0 || count > remaining-1 {
+					return SimpleErrorResp("ERR Bad arguments for RETURN"), nil
+				}
+				returnFields = make([]string, 0, count)
+				for _, arg := range args[i+2 : i+2+count] {
+					returnFields = append(returnFields, string(arg.Data))
+				}
+				i += 1 + count
+			case opt == "SORTBY" && remaining >= 1:
+				sortBy = string(args[i+1].Data)
+				if _, ok := idx.field(sortBy); !ok {
+					return SimpleErrorResp(fmt.Sprintf("ERR Property `%v` not loaded nor in schema", sortBy)), nil
+				}
+				i++
+				if i+1 < len(args) {
+					switch strings.ToUpper(string(args[i+1].Data)) {
+					case "ASC":
+						i++
+					case "DESC":
+						desc = true
+						i++
+					}
+				}
+			case opt == "LIMIT" && remaining >= 2:
+				var err1, err2 error
+				offset, err1 = strconv.Atoi(string(args[i+1].Data))
+				num, err2 = strconv.Atoi(string(args[i+2].Data))
+				if err1 != nil || err2 != nil || offset < 0 || num < 0 {
+					return SimpleErrorResp("ERR Bad arguments for LIMIT"), nil
+				}
+				i += 2
+			default:
+				return SimpleErrorResp(fmt.Sprintf("ERR Unknown argument `%v`", string(args[i].Data))), nil
+			}
+		}
+		if returnFields != nil && len(returnFields) == 0 {
+			noContent = true
+		}
+
+		query, terms, err := parseSearchQuery(idx, string(resp.Nested[2].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		keys := make([]string, 0)
+		for key := range query.eval(idx) {
+			keys = append(keys, key)
+		}
+		scores := make(map[string]float64, len(keys))
+		for _, key := range keys {
+			scores[key] = idx.score(key, terms)
+		}
+
+		if sortBy != "" {
+			field, _ := idx.field(sortBy)
+			values := make(map[string]searchSortValue, len(keys))
+			for _, key := range keys {
+				values[key] = searchDocSortValue(memory, idx, key, field)
+			}
+			sort.Slice(keys, func(i, j int) bool {
+				cmp := searchCompareValues(values[keys[i]], values[keys[j]], field.typ == "NUMERIC")
+				if cmp == 0 {
+					return keys[i] < keys[j]
+				}
+				// missing values stay last in both directions
+				if desc && !values[keys[i]].missing && !values[keys[j]].missing {
+					return cmp > 0
+				}
+				return cmp < 0
+			})
+		} else {
+			sort.Slice(keys, func(i, j int) bool {
+				if scores[keys[i]] != scores[keys[j]] {
+					return scores[keys[i]] > scores[keys[j]]
+				}
+				return keys[i] < keys[j]
+			})
+		}
+
+		output := ArrayResp(IntegerResp(len(keys)))
+		start := min(offset, len(keys))
+		end := start + min(num, len(keys)-start)
+		for _, key := range keys[start:end] {
+			output.Nested = append(output.Nested, BulkStringResp(key))
+			if withScores {
+				output.Nested = append(output.Nested, BulkStringResp(FormatScore(scores[key])))
+			}
+			if noContent {
+				continue
+			}
+			hash, _ := getHash(memory, key)
+			pairs := make([]string, 0)
+			if returnFields == nil {
+				pairs = hash.Pairs()
+			} else {
+				for _, name := range returnFields {
+					if value, ok := hash.Get(name); ok {
+						pairs = append(pairs, name, value)
+					}
+				}
+			}
+			output.Nested = append(output.Nested, BulkStringArrayResp(pairs))
+		}
+		return output, nil
+	}
+}
+
+func searchDocSortValue(memory *Memory, idx *SearchIndex, key string, field searchField) searchSortValue {
+	if field.typ == "NUMERIC" {
+		number, ok := idx.docs[key].numbers[field.name]
+		return searchSortValue{number: number, missing: !ok}
+	}
+	hash, _ := getHash(memory, key)
+	value, ok := hash.Get(field.name)
+	return searchSortValue{text: strings.ToLower(value), missing: !ok}
+}
+
+// searchRow is a row of the FT.AGGREGATE pipeline, values are strings or
+// lists of strings for TOLIST. key is the document of the row until rows
+// are grouped, missing fields are loaded from it when referenced.
+type searchRow struct {
+	key    string
+	names  []string
+	values map[string]any
+}
+
+func newSearchRow(key string) *searchRow {
+	return &searchRow{key: key, names: make([]string, 0), values: make(map[string]any)}
+}
+
+func (r *searchRow) set(name string, value any) {
+	if _, ok := r.values[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.values[name] = value
+}
+
+func (r *searchRow) get(memory *Memory, name string) (any, bool) {
+	if value, ok := r.values[name]; ok {
+		return value, true
+	}
+	if r.key == "" {
+		return nil, false
+	}
+	hash, _ := getHash(memory, r.key)
+	if hash == nil {
+		return nil, false
+	}
+	value, ok := hash.Get(name)
+	return value, ok
+}
+
+func (r *searchRow) resp() *RESP {
+	output := ArrayResp()
+	for _, name := range r.names {
+		output.Nested = append(output.Nested, BulkStringResp(name))
+		switch value := r.values[name].(type) {
+		case []string:
+			output.Nested = append(output.Nested, BulkStringArrayResp(value))
+		default:
+			output.Nested = append(output.Nested, BulkStringResp(value.(string)))
+		}
+	}
+	return output
+}
+
+// searchPropertyArgs reads "count @field ..." and strips the "@"
+func searchPropertyArgs(args []*RESP, i int) ([]string, int, *RESP) {
+	if i >= len(args) {
+		return nil, 0, SimpleErrorResp("ERR syntax error")
+	}
+	count, err := strconv.Atoi(string(args[i].Data))
+	if err != nil || count < 0 || count >= len(args)-i {
+		return nil, 0, SimpleErrorResp("ERR Bad arguments")
+	}
+	properties := make([]string, 0, count)
+	for _, arg := range args[i+1 : i+1+count] {
+		properties = append(properties, string(arg.Data))
+	}
+	return properties, i + count, nil
+}
+
+func stripProperty(property string) string {
+	return strings.TrimPrefix(property, "@")
+}
+
+type searchReducer struct {
+	name  string
+	args  []string
+	alias string
+}
+
+// reduce folds the rows of a group into one value
+func (r searchReducer) reduce(memory *Memory, rows []*searchRow) (any, *RESP) {
+	if r.name == "COUNT" {
+		return strconv.Itoa(len(rows)), nil
+	}
+	if len(r.args) != 1 {
+		return nil, SimpleErrorResp(fmt.Sprintf("ERR Bad arguments for %v", r.name))
+	}
+	property := stripProperty(r.args[0])
+
+	values := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if value, ok := row.get(memory, property); ok {
+			if str, ok := value.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+
+	switch r.name {
+	case "COUNT_DISTINCT", "TOLIST":
+		distinct := make([]string, 0)
+		seen := make(map[string]bool)
+		for _, value := range values {
+			if !seen[value] {
+				seen[value] = true
+				distinct = append(distinct, value)
+			}
+		}
+		if r.name == "TOLIST" {
+			return distinct, nil
+		}
+		return strconv.Itoa(len(distinct)), nil
+	case "SUM", "MIN", "MAX", "AVG":
+		sum, count := 0.0, 0
+		minValue, maxValue := math.Inf(1), math.Inf(-1)
+		for _, value := range values {
+			number, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			sum += number
+			count++
+			minValue, maxValue = math.Min(minValue, number), math.Max(maxValue, number)
+		}
+		switch r.name {
+		case "SUM":
+			return FormatScore(sum), nil
+		case "MIN":
+			return FormatScore(minValue), nil
+		case "MAX":
+			return FormatScore(maxValue), nil
+		}
+		if count == 0 {
+			return "nan", nil
+		}
+		return FormatScore(sum / float64(count)), nil
+	}
+	return nil, SimpleErrorResp(fmt.Sprintf("ERR Bad arguments for REDUCE: unknown reducer %v", r.name))
+}
+
+// searchGroupBy groups the rows by the values of the properties, groups
+// keep the order in which they first appear
+func searchGroupBy(memory *Memory, rows []*searchRow, properties []string, reducers []searchReducer) ([]*searchRow, *RESP) {
+	groups := make([][]*searchRow, 0)
+	groupRows := make([]*searchRow, 0)
+	index := make(map[string]int)
+	for _, row := range rows {
+		group := newSearchRow("")
+		parts := make([]string, 0, len(properties))
+		for _, property := range properties {
+			value, _ := row.get(memory, stripProperty(property))
+			str, _ := value.(string)
+			group.set(stripProperty(property), str)
+			parts = append(parts, str)
+		}
+		groupKey := strings.Join(parts, "\x00")
+		i, ok := index[groupKey]
+		if !ok {
+			i = len(groups)
+			index[groupKey] = i
+			groups = append(groups, nil)
+			groupRows = append(groupRows, group)
+		}
+		groups[i] = append(groups[i], row)
+	}
+
+	for i, group := range groupRows {
+		for _, reducer := range reducers {
+			value, errResp := reducer.reduce(memory, groups[i])
+			if errResp != nil {
+				return nil, errResp
+			}
+			group.set(reducer.alias, value)
+		}
+	}
+	return groupRows, nil
+}
+
+// searchSortRows sorts by "@field [ASC|DESC] ..." comparing numbers as
+// numbers and anything else as strings
+func searchSortRows(memory *Memory, rows []*searchRow, args []string) {
+	type sortKey struct {
+		property string
+		desc     bool
+	}
+	keys := make([]sortKey, 0)
+	for _, arg := range args {
+		switch strings.ToUpper(arg) {
+		case "ASC":
+			continue
+		case "DESC":
+			if len(keys) > 0 {
+				keys[len(keys)-1].desc = true
+			}
+			continue
+		}
+		keys = append(keys, sortKey{property: stripProperty(arg)})
+	}
+
+	valueOf := func(row *searchRow, property string) searchSortValue {
+		value, ok := row.get(memory, property)
+		str, isString := value.(string)
+		if !ok || !isString {
+			return searchSortValue{missing: true}
+		}
+		number, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return searchSortValue{text: str, number: math.NaN()}
+		}
+		return searchSortValue{text: str, number: number}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range keys {
+			a, b := valueOf(rows[i], key.property), valueOf(rows[j], key.property)
+			numeric := !math.IsNaN(a.number) && !math.IsNaN(b.number)
+			cmp := searchCompareValues(a, b, numeric)
+			if cmp == 0 {
+				continue
+			}
+			if key.desc && !a.missing && !b.missing {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// ftAggregate runs "index query [LOAD count field ...] [GROUPBY count
+// property ... [REDUCE function count arg ... [AS name]] ...] [SORTBY count
+// property [ASC|DESC] ... [MAX num]] [LIMIT offset num]" as a pipeline,
+// each step applied to the rows of the previous one
+func ftAggregate(memory *Memory, engine *SearchEngine) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for FT.AGGREGATE")
+		}
+		idx, errResp := engine.getIndex(string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		query, _, err := parseSearchQuery(idx, string(resp.Nested[2].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+
+		keys := make([]string, 0)
+		for key := range query.eval(idx) {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		rows := make([]*searchRow, 0, len(keys))
+		for _, key := range keys {
+			rows = append(rows, newSearchRow(key))
+		}
+
+		args := resp.Nested[3:]
+		for i := 0; i < len(args); i++ {
+			opt := strings.ToUpper(string(args[i].Data))
+			switch opt {
+			case "LOAD":
+				if i+1 < len(args) && string(args[i+1].Data) == "*" {
+					for _, row := range rows {
+						if hash, _ := getHash(memory, row.key); hash != nil {
+							pairs := hash.Pairs()
+							for j := 0; j < len(pairs); j += 2 {
+								row.set(pairs[j], pairs[j+1])
+							}
+						}
+					}
+					i++
+					continue
+				}
+				properties, next, errResp := searchPropertyArgs(args, i+1)
+				if errResp != nil {
+					return errResp, nil
+				}
+				for _, row := range rows {
+					for _, property := range properties {
+						if value, ok := row.get(memory, stripProperty(property)); ok {
+							row.set(stripProperty(property), value)
+						}
+					}
+				}
+				i = next
+			case "GROUPBY":
+				properties, next, errResp := searchPropertyArgs(args, i+1)
+				if errResp != nil {
+					return errResp, nil
+				}
+				i = next
+				reducers := make([]searchReducer, 0)
+				for i+1 < len(args) && strings.ToUpper(string(args[i+1].Data)) == "REDUCE" {
+					if i+2 >= len(args) {
+						return SimpleErrorResp("ERR Bad arguments for REDUCE"), nil
+					}
+					reducer := searchReducer{name: strings.ToUpper(string(args[i+2].Data))}
+					reducerArgs, next, errResp := searchPropertyArgs(args, i+3)
+					if errResp != nil {
+						return errResp, nil
+					}
+					reducer.args = reducerArgs
+					i = next
+					if i+2 < len(args) && strings.ToUpper(string(args[i+1].Data)) == "AS" {
+						reducer.alias = string(args[i+2].Data)
+						i += 2
+					} else {
+						stripped := make([]string, 0, len(reducerArgs))
+						for _, arg := range reducerArgs {
+							stripped = append(stripped, stripProperty(arg))
+						}
+						reducer.alias = "__generated_alias" + strings.ToLower(reducer.name) + strings.Join(stripped, ",")
+					}
+					reducers = append(reducers, reducer)
+				}
+				rows, errResp = searchGroupBy(memory, rows, properties, reducers)
+				if errResp != nil {
+					return errResp, nil
+				}
+			case "SORTBY":
+				properties, next, errResp := searchPropertyArgs(args, i+1)
+				if errResp != nil {
+					return errResp, nil
+				}
+				i = next
+				searchSortRows(memory, rows, properties)
+				if i+2 < len(args) && strings.ToUpper(string(args[i+1].Data)) == "MAX" {
+					maxRows, err := strconv.Atoi(string(args[i+2].Data))
+					if err != nil || maxRows < 0 {
+						return SimpleErrorResp("ERR Bad arguments for MAX"), nil
+					}
+					rows = rows[:min(maxRows, len(rows))]
+					i += 2
+				}
+			case "LIMIT":
+				if i+2 >= len(args) {
+					return SimpleErrorResp("ERR Bad arguments for LIMIT"), nil
+				}
+				offset, err1 := strconv.Atoi(string(args[i+1].Data))
+				num, err2 := strconv.Atoi(string(args[i+2].Data))
+				if err1 != nil || err2 != nil || offset < 0 || num < 0 {
+					return SimpleErrorResp("ERR Bad arguments for LIMIT"), nil
+				}
+				start := min(offset, len(rows))
+				rows = rows[start : start+min(num, len(rows)-start)]
+				i += 2
+			default:
+				return SimpleErrorResp(fmt.Sprintf("ERR Unknown argument `%v`", string(args[i].Data))), nil
+			}
+		}
+
+		output := ArrayResp(IntegerResp(len(rows)))
+		for _, row := range rows {
+			output.Nested = append(output.Nested, row.resp())
+		}
+		return output, nil
+	}
+}
+
+func ftInfo(engine *SearchEngine) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for FT.INFO")
+		}
+		idx, errResp := engine.getIndex(string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		attributes := ArrayResp()
+		for _, field := range idx.fields {
+			attribute := BulkStringArrayResp([]string{"identifier", field.name, "attribute", field.name, "type", field.typ})
+			if field.typ == "TAG" {
+				attribute.Nested = append(attribute.Nested, BulkStringResp("SEPARATOR"), BulkStringResp(field.separator))
+			}
+			if field.sortable {
+				attribute.Nested = append(attribute.Nested, BulkStringResp("SORTABLE"))
+			}
+			attributes.Nested = append(attributes.Nested, attribute)
+		}
+		definition := ArrayResp(
+			BulkStringResp("key_type"), BulkStringResp("HASH"),
+			BulkStringResp("prefixes"), BulkStringArrayResp(idx.prefixes),
+		)
+		return ArrayResp(
+			BulkStringResp("index_name"), BulkStringResp(idx.name),
+			BulkStringResp("index_definition"), definition,
+			BulkStringResp("attributes"), attributes,
+			BulkStringResp("num_docs"), IntegerResp(len(idx.docs)),
+			BulkStringResp("num_terms"), IntegerResp(len(idx.terms)),
+		), nil
+	}
+}
+
+// ftDropindex removes the index, with DD the indexed hashes are deleted too
+func ftDropindex(memory *Memory, engine *SearchEngine) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for FT.DROPINDEX")
+		}
+		name := string(resp.Nested[1].Data)
+		idx, errResp := engine.getIndex(name)
+		if errResp != nil {
+			return errResp, nil
+		}
+		deleteDocs := false
+		if len(resp.Nested) > 2 {
+			if strings.ToUpper(string(resp.Nested[2].Data)) != "DD" {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			deleteDocs = true
+		}
+
+		delete(engine.indexes, name)
+		if deleteDocs {
+			for key := range idx.docs {
+				memory.Delete(key)
+			}
+		}
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+func ftList(engine *SearchEngine) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		names := make([]string, 0, len(engine.indexes))
+		for name := range engine.indexes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return BulkStringArrayResp(names), nil
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSearchQuery_Parse(t *testing.T) {
+	idx := NewSearchIndex("idx", nil, []searchField{
+		{name: "title", typ: "TEXT"},
+		{name: "price", typ: "NUMERIC"},
+		{name: "tags", typ: "TAG", separator: ","},
+	})
+	idx.add("a", hashOf("title", "Red apple pie", "price", "10", "tags", "Fruit, dessert"))
+	idx.add("b", hashOf("title", "Green apple", "price", "5", "tags", "fruit"))
+	idx.add("c", hashOf("title", "Apricot jam", "price", "not a number", "tags", "spread"))
+
+	testcases := []struct {
+		query    string
+		expected []string
+	}{
+		{query: "*", expected: []string{"a", "b", "c"}},
+		{query: "apple", expected: []string{"a", "b"}},
+		{query: "apple pie", expected: []string{"a"}},
+		{query: "pie|jam", expected: []string{"a", "c"}},
+		{query: "-apple", expected: []string{"c"}},
+		{query: "ap*", expected: []string{"a", "b", "c"}},
+		{query: `"RED apple"`, expected: []string{"a"}},
+		{query: "@title:(green|jam)", expected: []string{"b", "c"}},
+		{query: "@price:[5 10]", expected: []string{"a", "b"}},
+		{query: "@price:[(5 +inf]", expected: []string{"a"}},
+		{query: "@tags:{fruit}", expected: []string{"a", "b"}},
+		{query: "@tags:{ Dessert | spread }", expected: []string{"a", "c"}},
+		{query: "apple -@tags:{dessert}", expected: []string{"b"}},
+	}
+	for _, tt := range testcases {
+		node, _, err := parseSearchQuery(idx, tt.query)
+		if err != nil {
+			t.Errorf("query: %v - unexpected error: %v", tt.query, err)
+			continue
+		}
+		keys := node.eval(idx)
+		if len(keys) != len(tt.expected) {
+			t.Errorf("query: %v - expected: %v - actual: %v", tt.query, tt.expected, keys)
+			continue
+		}
+		for _, key := range tt.expected {
+			if _, ok := keys[key]; !ok {
+				t.Errorf("query: %v - expected: %v - actual: %v", tt.query, tt.expected, keys)
+			}
+		}
+	}
+
+	for _, query := range []string{"(apple", "@missing:foo", "@price:[a 10]", "|"} {
+		if _, _, err := parseSearchQuery(idx, query); err == nil {
+			t.Errorf("query: %v - expected error", query)
+		}
+	}
+}
+
+func hashOf(pairs ...string) *Hash {
+	hash := NewHash()
+	for i := 0; i < len(pairs); i += 2 {
+		hash.Set(pairs[i], pairs[i+1])
+	}
+	return hash
+}
+
+func TestProcessor_Search(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "hset",
+			args:     []string{"HSET", "product:1", "name", "Red shirt", "price", "20", "color", "red"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "hset not indexed",
+			args:     []string{"HSET", "user:1", "name", "shirt lover"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "create",
+			args:     []string{"FT.CREATE", "products", "ON", "HASH", "PREFIX", "1", "product:", "SCHEMA", "name", "TEXT", "price", "NUMERIC", "SORTABLE", "color", "TAG"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "create existing",
+			args:     []string{"FT.CREATE", "products", "SCHEMA", "name", "TEXT"},
+			expected: "-ERR Index already exists\r\n",
+		},
+		{
+			name:     "hset after create",
+			args:     []string{"HSET", "product:2", "name", "Blue shirt", "price", "15", "color", "blue"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "hset third",
+			args:     []string{"HSET", "product:3", "name", "Red dress", "price", "40", "color", "red"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "search existing and new documents",
+			args:     []string{"FT.SEARCH", "products", "shirt", "SORTBY", "price"},
+			expected: "*5\r\n:2\r\n$9\r\nproduct:2\r\n*6\r\n$4\r\nname\r\n$10\r\nBlue shirt\r\n$5\r\nprice\r\n$2\r\n15\r\n$5\r\ncolor\r\n$4\r\nblue\r\n$9\r\nproduct:1\r\n*6\r\n$4\r\nname\r\n$9\r\nRed shirt\r\n$5\r\nprice\r\n$2\r\n20\r\n$5\r\ncolor\r\n$3\r\nred\r\n",
+		},
+		{
+			name:     "search tag and numeric range",
+			args:     []string{"FT.SEARCH", "products", "@color:{red} @price:[30 +inf]", "NOCONTENT"},
+			expected: "*2\r\n:1\r\n$9\r\nproduct:3\r\n",
+		},
+		{
+			name:     "search return and limit",
+			args:     []string{"FT.SEARCH", "products", "*", "RETURN", "1", "price", "SORTBY", "price", "DESC", "LIMIT", "0", "2"},
+			expected: "*5\r\n:3\r\n$9\r\nproduct:3\r\n*2\r\n$5\r\nprice\r\n$2\r\n40\r\n$9\r\nproduct:1\r\n*2\r\n$5\r\nprice\r\n$2\r\n20\r\n",
+		},
+		{
+			name:     "search huge limit",
+			args:     []string{"FT.SEARCH", "products", "*", "NOCONTENT", "SORTBY", "price", "DESC", "LIMIT", "1", "9223372036854775807"},
+			expected: "*3\r\n:3\r\n$9\r\nproduct:1\r\n$9\r\nproduct:2\r\n",
+		},
+		{
+			name:     "create huge prefix count",
+			args:     []string{"FT.CREATE", "other", "PREFIX", "9223372036854775807", "p", "SCHEMA", "name", "TEXT"},
+			expected: "-ERR Bad arguments for PREFIX\r\n",
+		},
+		{
+			name:     "update reindexes",
+			args:     []string{"HSET", "product:1", "color", "green"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "search after update",
+			args:     []string{"FT.SEARCH", "products", "@color:{red}", "NOCONTENT"},
+			expected: "*2\r\n:1\r\n$9\r\nproduct:3\r\n",
+		},
+		{
+			name:     "aggregate",
+			args:     []string{"FT.AGGREGATE", "products", "*", "GROUPBY", "1", "@color", "REDUCE", "COUNT", "0", "AS", "n", "REDUCE", "SUM", "1", "@price", "SORTBY", "2", "@color", "ASC"},
+			expected: "*4\r\n:3\r\n*6\r\n$5\r\ncolor\r\n$4\r\nblue\r\n$1\r\nn\r\n$1\r\n1\r\n$25\r\n__generated_aliassumprice\r\n$2\r\n15\r\n*6\r\n$5\r\ncolor\r\n$5\r\ngreen\r\n$1\r\nn\r\n$1\r\n1\r\n$25\r\n__generated_aliassumprice\r\n$2\r\n20\r\n*6\r\n$5\r\ncolor\r\n$3\r\nred\r\n$1\r\nn\r\n$1\r\n1\r\n$25\r\n__generated_aliassumprice\r\n$2\r\n40\r\n",
+		},
+		{
+			name:     "aggregate huge limit",
+			args:     []string{"FT.AGGREGATE", "products", "*", "GROUPBY", "1", "@color", "SORTBY", "2", "@color", "ASC", "LIMIT", "2", "9223372036854775807"},
+			expected: "*2\r\n:1\r\n*2\r\n$5\r\ncolor\r\n$3\r\nred\r\n",
+		},
+		{
+			name:     "aggregate huge groupby count",
+			args:     []string{"FT.AGGREGATE", "products", "*", "GROUPBY", "9223372036854775807", "@color"},
+			expected: "-ERR Bad arguments\r\n",
+		},
+		{
+			name:     "aggregate huge load count",
+			args:     []string{"FT.AGGREGATE", "products", "*", "LOAD", "9223372036854775807", "@color"},
+			expected: "-ERR Bad arguments\r\n",
+		},
+		{
+			name:     "delete removes from index",
+			args:     []string{"HDEL", "product:3", "name", "price", "color"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "info",
+			args:     []string{"FT.INFO", "products"},
+			expected: "*10\r\n$10\r\nindex_name\r\n$8\r\nproducts\r\n$16\r\nindex_definition\r\n*4\r\n$8\r\nkey_type\r\n$4\r\nHASH\r\n$8\r\nprefixes\r\n*1\r\n$8\r\nproduct:\r\n$10\r\nattributes\r\n*3\r\n*6\r\n$10\r\nidentifier\r\n$4\r\nname\r\n$9\r\nattribute\r\n$4\r\nname\r\n$4\r\ntype\r\n$4\r\nTEXT\r\n*7\r\n$10\r\nidentifier\r\n$5\r\nprice\r\n$9\r\nattribute\r\n$5\r\nprice\r\n$4\r\ntype\r\n$7\r\nNUMERIC\r\n$8\r\nSORTABLE\r\n*8\r\n$10\r\nidentifier\r\n$5\r\ncolor\r\n$9\r\nattribute\r\n$5\r\ncolor\r\n$4\r\ntype\r\n$3\r\nTAG\r\n$9\r\nSEPARATOR\r\n$1\r\n,\r\n$8\r\nnum_docs\r\n:2\r\n$9\r\nnum_terms\r\n:3\r\n",
+		},
+		{
+			name:     "list",
+			args:     []string{"FT._LIST"},
+			expected: "*1\r\n$8\r\nproducts\r\n",
+		},
+		{
+			name:     "syntax error",
+			args:     []string{"FT.SEARCH", "products", "(shirt"},
+			expected: "-ERR Syntax error at offset 6 near \r\n",
+		},
+		{
+			name:     "drop index with documents",
+			args:     []string{"FT.DROPINDEX", "products", "DD"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "documents deleted",
+			args:     []string{"HLEN", "product:1"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "other keys kept",
+			args:     []string{"HGET", "user:1", "name"},
+			expected: "$11\r\nshirt lover\r\n",
+		},
+		{
+			name:     "unknown index",
+			args:     []string{"FT.SEARCH", "products", "*"},
+			expected: "-ERR Unknown index name\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
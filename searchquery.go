@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// searchQueryNode evaluates to the keys of the matching documents
+type searchQueryNode interface {
+	eval(idx *SearchIndex) map[string]struct{}
+}
+
+type searchAllNode struct{}
+
+// searchTermNode matches a term, or every term starting with it for a
+// prefix, in one text field or in any when field is empty
+type searchTermNode struct {
+	field  string
+	term   string
+	prefix bool
+}
+
+type searchNumericNode struct {
+	field string
+	min   float64
+	max   float64
+	minex bool
+	maxex bool
+}
+
+type searchTagNode struct {
+	field string
+	tags  []string
+}
+
+type searchAndNode struct {
+	children []searchQueryNode
+}
+
+type searchOrNode struct {
+	children []searchQueryNode
+}
+
+type searchNotNode struct {
+	child searchQueryNode
+}
+
+func (n searchAllNode) eval(idx *SearchIndex) map[string]struct{} {
+	keys := make(map[string]struct{}, len(idx.docs))
+	for key := range idx.docs {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
+
+func (n searchTermNode) eval(idx *SearchIndex) map[string]struct{} {
+	keys := make(map[string]struct{})
+	collect := func(postings map[string]map[string]int) {
+		for key, fields := range postings {
+			if _, ok := fields[n.field]; ok || n.field == "" {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+	if !n.prefix {
+		collect(idx.terms[n.term])
+		return keys
+	}
+	for term, postings := range idx.terms {
+		if strings.HasPrefix(term, n.term) {
+			collect(postings)
+		}
+	}
+	return keys
+}
+
+func (n searchNumericNode) eval(idx *SearchIndex) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for key, doc := range idx.docs {
+		value, ok := doc.numbers[n.field]
+		if !ok {
+			continue
+		}
+		if (value > n.min || (!n.minex && value == n.min)) && (value < n.max || (!n.maxex && value == n.max)) {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
+
+func (n searchTagNode) eval(idx *SearchIndex) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, tag := range n.tags {
+		for key := range idx.tags[n.field][tag] {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
+
+func (n searchAndNode) eval(idx *SearchIndex) map[string]struct{} {
+	keys := n.children[0].eval(idx)
+	for _, child := range n.children[1:] {
+		other := child.eval(idx)
+		for key := range keys {
+			if _, ok := other[key]; !ok {
+				delete(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+func (n searchOrNode) eval(idx *SearchIndex) map[string]struct{} {
+	keys := make(map[string]struct{})
+	for _, child := range n.children {
+		for key := range child.eval(idx) {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
+
+func (n searchNotNode) eval(idx *SearchIndex) map[string]struct{} {
+	excluded := n.child.eval(idx)
+	keys := make(map[string]struct{})
+	for key := range idx.docs {
+		if _, ok := excluded[key]; !ok {
+			keys[key] = struct{}{}
+		}
+	}
+	return keys
+}
+
+// searchTokenize splits text into lower case terms
+func searchTokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// searchQueryParser parses the query syntax of FT.SEARCH:
+//
+//	hello world          both terms, in any text field
+//	hello|world          either term
+//	-hello               documents without the term
+//	hel*                 terms starting with the prefix
+//	"hello world"        both terms, adjacency is not checked
+//	@name:(john|jane)    terms of the name field
+//	@age:[10 (20]        numeric range, "(" excludes the bound
+//	@tags:{red | blue}   any of the tags
+//	*                    every document
+//
+// The text terms are collected to score the results.
+type searchQueryParser struct {
+	input string
+	pos   int
+	idx   *SearchIndex
+	terms []string
+}
+
+func parseSearchQuery(idx *SearchIndex, query string) (searchQueryNode, []string, error) {
+	p := &searchQueryParser{input: query, idx: idx, terms: make([]string, 0)}
+	node, err := p.parseUnion("")
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, nil, p.syntaxError()
+	}
+	return node, p.terms, nil
+}
+
+func (p *searchQueryParser) syntaxError() error {
+	return fmt.Errorf("ERR Syntax error at offset %d near %v", p.pos, p.input[min(p.pos, len(p.input)):])
+}
+
+func (p *searchQueryParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *searchQueryParser) peek() byte {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *searchQueryParser) parseUnion(field string) (searchQueryNode, error) {
+	node, err := p.parseIntersect(field)
+	if err != nil {
+		return nil, err
+	}
+	children := []searchQueryNode{node}
+	for p.peek() == '|' {
+		p.pos++
+		node, err := p.parseIntersect(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return searchOrNode{children: children}, nil
+}
+
+func (p *searchQueryParser) parseIntersect(field string) (searchQueryNode, error) {
+	children := make([]searchQueryNode, 0)
+	for {
+		c := p.peek()
+		if c == 0 || c == ')' || c == '|' {
+			break
+		}
+		node, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	switch len(children) {
+	case 0:
+		return nil, p.syntaxError()
+	case 1:
+		return children[0], nil
+	}
+	return searchAndNode{children: children}, nil
+}
+
+func (p *searchQueryParser) parseUnary(field string) (searchQueryNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		child, err := p.parseUnary(field)
+		if err != nil {
+			return nil, err
+		}
+		return searchNotNode{child: child}, nil
+	}
+	return p.parseAtom(field)
+}
+
+func (p *searchQueryParser) parseAtom(field string) (searchQueryNode, error) {
+	switch p.peek() {
+	case '(':
+		p.pos++
+		node, err := p.parseUnion(field)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.syntaxError()
+		}
+		p.pos++
+		return node, nil
+	case '@':
+		return p.parseFieldExpr()
+	case '"':
+		end := strings.IndexByte(p.input[p.pos+1:], '"')
+		if end < 0 {
+			return nil, p.syntaxError()
+		}
+		phrase := p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return p.termsNode(field, searchTokenize(phrase), false)
+	case '*':
+		if p.pos+1 == len(p.input) || strings.IndexByte(" )|", p.input[p.pos+1]) >= 0 {
+			p.pos++
+			return searchAllNode{}, nil
+		}
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && strings.IndexByte(" ()|@{}[]\"", p.input[p.pos]) < 0 {
+		p.pos++
+	}
+	word := p.input[start:p.pos]
+	prefix := strings.HasSuffix(word, "*")
+	tokens := searchTokenize(strings.TrimSuffix(word, "*"))
+	if len(tokens) == 0 {
+		return nil, p.syntaxError()
+	}
+	return p.termsNode(field, tokens, prefix)
+}
+
+// termsNode matches all the tokens, the last one as a prefix if asked
+func (p *searchQueryParser) termsNode(field string, tokens []string, prefix bool) (searchQueryNode, error) {
+	if len(tokens) == 0 {
+		return nil, p.syntaxError()
+	}
+	children := make([]searchQueryNode, 0, len(tokens))
+	for i, token := range tokens {
+		p.terms = append(p.terms, token)
+		children = append(children, searchTermNode{field: field, term: token, prefix: prefix && i == len(tokens)-1})
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return searchAndNode{children: children}, nil
+}
+
+func (p *searchQueryParser) parseFieldExpr() (searchQueryNode, error) {
+	colon := strings.IndexByte(p.input[p.pos:], ':')
+	if colon < 0 {
+		return nil, p.syntaxError()
+	}
+	name := p.input[p.pos+1 : p.pos+colon]
+	field, ok := p.idx.field(name)
+	if !ok {
+		return nil, fmt.Errorf("ERR Unknown field at offset %d near %v", p.pos, name)
+	}
+	p.pos += colon + 1
+
+	switch field.typ {
+	case "NUMERIC":
+		if p.peek() != '[' {
+			return nil, p.syntaxError()
+		}
+		end := strings.IndexByte(p.input[p.pos:], ']')
+		if end < 0 {
+			return nil, p.syntaxError()
+		}
+		bounds := strings.Fields(p.input[p.pos+1 : p.pos+end])
+		if len(bounds) != 2 {
+			return nil, p.syntaxError()
+		}
+		node := searchNumericNode{field: name}
+		var err error
+		if node.min, node.minex, err = parseSearchNumericBound(bounds[0]); err != nil {
+			return nil, err
+		}
+		if node.max, node.maxex, err = parseSearchNumericBound(bounds[1]); err != nil {
+			return nil, err
+		}
+		p.pos += end + 1
+		return node, nil
+	case "TAG":
+		if p.peek() != '{' {
+			return nil, p.syntaxError()
+		}
+		end := strings.IndexByte(p.input[p.pos:], '}')
+		if end < 0 {
+			return nil, p.syntaxError()
+		}
+		node := searchTagNode{field: name, tags: make([]string, 0)}
+		for _, tag := range strings.Split(p.input[p.pos+1:p.pos+end], "|") {
+			node.tags = append(node.tags, normalizeSearchTag(tag))
+		}
+		p.pos += end + 1
+		return node, nil
+	}
+	return p.parseAtom(name)
+}
+
+func parseSearchNumericBound(bound string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(bound, "(")
+	bound = strings.TrimPrefix(bound, "(")
+	switch bound {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	value, err := strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("ERR Expecting numeric or parameter near %v", bound)
+	}
+	return value, exclusive, nil
+}
+
+func normalizeSearchTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
@@ -1,12 +1,9 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"net"
 	"os"
-
-	"github.com/google/uuid"
 )
 
 // Ensures gofmt doesn't remove the "net" and "os" imports in stage 1 (feel free to remove this!)
@@ -49,8 +46,7 @@ func main() {
 	// init dependencies
 	respParser := NewRESP()
 	memory := NewMemory()
-	transaction := NewTransaction()
-	processor := NewProcessor(respParser, memory, transaction)
+	processor := NewProcessor(respParser, memory)
 
 	// process replication
 	err = InitReplication(processor, opts)
@@ -70,25 +66,42 @@ func main() {
 }
 
 func handle(conn net.Conn, processor *Processor) {
-	txId := uuid.New().String()
-	txContext := context.WithValue(context.Background(), "txId", txId)
-	buf := make([]byte, 1024)
-	for {
-		read, err := conn.Read(buf)
-		if err != nil {
-			fmt.Println("Error when parsing command!", err.Error())
-			break
-		}
-		if read == 0 {
-			fmt.Println("No data read")
-			break
-		}
+	client := processor.Connect(conn.RemoteAddr().String())
+	defer processor.Disconnect(client)
+	defer conn.Close()
 
-		// deep copy to avoid referencing
-		bufCmd := make([]byte, len(buf))
-		copy(bufCmd, buf)
+	// the connection is read concurrently so that a disconnection releases
+	// the command the client is blocked in
+	commands := make(chan []byte)
+	go func() {
+		defer close(commands)
+		defer client.cancel()
+		buf := make([]byte, 1024)
+		for {
+			read, err := conn.Read(buf)
+			if err != nil {
+				fmt.Println("Error when parsing command!", err.Error())
+				return
+			}
+			if read == 0 {
+				fmt.Println("No data read")
+				return
+			}
+
+			// deep copy to avoid referencing
+			bufCmd := make([]byte, len(buf))
+			copy(bufCmd, buf)
+
+			select {
+			case commands <- bufCmd:
+			case <-client.Context().Done():
+				return
+			}
+		}
+	}()
 
-		output, err := processor.Accept(txContext, bufCmd)
+	for cmd := range commands {
+		output, err := processor.Accept(client, cmd)
 		if err != nil {
 			fmt.Println("Invalid command: ", err)
 			break
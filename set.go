@@ -0,0 +1,674 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// same as the set-max-intset-entries default of redis
+const SetMaxIntsetEntries = 512
+
+// bounds the members repeated by SRANDMEMBER with a negative count so a
+// single reply can't exhaust the memory
+const SetMaxRandomMembers = 1 << 20
+
+// Set keeps small all-integer sets in a sorted intset and switches to a
+// hash table once a non-integer member is added or the intset grows too big
+type Set struct {
+	intset []int64
+	dict   map[string]struct{}
+}
+
+func NewSet() *Set {
+	return &Set{
+		intset: make([]int64, 0),
+	}
+}
+
+func (s *Set) Encoding() string {
+	if s.dict != nil {
+		return "hashtable"
+	}
+	return "intset"
+}
+
+func (s *Set) Len() int {
+	if s.dict != nil {
+		return len(s.dict)
+	}
+	return len(s.intset)
+}
+
+func (s *Set) Add(member string) bool {
+	if s.dict == nil {
+		num, ok := parseSetInteger(member)
+		if ok {
+			i, found := s.searchIntset(num)
+			if found {
+				return false
+			}
+			if len(s.intset) < SetMaxIntsetEntries {
+				s.intset = append(s.intset, 0)
+				copy(s.intset[i+1:], s.intset[i:])
+				s.intset[i] = num
+				return true
+			}
+		}
+		s.convertToDict()
+	}
+	if _, ok := s.dict[member]; ok {
+		return false
+	}
+	s.dict[member] = struct{}{}
+	return true
+}
+
+func (s *Set) Remove(member string) bool {
+	if s.dict != nil {
+		if _, ok := s.dict[member]; !ok {
+			return false
+		}
+		delete(s.dict, member)
+		return true
+	}
+	num, ok := parseSetInteger(member)
+	if !ok {
+		return false
+	}
+	i, found := s.searchIntset(num)
+	if !found {
+		return false
+	}
+	s.intset = append(s.intset[:i], s.intset[i+1:]...)
+	return true
+}
+
+func (s *Set) Contains(member string) bool {
+	if s.dict != nil {
+		_, ok := s.dict[member]
+		return ok
+	}
+	num, ok := parseSetInteger(member)
+	if !ok {
+		return false
+	}
+	_, found := s.searchIntset(num)
+	return found
+}
+
+// Members returns the members in no particular order, except for intsets
+// which are always sorted
+func (s *Set) Members() []string {
+	members := make([]string, 0, s.Len())
+	if s.dict != nil {
+		for member := range s.dict {
+			members = append(members, member)
+		}
+		return members
+	}
+	for _, num := range s.intset {
+		members = append(members, strconv.FormatInt(num, 10))
+	}
+	return members
+}
+
+func (s *Set) RandomMember() string {
+	if s.dict != nil {
+		// map iteration order is randomized but not uniformly, pick by index instead
+		target, i := rand.Intn(len(s.dict)), 0
+		for member := range s.dict {
+			if i == target {
+				return member
+			}
+			i++
+		}
+	}
+	return strconv.FormatInt(s.intset[rand.Intn(len(s.intset))], 10)
+}
+
+func (s *Set) Pop() string {
+	member := s.RandomMember()
+	s.Remove(member)
+	return member
+}
+
+func (s *Set) searchIntset(num int64) (int, bool) {
+	i := sort.Search(len(s.intset), func(i int) bool {
+		return s.intset[i] >= num
+	})
+	return i, i < len(s.intset) && s.intset[i] == num
+}
+
+func (s *Set) convertToDict() {
+	s.dict = make(map[string]struct{}, len(s.intset))
+	for _, num := range s.intset {
+		s.dict[strconv.FormatInt(num, 10)] = struct{}{}
+	}
+	s.intset = nil
+}
+
+// only canonical integers ("12", not "012" or "+12") can live in an intset,
+// otherwise the member would not round trip
+func parseSetInteger(member string) (int64, bool) {
+	num, err := strconv.ParseInt(member, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return num, strconv.FormatInt(num, 10) == member
+}
+
+// getSet returns nil set when the key does not exist and an error response
+// when the key holds another type
+func getSet(memory *Memory, key string) (*Set, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "set" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*Set), nil
+}
+
+func putSet(memory *Memory, key string, set *Set) {
+	if set.Len() == 0 {
+		memory.Delete(key)
+		return
+	}
+	memory.Put(key, Entry{Type: "set", Value: set}, Option{})
+}
+
+func sadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for SADD")
+		}
+		key := string(resp.Nested[1].Data)
+		set, errResp := getSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if set == nil {
+			set = NewSet()
+		}
+
+		added := 0
+		for _, arg := range resp.Nested[2:] {
+			if set.Add(string(arg.Data)) {
+				added++
+			}
+		}
+		putSet(memory, key, set)
+
+		return IntegerResp(added), nil
+	}
+}
+
+func srem(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for SREM")
+		}
+		key := string(resp.Nested[1].Data)
+		set, errResp := getSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if set == nil {
+			return IntegerResp(0), nil
+		}
+
+		removed := 0
+		for _, arg := range resp.Nested[2:] {
+			if set.Remove(string(arg.Data)) {
+				removed++
+			}
+		}
+		putSet(memory, key, set)
+
+		return IntegerResp(removed), nil
+	}
+}
+
+func sismember(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for SISMEMBER")
+		}
+		set, errResp := getSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if set != nil && set.Contains(string(resp.Nested[2].Data)) {
+			return IntegerResp(1), nil
+		}
+		return IntegerResp(0), nil
+	}
+}
+
+func smismember(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for SMISMEMBER")
+		}
+		set, errResp := getSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			if set != nil && set.Contains(string(arg.Data)) {
+				output.Nested = append(output.Nested, IntegerResp(1))
+			} else {
+				output.Nested = append(output.Nested, IntegerResp(0))
+			}
+		}
+		return output, nil
+	}
+}
+
+func smembers(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for SMEMBERS")
+		}
+		set, errResp := getSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if set == nil {
+			return ArrayResp(), nil
+		}
+		return BulkStringArrayResp(set.Members()), nil
+	}
+}
+
+func scard(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for SCARD")
+		}
+		set, errResp := getSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if set == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(set.Len()), nil
+	}
+}
+
+func spop(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for SPOP")
+		}
+		key := string(resp.Nested[1].Data)
+		set, errResp := getSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		// SPOP key
+		if len(resp.Nested) == 2 {
+			if set == nil {
+				return BulkStringResp(""), nil
+			}
+			member := set.Pop()
+			putSet(memory, key, set)
+			return BulkStringResp(member), nil
+		}
+
+		// SPOP key count
+		count, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || count < 0 {
+			return SimpleErrorResp("ERR value is out of range, must be positive"), nil
+		}
+		if set == nil {
+			return ArrayResp(), nil
+		}
+		popped := make([]string, 0, min(count, set.Len()))
+		for len(popped) < count && set.Len() > 0 {
+			popped = append(popped, set.Pop())
+		}
+		putSet(memory, key, set)
+
+		return BulkStringArrayResp(popped), nil
+	}
+}
+
+func srandmember(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for SRANDMEMBER")
+		}
+		set, errResp := getSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		// SRANDMEMBER key
+		if len(resp.Nested) == 2 {
+			if set == nil {
+				return BulkStringResp(""), nil
+			}
+			return BulkStringResp(set.RandomMember()), nil
+		}
+
+		// SRANDMEMBER key count
+		count, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil {
+			return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+		}
+		if count < -SetMaxRandomMembers {
+			return SimpleErrorResp("ERR value is out of range"), nil
+		}
+		if set == nil || count == 0 {
+			return ArrayResp(), nil
+		}
+
+		// negative count allows the same member to be returned multiple times
+		if count < 0 {
+			members := make([]string, 0, min(-count, set.Len()))
+			for len(members) < -count {
+				members = append(members, set.RandomMember())
+			}
+			return BulkStringArrayResp(members), nil
+		}
+
+		members := set.Members()
+		rand.Shuffle(len(members), func(i, j int) {
+			members[i], members[j] = members[j], members[i]
+		})
+		if count < len(members) {
+			members = members[:count]
+		}
+		return BulkStringArrayResp(members), nil
+	}
+}
+
+func smove(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for SMOVE")
+		}
+		srcKey, dstKey := string(resp.Nested[1].Data), string(resp.Nested[2].Data)
+		member := string(resp.Nested[3].Data)
+
+		src, errResp := getSet(memory, srcKey)
+		if errResp != nil {
+			return errResp, nil
+		}
+		dst, errResp := getSet(memory, dstKey)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		if src == nil || !src.Contains(member) {
+			return IntegerResp(0), nil
+		}
+		if srcKey == dstKey {
+			return IntegerResp(1), nil
+		}
+
+		src.Remove(member)
+		putSet(memory, srcKey, src)
+
+		if dst == nil {
+			dst = NewSet()
+		}
+		dst.Add(member)
+		putSet(memory, dstKey, dst)
+
+		return IntegerResp(1), nil
+	}
+}
+
+type setOperation int
+
+const (
+	setInter setOperation = iota
+	setUnion
+	setDiff
+)
+
+// computeSetOperation applies the operation over the sets stored at keys,
+// missing keys are treated as empty sets
+func computeSetOperation(memory *Memory, op setOperation, keys []string) (*Set, *RESP) {
+	sets := make([]*Set, 0, len(keys))
+	for _, key := range keys {
+		set, errResp := getSet(memory, key)
+		if errResp != nil {
+			return nil, errResp
+		}
+		if set == nil {
+			set = NewSet()
+		}
+		sets = append(sets, set)
+	}
+
+	result := NewSet()
+	switch op {
+	case setInter:
+		// iterate over the smallest set and probe the others
+		sort.SliceStable(sets, func(i, j int) bool {
+			return sets[i].Len() < sets[j].Len()
+		})
+		for _, member := range sets[0].Members() {
+			inAll := true
+			for _, other := range sets[1:] {
+				if !other.Contains(member) {
+					inAll = false
+					break
+				}
+			}
+			if inAll {
+				result.Add(member)
+			}
+		}
+	case setUnion:
+		for _, set := range sets {
+			for _, member := range set.Members() {
+				result.Add(member)
+			}
+		}
+	case setDiff:
+		for _, member := range sets[0].Members() {
+			inOther := false
+			for _, other := range sets[1:] {
+				if other.Contains(member) {
+					inOther = true
+					break
+				}
+			}
+			if !inOther {
+				result.Add(member)
+			}
+		}
+	}
+	return result, nil
+}
+
+func setOperationCmd(memory *Memory, name string, op setOperation) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		keys := make([]string, 0, len(resp.Nested)-1)
+		for _, arg := range resp.Nested[1:] {
+			keys = append(keys, string(arg.Data))
+		}
+
+		result, errResp := computeSetOperation(memory, op, keys)
+		if errResp != nil {
+			return errResp, nil
+		}
+		return BulkStringArrayResp(result.Members()), nil
+	}
+}
+
+func setOperationStoreCmd(memory *Memory, name string, op setOperation) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		dstKey := string(resp.Nested[1].Data)
+		keys := make([]string, 0, len(resp.Nested)-2)
+		for _, arg := range resp.Nested[2:] {
+			keys = append(keys, string(arg.Data))
+		}
+
+		result, errResp := computeSetOperation(memory, op, keys)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		// the destination is overwritten whatever type it was holding
+		memory.Delete(dstKey)
+		putSet(memory, dstKey, result)
+
+		return IntegerResp(result.Len()), nil
+	}
+}
+
+func sinter(memory *Memory) Executor {
+	return setOperationCmd(memory, "SINTER", setInter)
+}
+
+func sunion(memory *Memory) Executor {
+	return setOperationCmd(memory, "SUNION", setUnion)
+}
+
+func sdiff(memory *Memory) Executor {
+	return setOperationCmd(memory, "SDIFF", setDiff)
+}
+
+func sinterstore(memory *Memory) Executor {
+	return setOperationStoreCmd(memory, "SINTERSTORE", setInter)
+}
+
+func sunionstore(memory *Memory) Executor {
+	return setOperationStoreCmd(memory, "SUNIONSTORE", setUnion)
+}
+
+func sdiffstore(memory *Memory) Executor {
+	return setOperationStoreCmd(memory, "SDIFFSTORE", setDiff)
+}
+
+func sintercard(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for SINTERCARD")
+		}
+		numKeys, err := strconv.Atoi(string(resp.Nested[1].Data))
+		if err != nil || numKeys <= 0 {
+			return SimpleErrorResp("ERR numkeys should be greater than 0"), nil
+		}
+		if numKeys > len(resp.Nested)-2 {
+			return SimpleErrorResp("ERR Number of keys can't be greater than number of args"), nil
+		}
+
+		keys := make([]string, 0, numKeys)
+		for _, arg := range resp.Nested[2 : 2+numKeys] {
+			keys = append(keys, string(arg.Data))
+		}
+
+		// LIMIT 0 means unlimited
+		limit := 0
+		for i := 2 + numKeys; i < len(resp.Nested); i++ {
+			opt := strings.ToUpper(string(resp.Nested[i].Data))
+			if opt != "LIMIT" || i == len(resp.Nested)-1 {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			limit, err = strconv.Atoi(string(resp.Nested[i+1].Data))
+			if err != nil {
+				return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+			}
+			if limit < 0 {
+				return SimpleErrorResp("ERR LIMIT can't be negative"), nil
+			}
+			i++
+		}
+
+		result, errResp := computeSetOperation(memory, setInter, keys)
+		if errResp != nil {
+			return errResp, nil
+		}
+		card := result.Len()
+		if limit > 0 && card > limit {
+			card = limit
+		}
+		return IntegerResp(card), nil
+	}
+}
+
+func sscan(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for SSCAN")
+		}
+		set, errResp := getSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		cursor, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || cursor < 0 {
+			return SimpleErrorResp("ERR invalid cursor"), nil
+		}
+
+		pattern, count := "*", 10
+		for i := 3; i < len(resp.Nested); i += 2 {
+			if i == len(resp.Nested)-1 {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			opt, val := strings.ToUpper(string(resp.Nested[i].Data)), string(resp.Nested[i+1].Data)
+			switch opt {
+			case "MATCH":
+				pattern = val
+			case "COUNT":
+				count, err = strconv.Atoi(val)
+				if err != nil {
+					return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+				}
+				if count < 1 {
+					return SimpleErrorResp("ERR syntax error"), nil
+				}
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+
+		if set == nil {
+			return ArrayResp(BulkStringResp("0"), ArrayResp()), nil
+		}
+
+		// the cursor is an offset into the sorted members so that it stays
+		// stable between calls as long as the set is not modified
+		members := set.Members()
+		sort.Strings(members)
+
+		// bounded by the members so that cursor+count can't overflow
+		end := len(members)
+		if cursor < len(members) {
+			end = cursor + min(count, len(members)-cursor)
+		}
+		matched := make([]string, 0, min(count, len(members)))
+		next := cursor
+		for next < end {
+			if GlobMatch(pattern, members[next]) {
+				matched = append(matched, members[next])
+			}
+			next++
+		}
+		if next >= len(members) {
+			next = 0
+		}
+
+		return ArrayResp(BulkStringResp(strconv.Itoa(next)), BulkStringArrayResp(matched)), nil
+	}
+}
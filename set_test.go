@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSet_Encoding(t *testing.T) {
+	set := NewSet()
+	for i := 0; i < SetMaxIntsetEntries; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+	if set.Encoding() != "intset" {
+		t.Errorf("expected intset encoding, but got: %v", set.Encoding())
+	}
+
+	// non canonical integers can't be kept in an intset
+	if set.Contains("007") {
+		t.Errorf("expected 007 not to be a member")
+	}
+
+	set.Add(strconv.Itoa(SetMaxIntsetEntries))
+	if set.Encoding() != "hashtable" {
+		t.Errorf("expected hashtable encoding after growing, but got: %v", set.Encoding())
+	}
+	if set.Len() != SetMaxIntsetEntries+1 || !set.Contains("0") {
+		t.Errorf("members lost when converting to hashtable")
+	}
+
+	small := NewSet()
+	small.Add("1")
+	small.Add("apple")
+	if small.Encoding() != "hashtable" || !small.Contains("1") || !small.Contains("apple") {
+		t.Errorf("expected hashtable with both members after adding a string")
+	}
+}
+
+func TestProcessor_Set(t *testing.T) {
+	testcases := []struct {
+		name     string
+		args     string
+		expected string
+	}{
+		{
+			name:     "sadd ints",
+			args:     "*5\r\n$4\r\nSADD\r\n$1\r\na\r\n$1\r\n3\r\n$1\r\n1\r\n$1\r\n2\r\n",
+			expected: ":3\r\n",
+		},
+		{
+			name:     "sadd duplicate",
+			args:     "*4\r\n$4\r\nSADD\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\n2\r\n",
+			expected: ":1\r\n",
+		},
+		{
+			name:     "smembers sorted intset",
+			args:     "*2\r\n$8\r\nSMEMBERS\r\n$1\r\na\r\n",
+			expected: "*3\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "sinter",
+			args:     "*3\r\n$6\r\nSINTER\r\n$1\r\na\r\n$1\r\nb\r\n",
+			expected: "*1\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "sdiffstore",
+			args:     "*4\r\n$10\r\nSDIFFSTORE\r\n$1\r\nc\r\n$1\r\na\r\n$1\r\nb\r\n",
+			expected: ":2\r\n",
+		},
+		{
+			name:     "smismember",
+			args:     "*4\r\n$10\r\nSMISMEMBER\r\n$1\r\nc\r\n$1\r\n1\r\n$1\r\n2\r\n",
+			expected: "*2\r\n:1\r\n:0\r\n",
+		},
+		{
+			name:     "sintercard limit",
+			args:     "*6\r\n$10\r\nSINTERCARD\r\n$1\r\n2\r\n$1\r\na\r\n$1\r\nc\r\n$5\r\nLIMIT\r\n$1\r\n1\r\n",
+			expected: ":1\r\n",
+		},
+		{
+			name:     "smove",
+			args:     "*4\r\n$5\r\nSMOVE\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\n2\r\n",
+			expected: ":1\r\n",
+		},
+		{
+			name:     "source emptied by smove is deleted",
+			args:     "*2\r\n$4\r\nTYPE\r\n$1\r\nb\r\n",
+			expected: "+none\r\n",
+		},
+		{
+			name:     "srandmember negative count",
+			args:     "*3\r\n$11\r\nSRANDMEMBER\r\n$1\r\nb\r\n$2\r\n-3\r\n",
+			expected: "*0\r\n",
+		},
+		{
+			name:     "sscan match",
+			args:     "*5\r\n$5\r\nSSCAN\r\n$1\r\nc\r\n$1\r\n0\r\n$5\r\nMATCH\r\n$5\r\n[2-3]\r\n",
+			expected: "*2\r\n$1\r\n0\r\n*2\r\n$1\r\n2\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "wrong type",
+			args:     "*2\r\n$5\r\nSCARD\r\n$3\r\nstr\r\n",
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "get on set",
+			args:     "*2\r\n$3\r\nGET\r\n$1\r\nc\r\n",
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "incr on set",
+			args:     "*2\r\n$4\r\nINCR\r\n$1\r\nc\r\n",
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+		{
+			name:     "srandmember huge negative count",
+			args:     "*3\r\n$11\r\nSRANDMEMBER\r\n$1\r\nc\r\n$16\r\n-100000000000000\r\n",
+			expected: "-ERR value is out of range\r\n",
+		},
+		{
+			name:     "sscan huge count",
+			args:     "*5\r\n$5\r\nSSCAN\r\n$1\r\nc\r\n$1\r\n1\r\n$5\r\nCOUNT\r\n$19\r\n9223372036854775807\r\n",
+			expected: "*2\r\n$1\r\n0\r\n*2\r\n$1\r\n2\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "sadd single member",
+			args:     "*3\r\n$4\r\nSADD\r\n$3\r\none\r\n$1\r\nx\r\n",
+			expected: ":1\r\n",
+		},
+		{
+			name:     "spop huge count",
+			args:     "*3\r\n$4\r\nSPOP\r\n$3\r\none\r\n$15\r\n100000000000000\r\n",
+			expected: "*1\r\n$1\r\nx\r\n",
+		},
+	}
+
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	memory.Put("str", Entry{Type: "string", Value: "value"}, Option{})
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, []byte(tt.args))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != string(tt.expected) {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, string(tt.expected), string(output))
+		}
+	}
+}
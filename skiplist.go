@@ -0,0 +1,336 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// same parameters as the redis zset skiplist
+const (
+	ZSkiplistMaxLevel = 32
+	ZSkiplistP        = 0.25
+)
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	// number of nodes skipped by following forward at this level
+	span int
+}
+
+type zskiplistNode struct {
+	member   string
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+// zskiplist keeps nodes ordered by (score, member), spans allow to compute
+// the rank of a node while descending the levels
+type zskiplist struct {
+	header *zskiplistNode
+	tail   *zskiplistNode
+	length int
+	level  int
+}
+
+// zRangeSpec is a score range, minex/maxex mark exclusive bounds
+type zRangeSpec struct {
+	min, max     float64
+	minex, maxex bool
+}
+
+// zLexBound is a lex range item, inf is -1 for "-", 1 for "+" and 0 otherwise
+type zLexBound struct {
+	value string
+	ex    bool
+	inf   int
+}
+
+type zLexRangeSpec struct {
+	min, max zLexBound
+}
+
+func newZskiplistNode(level int, score float64, member string) *zskiplistNode {
+	return &zskiplistNode{
+		member: member,
+		score:  score,
+		level:  make([]zskiplistLevel, level),
+	}
+}
+
+func newZskiplist() *zskiplist {
+	return &zskiplist{
+		header: newZskiplistNode(ZSkiplistMaxLevel, 0, ""),
+		level:  1,
+	}
+}
+
+func zslRandomLevel() int {
+	level := 1
+	for rand.Float64() < ZSkiplistP && level < ZSkiplistMaxLevel {
+		level++
+	}
+	return level
+}
+
+// zslLess reports whether node sorts before (score, member)
+func zslLess(node *zskiplistNode, score float64, member string) bool {
+	return node.score < score || (node.score == score && node.member < member)
+}
+
+// insert assumes the member is not in the skiplist yet
+func (zsl *zskiplist) insert(score float64, member string) *zskiplistNode {
+	var update [ZSkiplistMaxLevel]*zskiplistNode
+	var rank [ZSkiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i != zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			rank[i] = 0
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = newZskiplistNode(level, score, member)
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = (rank[0] - rank[i]) + 1
+	}
+	// untouched levels now skip one more node
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+func (zsl *zskiplist) delete(score float64, member string) bool {
+	var update [ZSkiplistMaxLevel]*zskiplistNode
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLess(x.level[i].forward, score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+	zsl.deleteNode(x, update[:])
+	return true
+}
+
+func (zsl *zskiplist) deleteNode(x *zskiplistNode, update []*zskiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// getRank returns the 1-based rank of the element, 0 when it is not found
+func (zsl *zskiplist) getRank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score && x.level[i].forward.member <= member)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.score == score && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// getElementByRank looks up the node at the 1-based rank
+func (zsl *zskiplist) getElementByRank(rank int) *zskiplistNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+func (spec zRangeSpec) valueGteMin(value float64) bool {
+	if spec.minex {
+		return value > spec.min
+	}
+	return value >= spec.min
+}
+
+func (spec zRangeSpec) valueLteMax(value float64) bool {
+	if spec.maxex {
+		return value < spec.max
+	}
+	return value <= spec.max
+}
+
+func (zsl *zskiplist) isInRange(spec zRangeSpec) bool {
+	if spec.min > spec.max || (spec.min == spec.max && (spec.minex || spec.maxex)) {
+		return false
+	}
+	if zsl.tail == nil || !spec.valueGteMin(zsl.tail.score) {
+		return false
+	}
+	first := zsl.header.level[0].forward
+	return first != nil && spec.valueLteMax(first.score)
+}
+
+func (zsl *zskiplist) firstInRange(spec zRangeSpec) *zskiplistNode {
+	if !zsl.isInRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !spec.valueGteMin(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !spec.valueLteMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+func (zsl *zskiplist) lastInRange(spec zRangeSpec) *zskiplistNode {
+	if !zsl.isInRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && spec.valueLteMax(x.level[i].forward.score) {
+			x = x.level[i].forward
+		}
+	}
+	if !spec.valueGteMin(x.score) {
+		return nil
+	}
+	return x
+}
+
+func (spec zLexRangeSpec) valueGteMin(value string) bool {
+	switch spec.min.inf {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	if spec.min.ex {
+		return value > spec.min.value
+	}
+	return value >= spec.min.value
+}
+
+func (spec zLexRangeSpec) valueLteMax(value string) bool {
+	switch spec.max.inf {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	if spec.max.ex {
+		return value < spec.max.value
+	}
+	return value <= spec.max.value
+}
+
+func (zsl *zskiplist) isInLexRange(spec zLexRangeSpec) bool {
+	if spec.min.inf == 1 || spec.max.inf == -1 {
+		return false
+	}
+	if spec.min.inf == 0 && spec.max.inf == 0 {
+		if spec.min.value > spec.max.value ||
+			(spec.min.value == spec.max.value && (spec.min.ex || spec.max.ex)) {
+			return false
+		}
+	}
+	if zsl.tail == nil || !spec.valueGteMin(zsl.tail.member) {
+		return false
+	}
+	first := zsl.header.level[0].forward
+	return first != nil && spec.valueLteMax(first.member)
+}
+
+func (zsl *zskiplist) firstInLexRange(spec zLexRangeSpec) *zskiplistNode {
+	if !zsl.isInLexRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !spec.valueGteMin(x.level[i].forward.member) {
+			x = x.level[i].forward
+		}
+	}
+	x = x.level[0].forward
+	if !spec.valueLteMax(x.member) {
+		return nil
+	}
+	return x
+}
+
+func (zsl *zskiplist) lastInLexRange(spec zLexRangeSpec) *zskiplistNode {
+	if !zsl.isInLexRange(spec) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && spec.valueLteMax(x.level[i].forward.member) {
+			x = x.level[i].forward
+		}
+	}
+	if !spec.valueGteMin(x.member) {
+		return nil
+	}
+	return x
+}
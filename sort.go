@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type sortRequest struct {
+	by       string
+	dontSort bool
+	gets     []string
+	offset   int
+	count    int
+	desc     bool
+	alpha    bool
+	store    string
+	hasStore bool
+}
+
+type sortItem struct {
+	value string
+	// weight used by ALPHA, hasWeight is false when the BY key is missing
+	weight    string
+	hasWeight bool
+	score     float64
+}
+
+// parseSortRequest parses "[BY pattern] [LIMIT offset count] [GET pattern
+// [GET pattern ...]] [ASC|DESC] [ALPHA] [STORE destination]"
+func parseSortRequest(args []*RESP, readOnly bool) (*sortRequest, *RESP) {
+	req := &sortRequest{
+		gets:  make([]string, 0),
+		count: -1,
+	}
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i].Data))
+		remaining := len(args) - i - 1
+		switch {
+		case opt == "ASC":
+			req.desc = false
+		case opt == "DESC":
+			req.desc = true
+		case opt == "ALPHA":
+			req.alpha = true
+		case opt == "LIMIT" && remaining >= 2:
+			offset, err := strconv.Atoi(string(args[i+1].Data))
+			if err != nil {
+				return nil, SimpleErrorResp("ERR value is not an integer or out of range")
+			}
+			count, err := strconv.Atoi(string(args[i+2].Data))
+			if err != nil {
+				return nil, SimpleErrorResp("ERR value is not an integer or out of range")
+			}
+			req.offset, req.count = offset, count
+			i += 2
+		case opt == "STORE" && remaining >= 1 && !readOnly:
+			req.store, req.hasStore = string(args[i+1].Data), true
+			i++
+		case opt == "BY" && remaining >= 1:
+			req.by = string(args[i+1].Data)
+			// a pattern without "*" can't change per element, skip sorting
+			if !strings.Contains(req.by, "*") {
+				req.dontSort = true
+			}
+			i++
+		case opt == "GET" && remaining >= 1:
+			req.gets = append(req.gets, string(args[i+1].Data))
+			i++
+		default:
+			return nil, SimpleErrorResp("ERR syntax error")
+		}
+	}
+	return req, nil
+}
+
+// sortLookupByPattern substitutes the first "*" of the pattern with the
+// element and reads the resulting key, "#" stands for the element itself.
+// A "->field" suffix reads a field of a hash instead of a string.
+func sortLookupByPattern(memory *Memory, pattern, subst string) (string, bool) {
+	if pattern == "#" {
+		return subst, true
+	}
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return "", false
+	}
+
+	keyPattern, field := pattern, ""
+	if arrow := strings.Index(pattern[star+1:], "->"); arrow >= 0 && star+1+arrow+2 < len(pattern) {
+		keyPattern, field = pattern[:star+1+arrow], pattern[star+1+arrow+2:]
+	}
+	key := keyPattern[:star] + subst + keyPattern[star+1:]
+
+	entry := memory.Get(key)
+	if field != "" {
+		if entry.Type != "hash" {
+			return "", false
+		}
+		return (entry.Value).(*Hash).Get(field)
+	}
+	if entry.Type != "string" {
+		return "", false
+	}
+	return (entry.Value).(string), true
+}
+
+// sortElements reads the elements of a list, set or sorted set
+func sortElements(memory *Memory, key string, req *sortRequest) ([]string, *RESP) {
+	entry := memory.Get(key)
+	switch entry.Type {
+	case "none":
+		return []string{}, nil
+	case "list":
+		return append([]string{}, (entry.Value).(*List).items...), nil
+	case "set":
+		members := (entry.Value).(*Set).Members()
+		// keep the output deterministic when not sorting
+		if req.dontSort {
+			sort.Strings(members)
+		}
+		return members, nil
+	case "zset":
+		members := (entry.Value).(*SortedSet).Members()
+		elements := make([]string, 0, len(members))
+		for _, m := range members {
+			elements = append(elements, m.Member)
+		}
+		// sorted sets are already ordered, DESC is honored without sorting
+		if req.dontSort && req.desc {
+			for i, j := 0, len(elements)-1; i < j; i, j = i+1, j-1 {
+				elements[i], elements[j] = elements[j], elements[i]
+			}
+		}
+		return elements, nil
+	}
+	return nil, SimpleErrorResp(WrongTypeErr)
+}
+
+func sortGeneric(memory *Memory, key string, req *sortRequest) ([]*RESP, []string, *RESP) {
+	elements, errResp := sortElements(memory, key, req)
+	if errResp != nil {
+		return nil, nil, errResp
+	}
+
+	if !req.dontSort {
+		items := make([]sortItem, 0, len(elements))
+		for _, element := range elements {
+			item := sortItem{value: element, weight: element, hasWeight: true}
+			if req.by != "" {
+				item.weight, item.hasWeight = sortLookupByPattern(memory, req.by, element)
+			}
+			// missing weights score zero
+			if !req.alpha && item.hasWeight {
+				score, err := strconv.ParseFloat(strings.TrimSpace(item.weight), 64)
+				if err != nil {
+					return nil, nil, SimpleErrorResp("ERR One or more scores can't be converted into double")
+				}
+				item.score = score
+			}
+			items = append(items, item)
+		}
+
+		sort.SliceStable(items, func(i, j int) bool {
+			cmp := sortCompare(items[i], items[j], req.alpha)
+			if req.desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+
+		elements = elements[:0]
+		for _, item := range items {
+			elements = append(elements, item.value)
+		}
+	}
+
+	// apply LIMIT
+	start := min(max(req.offset, 0), len(elements))
+	end := len(elements)
+	if req.count >= 0 && req.count < end-start {
+		end = start + req.count
+	}
+	elements = elements[start:end]
+
+	output := make([]*RESP, 0, len(elements))
+	values := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if len(req.gets) == 0 {
+			output = append(output, BulkStringResp(element))
+			values = append(values, element)
+			continue
+		}
+		for _, pattern := range req.gets {
+			value, _ := sortLookupByPattern(memory, pattern, element)
+			output = append(output, BulkStringResp(value))
+			values = append(values, value)
+		}
+	}
+	return output, values, nil
+}
+
+func sortCompare(a, b sortItem, alpha bool) int {
+	if !alpha {
+		switch {
+		case a.score > b.score:
+			return 1
+		case a.score < b.score:
+			return -1
+		}
+		// same score, compare the elements to keep the result deterministic
+		return strings.Compare(a.value, b.value)
+	}
+	switch {
+	case !a.hasWeight && !b.hasWeight:
+		return 0
+	case !a.hasWeight:
+		return -1
+	case !b.hasWeight:
+		return 1
+	}
+	return strings.Compare(a.weight, b.weight)
+}
+
+func sortCmd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for SORT")
+		}
+		req, errResp := parseSortRequest(resp.Nested[2:], false)
+		if errResp != nil {
+			return errResp, nil
+		}
+		output, values, errResp := sortGeneric(memory, string(resp.Nested[1].Data), req)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		if req.hasStore {
+			list := NewList()
+			for _, value := range values {
+				list.PushBack(value)
+			}
+			memory.Delete(req.store)
+			putList(memory, req.store, list)
+			return IntegerResp(list.Len()), nil
+		}
+		return ArrayResp(output...), nil
+	}
+}
+
+func sortRo(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for SORT_RO")
+		}
+		req, errResp := parseSortRequest(resp.Nested[2:], true)
+		if errResp != nil {
+			return errResp, nil
+		}
+		output, _, errResp := sortGeneric(memory, string(resp.Nested[1].Data), req)
+		if errResp != nil {
+			return errResp, nil
+		}
+		return ArrayResp(output...), nil
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestProcessor_Sort(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "rpush",
+			args:     []string{"RPUSH", "ids", "3", "10", "1", "2"},
+			expected: ":4\r\n",
+		},
+		{
+			name:     "numeric sort",
+			args:     []string{"SORT", "ids"},
+			expected: "*4\r\n$1\r\n1\r\n$1\r\n2\r\n$1\r\n3\r\n$2\r\n10\r\n",
+		},
+		{
+			name:     "alpha desc limit",
+			args:     []string{"SORT", "ids", "ALPHA", "DESC", "LIMIT", "0", "2"},
+			expected: "*2\r\n$1\r\n3\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "limit huge count",
+			args:     []string{"SORT", "ids", "LIMIT", "1", "9223372036854775807"},
+			expected: "*3\r\n$1\r\n2\r\n$1\r\n3\r\n$2\r\n10\r\n",
+		},
+		{
+			name:     "limit huge offset",
+			args:     []string{"SORT", "ids", "LIMIT", "9223372036854775807", "9223372036854775807", "ALPHA"},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "weights",
+			args:     []string{"SET", "weight_1", "30"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "weights 2",
+			args:     []string{"SET", "weight_10", "20"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "names",
+			args:     []string{"SET", "name_10", "ten"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "sort by weight with get",
+			args:     []string{"SORT", "ids", "BY", "weight_*", "GET", "#", "GET", "name_*"},
+			expected: "*8\r\n$1\r\n2\r\n$-1\r\n$1\r\n3\r\n$-1\r\n$2\r\n10\r\n$3\r\nten\r\n$1\r\n1\r\n$-1\r\n",
+		},
+		{
+			name:     "hash field",
+			args:     []string{"HSET", "user_1", "age", "40"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "hash field 2",
+			args:     []string{"HSET", "user_2", "age", "5"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "sort by hash field",
+			args:     []string{"SORT", "ids", "BY", "user_*->age", "GET", "user_*->age"},
+			expected: "*4\r\n$-1\r\n$-1\r\n$1\r\n5\r\n$2\r\n40\r\n",
+		},
+		{
+			name:     "nosort",
+			args:     []string{"SORT", "ids", "BY", "nosort"},
+			expected: "*4\r\n$1\r\n3\r\n$2\r\n10\r\n$1\r\n1\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "sort set into list",
+			args:     []string{"SADD", "tags", "b", "c", "a"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "store",
+			args:     []string{"SORT", "tags", "ALPHA", "STORE", "sorted"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "stored list",
+			args:     []string{"LRANGE", "sorted", "0", "-1"},
+			expected: "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "zset",
+			args:     []string{"ZADD", "z", "2", "x", "1", "y"},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "sort_ro zset nosort desc",
+			args:     []string{"SORT_RO", "z", "BY", "nosort", "DESC"},
+			expected: "*2\r\n$1\r\nx\r\n$1\r\ny\r\n",
+		},
+		{
+			name:     "sort_ro rejects store",
+			args:     []string{"SORT_RO", "z", "STORE", "dst"},
+			expected: "-ERR syntax error\r\n",
+		},
+		{
+			name:     "not numbers",
+			args:     []string{"SORT", "tags"},
+			expected: "-ERR One or more scores can't be converted into double\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
@@ -0,0 +1,1012 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StreamNodeMaxEntries = 100
+	StreamNodeMaxBytes   = 4096
+)
+
+const StreamInvalidIDErr = "ERR Invalid stream ID specified as stream command argument"
+
+// StreamID is the 128 bit ID of a stream entry, IDs are ordered by
+// milliseconds then sequence
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+func (id StreamID) Less(other StreamID) bool {
+	return id.Compare(other) < 0
+}
+
+func (id StreamID) IsZero() bool {
+	return id.Ms == 0 && id.Seq == 0
+}
+
+// Incr returns the following ID, false when the ID is the greatest one
+func (id StreamID) Incr() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Decr returns the preceding ID, false when the ID is 0-0
+func (id StreamID) Decr() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// key encodes the ID in big endian so that keys sort like the IDs
+func (id StreamID) key() []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, id.Ms)
+	binary.BigEndian.PutUint64(key[8:], id.Seq)
+	return key
+}
+
+// ParseStreamID parses "ms-seq", or "ms" alone taking missingSeq as the
+// sequence
+func ParseStreamID(str string, missingSeq uint64) (StreamID, error) {
+	msStr, seqStr, hasSeq := strings.Cut(str, "-")
+	ms, err := strconv.ParseUint(msStr, 10, 64)
+	if err != nil {
+		return StreamID{}, fmt.Errorf(StreamInvalidIDErr)
+	}
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return StreamID{}, fmt.Errorf(StreamInvalidIDErr)
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+type StreamEntry struct {
+	ID StreamID
+	// field, value, field, value... as written, repeated names included
+	Fields []string
+}
+
+const (
+	streamItemDeleted    byte = 1
+	streamItemSameFields byte = 2
+)
+
+// streamNode packs consecutive entries in a byte slice the way redis
+// listpacks do. IDs are stored as deltas from the master ID of the node
+// and entries with the same fields as the master entry only store values:
+//
+//	flags | ms delta | seq delta | [field count | fields...] | values...
+//
+// Strings are prefixed by their length, numbers are uvarints.
+type streamNode struct {
+	master  StreamID
+	fields  []string
+	data    []byte
+	entries int
+	deleted int
+}
+
+// streamItem is a decoded entry of a node, offset locates its flags
+type streamItem struct {
+	StreamEntry
+	offset  int
+	deleted bool
+}
+
+func newStreamNode(master StreamID, fields []string) *streamNode {
+	names := make([]string, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		names = append(names, fields[i])
+	}
+	return &streamNode{master: master, fields: names, data: make([]byte, 0, 256)}
+}
+
+func (n *streamNode) sameFields(fields []string) bool {
+	if len(fields) != len(n.fields)*2 {
+		return false
+	}
+	for i, name := range n.fields {
+		if fields[i*2] != name {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *streamNode) append(id StreamID, fields []string) {
+	flags := byte(0)
+	same := n.sameFields(fields)
+	if same {
+		flags |= streamItemSameFields
+	}
+	n.data = append(n.data, flags)
+	n.data = binary.AppendUvarint(n.data, id.Ms-n.master.Ms)
+	if id.Ms == n.master.Ms {
+		n.data = binary.AppendUvarint(n.data, id.Seq-n.master.Seq)
+	} else {
+		n.data = binary.AppendUvarint(n.data, id.Seq)
+	}
+	if !same {
+		n.data = binary.AppendUvarint(n.data, uint64(len(fields)/2))
+		for i := 0; i < len(fields); i += 2 {
+			n.data = appendStreamString(n.data, fields[i])
+		}
+	}
+	for i := 1; i < len(fields); i += 2 {
+		n.data = appendStreamString(n.data, fields[i])
+	}
+	n.entries++
+}
+
+func appendStreamString(data []byte, str string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(str)))
+	return append(data, str...)
+}
+
+func readStreamString(data []byte, pos int) (string, int) {
+	length, n := binary.Uvarint(data[pos:])
+	pos += n
+	return string(data[pos : pos+int(length)]), pos + int(length)
+}
+
+// items decodes every entry of the node, deleted ones included
+func (n *streamNode) items() []streamItem {
+	items := make([]streamItem, 0, n.entries)
+	for pos := 0; pos < len(n.data); {
+		item := streamItem{offset: pos}
+		flags := n.data[pos]
+		pos++
+		item.deleted = flags&streamItemDeleted != 0
+
+		msDelta, size := binary.Uvarint(n.data[pos:])
+		pos += size
+		seq, size := binary.Uvarint(n.data[pos:])
+		pos += size
+		item.ID = StreamID{Ms: n.master.Ms + msDelta, Seq: seq}
+		if msDelta == 0 {
+			item.ID.Seq += n.master.Seq
+		}
+
+		names := n.fields
+		if flags&streamItemSameFields == 0 {
+			count, size := binary.Uvarint(n.data[pos:])
+			pos += size
+			names = make([]string, count)
+			for i := range names {
+				names[i], pos = readStreamString(n.data, pos)
+			}
+		}
+		item.Fields = make([]string, 0, len(names)*2)
+		for _, name := range names {
+			var value string
+			value, pos = readStreamString(n.data, pos)
+			item.Fields = append(item.Fields, name, value)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// Stream is the value of the stream type: nodes of entries in a radix tree
+// keyed by the ID of their first entry, so that a range starts with a seek
+// instead of a scan. The IDs and counters are stored rather than derived
+// from the entries, which may have been deleted.
+type Stream struct {
+	rax          *Rax
+	length       uint64
+	firstID      StreamID
+	lastID       StreamID
+	maxDeletedID StreamID
+	entriesAdded uint64
+	// name -> *StreamGroup, created with the first group
+	groups *Rax
+}
+
+func NewStream() *Stream {
+	return &Stream{rax: NewRax()}
+}
+
+func (s *Stream) Len() uint64 {
+	return s.length
+}
+
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// NextID resolves the ID of a new entry: "*" for an automatic one, "ms-*"
+// for the next sequence of ms or an explicit ID greater than the last one
+func (s *Stream) NextID(spec string) (StreamID, error) {
+	if spec == "*" {
+		ms := uint64(time.Now().UnixMilli())
+		if ms > s.lastID.Ms {
+			return StreamID{Ms: ms}, nil
+		}
+		// several entries in the same millisecond, or the clock went back
+		next, ok := s.lastID.Incr()
+		if !ok {
+			return StreamID{}, fmt.Errorf("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return next, nil
+	}
+
+	if msStr, ok := strings.CutSuffix(spec, "-*"); ok {
+		ms, err := strconv.ParseUint(msStr, 10, 64)
+		if err != nil {
+			return StreamID{}, fmt.Errorf(StreamInvalidIDErr)
+		}
+		switch {
+		case ms > s.lastID.Ms:
+			return StreamID{Ms: ms}, nil
+		case ms == s.lastID.Ms && s.lastID.Seq < math.MaxUint64:
+			return StreamID{Ms: ms, Seq: s.lastID.Seq + 1}, nil
+		}
+		return StreamID{}, fmt.Errorf("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+
+	id, err := ParseStreamID(spec, 0)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if id.IsZero() {
+		return StreamID{}, fmt.Errorf("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if !s.lastID.Less(id) {
+		return StreamID{}, fmt.Errorf("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	return id, nil
+}
+
+// Add appends the entry to the last node, or to a new one when the last
+// node is full. The ID must be greater than the last ID.
+func (s *Stream) Add(id StreamID, fields []string) {
+	var node *streamNode
+	if _, value, ok := s.rax.Last(); ok {
+		node = value.(*streamNode)
+	}
+	if node == nil || node.entries >= StreamNodeMaxEntries || len(node.data) >= StreamNodeMaxBytes {
+		node = newStreamNode(id, fields)
+		s.rax.Insert(id.key(), node)
+	}
+	node.append(id, fields)
+
+	if s.length == 0 {
+		s.firstID = id
+	}
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+}
+
+// Range returns the entries between start and end included, at most count
+// unless count is zero, from end to start when rev is set
+func (s *Stream) Range(start, end StreamID, count int, rev bool) []StreamEntry {
+	entries := make([]StreamEntry, 0)
+	if end.Less(start) {
+		return entries
+	}
+
+	if !rev {
+		// the node holding start begins before it
+		_, value, ok := s.rax.SeekLE(start.key())
+		if !ok {
+			_, value, ok = s.rax.First()
+		}
+		for ok {
+			node := value.(*streamNode)
+			for _, item := range node.items() {
+				if item.deleted || item.ID.Less(start) {
+					continue
+				}
+				if end.Less(item.ID) {
+					return entries
+				}
+				entries = append(entries, item.StreamEntry)
+				if count > 0 && len(entries) == count {
+					return entries
+				}
+			}
+			_, value, ok = s.rax.Next(node.master.key())
+		}
+		return entries
+	}
+
+	_, value, ok := s.rax.SeekLE(end.key())
+	for ok {
+		node := value.(*streamNode)
+		items := node.items()
+		for i := len(items) - 1; i >= 0; i-- {
+			item := items[i]
+			if item.deleted || end.Less(item.ID) {
+				continue
+			}
+			if item.ID.Less(start) {
+				return entries
+			}
+			entries = append(entries, item.StreamEntry)
+			if count > 0 && len(entries) == count {
+				return entries
+			}
+		}
+		_, value, ok = s.rax.Prev(node.master.key())
+	}
+	return entries
+}
+
+// Lookup returns the entry with the ID, false when it was never added or
+// was deleted
+func (s *Stream) Lookup(id StreamID) (StreamEntry, bool) {
+	entries := s.Range(id, id, 1, false)
+	if len(entries) == 0 {
+		return StreamEntry{}, false
+	}
+	return entries[0], true
+}
+
+// SetID sets the last ID of the stream and optionally its counters, the
+// last ID cannot go back past the entries still in the stream
+func (s *Stream) SetID(id StreamID, entriesAdded *uint64, maxDeletedID *StreamID) error {
+	if entriesAdded != nil && *entriesAdded < s.length {
+		return fmt.Errorf("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	if maxDeletedID != nil && id.Less(*maxDeletedID) {
+		return fmt.Errorf("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+	}
+	if last := s.Range(StreamID{}, MaxStreamID, 1, true); len(last) > 0 && id.Less(last[0].ID) {
+		return fmt.Errorf("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+
+	s.lastID = id
+	if entriesAdded != nil {
+		s.entriesAdded = *entriesAdded
+	}
+	if maxDeletedID != nil {
+		s.maxDeletedID = *maxDeletedID
+	}
+	return nil
+}
+
+// deleteItem flags the entry as deleted, nodes left without entries are
+// removed from the tree
+func (s *Stream) deleteItem(node *streamNode, item streamItem) {
+	node.data[item.offset] |= streamItemDeleted
+	node.deleted++
+	s.length--
+	if node.deleted == node.entries {
+		s.rax.Remove(node.master.key())
+	}
+}
+
+func (s *Stream) updateFirstID() {
+	s.firstID = StreamID{}
+	if entries := s.Range(StreamID{}, MaxStreamID, 1, false); len(entries) > 0 {
+		s.firstID = entries[0].ID
+	}
+}
+
+// Delete removes the entry, it returns false when there is no such entry
+func (s *Stream) Delete(id StreamID) bool {
+	_, value, ok := s.rax.SeekLE(id.key())
+	if !ok {
+		return false
+	}
+	node := value.(*streamNode)
+	for _, item := range node.items() {
+		if item.ID != id || item.deleted {
+			continue
+		}
+		s.deleteItem(node, item)
+		if s.maxDeletedID.Less(id) {
+			s.maxDeletedID = id
+		}
+		if id == s.firstID {
+			s.updateFirstID()
+		}
+		return true
+	}
+	return false
+}
+
+type streamTrimArgs struct {
+	// "MAXLEN" or "MINID"
+	strategy string
+	maxLen   uint64
+	minID    StreamID
+	// approximate trims only remove whole nodes, at most limit entries
+	// unless limit is zero
+	approx bool
+	limit  uint64
+}
+
+// Trim removes the oldest entries beyond maxLen or before minID and returns
+// how many were removed. Whole nodes are dropped first, exact trims then
+// delete the remaining entries one by one.
+func (s *Stream) Trim(trim streamTrimArgs) uint64 {
+	removed := uint64(0)
+	for s.length > 0 {
+		if trim.strategy == "MAXLEN" && s.length <= trim.maxLen {
+			break
+		}
+		_, value, _ := s.rax.First()
+		node := value.(*streamNode)
+		items := node.items()
+		live := uint64(node.entries - node.deleted)
+
+		var whole bool
+		if trim.strategy == "MAXLEN" {
+			whole = s.length-live >= trim.maxLen
+		} else {
+			for i := len(items) - 1; i >= 0; i-- {
+				if !items[i].deleted {
+					whole = items[i].ID.Less(trim.minID)
+					break
+				}
+			}
+		}
+		if whole {
+			if trim.limit > 0 && removed+live > trim.limit {
+				break
+			}
+			s.rax.Remove(node.master.key())
+			s.length -= live
+			removed += live
+			continue
+		}
+		if trim.approx {
+			break
+		}
+
+		for _, item := range items {
+			if item.deleted {
+				continue
+			}
+			if trim.strategy == "MAXLEN" && s.length <= trim.maxLen {
+				break
+			}
+			if trim.strategy == "MINID" && !item.ID.Less(trim.minID) {
+				break
+			}
+			s.deleteItem(node, item)
+			removed++
+		}
+		break
+	}
+	if removed > 0 {
+		s.updateFirstID()
+	}
+	return removed
+}
+
+// getStream returns nil stream when the key does not exist and an error
+// response when the key holds another type
+func getStream(memory *Memory, key string) (*Stream, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "stream" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*Stream), nil
+}
+
+func putStream(memory *Memory, key string, stream *Stream) {
+	memory.Put(key, Entry{Type: "stream", Value: stream}, Option{})
+}
+
+// streamEntriesResp replies the entries as [id, [field, value, ...]] pairs
+func streamEntriesResp(entries []StreamEntry) *RESP {
+	output := ArrayResp()
+	for _, entry := range entries {
+		output.Nested = append(output.Nested, ArrayResp(
+			BulkStringResp(entry.ID.String()),
+			BulkStringArrayResp(entry.Fields),
+		))
+	}
+	return output
+}
+
+// parseStreamTrim parses "MAXLEN|MINID [=|~] threshold [LIMIT count]" at
+// i, it returns the index of the next argument
+func parseStreamTrim(args []*RESP, i int) (streamTrimArgs, int, *RESP) {
+	trim := streamTrimArgs{strategy: strings.ToUpper(string(args[i].Data))}
+	i++
+	if i < len(args) && (string(args[i].Data) == "=" || string(args[i].Data) == "~") {
+		trim.approx = string(args[i].Data) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return trim, 0, SimpleErrorResp("ERR syntax error")
+	}
+	threshold := string(args[i].Data)
+	if trim.strategy == "MAXLEN" {
+		maxLen, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return trim, 0, SimpleErrorResp("ERR value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return trim, 0, SimpleErrorResp("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = uint64(maxLen)
+	} else {
+		minID, err := ParseStreamID(threshold, 0)
+		if err != nil {
+			return trim, 0, SimpleErrorResp(err.Error())
+		}
+		trim.minID = minID
+	}
+	i++
+
+	if trim.approx {
+		trim.limit = StreamNodeMaxEntries * 100
+	}
+	if i+1 < len(args) && strings.ToUpper(string(args[i].Data)) == "LIMIT" {
+		limit, err := strconv.ParseInt(string(args[i+1].Data), 10, 64)
+		if err != nil || limit < 0 {
+			return trim, 0, SimpleErrorResp("ERR The LIMIT argument must be >= 0.")
+		}
+		if !trim.approx {
+			return trim, 0, SimpleErrorResp("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		trim.limit = uint64(limit)
+		i += 2
+	}
+	return trim, i, nil
+}
+
+// xadd parses "key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT
+// count]] id field value [field value ...]", trimming after the entry is
+// added
+func xadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for XADD")
+		}
+		key := string(resp.Nested[1].Data)
+
+		noMkStream := false
+		var trim *streamTrimArgs
+		i := 2
+		for ; i < len(resp.Nested); i++ {
+			opt := strings.ToUpper(string(resp.Nested[i].Data))
+			if opt == "NOMKSTREAM" {
+				noMkStream = true
+				continue
+			}
+			if opt != "MAXLEN" && opt != "MINID" {
+				break
+			}
+			parsed, next, errResp := parseStreamTrim(resp.Nested, i)
+			if errResp != nil {
+				return errResp, nil
+			}
+			trim, i = &parsed, next-1
+		}
+		fieldCount := len(resp.Nested) - i - 1
+		if fieldCount <= 0 || fieldCount%2 != 0 {
+			return SimpleErrorResp("ERR wrong number of arguments for 'xadd' command"), nil
+		}
+
+		stream, errResp := getStream(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if stream == nil {
+			if noMkStream {
+				return BulkStringResp(""), nil
+			}
+			stream = NewStream()
+		}
+
+		id, err := stream.NextID(string(resp.Nested[i].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+
+		fields := make([]string, 0, fieldCount)
+		for _, arg := range resp.Nested[i+1:] {
+			fields = append(fields, string(arg.Data))
+		}
+		stream.Add(id, fields)
+		if trim != nil {
+			stream.Trim(*trim)
+		}
+		putStream(memory, key, stream)
+
+		return BulkStringResp(id.String()), nil
+	}
+}
+
+func xlen(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for XLEN")
+		}
+		stream, errResp := getStream(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if stream == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(int(stream.Len())), nil
+	}
+}
+
+func xdel(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for XDEL")
+		}
+		key := string(resp.Nested[1].Data)
+		stream, errResp := getStream(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		// every ID is checked before deleting any
+		ids := make([]StreamID, 0, len(resp.Nested)-2)
+		for _, arg := range resp.Nested[2:] {
+			id, err := ParseStreamID(string(arg.Data), 0)
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			ids = append(ids, id)
+		}
+		if stream == nil {
+			return IntegerResp(0), nil
+		}
+
+		deleted := 0
+		for _, id := range ids {
+			if stream.Delete(id) {
+				deleted++
+			}
+		}
+		if deleted > 0 {
+			putStream(memory, key, stream)
+		}
+		return IntegerResp(deleted), nil
+	}
+}
+
+// xtrim parses "key MAXLEN|MINID [=|~] threshold [LIMIT count]"
+func xtrim(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for XTRIM")
+		}
+		key := string(resp.Nested[1].Data)
+		strategy := strings.ToUpper(string(resp.Nested[2].Data))
+		if strategy != "MAXLEN" && strategy != "MINID" {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		trim, next, errResp := parseStreamTrim(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if next != len(resp.Nested) {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+
+		stream, errResp := getStream(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if stream == nil {
+			return IntegerResp(0), nil
+		}
+		removed := stream.Trim(trim)
+		if removed > 0 {
+			putStream(memory, key, stream)
+		}
+		return IntegerResp(int(removed)), nil
+	}
+}
+
+// xsetid parses "key last-id [ENTRIESADDED entries-added] [MAXDELETEDID
+// max-deleted-id]"
+func xsetid(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for XSETID")
+		}
+		key := string(resp.Nested[1].Data)
+		id, err := ParseStreamID(string(resp.Nested[2].Data), 0)
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+
+		var entriesAdded *uint64
+		var maxDeletedID *StreamID
+		for i := 3; i < len(resp.Nested); i += 2 {
+			if i+1 >= len(resp.Nested) {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			value := string(resp.Nested[i+1].Data)
+			switch strings.ToUpper(string(resp.Nested[i].Data)) {
+			case "ENTRIESADDED":
+				added, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+				}
+				if added < 0 {
+					return SimpleErrorResp("ERR entries_added must be positive"), nil
+				}
+				count := uint64(added)
+				entriesAdded = &count
+			case "MAXDELETEDID":
+				deleted, err := ParseStreamID(value, 0)
+				if err != nil {
+					return SimpleErrorResp(err.Error()), nil
+				}
+				maxDeletedID = &deleted
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+
+		stream, errResp := getStream(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if stream == nil {
+			return SimpleErrorResp("ERR no such key"), nil
+		}
+		if err := stream.SetID(id, entriesAdded, maxDeletedID); err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		putStream(memory, key, stream)
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+// parseStreamRangeBound parses a bound of a range, "-" and "+" being the
+// smallest and the greatest IDs. An ID without sequence covers the whole
+// millisecond and "(" excludes the ID from the range.
+func parseStreamRangeBound(bound string, end bool) (StreamID, error) {
+	switch bound {
+	case "-":
+		return StreamID{}, nil
+	case "+":
+		return MaxStreamID, nil
+	}
+
+	invalidErr := fmt.Errorf("ERR invalid start ID for the interval")
+	if end {
+		invalidErr = fmt.Errorf("ERR invalid end ID for the interval")
+	}
+	exclusive := strings.HasPrefix(bound, "(")
+	if exclusive {
+		bound = bound[1:]
+		if bound == "-" || bound == "+" {
+			return StreamID{}, invalidErr
+		}
+	}
+	missingSeq := uint64(0)
+	if end {
+		missingSeq = math.MaxUint64
+	}
+	id, err := ParseStreamID(bound, missingSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
+
+	ok := false
+	if end {
+		id, ok = id.Decr()
+	} else {
+		id, ok = id.Incr()
+	}
+	if !ok {
+		return StreamID{}, invalidErr
+	}
+	return id, nil
+}
+
+// xrangeGeneric parses "key start end [COUNT count]", bounds come from end
+// to start when rev is set
+func xrangeGeneric(memory *Memory, rev bool) Executor {
+	command := "XRANGE"
+	if rev {
+		command = "XREVRANGE"
+	}
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for %v", command)
+		}
+		startArg, endArg := string(resp.Nested[2].Data), string(resp.Nested[3].Data)
+		if rev {
+			startArg, endArg = endArg, startArg
+		}
+		start, err := parseStreamRangeBound(startArg, false)
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		end, err := parseStreamRangeBound(endArg, true)
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+
+		count := 0
+		if len(resp.Nested) > 4 {
+			if len(resp.Nested) != 6 || strings.ToUpper(string(resp.Nested[4].Data)) != "COUNT" {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			value, err := strconv.Atoi(string(resp.Nested[5].Data))
+			if err != nil {
+				return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+			}
+			if value <= 0 {
+				return ArrayResp(), nil
+			}
+			count = value
+		}
+
+		stream, errResp := getStream(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if stream == nil {
+			return ArrayResp(), nil
+		}
+		return streamEntriesResp(stream.Range(start, end, count, rev)), nil
+	}
+}
+
+func xrange(memory *Memory) Executor {
+	return xrangeGeneric(memory, false)
+}
+
+func xrevrange(memory *Memory) Executor {
+	return xrangeGeneric(memory, true)
+}
+
+// xread parses "[COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id
+// [id ...]", blocked readers are woken up by the writes to the keys
+func xread(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for XREAD")
+		}
+
+		count := 0
+		block, timeout := false, time.Duration(0)
+		i := 1
+		for ; i < len(resp.Nested); i++ {
+			opt := strings.ToUpper(string(resp.Nested[i].Data))
+			if opt == "STREAMS" {
+				i++
+				break
+			}
+			switch {
+			case opt == "COUNT" && i+1 < len(resp.Nested):
+				value, err := strconv.Atoi(string(resp.Nested[i+1].Data))
+				if err != nil {
+					return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+				}
+				count = max(value, 0)
+				i++
+			case opt == "BLOCK" && i+1 < len(resp.Nested):
+				ms, err := strconv.ParseInt(string(resp.Nested[i+1].Data), 10, 64)
+				if err != nil {
+					return SimpleErrorResp("ERR timeout is not an integer or out of range"), nil
+				}
+				if ms < 0 {
+					return SimpleErrorResp("ERR timeout is negative"), nil
+				}
+				// the duration is counted in nanoseconds
+				if ms > math.MaxInt64/int64(time.Millisecond) {
+					return SimpleErrorResp("ERR timeout is out of range"), nil
+				}
+				block, timeout = true, time.Duration(ms)*time.Millisecond
+				i++
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+		remaining := len(resp.Nested) - i
+		if remaining == 0 || remaining%2 != 0 {
+			return SimpleErrorResp("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified."), nil
+		}
+
+		// streams in the order of the arguments, each read after its ID
+		numStream := remaining / 2
+		keys := make([]string, 0, numStream)
+		after := make(map[string]StreamID, numStream)
+		for j := i; j < i+numStream; j++ {
+			key := string(resp.Nested[j].Data)
+			stream, errResp := getStream(memory, key)
+			if errResp != nil {
+				return errResp, nil
+			}
+			boundId := string(resp.Nested[j+numStream].Data)
+			if boundId == "$" {
+				// only the entries added from now on
+				if stream != nil {
+					after[key] = stream.LastID()
+				}
+			} else {
+				id, err := ParseStreamID(boundId, 0)
+				if err != nil {
+					return SimpleErrorResp(err.Error()), nil
+				}
+				after[key] = id
+			}
+			keys = append(keys, key)
+		}
+
+		serve := func() (*RESP, bool) {
+			output := ArrayResp()
+			for _, key := range keys {
+				stream, _ := getStream(memory, key)
+				if stream == nil {
+					continue
+				}
+				start, ok := after[key].Incr()
+				if !ok {
+					continue
+				}
+				entries := stream.Range(start, MaxStreamID, count, false)
+				if len(entries) > 0 {
+					output.Nested = append(output.Nested, ArrayResp(BulkStringResp(key), streamEntriesResp(entries)))
+				}
+			}
+			if len(output.Nested) == 0 {
+				return nil, false
+			}
+			return output, true
+		}
+
+		if !block {
+			if output, ok := serve(); ok {
+				return output, nil
+			}
+			return NullArrayResp(), nil
+		}
+		output := blockForKeys(client, memory, keys, timeout, serve)
+		if output == nil {
+			return NullArrayResp(), nil
+		}
+		return output, nil
+	}
+}
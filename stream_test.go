@@ -0,0 +1,646 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestStream_RangeAcrossNodes(t *testing.T) {
+	stream := NewStream()
+	for i := 0; i < 1000; i++ {
+		// alternate field names so that both node encodings are used
+		fields := []string{"n", fmt.Sprint(i)}
+		if i%3 == 0 {
+			fields = []string{"other", fmt.Sprint(i), "x", ""}
+		}
+		stream.Add(StreamID{Ms: uint64(i / 10), Seq: uint64(i % 10)}, fields)
+	}
+	if stream.rax.Len() < 1000/StreamNodeMaxEntries {
+		t.Errorf("expected entries split in nodes - actual nodes: %v", stream.rax.Len())
+	}
+
+	entries := stream.Range(StreamID{Ms: 9, Seq: 5}, StreamID{Ms: 20, Seq: 3}, 0, false)
+	if len(entries) != 109 || entries[0].ID != (StreamID{Ms: 9, Seq: 5}) || entries[108].ID != (StreamID{Ms: 20, Seq: 3}) {
+		t.Fatalf("forward range - actual: %v entries", len(entries))
+	}
+	for _, entry := range entries {
+		i := entry.ID.Ms*10 + entry.ID.Seq
+		if entry.Fields[1] != fmt.Sprint(i) {
+			t.Fatalf("entry %v - actual fields: %v", entry.ID, entry.Fields)
+		}
+	}
+
+	entries = stream.Range(StreamID{}, MaxStreamID, 5, true)
+	if len(entries) != 5 || entries[0].ID != (StreamID{Ms: 99, Seq: 9}) || entries[4].ID != (StreamID{Ms: 99, Seq: 5}) {
+		t.Fatalf("reverse range - actual: %v", entries)
+	}
+	if entries := stream.Range(StreamID{Ms: 200}, MaxStreamID, 0, false); len(entries) != 0 {
+		t.Errorf("range after last - actual: %v", entries)
+	}
+}
+
+func TestStream_NextID(t *testing.T) {
+	stream := NewStream()
+	testcases := []struct {
+		spec     string
+		expected string
+		err      string
+	}{
+		{spec: "0-0", err: "ERR The ID specified in XADD must be greater than 0-0"},
+		{spec: "0-*", expected: "0-1"},
+		{spec: "9-0", expected: "9-0"},
+		// numeric, not string, comparison
+		{spec: "10-0", expected: "10-0"},
+		{spec: "10-*", expected: "10-1"},
+		{spec: "9-*", err: "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		{spec: "10-1", err: "ERR The ID specified in XADD is equal or smaller than the target stream top item"},
+		{spec: "18446744073709551615-18446744073709551615", expected: "18446744073709551615-18446744073709551615"},
+		{spec: "*", err: "ERR The stream has exhausted the last possible ID, unable to add more items"},
+		{spec: "abc", err: StreamInvalidIDErr},
+		{spec: "1-x", err: StreamInvalidIDErr},
+	}
+	for _, tt := range testcases {
+		id, err := stream.NextID(tt.spec)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("spec: %v - expected error: %v - actual: %v", tt.spec, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || id.String() != tt.expected {
+			t.Errorf("spec: %v - expected: %v - actual: %v %v", tt.spec, tt.expected, id, err)
+			continue
+		}
+		stream.Add(id, []string{"f", "v"})
+	}
+}
+
+func BenchmarkStream_Add(b *testing.B) {
+	stream := NewStream()
+	fields := []string{"sensor", "1", "value", "42"}
+	for i := 0; i < b.N; i++ {
+		id, _ := stream.NextID("*")
+		stream.Add(id, fields)
+	}
+}
+
+func TestProcessor_Stream(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "xadd",
+			args:     []string{"XADD", "s", "9-1", "a", "1"},
+			expected: "$3\r\n9-1\r\n",
+		},
+		{
+			name:     "xadd greater numeric id",
+			args:     []string{"XADD", "s", "10-0", "b", "2"},
+			expected: "$4\r\n10-0\r\n",
+		},
+		{
+			name:     "xadd smaller id",
+			args:     []string{"XADD", "s", "9-5", "c", "3"},
+			expected: "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n",
+		},
+		{
+			name:     "xadd invalid id",
+			args:     []string{"XADD", "s", "x-1", "c", "3"},
+			expected: "-ERR Invalid stream ID specified as stream command argument\r\n",
+		},
+		{
+			name:     "xrange",
+			args:     []string{"XRANGE", "s", "-", "+"},
+			expected: "*2\r\n*2\r\n$3\r\n9-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$4\r\n10-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "xrange bounds",
+			args:     []string{"XRANGE", "s", "10-0", "10-0"},
+			expected: "*1\r\n*2\r\n$4\r\n10-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "xread",
+			args:     []string{"XREAD", "streams", "s", "9-1"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$4\r\n10-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "type",
+			args:     []string{"TYPE", "s"},
+			expected: "+stream\r\n",
+		},
+		{
+			name:     "hash",
+			args:     []string{"HSET", "h", "f", "v"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xadd on hash",
+			args:     []string{"XADD", "h", "*", "f", "v"},
+			expected: "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
+
+func TestProcessor_StreamFieldOrder(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+
+	// enough fields for a map to shuffle them, with a repeated name
+	fields := []string{"z", "1", "a", "2", "m", "3", "a", "4"}
+	for i := 0; i < 20; i++ {
+		fields = append(fields, fmt.Sprintf("f%d", 19-i), fmt.Sprint(i))
+	}
+	args := append([]string{"XADD", "s", "1-1"}, fields...)
+	if _, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(args))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// same field names as the first entry, stored without them
+	args = append([]string{"XADD", "s", "1-2"}, fields...)
+	if _, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(args))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	entry := ArrayResp(BulkStringResp("1-1"), BulkStringArrayResp(fields))
+	second := ArrayResp(BulkStringResp("1-2"), BulkStringArrayResp(fields))
+	testcases := []struct {
+		name     string
+		args     []string
+		expected *RESP
+	}{
+		{
+			name:     "xrange",
+			args:     []string{"XRANGE", "s", "-", "+"},
+			expected: ArrayResp(entry, second),
+		},
+		{
+			name:     "xread",
+			args:     []string{"XREAD", "streams", "s", "0-0"},
+			expected: ArrayResp(ArrayResp(BulkStringResp("s"), ArrayResp(entry, second))),
+		},
+	}
+	for _, tt := range testcases {
+		expected := string(respParser.Serialize(tt.expected))
+		for i := 0; i < 100; i++ {
+			output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+			if err != nil {
+				t.Fatalf("test: %v - unexpected error: %v", tt.name, err)
+			}
+			if string(output) != expected {
+				t.Fatalf("test: %v - read %v - expected: %q - actual: %q", tt.name, i, expected, string(output))
+			}
+		}
+	}
+}
+
+func TestStream_Trim(t *testing.T) {
+	newStream := func() *Stream {
+		stream := NewStream()
+		for i := 1; i <= 250; i++ {
+			stream.Add(StreamID{Ms: uint64(i)}, []string{"f", "v"})
+		}
+		return stream
+	}
+	testcases := []struct {
+		name     string
+		trim     streamTrimArgs
+		removed  uint64
+		expected uint64
+	}{
+		{name: "exact maxlen", trim: streamTrimArgs{strategy: "MAXLEN", maxLen: 120}, removed: 130, expected: 120},
+		{name: "approx maxlen keeps partial nodes", trim: streamTrimArgs{strategy: "MAXLEN", maxLen: 120, approx: true}, removed: 100, expected: 150},
+		{name: "approx maxlen with limit", trim: streamTrimArgs{strategy: "MAXLEN", maxLen: 10, approx: true, limit: 150}, removed: 100, expected: 150},
+		{name: "exact minid", trim: streamTrimArgs{strategy: "MINID", minID: StreamID{Ms: 201}}, removed: 200, expected: 50},
+		{name: "approx minid", trim: streamTrimArgs{strategy: "MINID", minID: StreamID{Ms: 150}, approx: true}, removed: 100, expected: 150},
+		{name: "nothing to trim", trim: streamTrimArgs{strategy: "MAXLEN", maxLen: 1000}, removed: 0, expected: 250},
+		{name: "everything", trim: streamTrimArgs{strategy: "MAXLEN", maxLen: 0}, removed: 250, expected: 0},
+	}
+	for _, tt := range testcases {
+		stream := newStream()
+		removed := stream.Trim(tt.trim)
+		if removed != tt.removed || stream.Len() != tt.expected {
+			t.Errorf("test: %v - expected: %v removed %v left - actual: %v removed %v left", tt.name, tt.removed, tt.expected, removed, stream.Len())
+			continue
+		}
+		entries := stream.Range(StreamID{}, MaxStreamID, 0, false)
+		if uint64(len(entries)) != tt.expected {
+			t.Errorf("test: %v - expected %v entries - actual: %v", tt.name, tt.expected, len(entries))
+		}
+		if len(entries) > 0 && (entries[0].ID != stream.firstID || entries[0].ID.Ms != 250-tt.expected+1) {
+			t.Errorf("test: %v - unexpected first entry: %v - first id: %v", tt.name, entries[0].ID, stream.firstID)
+		}
+	}
+}
+
+func TestProcessor_StreamHousekeeping(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "xadd odd field count",
+			args:     []string{"XADD", "s", "1-1", "a"},
+			expected: "-ERR wrong number of arguments for 'xadd' command\r\n",
+		},
+		{
+			name:     "xadd without fields",
+			args:     []string{"XADD", "s", "1-1"},
+			expected: "-ERR wrong number of arguments for 'xadd' command\r\n",
+		},
+		{
+			name:     "xadd nomkstream",
+			args:     []string{"XADD", "s", "NOMKSTREAM", "1-1", "a", "1"},
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "xlen missing",
+			args:     []string{"XLEN", "s"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "xadd 1",
+			args:     []string{"XADD", "s", "1-1", "a", "1"},
+			expected: "$3\r\n1-1\r\n",
+		},
+		{
+			name:     "xadd 2",
+			args:     []string{"XADD", "s", "2-1", "a", "2"},
+			expected: "$3\r\n2-1\r\n",
+		},
+		{
+			name:     "xadd 3 with maxlen",
+			args:     []string{"XADD", "s", "NOMKSTREAM", "MAXLEN", "=", "2", "3-1", "a", "3"},
+			expected: "$3\r\n3-1\r\n",
+		},
+		{
+			name:     "xlen after maxlen",
+			args:     []string{"XLEN", "s"},
+			expected: ":2\r\n",
+		},
+		{
+			name:     "xadd 4 with minid",
+			args:     []string{"XADD", "s", "MINID", "3", "4-1", "a", "4"},
+			expected: "$3\r\n4-1\r\n",
+		},
+		{
+			name:     "xrange after minid",
+			args:     []string{"XRANGE", "s", "-", "+"},
+			expected: "*2\r\n*2\r\n$3\r\n3-1\r\n*2\r\n$1\r\na\r\n$1\r\n3\r\n*2\r\n$3\r\n4-1\r\n*2\r\n$1\r\na\r\n$1\r\n4\r\n",
+		},
+		{
+			name:     "xdel",
+			args:     []string{"XDEL", "s", "3-1", "9-9"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xdel invalid id",
+			args:     []string{"XDEL", "s", "4-1", "x"},
+			expected: "-ERR Invalid stream ID specified as stream command argument\r\n",
+		},
+		{
+			name:     "xlen after xdel",
+			args:     []string{"XLEN", "s"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xtrim limit without approx",
+			args:     []string{"XTRIM", "s", "MAXLEN", "0", "LIMIT", "10"},
+			expected: "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n",
+		},
+		{
+			name:     "xtrim negative maxlen",
+			args:     []string{"XTRIM", "s", "MAXLEN", "-1"},
+			expected: "-ERR The MAXLEN argument must be >= 0.\r\n",
+		},
+		{
+			name:     "xtrim approx removes whole nodes",
+			args:     []string{"XTRIM", "s", "MAXLEN", "~", "0"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xlen after xtrim",
+			args:     []string{"XLEN", "s"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "xadd after emptied",
+			args:     []string{"XADD", "s", "4-*", "a", "5"},
+			expected: "$3\r\n4-2\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
+
+func TestProcessor_XReadBlock(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	writer := processor.Connect("writer")
+	accept := func(args ...string) string {
+		output, err := processor.Accept(writer, respParser.Serialize(BulkStringArrayResp(args)))
+		if err != nil {
+			t.Fatalf("%v - unexpected error: %v", args, err)
+		}
+		return string(output)
+	}
+
+	accept("XADD", "s", "1-1", "a", "1")
+	accept("XADD", "s", "2-1", "a", "2")
+	expected := "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"
+	if output := accept("xread", "count", "1", "streams", "s", "0"); output != expected {
+		t.Errorf("count - expected: %q - actual: %q", expected, output)
+	}
+	if output := accept("XREAD", "STREAMS", "s", "$"); output != "*-1\r\n" {
+		t.Errorf("$ without blocking - actual: %q", output)
+	}
+
+	if output := accept("XREAD", "BLOCK", "9223372036854775807", "STREAMS", "s", "$"); output != "-ERR timeout is out of range\r\n" {
+		t.Errorf("huge timeout - actual: %q", output)
+	}
+
+	// the timeout expires without writes
+	start := time.Now()
+	if output := accept("XREAD", "BLOCK", "50", "STREAMS", "s", "$"); output != "*-1\r\n" {
+		t.Errorf("timeout - actual: %q", output)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("timeout returned early after %v", elapsed)
+	}
+
+	// a write wakes the reader up well before the timeout
+	done := make(chan string)
+	go func() {
+		output, _ := processor.Accept(processor.Connect("blocked"), respParser.Serialize(BulkStringArrayResp([]string{"XREAD", "BLOCK", "10000", "STREAMS", "other", "s", "$", "$"})))
+		done <- string(output)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	accept("XADD", "s", "3-1", "a", "3")
+
+	select {
+	case output := <-done:
+		expected := "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n3-1\r\n*2\r\n$1\r\na\r\n$1\r\n3\r\n"
+		if output != expected {
+			t.Errorf("expected: %q - actual: %q", expected, output)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("XREAD was not woken up by XADD")
+	}
+
+	// the reader is released when its client disconnects
+	closed := processor.Connect("closed")
+	go func() {
+		output, _ := processor.Accept(closed, respParser.Serialize(BulkStringArrayResp([]string{"XREAD", "BLOCK", "0", "STREAMS", "s", "$"})))
+		done <- string(output)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	processor.Disconnect(closed)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("XREAD was not released on disconnection")
+	}
+}
+
+func TestProcessor_StreamRange(t *testing.T) {
+	respParser := NewRESP()
+	entry := func(id, value string) string {
+		return fmt.Sprintf("*2\r\n$%d\r\n%v\r\n*2\r\n$1\r\na\r\n$%d\r\n%v\r\n", len(id), id, len(value), value)
+	}
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "xrange missing key",
+			args:     []string{"XRANGE", "s", "-", "+"},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "xadd 1",
+			args:     []string{"XADD", "s", "5-1", "a", "1"},
+			expected: "$3\r\n5-1\r\n",
+		},
+		{
+			name:     "xadd 2",
+			args:     []string{"XADD", "s", "5-2", "a", "2"},
+			expected: "$3\r\n5-2\r\n",
+		},
+		{
+			name:     "xadd 3",
+			args:     []string{"XADD", "s", "6-0", "a", "3"},
+			expected: "$3\r\n6-0\r\n",
+		},
+		{
+			// far past the wall clock
+			name:     "xadd 4",
+			args:     []string{"XADD", "s", "99999999999999-0", "a", "4"},
+			expected: "$16\r\n99999999999999-0\r\n",
+		},
+		{
+			name:     "xrange all",
+			args:     []string{"XRANGE", "s", "-", "+"},
+			expected: "*4\r\n" + entry("5-1", "1") + entry("5-2", "2") + entry("6-0", "3") + entry("99999999999999-0", "4"),
+		},
+		{
+			name:     "xrange incomplete ids",
+			args:     []string{"XRANGE", "s", "5", "5"},
+			expected: "*2\r\n" + entry("5-1", "1") + entry("5-2", "2"),
+		},
+		{
+			name:     "xrange exclusive bounds",
+			args:     []string{"XRANGE", "s", "(5-1", "(6-0"},
+			expected: "*1\r\n" + entry("5-2", "2"),
+		},
+		{
+			name:     "xrange exclusive incomplete start",
+			args:     []string{"XRANGE", "s", "(5", "6"},
+			expected: "*3\r\n" + entry("5-1", "1") + entry("5-2", "2") + entry("6-0", "3"),
+		},
+		{
+			name:     "xrange count",
+			args:     []string{"XRANGE", "s", "-", "+", "count", "2"},
+			expected: "*2\r\n" + entry("5-1", "1") + entry("5-2", "2"),
+		},
+		{
+			name:     "xrange next page",
+			args:     []string{"XRANGE", "s", "(5-2", "+", "COUNT", "2"},
+			expected: "*2\r\n" + entry("6-0", "3") + entry("99999999999999-0", "4"),
+		},
+		{
+			name:     "xrange count zero",
+			args:     []string{"XRANGE", "s", "-", "+", "COUNT", "0"},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "xrevrange",
+			args:     []string{"XREVRANGE", "s", "+", "-", "COUNT", "3"},
+			expected: "*3\r\n" + entry("99999999999999-0", "4") + entry("6-0", "3") + entry("5-2", "2"),
+		},
+		{
+			name:     "xrevrange exclusive incomplete",
+			args:     []string{"XREVRANGE", "s", "(6", "5"},
+			expected: "*3\r\n" + entry("6-0", "3") + entry("5-2", "2") + entry("5-1", "1"),
+		},
+		{
+			name:     "xrevrange exclusive",
+			args:     []string{"XREVRANGE", "s", "(6-0", "(5-1"},
+			expected: "*1\r\n" + entry("5-2", "2"),
+		},
+		{
+			name:     "xrange exclusive special id",
+			args:     []string{"XRANGE", "s", "(-", "+"},
+			expected: "-ERR invalid start ID for the interval\r\n",
+		},
+		{
+			name:     "xrange exclusive end of 0-0",
+			args:     []string{"XRANGE", "s", "-", "(0-0"},
+			expected: "-ERR invalid end ID for the interval\r\n",
+		},
+		{
+			name:     "xrange syntax error",
+			args:     []string{"XRANGE", "s", "-", "+", "LIMIT", "1"},
+			expected: "-ERR syntax error\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
+
+func TestProcessor_XSetID(t *testing.T) {
+	respParser := NewRESP()
+	future := fmt.Sprint(time.Now().Add(time.Hour).UnixMilli())
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "xsetid missing key",
+			args:     []string{"XSETID", "s", "1-1"},
+			expected: "-ERR no such key\r\n",
+		},
+		{
+			name:     "xadd 1",
+			args:     []string{"XADD", "s", "5-1", "a", "1"},
+			expected: "$3\r\n5-1\r\n",
+		},
+		{
+			name:     "xadd 2",
+			args:     []string{"XADD", "s", "5-2", "a", "2"},
+			expected: "$3\r\n5-2\r\n",
+		},
+		{
+			name:     "xsetid before top item",
+			args:     []string{"XSETID", "s", "5-1"},
+			expected: "-ERR The ID specified in XSETID is smaller than the target stream top item\r\n",
+		},
+		{
+			name:     "xsetid entries added below length",
+			args:     []string{"XSETID", "s", "9-0", "ENTRIESADDED", "1"},
+			expected: "-ERR The entries_added specified in XSETID is smaller than the target stream length\r\n",
+		},
+		{
+			name:     "xsetid negative entries added",
+			args:     []string{"XSETID", "s", "9-0", "ENTRIESADDED", "-1"},
+			expected: "-ERR entries_added must be positive\r\n",
+		},
+		{
+			name:     "xsetid max deleted id after last id",
+			args:     []string{"XSETID", "s", "9-0", "MAXDELETEDID", "10-0"},
+			expected: "-ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id\r\n",
+		},
+		{
+			name:     "xsetid syntax error",
+			args:     []string{"XSETID", "s", "9-0", "ENTRIESADDED"},
+			expected: "-ERR syntax error\r\n",
+		},
+		{
+			name:     "xsetid",
+			args:     []string{"XSETID", "s", "9-0", "entriesadded", "10", "maxdeletedid", "4-0"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "xadd before last id",
+			args:     []string{"XADD", "s", "8-0", "a", "3"},
+			expected: "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n",
+		},
+		{
+			name:     "xadd after last id",
+			args:     []string{"XADD", "s", "9-*", "a", "3"},
+			expected: "$3\r\n9-1\r\n",
+		},
+		{
+			name:     "xinfo stream counters",
+			args:     []string{"XINFO", "STREAM", "s", "FULL", "COUNT", "0"},
+			expected: "*18\r\n$6\r\nlength\r\n:3\r\n$15\r\nradix-tree-keys\r\n:1\r\n$16\r\nradix-tree-nodes\r\n:2\r\n$17\r\nlast-generated-id\r\n$3\r\n9-1\r\n$20\r\nmax-deleted-entry-id\r\n$3\r\n4-0\r\n$13\r\nentries-added\r\n:11\r\n$23\r\nrecorded-first-entry-id\r\n$3\r\n5-1\r\n$7\r\nentries\r\n*3\r\n*2\r\n$3\r\n5-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n5-2\r\n*2\r\n$1\r\na\r\n$1\r\n2\r\n*2\r\n$3\r\n9-1\r\n*2\r\n$1\r\na\r\n$1\r\n3\r\n$6\r\ngroups\r\n*0\r\n",
+		},
+		{
+			// auto IDs keep increasing when the last ID is ahead of the clock
+			name:     "xsetid ahead of the clock",
+			args:     []string{"XSETID", "s", future + "-5"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "xadd auto id",
+			args:     []string{"XADD", "s", "*", "a", "4"},
+			expected: fmt.Sprintf("$%d\r\n%v-6\r\n", len(future)+2, future),
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
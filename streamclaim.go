@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// XAUTOCLAIM scans up to COUNT times this many pending entries
+const streamAutoclaimAttemptsFactor = 10
+
+func noKeyOrGroupErr(key, group string) *RESP {
+	return SimpleErrorResp(fmt.Sprintf("NOGROUP No such key '%v' or consumer group '%v'", key, group))
+}
+
+// lookupGroup returns the group of the stream, the error is replied when the
+// key or the group is missing
+func lookupGroup(memory *Memory, key, groupName string) (*Stream, *StreamGroup, *RESP) {
+	stream, errResp := getStream(memory, key)
+	if errResp != nil {
+		return nil, nil, errResp
+	}
+	if stream == nil || stream.Group(groupName) == nil {
+		return nil, nil, noKeyOrGroupErr(key, groupName)
+	}
+	return stream, stream.Group(groupName), nil
+}
+
+// claimedResp replies the claimed entries, or only their IDs when justID
+func claimedResp(entries []StreamEntry, justID bool) *RESP {
+	if !justID {
+		return streamEntriesResp(entries)
+	}
+	output := ArrayResp()
+	for _, entry := range entries {
+		output.Nested = append(output.Nested, BulkStringResp(entry.ID.String()))
+	}
+	return output
+}
+
+// xclaim parses "key group consumer min-idle-time id [id ...] [IDLE ms]
+// [TIME unix-time-milliseconds] [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID
+// id]", entries pending for less than min-idle-time are left to their owner
+// and deleted entries are dropped from the pending entries
+func xclaim(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 6 {
+			return nil, fmt.Errorf("insufficient arguments for XCLAIM")
+		}
+		key, groupName, consumerName := string(resp.Nested[1].Data), string(resp.Nested[2].Data), string(resp.Nested[3].Data)
+		stream, group, errResp := lookupGroup(memory, key, groupName)
+		if errResp != nil {
+			return errResp, nil
+		}
+		minIdle, err := strconv.ParseInt(string(resp.Nested[4].Data), 10, 64)
+		if err != nil {
+			return SimpleErrorResp("ERR Invalid min-idle-time argument for XCLAIM"), nil
+		}
+
+		// IDs go on until the first argument which is not one
+		ids := make([]StreamID, 0)
+		i := 5
+		for ; i < len(resp.Nested); i++ {
+			id, err := ParseStreamID(string(resp.Nested[i].Data), 0)
+			if err != nil {
+				break
+			}
+			ids = append(ids, id)
+		}
+
+		now := nowMillis()
+		deliveryTime := now
+		retryCount := int64(-1)
+		force, justID := false, false
+		lastID, hasLastID := StreamID{}, false
+		for ; i < len(resp.Nested); i++ {
+			opt := strings.ToUpper(string(resp.Nested[i].Data))
+			hasValue := i+1 < len(resp.Nested)
+			switch {
+			case opt == "FORCE":
+				force = true
+			case opt == "JUSTID":
+				justID = true
+			case opt == "IDLE" && hasValue:
+				i++
+				idle, err := strconv.ParseInt(string(resp.Nested[i].Data), 10, 64)
+				if err != nil {
+					return SimpleErrorResp("ERR Invalid IDLE option argument for XCLAIM"), nil
+				}
+				deliveryTime = now - idle
+			case opt == "TIME" && hasValue:
+				i++
+				value, err := strconv.ParseInt(string(resp.Nested[i].Data), 10, 64)
+				if err != nil {
+					return SimpleErrorResp("ERR Invalid TIME option argument for XCLAIM"), nil
+				}
+				deliveryTime = value
+			case opt == "RETRYCOUNT" && hasValue:
+				i++
+				value, err := strconv.ParseInt(string(resp.Nested[i].Data), 10, 64)
+				if err != nil || value < 0 {
+					return SimpleErrorResp("ERR Invalid RETRYCOUNT option argument for XCLAIM"), nil
+				}
+				retryCount = value
+			case opt == "LASTID" && hasValue:
+				i++
+				id, err := ParseStreamID(string(resp.Nested[i].Data), 0)
+				if err != nil {
+					return SimpleErrorResp(err.Error()), nil
+				}
+				lastID, hasLastID = id, true
+			default:
+				return SimpleErrorResp(fmt.Sprintf("ERR Unrecognized XCLAIM option '%v'", string(resp.Nested[i].Data))), nil
+			}
+		}
+		// delivery times are never in the future
+		if deliveryTime < 0 || deliveryTime > now {
+			deliveryTime = now
+		}
+
+		if hasLastID && group.lastID.Less(lastID) {
+			group.lastID = lastID
+		}
+		consumer := group.LookupConsumer(consumerName)
+		claimed := make([]StreamEntry, 0, len(ids))
+		for _, id := range ids {
+			entry, exists := stream.Lookup(id)
+			nack := group.nack(id)
+			if nack == nil {
+				// FORCE creates the pending entry whatever the idle time
+				if !force || !exists {
+					continue
+				}
+			} else if !exists {
+				group.Ack(id)
+				continue
+			} else if minIdle > 0 && now-nack.deliveryTime < minIdle {
+				continue
+			}
+
+			nack = group.assign(id, consumer, deliveryTime)
+			if retryCount >= 0 {
+				nack.deliveryCount = uint64(retryCount)
+			} else if !justID {
+				nack.deliveryCount++
+			}
+			consumer.activeTime = now
+			claimed = append(claimed, entry)
+		}
+		return claimedResp(claimed, justID), nil
+	}
+}
+
+// xautoclaim parses "key group consumer min-idle-time start [COUNT count]
+// [JUSTID]", it scans the pending entries from start and replies the cursor
+// to resume from, 0-0 once the scan is over, the claimed entries and the IDs
+// of the deleted entries dropped on the way
+func xautoclaim(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 6 {
+			return nil, fmt.Errorf("insufficient arguments for XAUTOCLAIM")
+		}
+		key, groupName, consumerName := string(resp.Nested[1].Data), string(resp.Nested[2].Data), string(resp.Nested[3].Data)
+		stream, group, errResp := lookupGroup(memory, key, groupName)
+		if errResp != nil {
+			return errResp, nil
+		}
+		minIdle, err := strconv.ParseInt(string(resp.Nested[4].Data), 10, 64)
+		if err != nil {
+			return SimpleErrorResp("ERR Invalid min-idle-time argument for XAUTOCLAIM"), nil
+		}
+		start, err := parseStreamRangeBound(string(resp.Nested[5].Data), false)
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+
+		count, justID := 100, false
+		for i := 6; i < len(resp.Nested); i++ {
+			opt := strings.ToUpper(string(resp.Nested[i].Data))
+			switch {
+			case opt == "JUSTID":
+				justID = true
+			case opt == "COUNT" && i+1 < len(resp.Nested):
+				i++
+				value, err := strconv.Atoi(string(resp.Nested[i].Data))
+				if err != nil || value <= 0 || value > math.MaxInt/streamAutoclaimAttemptsFactor {
+					return SimpleErrorResp("ERR COUNT must be > 0"), nil
+				}
+				count = value
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+
+		now := nowMillis()
+		consumer := group.LookupConsumer(consumerName)
+		claimed := make([]StreamEntry, 0)
+		deleted := ArrayResp()
+		// bounds the work when few entries are idle enough
+		attempts := count * streamAutoclaimAttemptsFactor
+		pelKey, value, ok := group.pel.SeekGE(start.key())
+		for ; ok && attempts > 0 && len(claimed) < count; pelKey, value, ok = group.pel.Next(pelKey) {
+			attempts--
+			nack := value.(*streamNACK)
+			entry, exists := stream.Lookup(nack.id)
+			if !exists {
+				group.Ack(nack.id)
+				deleted.Nested = append(deleted.Nested, BulkStringResp(nack.id.String()))
+				continue
+			}
+			if minIdle > 0 && now-nack.deliveryTime < minIdle {
+				continue
+			}
+
+			group.assign(nack.id, consumer, now)
+			if !justID {
+				nack.deliveryCount++
+			}
+			consumer.activeTime = now
+			claimed = append(claimed, entry)
+		}
+
+		cursor := StreamID{}
+		if ok {
+			cursor = value.(*streamNACK).id
+		}
+		return ArrayResp(BulkStringResp(cursor.String()), claimedResp(claimed, justID), deleted), nil
+	}
+}
@@ -0,0 +1,690 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamGroupInvalidEntriesRead marks the number of entries read by a
+// group as unknown, it is estimated again on the next read
+const StreamGroupInvalidEntriesRead = -1
+
+// streamNACK is an entry of a pending entries list: delivered to a consumer
+// and not acknowledged yet
+type streamNACK struct {
+	id            StreamID
+	consumer      *StreamConsumer
+	deliveryTime  int64
+	deliveryCount uint64
+}
+
+type StreamConsumer struct {
+	name string
+	// last time the consumer tried an interaction and last time it read or
+	// claimed entries, in milliseconds
+	seenTime   int64
+	activeTime int64
+	// ID -> *streamNACK shared with the group
+	pel *Rax
+}
+
+// StreamGroup is a consumer group: the last ID delivered to its consumers
+// and the entries delivered but not acknowledged yet
+type StreamGroup struct {
+	name        string
+	lastID      StreamID
+	entriesRead int64
+	// ID -> *streamNACK
+	pel *Rax
+	// name -> *StreamConsumer
+	consumers *Rax
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+func newStreamGroup(name string, lastID StreamID, entriesRead int64) *StreamGroup {
+	return &StreamGroup{
+		name:        name,
+		lastID:      lastID,
+		entriesRead: entriesRead,
+		pel:         NewRax(),
+		consumers:   NewRax(),
+	}
+}
+
+func (s *Stream) Group(name string) *StreamGroup {
+	if s.groups == nil {
+		return nil
+	}
+	group, ok := s.groups.Find([]byte(name))
+	if !ok {
+		return nil
+	}
+	return group.(*StreamGroup)
+}
+
+// CreateGroup returns nil when the group already exists
+func (s *Stream) CreateGroup(name string, lastID StreamID, entriesRead int64) *StreamGroup {
+	if s.groups == nil {
+		s.groups = NewRax()
+	}
+	if _, ok := s.groups.Find([]byte(name)); ok {
+		return nil
+	}
+	group := newStreamGroup(name, lastID, entriesRead)
+	s.groups.Insert([]byte(name), group)
+	return group
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if s.groups == nil {
+		return false
+	}
+	return s.groups.Remove([]byte(name))
+}
+
+func (g *StreamGroup) Consumer(name string) *StreamConsumer {
+	consumer, ok := g.consumers.Find([]byte(name))
+	if !ok {
+		return nil
+	}
+	return consumer.(*StreamConsumer)
+}
+
+// CreateConsumer returns nil when the consumer already exists
+func (g *StreamGroup) CreateConsumer(name string) *StreamConsumer {
+	if g.Consumer(name) != nil {
+		return nil
+	}
+	now := nowMillis()
+	consumer := &StreamConsumer{name: name, seenTime: now, activeTime: -1, pel: NewRax()}
+	g.consumers.Insert([]byte(name), consumer)
+	return consumer
+}
+
+// LookupConsumer returns the consumer, created when missing, and marks it
+// as seen
+func (g *StreamGroup) LookupConsumer(name string) *StreamConsumer {
+	consumer := g.Consumer(name)
+	if consumer == nil {
+		consumer = g.CreateConsumer(name)
+	}
+	consumer.seenTime = nowMillis()
+	return consumer
+}
+
+// DeleteConsumer removes the consumer and its pending entries, it returns
+// how many entries were pending
+func (g *StreamGroup) DeleteConsumer(name string) int {
+	consumer := g.Consumer(name)
+	if consumer == nil {
+		return 0
+	}
+	pending := consumer.pel.Len()
+	for _, nack := range raxValues(consumer.pel) {
+		g.pel.Remove(nack.(*streamNACK).id.key())
+	}
+	g.consumers.Remove([]byte(name))
+	return pending
+}
+
+// raxValues returns every value of the tree in key order
+func raxValues(t *Rax) []any {
+	values := make([]any, 0, t.Len())
+	key, value, ok := t.First()
+	for ok {
+		values = append(values, value)
+		key, value, ok = t.Next(key)
+	}
+	return values
+}
+
+// nack returns the pending entry of the group
+func (g *StreamGroup) nack(id StreamID) *streamNACK {
+	nack, ok := g.pel.Find(id.key())
+	if !ok {
+		return nil
+	}
+	return nack.(*streamNACK)
+}
+
+// assign delivers the entry to the consumer, moving it from its previous
+// owner when it was already pending
+func (g *StreamGroup) assign(id StreamID, consumer *StreamConsumer, now int64) *streamNACK {
+	nack := g.nack(id)
+	if nack == nil {
+		nack = &streamNACK{id: id}
+		g.pel.Insert(id.key(), nack)
+	} else if nack.consumer != consumer {
+		nack.consumer.pel.Remove(id.key())
+	}
+	nack.consumer = consumer
+	nack.deliveryTime = now
+	consumer.pel.Insert(id.key(), nack)
+	return nack
+}
+
+// Ack removes the entry from the pending entries
+func (g *StreamGroup) Ack(id StreamID) bool {
+	nack := g.nack(id)
+	if nack == nil {
+		return false
+	}
+	g.pel.Remove(id.key())
+	nack.consumer.pel.Remove(id.key())
+	return true
+}
+
+// pendingRange returns the pending entries of the group, or of a consumer,
+// between start and end included
+func pendingRange(pel *Rax, start, end StreamID, count int) []*streamNACK {
+	nacks := make([]*streamNACK, 0)
+	key, value, ok := pel.SeekGE(start.key())
+	for ok && (count <= 0 || len(nacks) < count) {
+		nack := value.(*streamNACK)
+		if end.Less(nack.id) {
+			break
+		}
+		nacks = append(nacks, nack)
+		key, value, ok = pel.Next(key)
+	}
+	return nacks
+}
+
+// hasTombstones tells whether entries between start and end may have been
+// deleted
+func (s *Stream) hasTombstones(start, end StreamID) bool {
+	if s.maxDeletedID.IsZero() {
+		return false
+	}
+	return !s.maxDeletedID.Less(start) && !end.Less(s.maxDeletedID)
+}
+
+// entriesReadAt estimates how many entries were added up to the ID, as a
+// group having read up to it would count them
+func (s *Stream) entriesReadAt(id StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	if s.length == 0 && id.Less(s.lastID) {
+		// every entry was deleted, there is no telling where id stands
+		return StreamGroupInvalidEntriesRead
+	}
+	if !id.Less(s.lastID) {
+		return int64(s.entriesAdded)
+	}
+	if id.Less(s.firstID) && !s.hasTombstones(s.firstID, MaxStreamID) && s.maxDeletedID.Less(s.firstID) {
+		return int64(s.entriesAdded - s.length)
+	}
+	return StreamGroupInvalidEntriesRead
+}
+
+// Lag is the number of entries not yet delivered to the group, false when
+// it cannot be computed
+func (s *Stream) Lag(group *StreamGroup) (int64, bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	// the counter of the group no longer tells the lag once entries after
+	// its last ID were deleted
+	entriesRead := group.entriesRead
+	if entriesRead == StreamGroupInvalidEntriesRead || s.hasTombstones(group.lastID, MaxStreamID) {
+		entriesRead = s.entriesReadAt(group.lastID)
+	}
+	if entriesRead == StreamGroupInvalidEntriesRead {
+		return 0, false
+	}
+	return int64(s.entriesAdded) - entriesRead, true
+}
+
+// deliver moves the last ID of the group past the entry and counts it as
+// read
+func (s *Stream) deliver(group *StreamGroup, id StreamID) {
+	if group.entriesRead != StreamGroupInvalidEntriesRead && !s.hasTombstones(group.lastID, id) {
+		group.entriesRead++
+	} else {
+		group.entriesRead = s.entriesReadAt(id)
+	}
+	group.lastID = id
+}
+
+func noGroupErr(key, group string) *RESP {
+	return SimpleErrorResp(fmt.Sprintf("NOGROUP No such consumer group '%v' for key name '%v'", group, key))
+}
+
+// parseGroupID parses the ID of XGROUP CREATE and SETID, "$" standing for
+// the last ID of the stream
+func parseGroupID(stream *Stream, arg string) (StreamID, error) {
+	if arg == "$" {
+		return stream.LastID(), nil
+	}
+	return ParseStreamID(arg, 0)
+}
+
+// parseEntriesRead parses the trailing "ENTRIESREAD n" option
+func parseEntriesRead(args []*RESP) (int64, bool, *RESP) {
+	if len(args) == 0 {
+		return 0, false, nil
+	}
+	if len(args) != 2 || strings.ToUpper(string(args[0].Data)) != "ENTRIESREAD" {
+		return 0, false, SimpleErrorResp("ERR syntax error")
+	}
+	entriesRead, err := strconv.ParseInt(string(args[1].Data), 10, 64)
+	if err != nil || entriesRead < StreamGroupInvalidEntriesRead {
+		return 0, false, SimpleErrorResp("ERR value for ENTRIESREAD must be positive or -1")
+	}
+	return entriesRead, true, nil
+}
+
+// xgroup runs the CREATE, CREATECONSUMER, DELCONSUMER, DESTROY and SETID
+// subcommands
+func xgroup(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for XGROUP")
+		}
+		subcommand := strings.ToUpper(string(resp.Nested[1].Data))
+		key, name := string(resp.Nested[2].Data), string(resp.Nested[3].Data)
+		args := resp.Nested[4:]
+
+		stream, errResp := getStream(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if subcommand == "CREATE" && stream == nil && len(args) > 1 && strings.ToUpper(string(args[1].Data)) == "MKSTREAM" {
+			stream = NewStream()
+			args = append(args[:1:1], args[2:]...)
+		}
+		if stream == nil {
+			return SimpleErrorResp("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."), nil
+		}
+
+		switch subcommand {
+		case "CREATE", "SETID":
+			if len(args) < 1 {
+				return nil, fmt.Errorf("insufficient arguments for XGROUP %v", subcommand)
+			}
+			id, err := parseGroupID(stream, string(args[0].Data))
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			if subcommand == "CREATE" && len(args) > 1 && strings.ToUpper(string(args[1].Data)) == "MKSTREAM" {
+				args = append(args[:1:1], args[2:]...)
+			}
+			entriesRead, hasEntriesRead, errResp := parseEntriesRead(args[1:])
+			if errResp != nil {
+				return errResp, nil
+			}
+			if !hasEntriesRead {
+				entriesRead = StreamGroupInvalidEntriesRead
+				if !id.Less(stream.LastID()) {
+					entriesRead = int64(stream.entriesAdded)
+				}
+			}
+
+			if subcommand == "CREATE" {
+				if stream.CreateGroup(name, id, entriesRead) == nil {
+					return SimpleErrorResp("BUSYGROUP Consumer Group name already exists"), nil
+				}
+			} else {
+				group := stream.Group(name)
+				if group == nil {
+					return noGroupErr(key, name), nil
+				}
+				group.lastID, group.entriesRead = id, entriesRead
+			}
+			putStream(memory, key, stream)
+			return SimpleStringResp("OK"), nil
+		case "DESTROY":
+			if !stream.DestroyGroup(name) {
+				return IntegerResp(0), nil
+			}
+			putStream(memory, key, stream)
+			return IntegerResp(1), nil
+		case "CREATECONSUMER", "DELCONSUMER":
+			if len(args) < 1 {
+				return nil, fmt.Errorf("insufficient arguments for XGROUP %v", subcommand)
+			}
+			group := stream.Group(name)
+			if group == nil {
+				return noGroupErr(key, name), nil
+			}
+			consumer := string(args[0].Data)
+			if subcommand == "DELCONSUMER" {
+				return IntegerResp(group.DeleteConsumer(consumer)), nil
+			}
+			if group.CreateConsumer(consumer) == nil {
+				return IntegerResp(0), nil
+			}
+			return IntegerResp(1), nil
+		}
+		return SimpleErrorResp(fmt.Sprintf("ERR unknown subcommand '%v'. Try XGROUP HELP.", string(resp.Nested[1].Data))), nil
+	}
+}
+
+// readGroup serves one stream of XREADGROUP: new entries for ">", which
+// become pending unless noAck, or else the entries already pending for the
+// consumer after the ID
+func (s *Stream) readGroup(group *StreamGroup, consumer *StreamConsumer, after string, count int, noAck bool) ([]StreamEntry, error) {
+	now := nowMillis()
+	if after == ">" {
+		start, ok := group.lastID.Incr()
+		if !ok {
+			return []StreamEntry{}, nil
+		}
+		entries := s.Range(start, MaxStreamID, count, false)
+		for _, entry := range entries {
+			s.deliver(group, entry.ID)
+			if !noAck {
+				nack := group.assign(entry.ID, consumer, now)
+				nack.deliveryCount = 1
+			}
+		}
+		if len(entries) > 0 {
+			consumer.activeTime = now
+		}
+		return entries, nil
+	}
+
+	id, err := ParseStreamID(after, 0)
+	if err != nil {
+		return nil, err
+	}
+	start, ok := id.Incr()
+	if !ok {
+		return []StreamEntry{}, nil
+	}
+	entries := make([]StreamEntry, 0)
+	for _, nack := range pendingRange(consumer.pel, start, MaxStreamID, count) {
+		nack.deliveryTime = now
+		nack.deliveryCount++
+		// deleted entries are replied with nil fields
+		entry, ok := s.Lookup(nack.id)
+		if !ok {
+			entry = StreamEntry{ID: nack.id}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// streamEntriesOrDeletedResp replies like streamEntriesResp, entries
+// without fields being deleted ones
+func streamEntriesOrDeletedResp(entries []StreamEntry) *RESP {
+	output := streamEntriesResp(entries)
+	for i, entry := range entries {
+		if entry.Fields == nil {
+			output.Nested[i].Nested[1] = BulkStringResp("")
+		}
+	}
+	return output
+}
+
+// xreadgroup parses "GROUP group consumer [COUNT count] [BLOCK
+// milliseconds] [NOACK] STREAMS key [key ...] id [id ...]", only reads of
+// new entries with ">" block
+func xreadgroup(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 7 {
+			return nil, fmt.Errorf("insufficient arguments for XREADGROUP")
+		}
+		if strings.ToUpper(string(resp.Nested[1].Data)) != "GROUP" {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		groupName, consumerName := string(resp.Nested[2].Data), string(resp.Nested[3].Data)
+
+		count, noAck := 0, false
+		block, timeout := false, time.Duration(0)
+		i := 4
+		for ; i < len(resp.Nested); i++ {
+			opt := strings.ToUpper(string(resp.Nested[i].Data))
+			if opt == "STREAMS" {
+				i++
+				break
+			}
+			switch {
+			case opt == "NOACK":
+				noAck = true
+			case opt == "COUNT" && i+1 < len(resp.Nested):
+				value, err := strconv.Atoi(string(resp.Nested[i+1].Data))
+				if err != nil {
+					return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+				}
+				count = max(value, 0)
+				i++
+			case opt == "BLOCK" && i+1 < len(resp.Nested):
+				ms, err := strconv.ParseInt(string(resp.Nested[i+1].Data), 10, 64)
+				if err != nil {
+					return SimpleErrorResp("ERR timeout is not an integer or out of range"), nil
+				}
+				if ms < 0 {
+					return SimpleErrorResp("ERR timeout is negative"), nil
+				}
+				// the duration is counted in nanoseconds
+				if ms > math.MaxInt64/int64(time.Millisecond) {
+					return SimpleErrorResp("ERR timeout is out of range"), nil
+				}
+				block, timeout = true, time.Duration(ms)*time.Millisecond
+				i++
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+		remaining := len(resp.Nested) - i
+		if remaining == 0 || remaining%2 != 0 {
+			return SimpleErrorResp("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified."), nil
+		}
+
+		numStream := remaining / 2
+		keys := make([]string, 0, numStream)
+		ids := make([]string, 0, numStream)
+		for j := i; j < i+numStream; j++ {
+			key, id := string(resp.Nested[j].Data), string(resp.Nested[j+numStream].Data)
+			stream, errResp := getStream(memory, key)
+			if errResp != nil {
+				return errResp, nil
+			}
+			if stream == nil || stream.Group(groupName) == nil {
+				return SimpleErrorResp(fmt.Sprintf("NOGROUP No such key '%v' or consumer group '%v' in XREADGROUP with GROUP option", key, groupName)), nil
+			}
+			if id != ">" {
+				if _, err := ParseStreamID(id, 0); err != nil {
+					return SimpleErrorResp(err.Error()), nil
+				}
+				// history is never waited for
+				block = false
+			}
+			keys, ids = append(keys, key), append(ids, id)
+		}
+
+		serve := func() (*RESP, bool) {
+			output := ArrayResp()
+			for j, key := range keys {
+				stream, _ := getStream(memory, key)
+				if stream == nil || stream.Group(groupName) == nil {
+					return SimpleErrorResp(fmt.Sprintf("NOGROUP No such key '%v' or consumer group '%v' in XREADGROUP with GROUP option", key, groupName)), true
+				}
+				group := stream.Group(groupName)
+				consumer := group.LookupConsumer(consumerName)
+				entries, err := stream.readGroup(group, consumer, ids[j], count, noAck)
+				if err != nil {
+					return SimpleErrorResp(err.Error()), true
+				}
+				// new entries only show up when there are some, the history
+				// of every stream is replied
+				if ids[j] == ">" && len(entries) == 0 {
+					continue
+				}
+				output.Nested = append(output.Nested, ArrayResp(BulkStringResp(key), streamEntriesOrDeletedResp(entries)))
+			}
+			if len(output.Nested) == 0 {
+				return nil, false
+			}
+			return output, true
+		}
+
+		if !block {
+			if output, ok := serve(); ok {
+				return output, nil
+			}
+			return NullArrayResp(), nil
+		}
+		output := blockForKeys(client, memory, keys, timeout, serve)
+		if output == nil {
+			return NullArrayResp(), nil
+		}
+		return output, nil
+	}
+}
+
+func xack(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for XACK")
+		}
+		stream, errResp := getStream(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		ids := make([]StreamID, 0, len(resp.Nested)-3)
+		for _, arg := range resp.Nested[3:] {
+			id, err := ParseStreamID(string(arg.Data), 0)
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			ids = append(ids, id)
+		}
+		if stream == nil {
+			return IntegerResp(0), nil
+		}
+		group := stream.Group(string(resp.Nested[2].Data))
+		if group == nil {
+			return IntegerResp(0), nil
+		}
+
+		acked := 0
+		for _, id := range ids {
+			if group.Ack(id) {
+				acked++
+			}
+		}
+		return IntegerResp(acked), nil
+	}
+}
+
+// xpending replies the summary of the pending entries for "key group", or
+// the entries themselves for "key group [IDLE min-idle-time] start end
+// count [consumer]"
+func xpending(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for XPENDING")
+		}
+		key, groupName := string(resp.Nested[1].Data), string(resp.Nested[2].Data)
+		args := resp.Nested[3:]
+
+		minIdle := int64(0)
+		if len(args) > 0 && strings.ToUpper(string(args[0].Data)) == "IDLE" {
+			if len(args) < 2 {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			value, err := strconv.ParseInt(string(args[1].Data), 10, 64)
+			if err != nil {
+				return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+			}
+			minIdle = value
+			args = args[2:]
+		}
+		if len(args) != 0 && len(args) != 3 && len(args) != 4 {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		if len(args) == 0 && len(resp.Nested) > 3 {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+
+		stream, errResp := getStream(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		var group *StreamGroup
+		if stream != nil {
+			group = stream.Group(groupName)
+		}
+		if group == nil {
+			return noGroupErr(key, groupName), nil
+		}
+
+		if len(args) == 0 {
+			if group.pel.Len() == 0 {
+				return ArrayResp(IntegerResp(0), BulkStringResp(""), BulkStringResp(""), BulkStringResp("")), nil
+			}
+			_, first, _ := group.pel.First()
+			_, last, _ := group.pel.Last()
+			consumers := ArrayResp()
+			for _, value := range raxValues(group.consumers) {
+				consumer := value.(*StreamConsumer)
+				if consumer.pel.Len() > 0 {
+					consumers.Nested = append(consumers.Nested, ArrayResp(
+						BulkStringResp(consumer.name),
+						BulkStringResp(strconv.Itoa(consumer.pel.Len())),
+					))
+				}
+			}
+			return ArrayResp(
+				IntegerResp(group.pel.Len()),
+				BulkStringResp(first.(*streamNACK).id.String()),
+				BulkStringResp(last.(*streamNACK).id.String()),
+				consumers,
+			), nil
+		}
+
+		start, err := parseStreamRangeBound(string(args[0].Data), false)
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		end, err := parseStreamRangeBound(string(args[1].Data), true)
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		count, err := strconv.Atoi(string(args[2].Data))
+		if err != nil {
+			return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+		}
+		pel := group.pel
+		if len(args) == 4 {
+			consumer := group.Consumer(string(args[3].Data))
+			if consumer == nil {
+				return ArrayResp(), nil
+			}
+			pel = consumer.pel
+		}
+		if count <= 0 {
+			return ArrayResp(), nil
+		}
+
+		now := nowMillis()
+		output := ArrayResp()
+		for _, nack := range pendingRange(pel, start, end, 0) {
+			idle := now - nack.deliveryTime
+			if idle < minIdle {
+				continue
+			}
+			output.Nested = append(output.Nested, ArrayResp(
+				BulkStringResp(nack.id.String()),
+				BulkStringResp(nack.consumer.name),
+				IntegerResp(int(idle)),
+				IntegerResp(int(nack.deliveryCount)),
+			))
+			if len(output.Nested) == count {
+				break
+			}
+		}
+		return output, nil
+	}
+}
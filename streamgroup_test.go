@@ -0,0 +1,466 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessor_StreamGroup(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "xgroup create missing key",
+			args:     []string{"XGROUP", "CREATE", "s", "g", "$"},
+			expected: "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n",
+		},
+		{
+			name:     "xgroup create mkstream",
+			args:     []string{"XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "xgroup create existing",
+			args:     []string{"XGROUP", "CREATE", "s", "g", "0"},
+			expected: "-BUSYGROUP Consumer Group name already exists\r\n",
+		},
+		{
+			name:     "xadd 1",
+			args:     []string{"XADD", "s", "1-1", "a", "1"},
+			expected: "$3\r\n1-1\r\n",
+		},
+		{
+			name:     "xadd 2",
+			args:     []string{"XADD", "s", "2-1", "a", "2"},
+			expected: "$3\r\n2-1\r\n",
+		},
+		{
+			name:     "xreadgroup missing group",
+			args:     []string{"XREADGROUP", "GROUP", "other", "alice", "STREAMS", "s", ">"},
+			expected: "-NOGROUP No such key 's' or consumer group 'other' in XREADGROUP with GROUP option\r\n",
+		},
+		{
+			name:     "xreadgroup new entries",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "xreadgroup next consumer",
+			args:     []string{"xreadgroup", "group", "g", "bob", "streams", "s", ">"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-1\r\n*2\r\n$1\r\na\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "xreadgroup nothing new",
+			args:     []string{"XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"},
+			expected: "*-1\r\n",
+		},
+		{
+			name:     "xreadgroup block out of range",
+			args:     []string{"XREADGROUP", "GROUP", "g", "bob", "BLOCK", "9223372036854775807", "STREAMS", "s", ">"},
+			expected: "-ERR timeout is out of range\r\n",
+		},
+		{
+			name:     "xpending summary",
+			args:     []string{"XPENDING", "s", "g"},
+			expected: "*4\r\n:2\r\n$3\r\n1-1\r\n$3\r\n2-1\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "xpending idle filter",
+			args:     []string{"XPENDING", "s", "g", "IDLE", "60000", "-", "+", "10"},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "xreadgroup history",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "xdel pending entry",
+			args:     []string{"XDEL", "s", "1-1"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xreadgroup history of deleted entry",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-1\r\n$-1\r\n",
+		},
+		{
+			name:     "xack",
+			args:     []string{"XACK", "s", "g", "1-1", "9-9"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xreadgroup empty history",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*0\r\n",
+		},
+		{
+			name:     "xadd 3",
+			args:     []string{"XADD", "s", "3-1", "a", "3"},
+			expected: "$3\r\n3-1\r\n",
+		},
+		{
+			name:     "xreadgroup noack",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "NOACK", "STREAMS", "s", ">"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n3-1\r\n*2\r\n$1\r\na\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "xpending summary after ack and noack",
+			args:     []string{"XPENDING", "s", "g"},
+			expected: "*4\r\n:1\r\n$3\r\n2-1\r\n$3\r\n2-1\r\n*1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "xpending of consumer without entries",
+			args:     []string{"XPENDING", "s", "g", "-", "+", "10", "alice"},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "xgroup createconsumer",
+			args:     []string{"XGROUP", "CREATECONSUMER", "s", "g", "carol"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xgroup createconsumer existing",
+			args:     []string{"XGROUP", "CREATECONSUMER", "s", "g", "carol"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "xgroup delconsumer with pending entries",
+			args:     []string{"XGROUP", "DELCONSUMER", "s", "g", "bob"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xpending empty",
+			args:     []string{"XPENDING", "s", "g"},
+			expected: "*4\r\n:0\r\n$-1\r\n$-1\r\n$-1\r\n",
+		},
+		{
+			name:     "xgroup setid",
+			args:     []string{"XGROUP", "SETID", "s", "g", "0", "ENTRIESREAD", "0"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "xreadgroup after setid",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*2\r\n*2\r\n$3\r\n2-1\r\n*2\r\n$1\r\na\r\n$1\r\n2\r\n*2\r\n$3\r\n3-1\r\n*2\r\n$1\r\na\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "xgroup destroy",
+			args:     []string{"XGROUP", "DESTROY", "s", "g"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xpending destroyed group",
+			args:     []string{"XPENDING", "s", "g"},
+			expected: "-NOGROUP No such consumer group 'g' for key name 's'\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
+
+func TestProcessor_XReadGroupWakeUp(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+
+	writer := processor.Connect("writer")
+	processor.Accept(writer, respParser.Serialize(BulkStringArrayResp([]string{"XGROUP", "CREATE", "jobs", "g", "$", "MKSTREAM"})))
+
+	done := make(chan string)
+	go func() {
+		output, _ := processor.Accept(processor.Connect("blocked"), respParser.Serialize(BulkStringArrayResp([]string{"XREADGROUP", "GROUP", "g", "worker", "BLOCK", "0", "STREAMS", "jobs", ">"})))
+		done <- string(output)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	processor.Accept(writer, respParser.Serialize(BulkStringArrayResp([]string{"XADD", "jobs", "1-1", "job", "1"})))
+
+	select {
+	case output := <-done:
+		expected := "*1\r\n*2\r\n$4\r\njobs\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$3\r\njob\r\n$1\r\n1\r\n"
+		if output != expected {
+			t.Errorf("expected: %q - actual: %q", expected, output)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("XREADGROUP was not woken up by XADD")
+	}
+
+	output, _ := processor.Accept(writer, respParser.Serialize(BulkStringArrayResp([]string{"XREADGROUP", "GROUP", "g", "worker", "BLOCK", "10", "STREAMS", "jobs", ">"})))
+	if string(output) != "*-1\r\n" {
+		t.Errorf("timeout - actual: %q", string(output))
+	}
+}
+
+func TestProcessor_StreamClaim(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "xgroup create",
+			args:     []string{"XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "xadd 1",
+			args:     []string{"XADD", "s", "1-1", "a", "1"},
+			expected: "$3\r\n1-1\r\n",
+		},
+		{
+			name:     "xadd 2",
+			args:     []string{"XADD", "s", "2-1", "a", "2"},
+			expected: "$3\r\n2-1\r\n",
+		},
+		{
+			name:     "xadd 3",
+			args:     []string{"XADD", "s", "3-1", "a", "3"},
+			expected: "$3\r\n3-1\r\n",
+		},
+		{
+			name:     "xreadgroup",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*3\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n2-1\r\n*2\r\n$1\r\na\r\n$1\r\n2\r\n*2\r\n$3\r\n3-1\r\n*2\r\n$1\r\na\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "xclaim missing group",
+			args:     []string{"XCLAIM", "s", "other", "bob", "0", "1-1"},
+			expected: "-NOGROUP No such key 's' or consumer group 'other'\r\n",
+		},
+		{
+			name:     "xclaim unknown option",
+			args:     []string{"XCLAIM", "s", "g", "bob", "0", "1-1", "BOGUS"},
+			expected: "-ERR Unrecognized XCLAIM option 'BOGUS'\r\n",
+		},
+		{
+			name:     "xclaim not idle enough",
+			args:     []string{"XCLAIM", "s", "g", "bob", "3600000", "1-1"},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "xclaim justid",
+			args:     []string{"XCLAIM", "s", "g", "bob", "0", "1-1", "JUSTID"},
+			expected: "*1\r\n$3\r\n1-1\r\n",
+		},
+		{
+			name:     "xclaim retrycount",
+			args:     []string{"XCLAIM", "s", "g", "bob", "0", "2-1", "RETRYCOUNT", "5", "LASTID", "9-9"},
+			expected: "*1\r\n*2\r\n$3\r\n2-1\r\n*2\r\n$1\r\na\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "xclaim force of missing entry",
+			args:     []string{"XCLAIM", "s", "g", "bob", "0", "8-1", "FORCE"},
+			expected: "*0\r\n",
+		},
+		{
+			name:     "xdel pending entry",
+			args:     []string{"XDEL", "s", "3-1"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xautoclaim count",
+			args:     []string{"XAUTOCLAIM", "s", "g", "carol", "0", "-", "COUNT", "1"},
+			expected: "*3\r\n$3\r\n2-1\r\n*1\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*0\r\n",
+		},
+		{
+			name:     "xautoclaim from cursor reports deleted entries",
+			args:     []string{"XAUTOCLAIM", "s", "g", "carol", "0", "2-1", "JUSTID"},
+			expected: "*3\r\n$3\r\n0-0\r\n*1\r\n$3\r\n2-1\r\n*1\r\n$3\r\n3-1\r\n",
+		},
+		{
+			name:     "xautoclaim invalid count",
+			args:     []string{"XAUTOCLAIM", "s", "g", "carol", "0", "0", "COUNT", "0"},
+			expected: "-ERR COUNT must be > 0\r\n",
+		},
+		{
+			name:     "xautoclaim huge count",
+			args:     []string{"XAUTOCLAIM", "s", "g", "carol", "0", "0", "COUNT", "9223372036854775807"},
+			expected: "-ERR COUNT must be > 0\r\n",
+		},
+		{
+			name:     "xpending summary",
+			args:     []string{"XPENDING", "s", "g"},
+			expected: "*4\r\n:2\r\n$3\r\n1-1\r\n$3\r\n2-1\r\n*1\r\n*2\r\n$5\r\ncarol\r\n$1\r\n2\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+
+	stream, _ := getStream(memory, "s")
+	group := stream.Group("g")
+	if group.lastID != (StreamID{Ms: 9, Seq: 9}) {
+		t.Errorf("last id after LASTID - actual: %v", group.lastID)
+	}
+	// read once, claimed with JUSTID and claimed again
+	if nack := group.nack(StreamID{Ms: 1, Seq: 1}); nack.deliveryCount != 2 {
+		t.Errorf("deliveries of 1-1 - actual: %v", nack.deliveryCount)
+	}
+	// set by RETRYCOUNT and claimed with JUSTID
+	if nack := group.nack(StreamID{Ms: 2, Seq: 1}); nack.deliveryCount != 5 {
+		t.Errorf("deliveries of 2-1 - actual: %v", nack.deliveryCount)
+	}
+}
+
+func TestProcessor_StreamInfo(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "xinfo missing key",
+			args:     []string{"XINFO", "STREAM", "s"},
+			expected: "-ERR no such key\r\n",
+		},
+		{
+			name:     "xadd 1",
+			args:     []string{"XADD", "s", "1-1", "a", "1"},
+			expected: "$3\r\n1-1\r\n",
+		},
+		{
+			name:     "xadd 2",
+			args:     []string{"XADD", "s", "2-1", "a", "2"},
+			expected: "$3\r\n2-1\r\n",
+		},
+		{
+			name:     "xadd 3",
+			args:     []string{"XADD", "s", "3-1", "a", "3"},
+			expected: "$3\r\n3-1\r\n",
+		},
+		{
+			name:     "xdel",
+			args:     []string{"XDEL", "s", "2-1"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "xgroup create from start",
+			args:     []string{"XGROUP", "CREATE", "s", "g", "0"},
+			expected: "+OK\r\n",
+		},
+		{
+			// entries before the deleted one cannot be counted
+			name:     "xinfo groups unknown lag",
+			args:     []string{"XINFO", "GROUPS", "s"},
+			expected: "*1\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:0\r\n$7\r\npending\r\n:0\r\n$17\r\nlast-delivered-id\r\n$3\r\n0-0\r\n$12\r\nentries-read\r\n$-1\r\n$3\r\nlag\r\n$-1\r\n",
+		},
+		{
+			name:     "xreadgroup",
+			args:     []string{"XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"},
+			expected: "*1\r\n*2\r\n$1\r\ns\r\n*2\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n*2\r\n$3\r\n3-1\r\n*2\r\n$1\r\na\r\n$1\r\n3\r\n",
+		},
+		{
+			name:     "xgroup create from end",
+			args:     []string{"XGROUP", "CREATE", "s", "g2", "$"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "xadd 4",
+			args:     []string{"XADD", "s", "4-1", "a", "4"},
+			expected: "$3\r\n4-1\r\n",
+		},
+		{
+			name:     "xinfo groups",
+			args:     []string{"XINFO", "GROUPS", "s"},
+			expected: "*2\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:2\r\n$17\r\nlast-delivered-id\r\n$3\r\n3-1\r\n$12\r\nentries-read\r\n:3\r\n$3\r\nlag\r\n:1\r\n*12\r\n$4\r\nname\r\n$2\r\ng2\r\n$9\r\nconsumers\r\n:0\r\n$7\r\npending\r\n:0\r\n$17\r\nlast-delivered-id\r\n$3\r\n3-1\r\n$12\r\nentries-read\r\n:3\r\n$3\r\nlag\r\n:1\r\n",
+		},
+		{
+			name:     "xinfo stream",
+			args:     []string{"XINFO", "STREAM", "s"},
+			expected: "*20\r\n$6\r\nlength\r\n:3\r\n$15\r\nradix-tree-keys\r\n:1\r\n$16\r\nradix-tree-nodes\r\n:2\r\n$17\r\nlast-generated-id\r\n$3\r\n4-1\r\n$20\r\nmax-deleted-entry-id\r\n$3\r\n2-1\r\n$13\r\nentries-added\r\n:4\r\n$23\r\nrecorded-first-entry-id\r\n$3\r\n1-1\r\n$6\r\ngroups\r\n:2\r\n$11\r\nfirst-entry\r\n*2\r\n$3\r\n1-1\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n$10\r\nlast-entry\r\n*2\r\n$3\r\n4-1\r\n*2\r\n$1\r\na\r\n$1\r\n4\r\n",
+		},
+		{
+			name:     "xinfo consumers missing group",
+			args:     []string{"XINFO", "CONSUMERS", "s", "other"},
+			expected: "-NOGROUP No such consumer group 'other' for key name 's'\r\n",
+		},
+		{
+			name:     "xinfo unknown subcommand",
+			args:     []string{"XINFO", "KEYS", "s"},
+			expected: "-ERR unknown subcommand 'KEYS'. Try XINFO HELP.\r\n",
+		},
+		{
+			name:     "xadd 5",
+			args:     []string{"XADD", "s", "5-1", "a", "5"},
+			expected: "$3\r\n5-1\r\n",
+		},
+		{
+			name:     "xadd 6",
+			args:     []string{"XADD", "s", "6-1", "a", "6"},
+			expected: "$3\r\n6-1\r\n",
+		},
+		{
+			name:     "xdel undelivered",
+			args:     []string{"XDEL", "s", "5-1"},
+			expected: ":1\r\n",
+		},
+		{
+			// the entries read no longer tell how many entries are left
+			name:     "xinfo groups lag after xdel",
+			args:     []string{"XINFO", "GROUPS", "s"},
+			expected: "*2\r\n*12\r\n$4\r\nname\r\n$1\r\ng\r\n$9\r\nconsumers\r\n:1\r\n$7\r\npending\r\n:2\r\n$17\r\nlast-delivered-id\r\n$3\r\n3-1\r\n$12\r\nentries-read\r\n:3\r\n$3\r\nlag\r\n$-1\r\n*12\r\n$4\r\nname\r\n$2\r\ng2\r\n$9\r\nconsumers\r\n:0\r\n$7\r\npending\r\n:0\r\n$17\r\nlast-delivered-id\r\n$3\r\n3-1\r\n$12\r\nentries-read\r\n:3\r\n$3\r\nlag\r\n$-1\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+
+	// times are checked apart from the rest of the replies
+	stream, _ := getStream(memory, "s")
+	full := streamInfoResp(stream, true, 1)
+	entries := full.Nested[15]
+	if len(entries.Nested) != 1 || string(entries.Nested[0].Nested[0].Data) != "1-1" {
+		t.Errorf("full entries - actual: %v", entries.Nested)
+	}
+	group := full.Nested[17].Nested[0]
+	if pending := group.Nested[11]; len(pending.Nested) != 1 || string(pending.Nested[0].Nested[1].Data) != "alice" {
+		t.Errorf("full pending entries - actual: %v", pending.Nested)
+	}
+	if pelCount := group.Nested[9]; string(pelCount.Data) != "2" {
+		t.Errorf("full pel count - actual: %v", string(pelCount.Data))
+	}
+
+	output, _ := processor.Accept(client, respParser.Serialize(BulkStringArrayResp([]string{"XINFO", "CONSUMERS", "s", "g"})))
+	prefix := "*1\r\n*8\r\n$4\r\nname\r\n$5\r\nalice\r\n$7\r\npending\r\n:2\r\n$4\r\nidle\r\n:"
+	if !strings.HasPrefix(string(output), prefix) {
+		t.Errorf("xinfo consumers - actual: %q", string(output))
+	}
+}
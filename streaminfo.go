@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// entriesReadResp replies the entries read by the group, nil when unknown
+func entriesReadResp(group *StreamGroup) *RESP {
+	if group.entriesRead == StreamGroupInvalidEntriesRead {
+		return BulkStringResp("")
+	}
+	return IntegerResp(int(group.entriesRead))
+}
+
+func lagResp(stream *Stream, group *StreamGroup) *RESP {
+	lag, ok := stream.Lag(group)
+	if !ok {
+		return BulkStringResp("")
+	}
+	return IntegerResp(int(lag))
+}
+
+func streamEntryOrNilResp(entries []StreamEntry) *RESP {
+	if len(entries) == 0 {
+		return BulkStringResp("")
+	}
+	return streamEntriesResp(entries).Nested[0]
+}
+
+func streamGroups(stream *Stream) []*StreamGroup {
+	if stream.groups == nil {
+		return []*StreamGroup{}
+	}
+	values := raxValues(stream.groups)
+	groups := make([]*StreamGroup, 0, len(values))
+	for _, value := range values {
+		groups = append(groups, value.(*StreamGroup))
+	}
+	return groups
+}
+
+func groupConsumers(group *StreamGroup) []*StreamConsumer {
+	values := raxValues(group.consumers)
+	consumers := make([]*StreamConsumer, 0, len(values))
+	for _, value := range values {
+		consumers = append(consumers, value.(*StreamConsumer))
+	}
+	return consumers
+}
+
+// streamInfoResp replies the summary of the stream, or with full the entries
+// up to count, zero for all of them, and the details of every group
+func streamInfoResp(stream *Stream, full bool, count int) *RESP {
+	output := ArrayResp(
+		BulkStringResp("length"), IntegerResp(int(stream.Len())),
+		BulkStringResp("radix-tree-keys"), IntegerResp(stream.rax.Len()),
+		BulkStringResp("radix-tree-nodes"), IntegerResp(stream.rax.Nodes()),
+		BulkStringResp("last-generated-id"), BulkStringResp(stream.LastID().String()),
+		BulkStringResp("max-deleted-entry-id"), BulkStringResp(stream.maxDeletedID.String()),
+		BulkStringResp("entries-added"), IntegerResp(int(stream.entriesAdded)),
+		BulkStringResp("recorded-first-entry-id"), BulkStringResp(stream.firstID.String()),
+	)
+	if !full {
+		output.Nested = append(output.Nested,
+			BulkStringResp("groups"), IntegerResp(len(streamGroups(stream))),
+			BulkStringResp("first-entry"), streamEntryOrNilResp(stream.Range(StreamID{}, MaxStreamID, 1, false)),
+			BulkStringResp("last-entry"), streamEntryOrNilResp(stream.Range(StreamID{}, MaxStreamID, 1, true)),
+		)
+		return output
+	}
+
+	groupsResp := ArrayResp()
+	for _, group := range streamGroups(stream) {
+		pending := ArrayResp()
+		for _, nack := range pendingRange(group.pel, StreamID{}, MaxStreamID, count) {
+			pending.Nested = append(pending.Nested, ArrayResp(
+				BulkStringResp(nack.id.String()),
+				BulkStringResp(nack.consumer.name),
+				IntegerResp(int(nack.deliveryTime)),
+				IntegerResp(int(nack.deliveryCount)),
+			))
+		}
+		consumersResp := ArrayResp()
+		for _, consumer := range groupConsumers(group) {
+			consumerPending := ArrayResp()
+			for _, nack := range pendingRange(consumer.pel, StreamID{}, MaxStreamID, count) {
+				consumerPending.Nested = append(consumerPending.Nested, ArrayResp(
+					BulkStringResp(nack.id.String()),
+					IntegerResp(int(nack.deliveryTime)),
+					IntegerResp(int(nack.deliveryCount)),
+				))
+			}
+			consumersResp.Nested = append(consumersResp.Nested, ArrayResp(
+				BulkStringResp("name"), BulkStringResp(consumer.name),
+				BulkStringResp("seen-time"), IntegerResp(int(consumer.seenTime)),
+				BulkStringResp("active-time"), IntegerResp(int(consumer.activeTime)),
+				BulkStringResp("pel-count"), IntegerResp(consumer.pel.Len()),
+				BulkStringResp("pending"), consumerPending,
+			))
+		}
+		groupsResp.Nested = append(groupsResp.Nested, ArrayResp(
+			BulkStringResp("name"), BulkStringResp(group.name),
+			BulkStringResp("last-delivered-id"), BulkStringResp(group.lastID.String()),
+			BulkStringResp("entries-read"), entriesReadResp(group),
+			BulkStringResp("lag"), lagResp(stream, group),
+			BulkStringResp("pel-count"), IntegerResp(group.pel.Len()),
+			BulkStringResp("pending"), pending,
+			BulkStringResp("consumers"), consumersResp,
+		))
+	}
+	output.Nested = append(output.Nested,
+		BulkStringResp("entries"), streamEntriesResp(stream.Range(StreamID{}, MaxStreamID, count, false)),
+		BulkStringResp("groups"), groupsResp,
+	)
+	return output
+}
+
+// xinfo runs the STREAM key [FULL [COUNT count]], GROUPS key and CONSUMERS
+// key group subcommands
+func xinfo(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for XINFO")
+		}
+		subcommand := strings.ToUpper(string(resp.Nested[1].Data))
+		key := string(resp.Nested[2].Data)
+		if subcommand != "STREAM" && subcommand != "GROUPS" && subcommand != "CONSUMERS" {
+			return SimpleErrorResp(fmt.Sprintf("ERR unknown subcommand '%v'. Try XINFO HELP.", string(resp.Nested[1].Data))), nil
+		}
+
+		stream, errResp := getStream(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if stream == nil {
+			return SimpleErrorResp("ERR no such key"), nil
+		}
+
+		switch subcommand {
+		case "STREAM":
+			args := resp.Nested[3:]
+			if len(args) == 0 {
+				return streamInfoResp(stream, false, 0), nil
+			}
+			if strings.ToUpper(string(args[0].Data)) != "FULL" {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			count := 10
+			if len(args) == 3 && strings.ToUpper(string(args[1].Data)) == "COUNT" {
+				value, err := strconv.Atoi(string(args[2].Data))
+				if err != nil {
+					return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+				}
+				count = max(value, 0)
+			} else if len(args) != 1 {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			return streamInfoResp(stream, true, count), nil
+		case "GROUPS":
+			output := ArrayResp()
+			for _, group := range streamGroups(stream) {
+				output.Nested = append(output.Nested, ArrayResp(
+					BulkStringResp("name"), BulkStringResp(group.name),
+					BulkStringResp("consumers"), IntegerResp(group.consumers.Len()),
+					BulkStringResp("pending"), IntegerResp(group.pel.Len()),
+					BulkStringResp("last-delivered-id"), BulkStringResp(group.lastID.String()),
+					BulkStringResp("entries-read"), entriesReadResp(group),
+					BulkStringResp("lag"), lagResp(stream, group),
+				))
+			}
+			return output, nil
+		}
+
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for XINFO CONSUMERS")
+		}
+		groupName := string(resp.Nested[3].Data)
+		group := stream.Group(groupName)
+		if group == nil {
+			return noGroupErr(key, groupName), nil
+		}
+		now := nowMillis()
+		output := ArrayResp()
+		for _, consumer := range groupConsumers(group) {
+			// consumers which never read or claimed have no inactive time
+			inactive := int64(-1)
+			if consumer.activeTime != -1 {
+				inactive = now - consumer.activeTime
+			}
+			output.Nested = append(output.Nested, ArrayResp(
+				BulkStringResp("name"), BulkStringResp(consumer.name),
+				BulkStringResp("pending"), IntegerResp(consumer.pel.Len()),
+				BulkStringResp("idle"), IntegerResp(int(now-consumer.seenTime)),
+				BulkStringResp("inactive"), IntegerResp(int(inactive)),
+			))
+		}
+		return output, nil
+	}
+}
@@ -0,0 +1,995 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TSDefaultChunkSize       = 4096
+	TSDefaultDuplicatePolicy = "BLOCK"
+
+	tsMinChunkSize = 48
+	tsMaxChunkSize = 1048576
+)
+
+var tsDuplicatePolicies = []string{"BLOCK", "FIRST", "LAST", "MIN", "MAX", "SUM"}
+
+var tsAggregations = []string{"AVG", "SUM", "MIN", "MAX", "RANGE", "COUNT", "FIRST", "LAST", "STD.P", "STD.S", "VAR.P", "VAR.S"}
+
+type tsLabel struct {
+	name  string
+	value string
+}
+
+// tsRule downsamples the samples of a series into dest. The latest bucket
+// stays open and is only written to dest once a sample of a later bucket
+// arrives.
+type tsRule struct {
+	dest        string
+	aggregation string
+	bucket      int64
+	open        bool
+	openBucket  int64
+}
+
+// TimeSeries stores samples ordered by timestamp in compressed chunks that
+// don't overlap
+type TimeSeries struct {
+	chunks          []*tsChunk
+	retention       int64
+	chunkSize       int
+	duplicatePolicy string
+	labels          []tsLabel
+	rules           []*tsRule
+	srcKey          string
+}
+
+func NewTimeSeries() *TimeSeries {
+	return &TimeSeries{
+		chunks:          make([]*tsChunk, 0),
+		chunkSize:       TSDefaultChunkSize,
+		duplicatePolicy: TSDefaultDuplicatePolicy,
+		labels:          make([]tsLabel, 0),
+		rules:           make([]*tsRule, 0),
+	}
+}
+
+func (ts *TimeSeries) TotalSamples() int {
+	total := 0
+	for _, chunk := range ts.chunks {
+		total += chunk.count
+	}
+	return total
+}
+
+func (ts *TimeSeries) Last() (tsSample, bool) {
+	if len(ts.chunks) == 0 {
+		return tsSample{}, false
+	}
+	chunk := ts.chunks[len(ts.chunks)-1]
+	samples := chunk.samples()
+	return samples[len(samples)-1], true
+}
+
+func (ts *TimeSeries) label(name string) (string, bool) {
+	for _, label := range ts.labels {
+		if label.name == name {
+			return label.value, true
+		}
+	}
+	return "", false
+}
+
+// retentionCutoff is the oldest timestamp kept, samples before it expire
+func (ts *TimeSeries) retentionCutoff() int64 {
+	if ts.retention == 0 || len(ts.chunks) == 0 {
+		return math.MinInt64
+	}
+	return ts.chunks[len(ts.chunks)-1].last - ts.retention
+}
+
+func applyDuplicatePolicy(policy string, old, value float64) (float64, error) {
+	switch policy {
+	case "FIRST":
+		return old, nil
+	case "LAST":
+		return value, nil
+	case "MIN":
+		return math.Min(old, value), nil
+	case "MAX":
+		return math.Max(old, value), nil
+	case "SUM":
+		return old + value, nil
+	}
+	return 0, fmt.Errorf("ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+}
+
+// Add appends the sample, samples older than the last one are inserted by
+// decoding and encoding the chunk holding them again. policy overrides the
+// duplicate policy of the series when set.
+func (ts *TimeSeries) Add(sample tsSample, policy string) error {
+	if sample.timestamp < ts.retentionCutoff() {
+		return fmt.Errorf("ERR TSDB: Timestamp is older than retention")
+	}
+	if policy == "" {
+		policy = ts.duplicatePolicy
+	}
+
+	if len(ts.chunks) == 0 || sample.timestamp > ts.chunks[len(ts.chunks)-1].last {
+		if len(ts.chunks) == 0 || ts.chunks[len(ts.chunks)-1].size() >= ts.chunkSize {
+			ts.chunks = append(ts.chunks, &tsChunk{})
+		}
+		ts.chunks[len(ts.chunks)-1].append(sample)
+		ts.trimRetention()
+		return nil
+	}
+
+	// the first chunk ending at or after the timestamp holds it
+	i := sort.Search(len(ts.chunks), func(i int) bool {
+		return ts.chunks[i].last >= sample.timestamp
+	})
+	samples := ts.chunks[i].samples()
+	j := sort.Search(len(samples), func(j int) bool {
+		return samples[j].timestamp >= sample.timestamp
+	})
+	if j < len(samples) && samples[j].timestamp == sample.timestamp {
+		value, err := applyDuplicatePolicy(policy, samples[j].value, sample.value)
+		if err != nil {
+			return err
+		}
+		samples[j].value = value
+	} else {
+		samples = append(samples[:j], append([]tsSample{sample}, samples[j:]...)...)
+	}
+
+	chunks := append([]*tsChunk{}, ts.chunks[:i]...)
+	chunks = append(chunks, encodeChunks(samples, ts.chunkSize)...)
+	ts.chunks = append(chunks, ts.chunks[i+1:]...)
+	return nil
+}
+
+// trimRetention drops the chunks whose samples all expired, expired samples
+// of the remaining chunks are filtered when read
+func (ts *TimeSeries) trimRetention() {
+	cutoff := ts.retentionCutoff()
+	expired := 0
+	for expired < len(ts.chunks)-1 && ts.chunks[expired].last < cutoff {
+		expired++
+	}
+	ts.chunks = ts.chunks[expired:]
+}
+
+// Range returns the samples between from and to, both inclusive
+func (ts *TimeSeries) Range(from, to int64) []tsSample {
+	from = max(from, ts.retentionCutoff())
+	output := make([]tsSample, 0)
+	for _, chunk := range ts.chunks {
+		if chunk.last < from || chunk.first > to {
+			continue
+		}
+		for _, sample := range chunk.samples() {
+			if sample.timestamp >= from && sample.timestamp <= to {
+				output = append(output, sample)
+			}
+		}
+	}
+	return output
+}
+
+// tsAccumulator folds the samples of a bucket into one value
+type tsAccumulator struct {
+	count      int
+	sum        float64
+	sumSquares float64
+	min        float64
+	max        float64
+	first      float64
+	last       float64
+}
+
+func (acc *tsAccumulator) add(value float64) {
+	if acc.count == 0 {
+		acc.min, acc.max, acc.first = value, value, value
+	}
+	acc.count++
+	acc.sum += value
+	acc.sumSquares += value * value
+	acc.min = math.Min(acc.min, value)
+	acc.max = math.Max(acc.max, value)
+	acc.last = value
+}
+
+func (acc *tsAccumulator) result(aggregation string) float64 {
+	count := float64(acc.count)
+	variance := func(sample bool) float64 {
+		if sample {
+			if acc.count < 2 {
+				return 0
+			}
+			return (acc.sumSquares - acc.sum*acc.sum/count) / (count - 1)
+		}
+		return acc.sumSquares/count - (acc.sum/count)*(acc.sum/count)
+	}
+
+	switch aggregation {
+	case "AVG":
+		return acc.sum / count
+	case "SUM":
+		return acc.sum
+	case "MIN":
+		return acc.min
+	case "MAX":
+		return acc.max
+	case "RANGE":
+		return acc.max - acc.min
+	case "COUNT":
+		return count
+	case "FIRST":
+		return acc.first
+	case "LAST":
+		return acc.last
+	case "VAR.P":
+		return variance(false)
+	case "VAR.S":
+		return variance(true)
+	case "STD.P":
+		return math.Sqrt(variance(false))
+	}
+	return math.Sqrt(variance(true))
+}
+
+func tsBucketStart(timestamp, bucket int64) int64 {
+	return timestamp - ((timestamp%bucket)+bucket)%bucket
+}
+
+// tsAggregate groups ordered samples into buckets aligned to the epoch,
+// each bucket is reported at its start
+func tsAggregate(samples []tsSample, aggregation string, bucket int64) []tsSample {
+	output := make([]tsSample, 0)
+	var acc tsAccumulator
+	current := int64(0)
+	for _, sample := range samples {
+		start := tsBucketStart(sample.timestamp, bucket)
+		if acc.count > 0 && start != current {
+			output = append(output, tsSample{timestamp: current, value: acc.result(aggregation)})
+			acc = tsAccumulator{}
+		}
+		current = start
+		acc.add(sample.value)
+	}
+	if acc.count > 0 {
+		output = append(output, tsSample{timestamp: current, value: acc.result(aggregation)})
+	}
+	return output
+}
+
+// getTimeSeries returns nil series when the key does not exist and an
+// error response when the key holds another type
+func getTimeSeries(memory *Memory, key string) (*TimeSeries, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "TSDB-TYPE" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*TimeSeries), nil
+}
+
+func putTimeSeries(memory *Memory, key string, ts *TimeSeries) {
+	memory.Put(key, Entry{Type: "TSDB-TYPE", Value: ts}, Option{})
+}
+
+// tsAddSample adds the sample and feeds the compaction rules of the series
+func tsAddSample(memory *Memory, key string, ts *TimeSeries, sample tsSample, policy string) error {
+	// a later bucket closes the open one, compact it before adding the sample
+	// since the retention may then trim the samples of that bucket
+	for _, rule := range ts.rules {
+		dest, errResp := getTimeSeries(memory, rule.dest)
+		if errResp != nil || dest == nil {
+			continue
+		}
+		if rule.open && tsBucketStart(sample.timestamp, rule.bucket) > rule.openBucket {
+			tsCompactBucket(memory, rule, ts, dest, rule.openBucket)
+			rule.open = false
+		}
+	}
+
+	if err := ts.Add(sample, policy); err != nil {
+		return err
+	}
+	putTimeSeries(memory, key, ts)
+
+	for _, rule := range ts.rules {
+		dest, errResp := getTimeSeries(memory, rule.dest)
+		if errResp != nil || dest == nil {
+			continue
+		}
+		bucket := tsBucketStart(sample.timestamp, rule.bucket)
+		if !rule.open {
+			rule.open, rule.openBucket = true, bucket
+			continue
+		}
+		// a sample of a closed bucket updates its downsampled value
+		if bucket < rule.openBucket {
+			tsCompactBucket(memory, rule, ts, dest, bucket)
+		}
+	}
+	return nil
+}
+
+func tsCompactBucket(memory *Memory, rule *tsRule, src, dest *TimeSeries, bucket int64) {
+	samples := tsAggregate(src.Range(bucket, bucket+rule.bucket-1), rule.aggregation, rule.bucket)
+	if len(samples) == 0 {
+		return
+	}
+	if err := dest.Add(samples[0], "LAST"); err == nil {
+		putTimeSeries(memory, rule.dest, dest)
+	}
+}
+
+// tsOptions holds the options shared by TS.CREATE, TS.ADD and TS.INCRBY
+type tsOptions struct {
+	retention       int64
+	hasRetention    bool
+	chunkSize       int
+	duplicatePolicy string
+	onDuplicate     string
+	labels          []tsLabel
+	timestamp       string
+}
+
+func parseDuplicatePolicy(arg *RESP) (string, bool) {
+	policy := strings.ToUpper(string(arg.Data))
+	for _, p := range tsDuplicatePolicies {
+		if p == policy {
+			return policy, true
+		}
+	}
+	return "", false
+}
+
+// parseTSOptions parses "[RETENTION ms] [CHUNK_SIZE size] [DUPLICATE_POLICY
+// policy] [LABELS label value ...]", extra is the option only one command
+// accepts: ON_DUPLICATE for TS.ADD and TIMESTAMP for TS.INCRBY
+func parseTSOptions(args []*RESP, extra string) (*tsOptions, *RESP) {
+	opts := &tsOptions{
+		chunkSize: TSDefaultChunkSize,
+		labels:    make([]tsLabel, 0),
+	}
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i].Data))
+		if opt == "LABELS" {
+			rest := args[i+1:]
+			if len(rest)%2 != 0 {
+				return nil, SimpleErrorResp("ERR TSDB: wrong number of labels")
+			}
+			for j := 0; j < len(rest); j += 2 {
+				opts.labels = append(opts.labels, tsLabel{name: string(rest[j].Data), value: string(rest[j+1].Data)})
+			}
+			break
+		}
+		if i+1 >= len(args) {
+			return nil, SimpleErrorResp("ERR syntax error")
+		}
+		value := args[i+1]
+		switch {
+		case opt == "RETENTION":
+			retention, err := strconv.ParseInt(string(value.Data), 10, 64)
+			if err != nil || retention < 0 {
+				return nil, SimpleErrorResp("ERR TSDB: invalid RETENTION value")
+			}
+			opts.retention, opts.hasRetention = retention, true
+		case opt == "CHUNK_SIZE":
+			size, err := strconv.Atoi(string(value.Data))
+			if err != nil || size < tsMinChunkSize || size > tsMaxChunkSize || size%8 != 0 {
+				return nil, SimpleErrorResp("ERR TSDB: CHUNK_SIZE value must be a multiple of 8 in the range [48 .. 1048576]")
+			}
+			opts.chunkSize = size
+		case opt == "DUPLICATE_POLICY":
+			policy, ok := parseDuplicatePolicy(value)
+			if !ok {
+				return nil, SimpleErrorResp("ERR TSDB: Unknown DUPLICATE_POLICY")
+			}
+			opts.duplicatePolicy = policy
+		case opt == "ON_DUPLICATE" && extra == opt:
+			policy, ok := parseDuplicatePolicy(value)
+			if !ok {
+				return nil, SimpleErrorResp("ERR TSDB: Unknown ON_DUPLICATE policy")
+			}
+			opts.onDuplicate = policy
+		case opt == "TIMESTAMP" && extra == opt:
+			opts.timestamp = string(value.Data)
+		default:
+			return nil, SimpleErrorResp("ERR syntax error")
+		}
+		i++
+	}
+	return opts, nil
+}
+
+func newTimeSeriesWithOptions(opts *tsOptions) *TimeSeries {
+	ts := NewTimeSeries()
+	ts.retention = opts.retention
+	ts.chunkSize = opts.chunkSize
+	if opts.duplicatePolicy != "" {
+		ts.duplicatePolicy = opts.duplicatePolicy
+	}
+	ts.labels = opts.labels
+	return ts
+}
+
+// parseTimestamp parses a timestamp in milliseconds, "*" is the current time
+func parseTimestamp(arg string) (int64, *RESP) {
+	if arg == "*" {
+		return time.Now().UnixMilli(), nil
+	}
+	timestamp, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || timestamp < 0 {
+		return 0, SimpleErrorResp("ERR TSDB: invalid timestamp")
+	}
+	return timestamp, nil
+}
+
+func parseTSValue(arg string) (float64, *RESP) {
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(value) {
+		return 0, SimpleErrorResp("ERR TSDB: invalid value")
+	}
+	return value, nil
+}
+
+func tsSampleResp(sample tsSample) *RESP {
+	return ArrayResp(IntegerResp(int(sample.timestamp)), BulkStringResp(FormatScore(sample.value)))
+}
+
+func tsCreate(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for TS.CREATE")
+		}
+		key := string(resp.Nested[1].Data)
+		opts, errResp := parseTSOptions(resp.Nested[2:], "")
+		if errResp != nil {
+			return errResp, nil
+		}
+		if memory.Get(key).Type != "none" {
+			return SimpleErrorResp("ERR TSDB: key already exists"), nil
+		}
+		putTimeSeries(memory, key, newTimeSeriesWithOptions(opts))
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+func tsAdd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for TS.ADD")
+		}
+		key := string(resp.Nested[1].Data)
+		timestamp, errResp := parseTimestamp(string(resp.Nested[2].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		value, errResp := parseTSValue(string(resp.Nested[3].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		opts, errResp := parseTSOptions(resp.Nested[4:], "ON_DUPLICATE")
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		ts, errResp := getTimeSeries(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if ts == nil {
+			ts = newTimeSeriesWithOptions(opts)
+		}
+		if err := tsAddSample(memory, key, ts, tsSample{timestamp: timestamp, value: value}, opts.onDuplicate); err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		return IntegerResp(int(timestamp)), nil
+	}
+}
+
+func tsMadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 || (len(resp.Nested)-1)%3 != 0 {
+			return nil, fmt.Errorf("insufficient arguments for TS.MADD")
+		}
+		output := ArrayResp()
+		for i := 1; i < len(resp.Nested); i += 3 {
+			key := string(resp.Nested[i].Data)
+			result := func() *RESP {
+				timestamp, errResp := parseTimestamp(string(resp.Nested[i+1].Data))
+				if errResp != nil {
+					return errResp
+				}
+				value, errResp := parseTSValue(string(resp.Nested[i+2].Data))
+				if errResp != nil {
+					return errResp
+				}
+				ts, errResp := getTimeSeries(memory, key)
+				if errResp != nil {
+					return errResp
+				}
+				if ts == nil {
+					return SimpleErrorResp("ERR TSDB: the key does not exist")
+				}
+				if err := tsAddSample(memory, key, ts, tsSample{timestamp: timestamp, value: value}, ""); err != nil {
+					return SimpleErrorResp(err.Error())
+				}
+				return IntegerResp(int(timestamp))
+			}()
+			output.Nested = append(output.Nested, result)
+		}
+		return output, nil
+	}
+}
+
+func tsIncrbyGeneric(memory *Memory, name string, sign float64) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		key := string(resp.Nested[1].Data)
+		incr, errResp := parseTSValue(string(resp.Nested[2].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		opts, errResp := parseTSOptions(resp.Nested[3:], "TIMESTAMP")
+		if errResp != nil {
+			return errResp, nil
+		}
+		timestamp := time.Now().UnixMilli()
+		if opts.timestamp != "" {
+			timestamp, errResp = parseTimestamp(opts.timestamp)
+			if errResp != nil {
+				return errResp, nil
+			}
+		}
+
+		ts, errResp := getTimeSeries(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if ts == nil {
+			ts = newTimeSeriesWithOptions(opts)
+		}
+		value := sign * incr
+		if last, ok := ts.Last(); ok {
+			if timestamp < last.timestamp {
+				return SimpleErrorResp("ERR TSDB: timestamp must be equal to or higher than the maximum existing timestamp"), nil
+			}
+			value += last.value
+		}
+		if err := tsAddSample(memory, key, ts, tsSample{timestamp: timestamp, value: value}, "LAST"); err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		return IntegerResp(int(timestamp)), nil
+	}
+}
+
+func tsIncrby(memory *Memory) Executor {
+	return tsIncrbyGeneric(memory, "TS.INCRBY", 1)
+}
+
+func tsDecrby(memory *Memory) Executor {
+	return tsIncrbyGeneric(memory, "TS.DECRBY", -1)
+}
+
+func tsGet(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for TS.GET")
+		}
+		ts, errResp := getTimeSeries(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if ts == nil {
+			return SimpleErrorResp("ERR TSDB: the key does not exist"), nil
+		}
+		last, ok := ts.Last()
+		if !ok {
+			return ArrayResp(), nil
+		}
+		return tsSampleResp(last), nil
+	}
+}
+
+// tsFilter is a label matcher of TS.MRANGE: "label=value", "label!=value",
+// "label=(v1,v2)", "label!=(v1,v2)", "label=" for a missing label and
+// "label!=" for an existing one
+type tsFilter struct {
+	label  string
+	values []string
+	negate bool
+}
+
+func parseTSFilter(expr string) (tsFilter, bool) {
+	filter := tsFilter{}
+	index := strings.Index(expr, "=")
+	if index <= 0 {
+		return filter, false
+	}
+	filter.label, filter.negate = expr[:index], false
+	if strings.HasSuffix(filter.label, "!") {
+		filter.label, filter.negate = filter.label[:len(filter.label)-1], true
+	}
+	value := expr[index+1:]
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		filter.values = strings.Split(value[1:len(value)-1], ",")
+	} else if value != "" {
+		filter.values = []string{value}
+	}
+	return filter, filter.label != ""
+}
+
+func (f tsFilter) match(ts *TimeSeries) bool {
+	value, ok := ts.label(f.label)
+	if len(f.values) == 0 {
+		return ok == f.negate
+	}
+	in := false
+	for _, v := range f.values {
+		in = in || (ok && v == value)
+	}
+	return in != f.negate
+}
+
+// tsRangeRequest holds the options of TS.RANGE and TS.MRANGE
+type tsRangeRequest struct {
+	from        int64
+	to          int64
+	count       int
+	aggregation string
+	bucket      int64
+	filterByTs  map[int64]bool
+	minValue    float64
+	maxValue    float64
+	filterValue bool
+	withLabels  bool
+	filters     []tsFilter
+}
+
+func parseRangeTimestamp(arg string, defaultValue int64) (int64, *RESP) {
+	if arg == "-" || arg == "+" {
+		return defaultValue, nil
+	}
+	return parseTimestamp(arg)
+}
+
+// parseTSRangeRequest parses "fromTimestamp toTimestamp [FILTER_BY_TS ts
+// ...] [FILTER_BY_VALUE min max] [COUNT count] [AGGREGATION aggregator
+// bucketDuration]", multi also accepts WITHLABELS and requires FILTER
+func parseTSRangeRequest(args []*RESP, multi bool) (*tsRangeRequest, *RESP) {
+	req := &tsRangeRequest{count: -1}
+	var errResp *RESP
+	if req.from, errResp = parseRangeTimestamp(string(args[0].Data), 0); errResp != nil {
+		return nil, errResp
+	}
+	if req.to, errResp = parseRangeTimestamp(string(args[1].Data), math.MaxInt64); errResp != nil {
+		return nil, errResp
+	}
+
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i].Data))
+		remaining := len(args) - i - 1
+		switch {
+		case opt == "COUNT" && remaining >= 1:
+			count, err := strconv.Atoi(string(args[i+1].Data))
+			if err != nil || count < 0 {
+				return nil, SimpleErrorResp("ERR TSDB: Couldn't parse COUNT")
+			}
+			req.count = count
+			i++
+		case opt == "AGGREGATION" && remaining >= 2:
+			req.aggregation = strings.ToUpper(string(args[i+1].Data))
+			if !isTSAggregation(req.aggregation) {
+				return nil, SimpleErrorResp("ERR TSDB: Unknown aggregation type")
+			}
+			bucket, err := strconv.ParseInt(string(args[i+2].Data), 10, 64)
+			if err != nil || bucket <= 0 {
+				return nil, SimpleErrorResp("ERR TSDB: bucketDuration must be greater than zero")
+			}
+			req.bucket = bucket
+			i += 2
+		case opt == "FILTER_BY_VALUE" && remaining >= 2:
+			minValue, errResp := parseTSValue(string(args[i+1].Data))
+			if errResp != nil {
+				return nil, errResp
+			}
+			maxValue, errResp := parseTSValue(string(args[i+2].Data))
+			if errResp != nil {
+				return nil, errResp
+			}
+			req.minValue, req.maxValue, req.filterValue = minValue, maxValue, true
+			i += 2
+		case opt == "FILTER_BY_TS" && remaining >= 1:
+			req.filterByTs = make(map[int64]bool)
+			for i+1 < len(args) {
+				timestamp, err := strconv.ParseInt(string(args[i+1].Data), 10, 64)
+				if err != nil {
+					break
+				}
+				req.filterByTs[timestamp] = true
+				i++
+			}
+		case opt == "WITHLABELS" && multi:
+			req.withLabels = true
+		case opt == "FILTER" && multi && remaining >= 1:
+			for _, arg := range args[i+1:] {
+				filter, ok := parseTSFilter(string(arg.Data))
+				if !ok {
+					return nil, SimpleErrorResp("ERR TSDB: failed parsing labels")
+				}
+				req.filters = append(req.filters, filter)
+			}
+			i = len(args)
+		default:
+			return nil, SimpleErrorResp("ERR syntax error")
+		}
+	}
+
+	if multi {
+		hasMatcher := false
+		for _, filter := range req.filters {
+			hasMatcher = hasMatcher || (!filter.negate && len(filter.values) > 0)
+		}
+		if !hasMatcher {
+			return nil, SimpleErrorResp("ERR TSDB: please provide at least one matcher")
+		}
+	}
+	return req, nil
+}
+
+func isTSAggregation(aggregation string) bool {
+	for _, a := range tsAggregations {
+		if a == aggregation {
+			return true
+		}
+	}
+	return false
+}
+
+// tsRangeGeneric applies the filters, the aggregation and the count, in
+// this order, to the samples of the range
+func tsRangeGeneric(ts *TimeSeries, req *tsRangeRequest, reverse bool) *RESP {
+	samples := ts.Range(req.from, req.to)
+	if req.filterByTs != nil || req.filterValue {
+		filtered := make([]tsSample, 0, len(samples))
+		for _, sample := range samples {
+			if req.filterByTs != nil && !req.filterByTs[sample.timestamp] {
+				continue
+			}
+			if req.filterValue && (sample.value < req.minValue || sample.value > req.maxValue) {
+				continue
+			}
+			filtered = append(filtered, sample)
+		}
+		samples = filtered
+	}
+	if req.aggregation != "" {
+		samples = tsAggregate(samples, req.aggregation, req.bucket)
+	}
+	if reverse {
+		for i, j := 0, len(samples)-1; i < j; i, j = i+1, j-1 {
+			samples[i], samples[j] = samples[j], samples[i]
+		}
+	}
+	if req.count >= 0 && req.count < len(samples) {
+		samples = samples[:req.count]
+	}
+
+	output := ArrayResp()
+	for _, sample := range samples {
+		output.Nested = append(output.Nested, tsSampleResp(sample))
+	}
+	return output
+}
+
+func tsRangeCmd(memory *Memory, name string, reverse bool) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		req, errResp := parseTSRangeRequest(resp.Nested[2:], false)
+		if errResp != nil {
+			return errResp, nil
+		}
+		ts, errResp := getTimeSeries(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if ts == nil {
+			return SimpleErrorResp("ERR TSDB: the key does not exist"), nil
+		}
+		return tsRangeGeneric(ts, req, reverse), nil
+	}
+}
+
+func tsRange(memory *Memory) Executor {
+	return tsRangeCmd(memory, "TS.RANGE", false)
+}
+
+func tsRevrange(memory *Memory) Executor {
+	return tsRangeCmd(memory, "TS.REVRANGE", true)
+}
+
+// tsMrangeCmd replies, per series matching the filters and ordered by key,
+// the key, the labels when WITHLABELS is given and the samples
+func tsMrangeCmd(memory *Memory, name string, reverse bool) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		req, errResp := parseTSRangeRequest(resp.Nested[1:], true)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		keys := memory.Keys()
+		sort.Strings(keys)
+		output := ArrayResp()
+		for _, key := range keys {
+			entry := memory.Get(key)
+			if entry.Type != "TSDB-TYPE" {
+				continue
+			}
+			ts := (entry.Value).(*TimeSeries)
+			matched := true
+			for _, filter := range req.filters {
+				matched = matched && filter.match(ts)
+			}
+			if !matched {
+				continue
+			}
+
+			labels := ArrayResp()
+			if req.withLabels {
+				for _, label := range ts.labels {
+					labels.Nested = append(labels.Nested, BulkStringArrayResp([]string{label.name, label.value}))
+				}
+			}
+			output.Nested = append(output.Nested, ArrayResp(BulkStringResp(key), labels, tsRangeGeneric(ts, req, reverse)))
+		}
+		return output, nil
+	}
+}
+
+func tsMrange(memory *Memory) Executor {
+	return tsMrangeCmd(memory, "TS.MRANGE", false)
+}
+
+func tsMrevrange(memory *Memory) Executor {
+	return tsMrangeCmd(memory, "TS.MREVRANGE", true)
+}
+
+func tsCreaterule(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 6 {
+			return nil, fmt.Errorf("insufficient arguments for TS.CREATERULE")
+		}
+		srcKey, destKey := string(resp.Nested[1].Data), string(resp.Nested[2].Data)
+		if strings.ToUpper(string(resp.Nested[3].Data)) != "AGGREGATION" {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		aggregation := strings.ToUpper(string(resp.Nested[4].Data))
+		if !isTSAggregation(aggregation) {
+			return SimpleErrorResp("ERR TSDB: Unknown aggregation type"), nil
+		}
+		bucket, err := strconv.ParseInt(string(resp.Nested[5].Data), 10, 64)
+		if err != nil || bucket <= 0 {
+			return SimpleErrorResp("ERR TSDB: bucketDuration must be greater than zero"), nil
+		}
+		if srcKey == destKey {
+			return SimpleErrorResp("ERR TSDB: the source key and destination key should be different"), nil
+		}
+
+		src, errResp := getTimeSeries(memory, srcKey)
+		if errResp != nil {
+			return errResp, nil
+		}
+		dest, errResp := getTimeSeries(memory, destKey)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if src == nil || dest == nil {
+			return SimpleErrorResp("ERR TSDB: the key does not exist"), nil
+		}
+		// chains of rules are not supported
+		if dest.srcKey != "" || len(dest.rules) > 0 || src.srcKey != "" {
+			return SimpleErrorResp("ERR TSDB: the destination key already has a src rule"), nil
+		}
+
+		src.rules = append(src.rules, &tsRule{dest: destKey, aggregation: aggregation, bucket: bucket})
+		dest.srcKey = srcKey
+		putTimeSeries(memory, srcKey, src)
+		putTimeSeries(memory, destKey, dest)
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+func tsDeleterule(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for TS.DELETERULE")
+		}
+		srcKey, destKey := string(resp.Nested[1].Data), string(resp.Nested[2].Data)
+		src, errResp := getTimeSeries(memory, srcKey)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if src == nil {
+			return SimpleErrorResp("ERR TSDB: the key does not exist"), nil
+		}
+		for i, rule := range src.rules {
+			if rule.dest != destKey {
+				continue
+			}
+			src.rules = append(src.rules[:i], src.rules[i+1:]...)
+			putTimeSeries(memory, srcKey, src)
+			if dest, _ := getTimeSeries(memory, destKey); dest != nil {
+				dest.srcKey = ""
+				putTimeSeries(memory, destKey, dest)
+			}
+			return SimpleStringResp("OK"), nil
+		}
+		return SimpleErrorResp("ERR TSDB: compaction rule does not exist"), nil
+	}
+}
+
+func tsInfo(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for TS.INFO")
+		}
+		ts, errResp := getTimeSeries(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if ts == nil {
+			return SimpleErrorResp("ERR TSDB: the key does not exist"), nil
+		}
+
+		memoryUsage := 0
+		for _, chunk := range ts.chunks {
+			memoryUsage += chunk.size()
+		}
+		first, last := 0, 0
+		if len(ts.chunks) > 0 {
+			first, last = int(ts.chunks[0].first), int(ts.chunks[len(ts.chunks)-1].last)
+		}
+		labels := ArrayResp()
+		for _, label := range ts.labels {
+			labels.Nested = append(labels.Nested, BulkStringArrayResp([]string{label.name, label.value}))
+		}
+		rules := ArrayResp()
+		for _, rule := range ts.rules {
+			rules.Nested = append(rules.Nested, ArrayResp(BulkStringResp(rule.dest), IntegerResp(int(rule.bucket)), BulkStringResp(rule.aggregation)))
+		}
+
+		return ArrayResp(
+			BulkStringResp("totalSamples"), IntegerResp(ts.TotalSamples()),
+			BulkStringResp("memoryUsage"), IntegerResp(memoryUsage),
+			BulkStringResp("firstTimestamp"), IntegerResp(first),
+			BulkStringResp("lastTimestamp"), IntegerResp(last),
+			BulkStringResp("retentionTime"), IntegerResp(int(ts.retention)),
+			BulkStringResp("chunkCount"), IntegerResp(len(ts.chunks)),
+			BulkStringResp("chunkSize"), IntegerResp(ts.chunkSize),
+			BulkStringResp("chunkType"), BulkStringResp("compressed"),
+			BulkStringResp("duplicatePolicy"), BulkStringResp(strings.ToLower(ts.duplicatePolicy)),
+			BulkStringResp("labels"), labels,
+			BulkStringResp("sourceKey"), BulkStringResp(ts.srcKey),
+			BulkStringResp("rules"), rules,
+		), nil
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTSChunk_Compression(t *testing.T) {
+	samples := make([]tsSample, 0)
+	timestamp := int64(1700000000000)
+	for i := 0; i < 1000; i++ {
+		// mostly regular intervals with a few jumps
+		timestamp += 1000 + int64(i%7)*int64(i%3)
+		if i%100 == 0 {
+			timestamp += 1 << 20
+		}
+		samples = append(samples, tsSample{timestamp: timestamp, value: 20 + math.Sin(float64(i)/10)})
+	}
+	samples = append(samples, tsSample{timestamp: timestamp + 1, value: math.Inf(1)}, tsSample{timestamp: timestamp + 2, value: -0.5})
+
+	chunks := encodeChunks(samples, 1<<20)
+	if len(chunks) != 1 {
+		t.Fatalf("expected one chunk, got %v", len(chunks))
+	}
+	if size := chunks[0].size(); size >= len(samples)*16/2 {
+		t.Errorf("poor compression: %v bytes for %v samples", size, len(samples))
+	}
+	decoded := chunks[0].samples()
+	if len(decoded) != len(samples) {
+		t.Fatalf("expected %v samples, got %v", len(samples), len(decoded))
+	}
+	for i := range samples {
+		if decoded[i] != samples[i] {
+			t.Fatalf("sample %v: expected %v - actual %v", i, samples[i], decoded[i])
+		}
+	}
+
+	if chunks := encodeChunks(samples, 64); len(chunks) < 10 {
+		t.Errorf("expected samples to be split in chunks, got %v", len(chunks))
+	}
+}
+
+func TestTimeSeries_OutOfOrder(t *testing.T) {
+	ts := NewTimeSeries()
+	ts.chunkSize = tsMinChunkSize
+	ts.duplicatePolicy = "SUM"
+	for i := int64(0); i < 200; i += 2 {
+		ts.Add(tsSample{timestamp: i, value: float64(i)}, "")
+	}
+	for i := int64(1); i < 200; i += 2 {
+		ts.Add(tsSample{timestamp: i, value: float64(i)}, "")
+	}
+	ts.Add(tsSample{timestamp: 10, value: 1}, "")
+
+	samples := ts.Range(0, math.MaxInt64)
+	if len(samples) != 200 {
+		t.Fatalf("expected 200 samples, got %v", len(samples))
+	}
+	for i, sample := range samples {
+		expected := float64(i)
+		if i == 10 {
+			expected = 11
+		}
+		if sample.timestamp != int64(i) || sample.value != expected {
+			t.Fatalf("unexpected sample %v: %v", i, sample)
+		}
+	}
+}
+
+func TestProcessor_TimeSeries(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "create",
+			args:     []string{"TS.CREATE", "temp:1", "RETENTION", "100000", "LABELS", "sensor", "temp", "room", "a"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "create existing",
+			args:     []string{"TS.CREATE", "temp:1"},
+			expected: "-ERR TSDB: key already exists\r\n",
+		},
+		{
+			name:     "create second",
+			args:     []string{"TS.CREATE", "temp:2", "DUPLICATE_POLICY", "MAX", "LABELS", "sensor", "temp", "room", "b"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "create compaction",
+			args:     []string{"TS.CREATE", "temp:1:avg"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "create rule",
+			args:     []string{"TS.CREATERULE", "temp:1", "temp:1:avg", "AGGREGATION", "avg", "10"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "add",
+			args:     []string{"TS.ADD", "temp:1", "1", "10"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "madd",
+			args:     []string{"TS.MADD", "temp:1", "5", "20", "temp:1", "12", "30", "temp:2", "1", "5", "missing", "1", "1"},
+			expected: "*4\r\n:5\r\n:12\r\n:1\r\n-ERR TSDB: the key does not exist\r\n",
+		},
+		{
+			name:     "duplicate blocked",
+			args:     []string{"TS.ADD", "temp:1", "5", "1"},
+			expected: "-ERR TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode\r\n",
+		},
+		{
+			name:     "duplicate on_duplicate",
+			args:     []string{"TS.ADD", "temp:1", "5", "25", "ON_DUPLICATE", "LAST"},
+			expected: ":5\r\n",
+		},
+		{
+			name:     "duplicate policy max",
+			args:     []string{"TS.ADD", "temp:2", "1", "3"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "range",
+			args:     []string{"TS.RANGE", "temp:1", "-", "+"},
+			expected: "*3\r\n*2\r\n:1\r\n$2\r\n10\r\n*2\r\n:5\r\n$2\r\n25\r\n*2\r\n:12\r\n$2\r\n30\r\n",
+		},
+		{
+			name:     "revrange count",
+			args:     []string{"TS.REVRANGE", "temp:1", "0", "100", "COUNT", "1"},
+			expected: "*1\r\n*2\r\n:12\r\n$2\r\n30\r\n",
+		},
+		{
+			name:     "range aggregation",
+			args:     []string{"TS.RANGE", "temp:1", "-", "+", "AGGREGATION", "avg", "10"},
+			expected: "*2\r\n*2\r\n:0\r\n$4\r\n17.5\r\n*2\r\n:10\r\n$2\r\n30\r\n",
+		},
+		{
+			name:     "compacted bucket",
+			args:     []string{"TS.RANGE", "temp:1:avg", "-", "+"},
+			expected: "*1\r\n*2\r\n:0\r\n$4\r\n17.5\r\n",
+		},
+		{
+			name:     "late sample updates closed bucket",
+			args:     []string{"TS.ADD", "temp:1", "7", "5"},
+			expected: ":7\r\n",
+		},
+		{
+			name:     "compacted bucket updated",
+			args:     []string{"TS.RANGE", "temp:1:avg", "-", "+"},
+			expected: "*1\r\n*2\r\n:0\r\n$18\r\n13.333333333333334\r\n",
+		},
+		{
+			name:     "incrby",
+			args:     []string{"TS.INCRBY", "temp:1", "2", "TIMESTAMP", "12"},
+			expected: ":12\r\n",
+		},
+		{
+			name:     "incrby older timestamp",
+			args:     []string{"TS.INCRBY", "temp:1", "2", "TIMESTAMP", "3"},
+			expected: "-ERR TSDB: timestamp must be equal to or higher than the maximum existing timestamp\r\n",
+		},
+		{
+			name:     "get",
+			args:     []string{"TS.GET", "temp:1"},
+			expected: "*2\r\n:12\r\n$2\r\n32\r\n",
+		},
+		{
+			name:     "mrange",
+			args:     []string{"TS.MRANGE", "-", "+", "WITHLABELS", "AGGREGATION", "max", "100", "FILTER", "sensor=temp", "room!=b"},
+			expected: "*1\r\n*3\r\n$6\r\ntemp:1\r\n*2\r\n*2\r\n$6\r\nsensor\r\n$4\r\ntemp\r\n*2\r\n$4\r\nroom\r\n$1\r\na\r\n*1\r\n*2\r\n:0\r\n$2\r\n32\r\n",
+		},
+		{
+			name:     "mrevrange",
+			args:     []string{"TS.MREVRANGE", "-", "+", "FILTER", "room=(a,b)"},
+			expected: "*2\r\n*3\r\n$6\r\ntemp:1\r\n*0\r\n*4\r\n*2\r\n:12\r\n$2\r\n32\r\n*2\r\n:7\r\n$1\r\n5\r\n*2\r\n:5\r\n$2\r\n25\r\n*2\r\n:1\r\n$2\r\n10\r\n*3\r\n$6\r\ntemp:2\r\n*0\r\n*1\r\n*2\r\n:1\r\n$1\r\n5\r\n",
+		},
+		{
+			name:     "mrange without matcher",
+			args:     []string{"TS.MRANGE", "-", "+", "FILTER", "room!=a"},
+			expected: "-ERR TSDB: please provide at least one matcher\r\n",
+		},
+		{
+			name:     "retention",
+			args:     []string{"TS.ADD", "temp:1", "200000", "1"},
+			expected: ":200000\r\n",
+		},
+		{
+			name:     "older than retention",
+			args:     []string{"TS.ADD", "temp:1", "50000", "1"},
+			expected: "-ERR TSDB: Timestamp is older than retention\r\n",
+		},
+		{
+			name:     "expired samples",
+			args:     []string{"TS.RANGE", "temp:1", "-", "+"},
+			expected: "*1\r\n*2\r\n:200000\r\n$1\r\n1\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
+
+func TestProcessor_TimeSeriesCompactionRetention(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, args := range [][]string{
+		{"TS.CREATE", "src", "RETENTION", "100"},
+		{"TS.CREATE", "dest"},
+		{"TS.CREATERULE", "src", "dest", "AGGREGATION", "sum", "10"},
+		{"TS.ADD", "src", "1", "1"},
+		{"TS.ADD", "src", "12", "2"},
+		{"TS.ADD", "src", "25", "3"},
+		// trims every previous sample, including the open bucket 20
+		{"TS.ADD", "src", "200", "4"},
+	} {
+		if _, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(args))); err != nil {
+			t.Fatalf("%v - unexpected error: %v", args, err)
+		}
+	}
+
+	output, _ := processor.Accept(client, respParser.Serialize(BulkStringArrayResp([]string{"TS.RANGE", "dest", "-", "+"})))
+	expected := "*3\r\n*2\r\n:0\r\n$1\r\n1\r\n*2\r\n:10\r\n$1\r\n2\r\n*2\r\n:20\r\n$1\r\n3\r\n"
+	if string(output) != expected {
+		t.Errorf("expected: %q - actual: %q", expected, string(output))
+	}
+}
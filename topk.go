@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	TopKDefaultWidth = 8
+	TopKDefaultDepth = 7
+	TopKDefaultDecay = 0.9
+	TopKMaxIncrement = 100000
+	// bounds so a single command can not exhaust the memory
+	TopKMaxK       = 1 << 16
+	TopKMaxBuckets = 1 << 22
+
+	topkFingerprintSeed = 0x5bd1e995
+)
+
+type topkBucket struct {
+	fingerprint uint32
+	count       int
+}
+
+type topkItem struct {
+	item        string
+	fingerprint uint32
+	count       int
+}
+
+// TopK is a HeavyKeeper sketch: each row holds a fingerprint and a count per
+// bucket, a colliding item decays the count with probability decay^count
+// and takes the bucket over once it reaches zero. The k heaviest items seen
+// are kept aside in the top list.
+type TopK struct {
+	k       int
+	width   int
+	depth   int
+	decay   float64
+	buckets []topkBucket
+	top     []topkItem
+}
+
+func NewTopK(k, width, depth int, decay float64) *TopK {
+	return &TopK{
+		k:       k,
+		width:   width,
+		depth:   depth,
+		decay:   decay,
+		buckets: make([]topkBucket, width*depth),
+		top:     make([]topkItem, 0, k),
+	}
+}
+
+func (tk *TopK) topIndex(item string) int {
+	for i, entry := range tk.top {
+		if entry.item == item {
+			return i
+		}
+	}
+	return -1
+}
+
+// IncrBy counts the item and returns the item expelled from the top list
+// to make room for it, if any
+func (tk *TopK) IncrBy(item []byte, incr int) (string, bool) {
+	fingerprint := uint32(MurmurHash64A(item, topkFingerprintSeed))
+	maxCount := 0
+	for row := 0; row < tk.depth; row++ {
+		bucket := &tk.buckets[row*tk.width+int(MurmurHash64A(item, uint64(row))%uint64(tk.width))]
+		switch {
+		case bucket.count == 0:
+			bucket.fingerprint, bucket.count = fingerprint, incr
+		case bucket.fingerprint == fingerprint:
+			bucket.count += incr
+		default:
+			for remaining := incr; remaining > 0; remaining-- {
+				if rand.Float64() < math.Pow(tk.decay, float64(bucket.count)) {
+					bucket.count--
+					if bucket.count == 0 {
+						bucket.fingerprint, bucket.count = fingerprint, remaining
+						break
+					}
+				}
+			}
+		}
+		if bucket.fingerprint == fingerprint {
+			maxCount = max(maxCount, bucket.count)
+		}
+	}
+
+	name := string(item)
+	if i := tk.topIndex(name); i >= 0 {
+		tk.top[i].count = max(tk.top[i].count, maxCount)
+		return "", false
+	}
+	if len(tk.top) < tk.k {
+		tk.top = append(tk.top, topkItem{item: name, fingerprint: fingerprint, count: maxCount})
+		return "", false
+	}
+
+	minIndex := 0
+	for i, entry := range tk.top {
+		if entry.count < tk.top[minIndex].count {
+			minIndex = i
+		}
+	}
+	if maxCount <= tk.top[minIndex].count {
+		return "", false
+	}
+	expelled := tk.top[minIndex].item
+	tk.top[minIndex] = topkItem{item: name, fingerprint: fingerprint, count: maxCount}
+	return expelled, true
+}
+
+// List returns the top items, heaviest first
+func (tk *TopK) List() []topkItem {
+	items := append([]topkItem{}, tk.top...)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].count != items[j].count {
+			return items[i].count > items[j].count
+		}
+		return items[i].item < items[j].item
+	})
+	return items
+}
+
+// getTopK returns nil sketch when the key does not exist and an error
+// response when the key holds another type
+func getTopK(memory *Memory, key string) (*TopK, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "TopK-TYPE" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*TopK), nil
+}
+
+func putTopK(memory *Memory, key string, tk *TopK) {
+	memory.Put(key, Entry{Type: "TopK-TYPE", Value: tk}, Option{})
+}
+
+func topkReserve(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) != 3 && len(resp.Nested) != 6 {
+			return nil, fmt.Errorf("insufficient arguments for TOPK.RESERVE")
+		}
+		key := string(resp.Nested[1].Data)
+		k, err := strconv.Atoi(string(resp.Nested[2].Data))
+		if err != nil || k < 1 || k > TopKMaxK {
+			return SimpleErrorResp("ERR TopK: invalid k"), nil
+		}
+
+		width, depth, decay := TopKDefaultWidth, TopKDefaultDepth, TopKDefaultDecay
+		if len(resp.Nested) == 6 {
+			width, err = strconv.Atoi(string(resp.Nested[3].Data))
+			if err != nil || width < 1 {
+				return SimpleErrorResp("ERR TopK: invalid width"), nil
+			}
+			depth, err = strconv.Atoi(string(resp.Nested[4].Data))
+			if err != nil || depth < 1 {
+				return SimpleErrorResp("ERR TopK: invalid depth"), nil
+			}
+			decay, err = strconv.ParseFloat(string(resp.Nested[5].Data), 64)
+			if err != nil || decay <= 0 || decay > 1 {
+				return SimpleErrorResp("ERR TopK: invalid decay value. must be '<= 1' & '> 0'"), nil
+			}
+			if width > TopKMaxBuckets/depth {
+				return SimpleErrorResp("ERR TopK: width*depth is too large"), nil
+			}
+		}
+
+		if memory.Get(key).Type != "none" {
+			return SimpleErrorResp("ERR TopK: key already exists"), nil
+		}
+		putTopK(memory, key, NewTopK(k, width, depth, decay))
+		return SimpleStringResp("OK"), nil
+	}
+}
+
+// topkIncrGeneric replies per item the name of the item it expelled from
+// the top list, or nil
+func topkIncrGeneric(memory *Memory, key string, items []*RESP, increments []int) *RESP {
+	tk, errResp := getTopK(memory, key)
+	if errResp != nil {
+		return errResp
+	}
+	if tk == nil {
+		return SimpleErrorResp("ERR TopK: key does not exist")
+	}
+	output := ArrayResp()
+	for i, item := range items {
+		expelled, _ := tk.IncrBy(item.Data, increments[i])
+		output.Nested = append(output.Nested, BulkStringResp(expelled))
+	}
+	putTopK(memory, key, tk)
+	return output
+}
+
+func topkAdd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for TOPK.ADD")
+		}
+		items := resp.Nested[2:]
+		increments := make([]int, len(items))
+		for i := range increments {
+			increments[i] = 1
+		}
+		return topkIncrGeneric(memory, string(resp.Nested[1].Data), items, increments), nil
+	}
+}
+
+func topkIncrby(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 || len(resp.Nested)%2 != 0 {
+			return nil, fmt.Errorf("insufficient arguments for TOPK.INCRBY")
+		}
+		items := make([]*RESP, 0, len(resp.Nested)/2-1)
+		increments := make([]int, 0, len(resp.Nested)/2-1)
+		for i := 2; i < len(resp.Nested); i += 2 {
+			incr, err := strconv.Atoi(string(resp.Nested[i+1].Data))
+			if err != nil || incr < 1 || incr > TopKMaxIncrement {
+				return SimpleErrorResp("ERR TopK: increment must be an integer greater or equal to 1 and smaller or equal to 100000"), nil
+			}
+			items = append(items, resp.Nested[i])
+			increments = append(increments, incr)
+		}
+		return topkIncrGeneric(memory, string(resp.Nested[1].Data), items, increments), nil
+	}
+}
+
+func topkQuery(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for TOPK.QUERY")
+		}
+		tk, errResp := getTopK(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if tk == nil {
+			return SimpleErrorResp("ERR TopK: key does not exist"), nil
+		}
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			output.Nested = append(output.Nested, BoolIntegerResp(tk.topIndex(string(arg.Data)) >= 0))
+		}
+		return output, nil
+	}
+}
+
+func topkList(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for TOPK.LIST")
+		}
+		withCount := false
+		if len(resp.Nested) > 2 {
+			if len(resp.Nested) > 3 || strings.ToUpper(string(resp.Nested[2].Data)) != "WITHCOUNT" {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			withCount = true
+		}
+		tk, errResp := getTopK(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if tk == nil {
+			return SimpleErrorResp("ERR TopK: key does not exist"), nil
+		}
+
+		output := ArrayResp()
+		for _, entry := range tk.List() {
+			output.Nested = append(output.Nested, BulkStringResp(entry.item))
+			if withCount {
+				output.Nested = append(output.Nested, IntegerResp(entry.count))
+			}
+		}
+		return output, nil
+	}
+}
+
+func topkInfo(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for TOPK.INFO")
+		}
+		tk, errResp := getTopK(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if tk == nil {
+			return SimpleErrorResp("ERR TopK: key does not exist"), nil
+		}
+		return ArrayResp(
+			BulkStringResp("k"), IntegerResp(tk.k),
+			BulkStringResp("width"), IntegerResp(tk.width),
+			BulkStringResp("depth"), IntegerResp(tk.depth),
+			BulkStringResp("decay"), BulkStringResp(strconv.FormatFloat(tk.decay, 'f', -1, 64)),
+		), nil
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopK_HeavyHitters(t *testing.T) {
+	tk := NewTopK(5, 100, 5, 0.9)
+	// five heavy items among a long tail of light ones
+	for round := 0; round < 100; round++ {
+		for i := 0; i < 5; i++ {
+			tk.IncrBy([]byte(fmt.Sprintf("heavy:%d", i)), 1)
+		}
+		tk.IncrBy([]byte(fmt.Sprintf("light:%d", round)), 1)
+	}
+	for i := 0; i < 5; i++ {
+		if tk.topIndex(fmt.Sprintf("heavy:%d", i)) < 0 {
+			t.Errorf("heavy:%d is missing from the top list", i)
+		}
+	}
+}
+
+func TestProcessor_TopK(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "reserve",
+			args:     []string{"TOPK.RESERVE", "tk", "2", "50", "4", "0.9"},
+			expected: "+OK\r\n",
+		},
+		{
+			name:     "reserve k too large",
+			args:     []string{"TOPK.RESERVE", "big", "100000000000"},
+			expected: "-ERR TopK: invalid k\r\n",
+		},
+		{
+			name:     "reserve width*depth too large",
+			args:     []string{"TOPK.RESERVE", "big", "2", "100000000000", "100000000000", "0.9"},
+			expected: "-ERR TopK: width*depth is too large\r\n",
+		},
+		{
+			name:     "reserve existing",
+			args:     []string{"TOPK.RESERVE", "tk", "2"},
+			expected: "-ERR TopK: key already exists\r\n",
+		},
+		{
+			name:     "add",
+			args:     []string{"TOPK.ADD", "tk", "a", "b", "a"},
+			expected: "*3\r\n$-1\r\n$-1\r\n$-1\r\n",
+		},
+		{
+			name:     "incrby expels the lightest item",
+			args:     []string{"TOPK.INCRBY", "tk", "c", "5"},
+			expected: "*1\r\n$1\r\nb\r\n",
+		},
+		{
+			name:     "list",
+			args:     []string{"TOPK.LIST", "tk"},
+			expected: "*2\r\n$1\r\nc\r\n$1\r\na\r\n",
+		},
+		{
+			name:     "list withcount",
+			args:     []string{"TOPK.LIST", "tk", "WITHCOUNT"},
+			expected: "*4\r\n$1\r\nc\r\n:5\r\n$1\r\na\r\n:2\r\n",
+		},
+		{
+			name:     "query",
+			args:     []string{"TOPK.QUERY", "tk", "a", "b"},
+			expected: "*2\r\n:1\r\n:0\r\n",
+		},
+		{
+			name:     "incrby out of range",
+			args:     []string{"TOPK.INCRBY", "tk", "c", "0"},
+			expected: "-ERR TopK: increment must be an integer greater or equal to 1 and smaller or equal to 100000\r\n",
+		},
+		{
+			name:     "info",
+			args:     []string{"TOPK.INFO", "tk"},
+			expected: "*8\r\n$1\r\nk\r\n:2\r\n$5\r\nwidth\r\n:50\r\n$5\r\ndepth\r\n:4\r\n$5\r\ndecay\r\n$3\r\n0.9\r\n",
+		},
+		{
+			name:     "add missing key",
+			args:     []string{"TOPK.ADD", "missing", "a"},
+			expected: "-ERR TopK: key does not exist\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
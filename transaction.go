@@ -7,62 +7,84 @@ const (
 	TxExecuting TxStatus = "EXECUTING"
 )
 
-type Transaction struct {
-	Active map[string]*TxUnit
-}
-
 type TxUnit struct {
 	Status TxStatus
 	Queued [][]byte
 }
 
-func NewTransaction() *Transaction {
-	return &Transaction{
-		Active: make(map[string]*TxUnit),
+// Multi starts queuing the commands of the client
+func (c *Client) Multi() {
+	c.tx = &TxUnit{
+		Status: TxActive,
+		Queued: make([][]byte, 0),
 	}
+	c.Flags |= ClientMulti
+	c.Flags &^= ClientDirtyExec
 }
 
-func (tx *Transaction) Start(txId string) {
-	tx.Active[txId] = &TxUnit{
-		Status: TxActive,
-		Queued: make([][]byte, 0),
+func (c *Client) Enqueue(cmd []byte) {
+	if c.tx == nil {
+		return
 	}
+	c.tx.Queued = append(c.tx.Queued, cmd)
 }
 
-func (tx *Transaction) Enqueue(txId string, cmd []byte) {
-	txUnit, ok := tx.Active[txId]
-	if !ok {
+// Flag marks the transaction to be discarded by EXEC
+func (c *Client) Flag() {
+	if c.tx == nil {
 		return
 	}
-	txUnit.Queued = append(txUnit.Queued, cmd)
-	tx.Active[txId] = txUnit
+	c.Flags |= ClientDirtyExec
+}
+
+// InMulti tells whether the commands of the client are being queued
+func (c *Client) InMulti() bool {
+	return c.tx != nil && c.tx.Status == TxActive
 }
 
-func (tx *Transaction) IsExisted(txId string) bool {
-	_, ok := tx.Active[txId]
-	return ok
+func (c *Client) IsExisted() bool {
+	return c.tx != nil
 }
 
-func (tx *Transaction) Inactive(txId string) {
-	_, ok := tx.Active[txId]
-	if ok {
-		delete(tx.Active, txId)
+// Discard drops the transaction of the client
+func (c *Client) Discard() {
+	c.tx = nil
+	c.Flags &^= ClientMulti | ClientDirtyExec | ClientExecuting
+}
+
+func (c *Client) GetTx() *TxUnit {
+	return c.tx
+}
+
+func (c *Client) ChangeTxStatus(txStatus TxStatus) {
+	if c.tx == nil {
+		return
+	}
+	c.tx.Status = txStatus
+	if txStatus == TxExecuting {
+		c.Flags |= ClientExecuting
 	}
 }
 
-func (tx *Transaction) GetTx(txId string) *TxUnit {
-	queued, ok := tx.Active[txId]
-	if !ok {
-		return nil
+// Watch records the version of the key, a key watched twice keeps its first
+// version
+func (c *Client) Watch(key string, version uint64) {
+	if _, ok := c.watched[key]; !ok {
+		c.watched[key] = version
 	}
-	return queued
 }
 
-func (tx *Transaction) ChangeTxStatus(txId string, txStatus TxStatus) {
-	txUnit, ok := tx.Active[txId]
-	if !ok {
-		return
+func (c *Client) Unwatch() {
+	clear(c.watched)
+}
+
+// IsDirty tells whether any key watched by the client changed since it was
+// watched
+func (c *Client) IsDirty(memory *Memory) bool {
+	for key, version := range c.watched {
+		if memory.Version(key) != version {
+			return true
+		}
 	}
-	txUnit.Status = txStatus
-	tx.Active[txId] = txUnit
+	return false
 }
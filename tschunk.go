@@ -0,0 +1,208 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+type tsSample struct {
+	timestamp int64
+	value     float64
+}
+
+// tsBitStream is an append-only stream of bits, most significant first
+type tsBitStream struct {
+	buf   []byte
+	nbits int
+}
+
+func (s *tsBitStream) writeBit(bit bool) {
+	if s.nbits%8 == 0 {
+		s.buf = append(s.buf, 0)
+	}
+	if bit {
+		s.buf[len(s.buf)-1] |= 1 << (7 - s.nbits%8)
+	}
+	s.nbits++
+}
+
+func (s *tsBitStream) writeBits(value uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		s.writeBit(value&(1<<i) != 0)
+	}
+}
+
+type tsBitReader struct {
+	stream *tsBitStream
+	pos    int
+}
+
+func (r *tsBitReader) readBit() bool {
+	bit := r.stream.buf[r.pos/8]&(1<<(7-r.pos%8)) != 0
+	r.pos++
+	return bit
+}
+
+func (r *tsBitReader) readBits(n int) uint64 {
+	value := uint64(0)
+	for i := 0; i < n; i++ {
+		value <<= 1
+		if r.readBit() {
+			value |= 1
+		}
+	}
+	return value
+}
+
+// signExtend turns the n low bits of value into a signed number
+func signExtend(value uint64, n int) int64 {
+	shift := 64 - n
+	return int64(value<<shift) >> shift
+}
+
+// tsDeltaBuckets are the delta-of-delta encodings: a prefix of ones ended
+// by a zero selects the number of bits of the two's complement value, the
+// last bucket uses a full word and no terminating zero
+var tsDeltaBuckets = []int{7, 9, 12}
+
+// tsChunk compresses samples the way Gorilla does: timestamps as delta of
+// deltas and values as the XOR with the previous value, storing only the
+// meaningful bits between the leading and trailing zeros
+type tsChunk struct {
+	stream tsBitStream
+	count  int
+	first  int64
+	last   int64
+
+	// encoder state
+	prevDelta    int64
+	prevValue    uint64
+	prevLeading  int
+	prevTrailing int
+	hasWindow    bool
+}
+
+// append adds a sample newer than the last one of the chunk
+func (c *tsChunk) append(sample tsSample) {
+	valueBits := math.Float64bits(sample.value)
+	if c.count == 0 {
+		c.stream.writeBits(uint64(sample.timestamp), 64)
+		c.stream.writeBits(valueBits, 64)
+		c.first, c.last, c.prevValue = sample.timestamp, sample.timestamp, valueBits
+		c.count++
+		return
+	}
+
+	delta := sample.timestamp - c.last
+	c.writeDeltaOfDelta(delta - c.prevDelta)
+	c.writeValue(valueBits)
+	c.prevDelta, c.last, c.prevValue = delta, sample.timestamp, valueBits
+	c.count++
+}
+
+func (c *tsChunk) writeDeltaOfDelta(dod int64) {
+	if dod == 0 {
+		c.stream.writeBit(false)
+		return
+	}
+	for _, n := range tsDeltaBuckets {
+		c.stream.writeBit(true)
+		if dod >= -(1<<(n-1)) && dod < 1<<(n-1) {
+			c.stream.writeBit(false)
+			c.stream.writeBits(uint64(dod), n)
+			return
+		}
+	}
+	c.stream.writeBit(true)
+	c.stream.writeBits(uint64(dod), 64)
+}
+
+func (c *tsChunk) writeValue(valueBits uint64) {
+	xor := valueBits ^ c.prevValue
+	if xor == 0 {
+		c.stream.writeBit(false)
+		return
+	}
+	c.stream.writeBit(true)
+
+	leading := min(bits.LeadingZeros64(xor), 31)
+	trailing := bits.TrailingZeros64(xor)
+	if c.hasWindow && leading >= c.prevLeading && trailing >= c.prevTrailing {
+		// the meaningful bits fit in the previous window
+		c.stream.writeBit(false)
+		c.stream.writeBits(xor>>c.prevTrailing, 64-c.prevLeading-c.prevTrailing)
+		return
+	}
+
+	meaningful := 64 - leading - trailing
+	c.stream.writeBit(true)
+	c.stream.writeBits(uint64(leading), 5)
+	// 64 meaningful bits don't fit in 6 bits and are written as 0
+	c.stream.writeBits(uint64(meaningful&63), 6)
+	c.stream.writeBits(xor>>trailing, meaningful)
+	c.prevLeading, c.prevTrailing, c.hasWindow = leading, trailing, true
+}
+
+// samples decodes the whole chunk
+func (c *tsChunk) samples() []tsSample {
+	output := make([]tsSample, 0, c.count)
+	if c.count == 0 {
+		return output
+	}
+	reader := &tsBitReader{stream: &c.stream}
+	timestamp := int64(reader.readBits(64))
+	valueBits := reader.readBits(64)
+	output = append(output, tsSample{timestamp: timestamp, value: math.Float64frombits(valueBits)})
+
+	delta := int64(0)
+	leading, trailing := 0, 0
+	for i := 1; i < c.count; i++ {
+		delta += readDeltaOfDelta(reader)
+		timestamp += delta
+
+		if reader.readBit() {
+			if reader.readBit() {
+				leading = int(reader.readBits(5))
+				meaningful := int(reader.readBits(6))
+				if meaningful == 0 {
+					meaningful = 64
+				}
+				trailing = 64 - leading - meaningful
+			}
+			valueBits ^= reader.readBits(64-leading-trailing) << trailing
+		}
+		output = append(output, tsSample{timestamp: timestamp, value: math.Float64frombits(valueBits)})
+	}
+	return output
+}
+
+func readDeltaOfDelta(reader *tsBitReader) int64 {
+	if !reader.readBit() {
+		return 0
+	}
+	for _, n := range tsDeltaBuckets {
+		if !reader.readBit() {
+			return signExtend(reader.readBits(n), n)
+		}
+	}
+	return int64(reader.readBits(64))
+}
+
+func (c *tsChunk) size() int {
+	return len(c.stream.buf)
+}
+
+// encodeChunks compresses ordered samples into chunks of about chunkSize
+// bytes
+func encodeChunks(samples []tsSample, chunkSize int) []*tsChunk {
+	chunks := make([]*tsChunk, 0)
+	var chunk *tsChunk
+	for _, sample := range samples {
+		if chunk == nil || chunk.size() >= chunkSize {
+			chunk = &tsChunk{}
+			chunks = append(chunks, chunk)
+		}
+		chunk.append(sample)
+	}
+	return chunks
+}
@@ -1,11 +1,8 @@
 package main
 
 import (
-	"fmt"
-	"sort"
 	"strconv"
 	"strings"
-	"time"
 )
 
 func RespTypeString(respType RESPType) string {
@@ -28,104 +25,147 @@ func ToLowerCase(input string) string {
 	return strings.ToLower(input)
 }
 
-func ValidateStreamId(streamEntry StreamEntry, id string) error {
-	lastTime, lastSeq := "0", "0"
+const WrongTypeErr = "WRONGTYPE Operation against a key holding the wrong kind of value"
 
-	if len(streamEntry) > 0 {
-		keys := make([]string, 0, len(streamEntry))
-		for k := range streamEntry {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		latest := keys[len(keys)-1]
-
-		splittedLatest := strings.Split(latest, "-")
-		lastTime, lastSeq = splittedLatest[0], splittedLatest[1]
+func SimpleErrorResp(msg string) *RESP {
+	return &RESP{
+		Type: SimpleError,
+		Data: []byte(msg),
 	}
+}
 
-	splittedNow := strings.Split(id, "-")
-	time, seq := splittedNow[0], splittedNow[1]
-
-	if time == "0" && seq == "0" {
-		return fmt.Errorf("ERR The ID specified in XADD must be greater than 0-0")
+func SimpleStringResp(str string) *RESP {
+	return &RESP{
+		Type: SimpleString,
+		Data: []byte(str),
 	}
+}
 
-	if time < lastTime || time == lastTime && seq <= lastSeq {
-		return fmt.Errorf("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+// empty string will be serialized as a null bulk string
+func BulkStringResp(str string) *RESP {
+	return &RESP{
+		Type: BulkString,
+		Data: []byte(str),
 	}
-
-	return nil
 }
 
-func GenerateNextSeq(streamEntry StreamEntry, id string) string {
-	lastTime, lastSeq := "0", "0"
-	if len(streamEntry) > 0 {
-		keys := make([]string, 0, len(streamEntry))
-		for k := range streamEntry {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-		latest := keys[len(keys)-1]
+func IntegerResp(num int) *RESP {
+	return &RESP{
+		Type: Integers,
+		Data: []byte(strconv.Itoa(num)),
+	}
+}
 
-		splittedLatest := strings.Split(latest, "-")
-		lastTime, lastSeq = splittedLatest[0], splittedLatest[1]
+// BoolIntegerResp replies 1 for true and 0 for false
+func BoolIntegerResp(b bool) *RESP {
+	if b {
+		return IntegerResp(1)
 	}
+	return IntegerResp(0)
+}
 
-	if id == "*" {
-		currentMillis := time.Now().UnixMilli()
-		if lastTime == fmt.Sprintf("%v", currentMillis) {
-			lastSeqInt, _ := strconv.Atoi(lastSeq)
-			return fmt.Sprintf("%v-%v", currentMillis, lastSeqInt+1)
-		}
-		return fmt.Sprintf("%v-%v", currentMillis, 0)
+func ArrayResp(items ...*RESP) *RESP {
+	nested := make([]*RESP, 0, len(items))
+	nested = append(nested, items...)
+	return &RESP{
+		Type:   Arrays,
+		Nested: nested,
 	}
+}
 
-	splitted := strings.Split(id, "-")
-	time, seq := splitted[0], "0"
-	if lastTime == "0" && lastSeq == "0" {
-		if time == "0" {
-			seq = "1"
-		} else {
-			seq = "0"
-		}
-	} else {
-		if time == lastTime {
-			seqInt, _ := strconv.Atoi(lastSeq)
-			seq = strconv.Itoa(seqInt + 1)
-		} else {
-			seq = "0"
-		}
+// NullArrayResp replies a null array, serialized with -1 as size
+func NullArrayResp() *RESP {
+	return &RESP{
+		Type: Arrays,
+		Null: true,
 	}
-	return fmt.Sprintf("%v-%v", time, seq)
 }
 
-func QueryStreamKeysByRange(streamEntry StreamEntry, start string, end string, inclusive bool) []string {
-	output := make([]string, 0, len(streamEntry))
-	if start == "-" {
-		start = "0"
+func BulkStringArrayResp(items []string) *RESP {
+	nested := make([]*RESP, 0, len(items))
+	for _, item := range items {
+		nested = append(nested, BulkStringResp(item))
 	}
-	if end == "+" {
-		end = fmt.Sprintf("%v", time.Now().UnixMilli())
+	return &RESP{
+		Type:   Arrays,
+		Nested: nested,
 	}
+}
 
-	if inclusive {
-		for key := range streamEntry {
-			if key >= start && key <= end {
-				output = append(output, key)
+// GlobMatch reports whether str matches the glob-style pattern used by
+// SCAN MATCH and KEYS: '*', '?', '[...]' (with '^' negation and ranges) and '\' escapes
+func GlobMatch(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
 			}
-		}
-	} else {
-		for key := range streamEntry {
-			if key > start && key < end {
-				output = append(output, key)
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if GlobMatch(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+			str = str[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == str[0] {
+						match = true
+					}
+				} else if len(pattern) >= 3 && pattern[1] == '-' && pattern[2] != ']' {
+					start, end := pattern[0], pattern[2]
+					if start > end {
+						start, end = end, start
+					}
+					if str[0] >= start && str[0] <= end {
+						match = true
+					}
+					pattern = pattern[2:]
+				} else if pattern[0] == str[0] {
+					match = true
+				}
+				pattern = pattern[1:]
+			}
+			if not {
+				match = !match
 			}
+			if !match {
+				return false
+			}
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+			str = str[1:]
+		}
+		if len(pattern) > 0 {
+			pattern = pattern[1:]
 		}
 	}
-	sort.Strings(output)
-
-	if start == "$" {
-		return []string{output[len(output)-1]}
-	}
-
-	return output
+	return len(str) == 0
 }
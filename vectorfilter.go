@@ -0,0 +1,463 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// vectorFilter evaluates a FILTER expression against the JSON attributes of
+// an element. Values are float64, string, bool, []any or nil, nil standing
+// for a missing attribute or an invalid operation so that the element is
+// left out.
+type vectorFilter func(attributes *jsonObject) any
+
+// parseVectorFilter compiles the expression language of VSIM FILTER:
+//
+//	.year >= 1980 and .genre == "action"
+//	not (.rating < 3 || .tags in ["old"])
+//	.price * 2 <= 100
+//
+// Selectors read the top level members of the attributes, "in" checks the
+// membership in an array or a substring.
+func parseVectorFilter(expr string) (vectorFilter, error) {
+	tokens, err := tokenizeVectorFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &vectorFilterParser{tokens: tokens}
+	filter, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, vectorFilterSyntaxErr
+	}
+	return filter, nil
+}
+
+var vectorFilterSyntaxErr = fmt.Errorf("ERR syntax error in FILTER expression")
+
+// matchVectorFilter evaluates the filter, elements without attributes
+// never match
+func matchVectorFilter(filter vectorFilter, attributes *jsonObject) bool {
+	if attributes == nil {
+		return false
+	}
+	return vectorFilterTruthy(filter(attributes))
+}
+
+type vectorFilterToken struct {
+	kind  string // "number", "string", "selector", "op" or "word"
+	text  string
+	value any
+}
+
+func tokenizeVectorFilter(expr string) ([]vectorFilterToken, error) {
+	tokens := make([]vectorFilterToken, 0)
+	isIdent := func(r byte) bool {
+		return r == '_' || unicode.IsLetter(rune(r)) || unicode.IsDigit(rune(r))
+	}
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '.' && i+1 < len(expr) && (expr[i+1] == '_' || unicode.IsLetter(rune(expr[i+1]))):
+			start := i + 1
+			for i = start; i < len(expr) && isIdent(expr[i]); i++ {
+			}
+			tokens = append(tokens, vectorFilterToken{kind: "selector", text: expr[start:i]})
+		case c == '.' || unicode.IsDigit(rune(c)):
+			start := i
+			for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || strings.IndexByte(".eE", expr[i]) >= 0 ||
+				((expr[i] == '-' || expr[i] == '+') && (expr[i-1] == 'e' || expr[i-1] == 'E'))) {
+				i++
+			}
+			number, err := strconv.ParseFloat(expr[start:i], 64)
+			if err != nil {
+				return nil, vectorFilterSyntaxErr
+			}
+			tokens = append(tokens, vectorFilterToken{kind: "number", value: number})
+		case c == '"' || c == '\'':
+			var builder strings.Builder
+			i++
+			for ; i < len(expr) && expr[i] != c; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				builder.WriteByte(expr[i])
+			}
+			if i >= len(expr) {
+				return nil, vectorFilterSyntaxErr
+			}
+			i++
+			tokens = append(tokens, vectorFilterToken{kind: "string", value: builder.String()})
+		case isIdent(c):
+			start := i
+			for ; i < len(expr) && isIdent(expr[i]); i++ {
+			}
+			tokens = append(tokens, vectorFilterToken{kind: "word", text: strings.ToLower(expr[start:i])})
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", ">=", "<=", "&&", "||", ">", "<", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, vectorFilterSyntaxErr
+			}
+			i += len(op)
+			tokens = append(tokens, vectorFilterToken{kind: "op", text: op})
+		}
+	}
+	return tokens, nil
+}
+
+type vectorFilterParser struct {
+	tokens []vectorFilterToken
+	pos    int
+}
+
+// accept consumes the next token when it is one of the operators or words
+func (p *vectorFilterParser) accept(texts ...string) (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	token := p.tokens[p.pos]
+	if token.kind != "op" && token.kind != "word" {
+		return "", false
+	}
+	for _, text := range texts {
+		if token.text == text {
+			p.pos++
+			return text, true
+		}
+	}
+	return "", false
+}
+
+func (p *vectorFilterParser) parseOr() (vectorFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("or", "||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(attributes *jsonObject) any {
+			return vectorFilterTruthy(l(attributes)) || vectorFilterTruthy(right(attributes))
+		}
+	}
+}
+
+func (p *vectorFilterParser) parseAnd() (vectorFilter, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("and", "&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(attributes *jsonObject) any {
+			return vectorFilterTruthy(l(attributes)) && vectorFilterTruthy(right(attributes))
+		}
+	}
+}
+
+func (p *vectorFilterParser) parseNot() (vectorFilter, error) {
+	if _, ok := p.accept("not", "!"); !ok {
+		return p.parseComparison()
+	}
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return func(attributes *jsonObject) any {
+		value := operand(attributes)
+		if value == nil {
+			return nil
+		}
+		return !vectorFilterTruthy(value)
+	}, nil
+}
+
+func (p *vectorFilterParser) parseComparison() (vectorFilter, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", ">", ">=", "<", "<=", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return func(attributes *jsonObject) any {
+		a, b := left(attributes), right(attributes)
+		if a == nil || b == nil {
+			return nil
+		}
+		switch op {
+		case "==":
+			return vectorFilterEqual(a, b)
+		case "!=":
+			return !vectorFilterEqual(a, b)
+		case "in":
+			return vectorFilterIn(a, b)
+		}
+		cmp, ok := vectorFilterCompare(a, b)
+		if !ok {
+			return nil
+		}
+		switch op {
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		case "<":
+			return cmp < 0
+		}
+		return cmp <= 0
+	}, nil
+}
+
+func (p *vectorFilterParser) parseAdditive() (vectorFilter, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = vectorFilterArithmetic(op, left, right)
+	}
+}
+
+func (p *vectorFilterParser) parseMultiplicative() (vectorFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = vectorFilterArithmetic(op, left, right)
+	}
+}
+
+func (p *vectorFilterParser) parseUnary() (vectorFilter, error) {
+	if _, ok := p.accept("-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		zero := func(attributes *jsonObject) any { return 0.0 }
+		return vectorFilterArithmetic("-", zero, operand), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *vectorFilterParser) parsePrimary() (vectorFilter, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, vectorFilterSyntaxErr
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case "number", "string":
+		return func(attributes *jsonObject) any { return token.value }, nil
+	case "selector":
+		return func(attributes *jsonObject) any {
+			return vectorFilterValue(attributes.fields[token.text])
+		}, nil
+	case "word":
+		switch token.text {
+		case "true", "false":
+			value := token.text == "true"
+			return func(attributes *jsonObject) any { return value }, nil
+		}
+		return nil, vectorFilterSyntaxErr
+	}
+
+	switch token.text {
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(")"); !ok {
+			return nil, vectorFilterSyntaxErr
+		}
+		return inner, nil
+	case "[":
+		items := make([]vectorFilter, 0)
+		if _, ok := p.accept("]"); ok {
+			return func(attributes *jsonObject) any { return []any{} }, nil
+		}
+		for {
+			item, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if _, ok := p.accept("]"); ok {
+				break
+			}
+			if _, ok := p.accept(","); !ok {
+				return nil, vectorFilterSyntaxErr
+			}
+		}
+		return func(attributes *jsonObject) any {
+			values := make([]any, 0, len(items))
+			for _, item := range items {
+				values = append(values, item(attributes))
+			}
+			return values
+		}, nil
+	}
+	return nil, vectorFilterSyntaxErr
+}
+
+// vectorFilterValue converts a JSON attribute, objects are not supported
+func vectorFilterValue(value any) any {
+	switch v := value.(type) {
+	case int64:
+		return float64(v)
+	case float64, string, bool:
+		return v
+	case *jsonArray:
+		values := make([]any, 0, len(v.items))
+		for _, item := range v.items {
+			values = append(values, vectorFilterValue(item))
+		}
+		return values
+	}
+	return nil
+}
+
+func vectorFilterTruthy(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	}
+	return false
+}
+
+func vectorFilterEqual(a, b any) bool {
+	switch va := a.(type) {
+	case []any:
+		vb, ok := b.([]any)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !vectorFilterEqual(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	case float64, string, bool:
+		return a == b
+	}
+	return false
+}
+
+func vectorFilterCompare(a, b any) (int, bool) {
+	switch va := a.(type) {
+	case float64:
+		if vb, ok := b.(float64); ok {
+			switch {
+			case va < vb:
+				return -1, true
+			case va > vb:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if vb, ok := b.(string); ok {
+			return strings.Compare(va, vb), true
+		}
+	}
+	return 0, false
+}
+
+func vectorFilterIn(a, b any) bool {
+	switch vb := b.(type) {
+	case []any:
+		for _, item := range vb {
+			if vectorFilterEqual(a, item) {
+				return true
+			}
+		}
+	case string:
+		if va, ok := a.(string); ok {
+			return strings.Contains(vb, va)
+		}
+	}
+	return false
+}
+
+func vectorFilterArithmetic(op string, left, right vectorFilter) vectorFilter {
+	return func(attributes *jsonObject) any {
+		a, ok1 := left(attributes).(float64)
+		b, ok2 := right(attributes).(float64)
+		if !ok1 || !ok2 {
+			return nil
+		}
+		switch op {
+		case "+":
+			return a + b
+		case "-":
+			return a - b
+		case "*":
+			return a * b
+		case "/":
+			if b == 0 {
+				return nil
+			}
+			return a / b
+		}
+		if b == 0 {
+			return nil
+		}
+		return math.Mod(a, b)
+	}
+}
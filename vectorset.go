@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// VectorSet is the value of the vectorset type, every vector of a set has
+// the same dimension and quantization
+type VectorSet struct {
+	dim      int
+	quantize bool
+	graph    *HNSW
+}
+
+func NewVectorSet(dim int, quantize bool, m, efConstruction int) *VectorSet {
+	return &VectorSet{
+		dim:      dim,
+		quantize: quantize,
+		graph:    NewHNSW(m, efConstruction),
+	}
+}
+
+// Add inserts the element or moves it when the vector changed, it returns
+// the node and whether the element is new
+func (vs *VectorSet) Add(element string, vector []float32) (*hnswNode, bool) {
+	node := newHNSWNode(element, vector, vs.quantize)
+	existing := vs.graph.Get(element)
+	if existing != nil {
+		if hnswDistance(node, existing) == 0 && node.norm == existing.norm {
+			return existing, false
+		}
+		node.attributes, node.object = existing.attributes, existing.object
+		vs.graph.Delete(element)
+	}
+	vs.graph.Insert(node)
+	return node, existing == nil
+}
+
+// setVectorAttributes replaces the attributes of the node, an empty string
+// removes them
+func setVectorAttributes(node *hnswNode, attributes string) *RESP {
+	if attributes == "" {
+		node.attributes, node.object = "", nil
+		return nil
+	}
+	value, err := ParseJSON(attributes)
+	if err != nil {
+		return SimpleErrorResp("ERR invalid JSON in attributes")
+	}
+	node.attributes = attributes
+	node.object, _ = value.(*jsonObject)
+	return nil
+}
+
+// getVectorSet returns nil set when the key does not exist and an error
+// response when the key holds another type
+func getVectorSet(memory *Memory, key string) (*VectorSet, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "vectorset" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*VectorSet), nil
+}
+
+func putVectorSet(memory *Memory, key string, vs *VectorSet) {
+	if vs.graph.Len() == 0 {
+		memory.Delete(key)
+		return
+	}
+	memory.Put(key, Entry{Type: "vectorset", Value: vs}, Option{})
+}
+
+// parseVector reads "VALUES count value ..." or "FP32 blob" at i, it
+// returns the vector and the index of the next argument
+func parseVector(args []*RESP, i int) ([]float32, int, *RESP) {
+	if i >= len(args) {
+		return nil, 0, SimpleErrorResp("ERR syntax error")
+	}
+	switch strings.ToUpper(string(args[i].Data)) {
+	case "FP32":
+		if i+1 >= len(args) {
+			return nil, 0, SimpleErrorResp("ERR syntax error")
+		}
+		blob := args[i+1].Data
+		if len(blob) == 0 || len(blob)%4 != 0 {
+			return nil, 0, SimpleErrorResp("ERR invalid vector specification")
+		}
+		vector := make([]float32, len(blob)/4)
+		for j := range vector {
+			vector[j] = math.Float32frombits(binary.LittleEndian.Uint32(blob[j*4:]))
+		}
+		return vector, i + 2, nil
+	case "VALUES":
+		if i+1 >= len(args) {
+			return nil, 0, SimpleErrorResp("ERR syntax error")
+		}
+		count, err := strconv.Atoi(string(args[i+1].Data))
+		if err != nil || count <= 0 {
+			return nil, 0, SimpleErrorResp("ERR invalid vector specification")
+		}
+		if count > len(args)-i-2 {
+			return nil, 0, SimpleErrorResp("ERR invalid vector specification")
+		}
+		vector := make([]float32, count)
+		for j := range vector {
+			value, err := strconv.ParseFloat(string(args[i+2+j].Data), 32)
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil, 0, SimpleErrorResp("ERR invalid vector specification")
+			}
+			vector[j] = float32(value)
+		}
+		return vector, i + 2 + count, nil
+	}
+	return nil, 0, SimpleErrorResp("ERR syntax error")
+}
+
+func vectorDimensionErr(got, expected int) *RESP {
+	return SimpleErrorResp(fmt.Sprintf("ERR Vector dimension mismatch - got %v but set has %v", got, expected))
+}
+
+// vadd parses "key (FP32 blob | VALUES count value ...) element [CAS]
+// [NOQUANT | Q8] [EF build-exploration-factor] [SETATTR attributes] [M
+// links]", quantization and graph options only apply when the set is
+// created
+func vadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for VADD")
+		}
+		key := string(resp.Nested[1].Data)
+		vector, i, errResp := parseVector(resp.Nested, 2)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if i >= len(resp.Nested) {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		element := string(resp.Nested[i].Data)
+
+		quant, m, ef := "", HNSWDefaultM, HNSWDefaultEFConstruction
+		attributes, hasAttributes := "", false
+		args := resp.Nested[i+1:]
+		for j := 0; j < len(args); j++ {
+			opt := strings.ToUpper(string(args[j].Data))
+			switch {
+			case opt == "CAS":
+				// commands run one at a time, there is nothing to check
+			case opt == "NOQUANT" || opt == "Q8":
+				quant = opt
+			case (opt == "EF" || opt == "M") && j+1 < len(args):
+				value, err := strconv.Atoi(string(args[j+1].Data))
+				if err != nil || value <= 0 || (opt == "M" && (value < 2 || value > HNSWMaxM)) || (opt == "EF" && value > HNSWMaxEF) {
+					return SimpleErrorResp(fmt.Sprintf("ERR invalid %v", opt)), nil
+				}
+				if opt == "EF" {
+					ef = value
+				} else {
+					m = value
+				}
+				j++
+			case opt == "SETATTR" && j+1 < len(args):
+				attributes, hasAttributes = string(args[j+1].Data), true
+				j++
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+
+		vs, errResp := getVectorSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if vs == nil {
+			// int8 quantization unless asked otherwise, as redis does
+			vs = NewVectorSet(len(vector), quant != "NOQUANT", m, ef)
+		}
+		if len(vector) != vs.dim {
+			return vectorDimensionErr(len(vector), vs.dim), nil
+		}
+		if quant != "" && (quant == "Q8") != vs.quantize {
+			return SimpleErrorResp("ERR asked quantization mismatch with existing vector set"), nil
+		}
+
+		node, added := vs.Add(element, vector)
+		if hasAttributes {
+			if errResp := setVectorAttributes(node, attributes); errResp != nil {
+				if added {
+					vs.graph.Delete(element)
+				}
+				return errResp, nil
+			}
+		}
+		putVectorSet(memory, key, vs)
+		return BoolIntegerResp(added), nil
+	}
+}
+
+// vsim parses "key (ELE element | FP32 blob | VALUES count value ...)
+// [WITHSCORES] [WITHATTRIBS] [COUNT num] [EF search-exploration-factor]
+// [FILTER expression] [FILTER-EF max-filtering-effort] [TRUTH] [NOTHREAD]",
+// scores go from 0 for opposite vectors to 1 for identical ones
+func vsim(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for VSIM")
+		}
+		vs, errResp := getVectorSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		var vector []float32
+		var element *hnswNode
+		i := 2
+		if strings.ToUpper(string(resp.Nested[2].Data)) == "ELE" {
+			if vs != nil {
+				element = vs.graph.Get(string(resp.Nested[3].Data))
+			}
+			i = 4
+		} else {
+			vector, i, errResp = parseVector(resp.Nested, 2)
+			if errResp != nil {
+				return errResp, nil
+			}
+		}
+
+		withScores, withAttributes, truth := false, false, false
+		count, ef, filterEF := 10, HNSWDefaultEFConstruction, 0
+		var filter vectorFilter
+		args := resp.Nested[i:]
+		for j := 0; j < len(args); j++ {
+			opt := strings.ToUpper(string(args[j].Data))
+			switch {
+			case opt == "WITHSCORES":
+				withScores = true
+			case opt == "WITHATTRIBS":
+				withAttributes = true
+			case opt == "TRUTH":
+				truth = true
+			case opt == "NOTHREAD":
+			case (opt == "COUNT" || opt == "EF" || opt == "FILTER-EF") && j+1 < len(args):
+				value, err := strconv.Atoi(string(args[j+1].Data))
+				if err != nil || value <= 0 || (opt != "COUNT" && value > HNSWMaxEF) {
+					return SimpleErrorResp(fmt.Sprintf("ERR invalid %v", opt)), nil
+				}
+				switch opt {
+				case "COUNT":
+					count = value
+				case "EF":
+					ef = value
+				default:
+					filterEF = value
+				}
+				j++
+			case opt == "FILTER" && j+1 < len(args):
+				var err error
+				filter, err = parseVectorFilter(string(args[j+1].Data))
+				if err != nil {
+					return SimpleErrorResp(err.Error()), nil
+				}
+				j++
+			default:
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+		}
+
+		if vs == nil {
+			return ArrayResp(), nil
+		}
+		query := element
+		if query == nil {
+			if vector == nil {
+				return SimpleErrorResp("ERR element not found in set"), nil
+			}
+			if len(vector) != vs.dim {
+				return vectorDimensionErr(len(vector), vs.dim), nil
+			}
+			query = newHNSWNode("", vector, vs.quantize)
+		}
+
+		var accept func(*hnswNode) bool
+		if filter != nil {
+			accept = func(node *hnswNode) bool {
+				return matchVectorFilter(filter, node.object)
+			}
+			if filterEF == 0 {
+				filterEF = count * 100
+			}
+		}
+		var results []hnswCandidate
+		if truth {
+			results = vs.graph.SearchExact(query, count, accept)
+		} else {
+			results = vs.graph.Search(query, count, ef, accept, filterEF)
+		}
+
+		output := ArrayResp()
+		for _, result := range results {
+			output.Nested = append(output.Nested, BulkStringResp(result.node.element))
+			if withScores {
+				score := 1 - result.distance/2
+				output.Nested = append(output.Nested, BulkStringResp(FormatScore(math.Max(0, math.Min(1, score)))))
+			}
+			if withAttributes {
+				output.Nested = append(output.Nested, BulkStringResp(result.node.attributes))
+			}
+		}
+		return output, nil
+	}
+}
+
+func vrem(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for VREM")
+		}
+		key := string(resp.Nested[1].Data)
+		vs, errResp := getVectorSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if vs == nil || !vs.graph.Delete(string(resp.Nested[2].Data)) {
+			return IntegerResp(0), nil
+		}
+		putVectorSet(memory, key, vs)
+		return IntegerResp(1), nil
+	}
+}
+
+func vcard(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for VCARD")
+		}
+		vs, errResp := getVectorSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if vs == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(vs.graph.Len()), nil
+	}
+}
+
+func vdim(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for VDIM")
+		}
+		vs, errResp := getVectorSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if vs == nil {
+			return SimpleErrorResp("ERR key does not exist"), nil
+		}
+		return IntegerResp(vs.dim), nil
+	}
+}
+
+// vemb returns the vector of the element, approximated for quantized sets
+func vemb(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for VEMB")
+		}
+		vs, errResp := getVectorSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if vs == nil {
+			return BulkStringResp(""), nil
+		}
+		node := vs.graph.Get(string(resp.Nested[2].Data))
+		if node == nil {
+			return BulkStringResp(""), nil
+		}
+		values := make([]string, 0, vs.dim)
+		for _, v := range node.embedding() {
+			values = append(values, formatVectorComponent(v))
+		}
+		return BulkStringArrayResp(values), nil
+	}
+}
+
+func vsetattr(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for VSETATTR")
+		}
+		vs, errResp := getVectorSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if vs == nil {
+			return IntegerResp(0), nil
+		}
+		node := vs.graph.Get(string(resp.Nested[2].Data))
+		if node == nil {
+			return IntegerResp(0), nil
+		}
+		if errResp := setVectorAttributes(node, string(resp.Nested[3].Data)); errResp != nil {
+			return errResp, nil
+		}
+		return IntegerResp(1), nil
+	}
+}
+
+func vgetattr(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for VGETATTR")
+		}
+		vs, errResp := getVectorSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if vs == nil {
+			return BulkStringResp(""), nil
+		}
+		node := vs.graph.Get(string(resp.Nested[2].Data))
+		if node == nil {
+			return BulkStringResp(""), nil
+		}
+		return BulkStringResp(node.attributes), nil
+	}
+}
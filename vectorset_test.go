@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func randomVector(r *rand.Rand, dim int) []float32 {
+	vector := make([]float32, dim)
+	for i := range vector {
+		vector[i] = float32(r.NormFloat64())
+	}
+	return vector
+}
+
+func TestHNSW_Recall(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, quantize := range []bool{false, true} {
+		graph := NewHNSW(HNSWDefaultM, 100)
+		for i := 0; i < 1000; i++ {
+			graph.Insert(newHNSWNode(fmt.Sprintf("e%d", i), randomVector(r, 32), quantize))
+		}
+		// deleted nodes must not break the graph
+		for i := 0; i < 1000; i += 4 {
+			graph.Delete(fmt.Sprintf("e%d", i))
+		}
+
+		found, total := 0, 0
+		for q := 0; q < 50; q++ {
+			query := newHNSWNode("", randomVector(r, 32), quantize)
+			exact := make(map[string]bool)
+			for _, c := range graph.SearchExact(query, 10, nil) {
+				exact[c.node.element] = true
+			}
+			for _, c := range graph.Search(query, 10, 100, nil, 0) {
+				if exact[c.node.element] {
+					found++
+				}
+			}
+			total += len(exact)
+		}
+		if recall := float64(found) / float64(total); recall < 0.9 {
+			t.Errorf("quantize: %v - recall too low: %v", quantize, recall)
+		}
+	}
+}
+
+func TestVectorFilter(t *testing.T) {
+	attributes, _ := ParseJSON(`{"year": 1984, "genre": "action", "rating": 4.5, "tags": ["classic", "sci-fi"], "title": "The Terminator"}`)
+	testcases := []struct {
+		expr     string
+		expected bool
+	}{
+		{expr: ".year > 1980", expected: true},
+		{expr: ".year >= 1980 and .genre == 'drama'", expected: false},
+		{expr: ".year < 1980 || .genre == \"action\"", expected: true},
+		{expr: "not (.rating < 3)", expected: true},
+		{expr: "!(.rating * 2 >= 9)", expected: false},
+		{expr: "(.year - 1900) % 10 == 4", expected: true},
+		{expr: "'classic' in .tags", expected: true},
+		{expr: ".genre in ['drama', 'comedy']", expected: false},
+		{expr: "'Term' in .title", expected: true},
+		{expr: ".missing == 1", expected: false},
+		{expr: "not .missing", expected: false},
+		{expr: ".genre > 5", expected: false},
+	}
+	for _, tt := range testcases {
+		filter, err := parseVectorFilter(tt.expr)
+		if err != nil {
+			t.Errorf("expr: %v - unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if actual := matchVectorFilter(filter, attributes.(*jsonObject)); actual != tt.expected {
+			t.Errorf("expr: %v - expected: %v - actual: %v", tt.expr, tt.expected, actual)
+		}
+	}
+
+	for _, expr := range []string{".year >", "(.year", ".year == 'open", "1 2", "@"} {
+		if _, err := parseVectorFilter(expr); err == nil {
+			t.Errorf("expr: %v - expected error", expr)
+		}
+	}
+}
+
+func TestProcessor_VectorSet(t *testing.T) {
+	respParser := NewRESP()
+	testcases := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{
+			name:     "add",
+			args:     []string{"VADD", "points", "VALUES", "2", "1", "0", "a", "NOQUANT", "SETATTR", `{"color":"red","size":3}`},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "add second",
+			args:     []string{"VADD", "points", "VALUES", "2", "0", "1", "b", "SETATTR", `{"color":"blue","size":5}`},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "add third",
+			args:     []string{"VADD", "points", "VALUES", "2", "1", "1", "c"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "add existing",
+			args:     []string{"VADD", "points", "VALUES", "2", "1", "0", "a"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "dimension mismatch",
+			args:     []string{"VADD", "points", "VALUES", "3", "1", "0", "0", "d"},
+			expected: "-ERR Vector dimension mismatch - got 3 but set has 2\r\n",
+		},
+		{
+			name:     "quantization mismatch",
+			args:     []string{"VADD", "points", "VALUES", "2", "1", "0", "d", "Q8"},
+			expected: "-ERR asked quantization mismatch with existing vector set\r\n",
+		},
+		{
+			name:     "add huge values count",
+			args:     []string{"VADD", "points", "VALUES", "9223372036854775807", "1", "0", "c"},
+			expected: "-ERR invalid vector specification\r\n",
+		},
+		{
+			name:     "sim huge values count",
+			args:     []string{"VSIM", "points", "VALUES", "9223372036854775807", "1", "0"},
+			expected: "-ERR invalid vector specification\r\n",
+		},
+		{
+			name:     "add huge M",
+			args:     []string{"VADD", "other", "VALUES", "2", "1", "0", "c", "M", "9223372036854775807"},
+			expected: "-ERR invalid M\r\n",
+		},
+		{
+			name:     "add huge EF",
+			args:     []string{"VADD", "other", "VALUES", "2", "1", "0", "c", "EF", "9223372036854775807"},
+			expected: "-ERR invalid EF\r\n",
+		},
+		{
+			name:     "card",
+			args:     []string{"VCARD", "points"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "sim with scores",
+			args:     []string{"VSIM", "points", "VALUES", "2", "1", "0", "WITHSCORES", "COUNT", "2"},
+			expected: "*4\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nc\r\n$18\r\n0.8535533845424652\r\n",
+		},
+		{
+			name:     "sim by element",
+			args:     []string{"VSIM", "points", "ELE", "b", "COUNT", "2"},
+			expected: "*2\r\n$1\r\nb\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "sim with filter",
+			args:     []string{"VSIM", "points", "VALUES", "2", "1", "0", "FILTER", ".size > 4", "WITHATTRIBS"},
+			expected: "*2\r\n$1\r\nb\r\n$25\r\n{\"color\":\"blue\",\"size\":5}\r\n",
+		},
+		{
+			name:     "sim with invalid filter",
+			args:     []string{"VSIM", "points", "VALUES", "2", "1", "0", "FILTER", ".size >"},
+			expected: "-ERR syntax error in FILTER expression\r\n",
+		},
+		{
+			name:     "emb",
+			args:     []string{"VEMB", "points", "b"},
+			expected: "*2\r\n$1\r\n0\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "set attributes",
+			args:     []string{"VSETATTR", "points", "c", `{"size":10}`},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "get attributes",
+			args:     []string{"VGETATTR", "points", "c"},
+			expected: "$11\r\n{\"size\":10}\r\n",
+		},
+		{
+			name:     "sim with filter after set attributes",
+			args:     []string{"VSIM", "points", "VALUES", "2", "1", "0", "FILTER", ".size > 4"},
+			expected: "*2\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		},
+		{
+			name:     "rem",
+			args:     []string{"VREM", "points", "a"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "rem missing",
+			args:     []string{"VREM", "points", "a"},
+			expected: ":0\r\n",
+		},
+		{
+			name:     "sim after rem",
+			args:     []string{"VSIM", "points", "VALUES", "2", "1", "0"},
+			expected: "*2\r\n$1\r\nc\r\n$1\r\nb\r\n",
+		},
+		{
+			name:     "quantized set",
+			args:     []string{"VADD", "q", "VALUES", "3", "0.5", "-1", "2", "x"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "dim",
+			args:     []string{"VDIM", "q"},
+			expected: ":3\r\n",
+		},
+		{
+			name:     "rem last element deletes the key",
+			args:     []string{"VREM", "q", "x"},
+			expected: ":1\r\n",
+		},
+		{
+			name:     "card missing key",
+			args:     []string{"VCARD", "q"},
+			expected: ":0\r\n",
+		},
+	}
+
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, respParser.Serialize(BulkStringArrayResp(tt.args)))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != tt.expected {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, tt.expected, string(output))
+		}
+	}
+}
@@ -0,0 +1,1299 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type ZSetMember struct {
+	Member string
+	Score  float64
+}
+
+// SortedSet pairs a skiplist ordered by score with a dict from member to
+// score, so that lookups are O(1) while rank and range queries are O(log n)
+type SortedSet struct {
+	zsl  *zskiplist
+	dict map[string]float64
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		zsl:  newZskiplist(),
+		dict: make(map[string]float64),
+	}
+}
+
+func (z *SortedSet) Len() int {
+	return len(z.dict)
+}
+
+func (z *SortedSet) Score(member string) (float64, bool) {
+	score, ok := z.dict[member]
+	return score, ok
+}
+
+// Add inserts the member or updates its score, returns true when the member is new
+func (z *SortedSet) Add(score float64, member string) bool {
+	cur, ok := z.dict[member]
+	if ok {
+		if cur != score {
+			z.zsl.delete(cur, member)
+			z.zsl.insert(score, member)
+			z.dict[member] = score
+		}
+		return false
+	}
+	z.zsl.insert(score, member)
+	z.dict[member] = score
+	return true
+}
+
+func (z *SortedSet) Remove(member string) bool {
+	score, ok := z.dict[member]
+	if !ok {
+		return false
+	}
+	z.zsl.delete(score, member)
+	delete(z.dict, member)
+	return true
+}
+
+// Rank returns the 0-based rank of the member
+func (z *SortedSet) Rank(member string, reverse bool) (int, bool) {
+	score, ok := z.dict[member]
+	if !ok {
+		return 0, false
+	}
+	rank := z.zsl.getRank(score, member)
+	if reverse {
+		return z.zsl.length - rank, true
+	}
+	return rank - 1, true
+}
+
+// RangeByRank returns the members between the 0-based ranks start and stop
+// (both inclusive), which must already be within bounds
+func (z *SortedSet) RangeByRank(start, stop int, reverse bool) []ZSetMember {
+	if start > stop || start >= z.zsl.length {
+		return []ZSetMember{}
+	}
+	stop = min(stop, z.zsl.length-1)
+	output := make([]ZSetMember, 0, stop-start+1)
+	var x *zskiplistNode
+	if reverse {
+		x = z.zsl.getElementByRank(z.zsl.length - start)
+	} else {
+		x = z.zsl.getElementByRank(start + 1)
+	}
+	for i := start; i <= stop && x != nil; i++ {
+		output = append(output, ZSetMember{Member: x.member, Score: x.score})
+		if reverse {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return output
+}
+
+// RangeByScore returns the members in the score range, skipping offset of
+// them and returning at most count (negative count means all)
+func (z *SortedSet) RangeByScore(spec zRangeSpec, reverse bool, offset, count int) []ZSetMember {
+	var x *zskiplistNode
+	if reverse {
+		x = z.zsl.lastInRange(spec)
+	} else {
+		x = z.zsl.firstInRange(spec)
+	}
+	output := make([]ZSetMember, 0)
+	for x != nil && offset > 0 {
+		offset--
+		x = z.nextNode(x, reverse)
+	}
+	for x != nil && count != 0 {
+		if reverse && !spec.valueGteMin(x.score) || !reverse && !spec.valueLteMax(x.score) {
+			break
+		}
+		output = append(output, ZSetMember{Member: x.member, Score: x.score})
+		count--
+		x = z.nextNode(x, reverse)
+	}
+	return output
+}
+
+// RangeByLex is the same as RangeByScore but for lex ranges, which are only
+// meaningful when all the members share the same score
+func (z *SortedSet) RangeByLex(spec zLexRangeSpec, reverse bool, offset, count int) []ZSetMember {
+	var x *zskiplistNode
+	if reverse {
+		x = z.zsl.lastInLexRange(spec)
+	} else {
+		x = z.zsl.firstInLexRange(spec)
+	}
+	output := make([]ZSetMember, 0)
+	for x != nil && offset > 0 {
+		offset--
+		x = z.nextNode(x, reverse)
+	}
+	for x != nil && count != 0 {
+		if reverse && !spec.valueGteMin(x.member) || !reverse && !spec.valueLteMax(x.member) {
+			break
+		}
+		output = append(output, ZSetMember{Member: x.member, Score: x.score})
+		count--
+		x = z.nextNode(x, reverse)
+	}
+	return output
+}
+
+func (z *SortedSet) CountInRange(spec zRangeSpec) int {
+	first := z.zsl.firstInRange(spec)
+	if first == nil {
+		return 0
+	}
+	last := z.zsl.lastInRange(spec)
+	return z.zsl.getRank(last.score, last.member) - z.zsl.getRank(first.score, first.member) + 1
+}
+
+func (z *SortedSet) CountInLexRange(spec zLexRangeSpec) int {
+	first := z.zsl.firstInLexRange(spec)
+	if first == nil {
+		return 0
+	}
+	last := z.zsl.lastInLexRange(spec)
+	return z.zsl.getRank(last.score, last.member) - z.zsl.getRank(first.score, first.member) + 1
+}
+
+// Members returns all the members ordered by score
+func (z *SortedSet) Members() []ZSetMember {
+	return z.RangeByRank(0, z.Len()-1, false)
+}
+
+func (z *SortedSet) nextNode(x *zskiplistNode, reverse bool) *zskiplistNode {
+	if reverse {
+		return x.backward
+	}
+	return x.level[0].forward
+}
+
+// FormatScore formats the score the way redis replies with doubles
+func FormatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	}
+	if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	// shortest representation, with the exponent only where %.17g would use it
+	exp := strconv.FormatFloat(score, 'e', -1, 64)
+	exponent, _ := strconv.Atoi(exp[strings.IndexByte(exp, 'e')+1:])
+	if exponent < -4 || exponent >= 17 {
+		return exp
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+func ParseScore(input string) (float64, error) {
+	score, err := strconv.ParseFloat(input, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, fmt.Errorf("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// parseScoreRange parses min and max of ZCOUNT and ZRANGE BYSCORE, each of
+// them can be prefixed by "(" to be exclusive, "-inf" and "+inf" are accepted
+func parseScoreRange(min, max string) (zRangeSpec, error) {
+	spec := zRangeSpec{}
+	var err error
+	if strings.HasPrefix(min, "(") {
+		spec.minex = true
+		min = min[1:]
+	}
+	if strings.HasPrefix(max, "(") {
+		spec.maxex = true
+		max = max[1:]
+	}
+	spec.min, err = strconv.ParseFloat(min, 64)
+	if err != nil || math.IsNaN(spec.min) {
+		return spec, fmt.Errorf("ERR min or max is not a float")
+	}
+	spec.max, err = strconv.ParseFloat(max, 64)
+	if err != nil || math.IsNaN(spec.max) {
+		return spec, fmt.Errorf("ERR min or max is not a float")
+	}
+	return spec, nil
+}
+
+func parseLexBound(input string) (zLexBound, error) {
+	switch {
+	case input == "-":
+		return zLexBound{inf: -1}, nil
+	case input == "+":
+		return zLexBound{inf: 1}, nil
+	case strings.HasPrefix(input, "["):
+		return zLexBound{value: input[1:]}, nil
+	case strings.HasPrefix(input, "("):
+		return zLexBound{value: input[1:], ex: true}, nil
+	}
+	return zLexBound{}, fmt.Errorf("ERR min or max not valid string range item")
+}
+
+func parseLexRange(min, max string) (zLexRangeSpec, error) {
+	minBound, err := parseLexBound(min)
+	if err != nil {
+		return zLexRangeSpec{}, err
+	}
+	maxBound, err := parseLexBound(max)
+	if err != nil {
+		return zLexRangeSpec{}, err
+	}
+	return zLexRangeSpec{min: minBound, max: maxBound}, nil
+}
+
+// getSortedSet returns nil when the key does not exist and an error response
+// when the key holds another type
+func getSortedSet(memory *Memory, key string) (*SortedSet, *RESP) {
+	entry := memory.Get(key)
+	if entry.Type == "none" {
+		return nil, nil
+	}
+	if entry.Type != "zset" {
+		return nil, SimpleErrorResp(WrongTypeErr)
+	}
+	return (entry.Value).(*SortedSet), nil
+}
+
+func putSortedSet(memory *Memory, key string, zset *SortedSet) {
+	if zset.Len() == 0 {
+		memory.Delete(key)
+		return
+	}
+	memory.Put(key, Entry{Type: "zset", Value: zset}, Option{})
+}
+
+func zsetMembersResp(members []ZSetMember, withScores bool) *RESP {
+	output := ArrayResp()
+	for _, m := range members {
+		output.Nested = append(output.Nested, BulkStringResp(m.Member))
+		if withScores {
+			output.Nested = append(output.Nested, BulkStringResp(FormatScore(m.Score)))
+		}
+	}
+	return output
+}
+
+type zaddFlags struct {
+	nx, xx, gt, lt, ch, incr bool
+}
+
+func zadd(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for ZADD")
+		}
+		key := string(resp.Nested[1].Data)
+
+		// build ZADD options
+		flags := zaddFlags{}
+		i := 2
+	options:
+		for i < len(resp.Nested) {
+			switch strings.ToUpper(string(resp.Nested[i].Data)) {
+			case "NX":
+				flags.nx = true
+			case "XX":
+				flags.xx = true
+			case "GT":
+				flags.gt = true
+			case "LT":
+				flags.lt = true
+			case "CH":
+				flags.ch = true
+			case "INCR":
+				flags.incr = true
+			default:
+				break options
+			}
+			i++
+		}
+
+		pairs := resp.Nested[i:]
+		if len(pairs) == 0 || len(pairs)%2 != 0 {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		if flags.nx && flags.xx {
+			return SimpleErrorResp("ERR XX and NX options at the same time are not compatible"), nil
+		}
+		if (flags.gt && flags.nx) || (flags.lt && flags.nx) || (flags.gt && flags.lt) {
+			return SimpleErrorResp("ERR GT, LT, and/or NX options at the same time are not compatible"), nil
+		}
+		if flags.incr && len(pairs) > 2 {
+			return SimpleErrorResp("ERR INCR option supports a single increment-element pair"), nil
+		}
+
+		// validate all the scores before touching the set
+		scores := make([]float64, 0, len(pairs)/2)
+		for j := 0; j < len(pairs); j += 2 {
+			score, err := ParseScore(string(pairs[j].Data))
+			if err != nil {
+				return SimpleErrorResp(err.Error()), nil
+			}
+			scores = append(scores, score)
+		}
+
+		zset, errResp := getSortedSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			if flags.xx {
+				if flags.incr {
+					return BulkStringResp(""), nil
+				}
+				return IntegerResp(0), nil
+			}
+			zset = NewSortedSet()
+		}
+
+		added, updated := 0, 0
+		var incrScore *float64
+		for j, score := range scores {
+			member := string(pairs[j*2+1].Data)
+			newScore, result, err := zsetAdd(zset, member, score, flags)
+			if err != nil {
+				putSortedSet(memory, key, zset)
+				return SimpleErrorResp(err.Error()), nil
+			}
+			switch result {
+			case zaddAdded:
+				added++
+			case zaddUpdated:
+				updated++
+			}
+			if result != zaddNop {
+				incrScore = &newScore
+			} else if flags.incr {
+				// incr with a condition that wasn't met replies nil
+				incrScore = nil
+			}
+		}
+		putSortedSet(memory, key, zset)
+
+		if flags.incr {
+			if incrScore == nil {
+				return BulkStringResp(""), nil
+			}
+			return BulkStringResp(FormatScore(*incrScore)), nil
+		}
+		if flags.ch {
+			return IntegerResp(added + updated), nil
+		}
+		return IntegerResp(added), nil
+	}
+}
+
+type zaddResult int
+
+const (
+	zaddNop zaddResult = iota
+	zaddAdded
+	zaddUpdated
+	// the score stayed the same, which CH doesn't count
+	zaddUnchanged
+)
+
+func zsetAdd(zset *SortedSet, member string, score float64, flags zaddFlags) (float64, zaddResult, error) {
+	cur, ok := zset.Score(member)
+	if !ok {
+		if flags.xx {
+			return 0, zaddNop, nil
+		}
+		zset.Add(score, member)
+		return score, zaddAdded, nil
+	}
+
+	if flags.nx {
+		return 0, zaddNop, nil
+	}
+	if flags.incr {
+		score += cur
+		if math.IsNaN(score) {
+			return 0, zaddNop, fmt.Errorf("ERR resulting score is not a number (NaN)")
+		}
+	}
+	if (flags.lt && score >= cur) || (flags.gt && score <= cur) {
+		return 0, zaddNop, nil
+	}
+	if score == cur {
+		return score, zaddUnchanged, nil
+	}
+	zset.Add(score, member)
+	return score, zaddUpdated, nil
+}
+
+func zincrby(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for ZINCRBY")
+		}
+		key, member := string(resp.Nested[1].Data), string(resp.Nested[3].Data)
+		incr, err := ParseScore(string(resp.Nested[2].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+
+		zset, errResp := getSortedSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			zset = NewSortedSet()
+		}
+		score, _, err := zsetAdd(zset, member, incr, zaddFlags{incr: true})
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		putSortedSet(memory, key, zset)
+
+		return BulkStringResp(FormatScore(score)), nil
+	}
+}
+
+func zrem(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for ZREM")
+		}
+		key := string(resp.Nested[1].Data)
+		zset, errResp := getSortedSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			return IntegerResp(0), nil
+		}
+
+		removed := 0
+		for _, arg := range resp.Nested[2:] {
+			if zset.Remove(string(arg.Data)) {
+				removed++
+			}
+		}
+		putSortedSet(memory, key, zset)
+
+		return IntegerResp(removed), nil
+	}
+}
+
+func zscore(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for ZSCORE")
+		}
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			return BulkStringResp(""), nil
+		}
+		score, ok := zset.Score(string(resp.Nested[2].Data))
+		if !ok {
+			return BulkStringResp(""), nil
+		}
+		return BulkStringResp(FormatScore(score)), nil
+	}
+}
+
+func zmscore(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for ZMSCORE")
+		}
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		output := ArrayResp()
+		for _, arg := range resp.Nested[2:] {
+			if zset == nil {
+				output.Nested = append(output.Nested, BulkStringResp(""))
+				continue
+			}
+			score, ok := zset.Score(string(arg.Data))
+			if !ok {
+				output.Nested = append(output.Nested, BulkStringResp(""))
+				continue
+			}
+			output.Nested = append(output.Nested, BulkStringResp(FormatScore(score)))
+		}
+		return output, nil
+	}
+}
+
+func zcard(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for ZCARD")
+		}
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(zset.Len()), nil
+	}
+}
+
+func zcount(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for ZCOUNT")
+		}
+		spec, err := parseScoreRange(string(resp.Nested[2].Data), string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(zset.CountInRange(spec)), nil
+	}
+}
+
+func zlexcount(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for ZLEXCOUNT")
+		}
+		spec, err := parseLexRange(string(resp.Nested[2].Data), string(resp.Nested[3].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			return IntegerResp(0), nil
+		}
+		return IntegerResp(zset.CountInLexRange(spec)), nil
+	}
+}
+
+func zrankGeneric(memory *Memory, name string, reverse bool) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		withScore := false
+		if len(resp.Nested) > 3 {
+			if len(resp.Nested) > 4 || strings.ToUpper(string(resp.Nested[3].Data)) != "WITHSCORE" {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			withScore = true
+		}
+
+		zset, errResp := getSortedSet(memory, string(resp.Nested[1].Data))
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil {
+			return BulkStringResp(""), nil
+		}
+		member := string(resp.Nested[2].Data)
+		rank, ok := zset.Rank(member, reverse)
+		if !ok {
+			return BulkStringResp(""), nil
+		}
+		if withScore {
+			score, _ := zset.Score(member)
+			return ArrayResp(IntegerResp(rank), BulkStringResp(FormatScore(score))), nil
+		}
+		return IntegerResp(rank), nil
+	}
+}
+
+func zrank(memory *Memory) Executor {
+	return zrankGeneric(memory, "ZRANK", false)
+}
+
+func zrevrank(memory *Memory) Executor {
+	return zrankGeneric(memory, "ZREVRANK", true)
+}
+
+type zrangeType int
+
+const (
+	zrangeByRank zrangeType = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+type zrangeRequest struct {
+	key        string
+	min, max   string
+	rangeType  zrangeType
+	reverse    bool
+	withScores bool
+	hasLimit   bool
+	offset     int
+	count      int
+}
+
+// parseZrangeRequest parses "key min max [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]"
+func parseZrangeRequest(args []*RESP) (*zrangeRequest, *RESP) {
+	req := &zrangeRequest{
+		key:   string(args[0].Data),
+		min:   string(args[1].Data),
+		max:   string(args[2].Data),
+		count: -1,
+	}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i].Data)) {
+		case "BYSCORE":
+			req.rangeType = zrangeByScore
+		case "BYLEX":
+			req.rangeType = zrangeByLex
+		case "REV":
+			req.reverse = true
+		case "WITHSCORES":
+			req.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, SimpleErrorResp("ERR syntax error")
+			}
+			offset, err := strconv.Atoi(string(args[i+1].Data))
+			if err != nil {
+				return nil, SimpleErrorResp("ERR value is not an integer or out of range")
+			}
+			count, err := strconv.Atoi(string(args[i+2].Data))
+			if err != nil {
+				return nil, SimpleErrorResp("ERR value is not an integer or out of range")
+			}
+			req.hasLimit, req.offset, req.count = true, offset, count
+			i += 2
+		default:
+			return nil, SimpleErrorResp("ERR syntax error")
+		}
+	}
+	if req.hasLimit && req.rangeType == zrangeByRank {
+		return nil, SimpleErrorResp("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if req.withScores && req.rangeType == zrangeByLex {
+		return nil, SimpleErrorResp("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return req, nil
+}
+
+// zrangeGeneric runs the request against the sorted set, missing keys are empty
+func zrangeGeneric(memory *Memory, req *zrangeRequest) ([]ZSetMember, *RESP) {
+	// with REV the range is given from max to min for scores and lex
+	min, max := req.min, req.max
+	if req.reverse && req.rangeType != zrangeByRank {
+		min, max = max, min
+	}
+
+	var scoreSpec zRangeSpec
+	var lexSpec zLexRangeSpec
+	var start, stop int
+	var err error
+	switch req.rangeType {
+	case zrangeByScore:
+		scoreSpec, err = parseScoreRange(min, max)
+	case zrangeByLex:
+		lexSpec, err = parseLexRange(min, max)
+	default:
+		start, err = strconv.Atoi(min)
+		if err == nil {
+			stop, err = strconv.Atoi(max)
+		}
+		if err != nil {
+			err = fmt.Errorf("ERR value is not an integer or out of range")
+		}
+	}
+	if err != nil {
+		return nil, SimpleErrorResp(err.Error())
+	}
+
+	zset, errResp := getSortedSet(memory, req.key)
+	if errResp != nil {
+		return nil, errResp
+	}
+	if zset == nil || req.offset < 0 {
+		return []ZSetMember{}, nil
+	}
+
+	switch req.rangeType {
+	case zrangeByScore:
+		return zset.RangeByScore(scoreSpec, req.reverse, req.offset, req.count), nil
+	case zrangeByLex:
+		return zset.RangeByLex(lexSpec, req.reverse, req.offset, req.count), nil
+	}
+
+	length := zset.Len()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	return zset.RangeByRank(start, stop, req.reverse), nil
+}
+
+func zrange(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for ZRANGE")
+		}
+		req, errResp := parseZrangeRequest(resp.Nested[1:])
+		if errResp != nil {
+			return errResp, nil
+		}
+		members, errResp := zrangeGeneric(memory, req)
+		if errResp != nil {
+			return errResp, nil
+		}
+		return zsetMembersResp(members, req.withScores), nil
+	}
+}
+
+func zrangestore(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for ZRANGESTORE")
+		}
+		dstKey := string(resp.Nested[1].Data)
+		req, errResp := parseZrangeRequest(resp.Nested[2:])
+		if errResp != nil {
+			return errResp, nil
+		}
+		if req.withScores {
+			return SimpleErrorResp("ERR syntax error"), nil
+		}
+		members, errResp := zrangeGeneric(memory, req)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		result := NewSortedSet()
+		for _, m := range members {
+			result.Add(m.Score, m.Member)
+		}
+		memory.Delete(dstKey)
+		putSortedSet(memory, dstKey, result)
+
+		return IntegerResp(result.Len()), nil
+	}
+}
+
+type zsetAggregate int
+
+const (
+	zsetAggregateSum zsetAggregate = iota
+	zsetAggregateMin
+	zsetAggregateMax
+)
+
+type zsetOperation int
+
+const (
+	zsetUnion zsetOperation = iota
+	zsetInter
+	zsetDiff
+)
+
+type zsetOperationRequest struct {
+	keys       []string
+	weights    []float64
+	aggregate  zsetAggregate
+	withScores bool
+}
+
+// getZsetOrSetMembers reads the input of the multi key operations, which can
+// be plain sets whose members all score 1
+func getZsetOrSetMembers(memory *Memory, key string) ([]ZSetMember, *RESP) {
+	entry := memory.Get(key)
+	switch entry.Type {
+	case "none":
+		return []ZSetMember{}, nil
+	case "zset":
+		return (entry.Value).(*SortedSet).Members(), nil
+	case "set":
+		members := (entry.Value).(*Set).Members()
+		output := make([]ZSetMember, 0, len(members))
+		for _, member := range members {
+			output = append(output, ZSetMember{Member: member, Score: 1})
+		}
+		return output, nil
+	}
+	return nil, SimpleErrorResp(WrongTypeErr)
+}
+
+// parseZsetOperationRequest parses "numkeys key [key ...] [WEIGHTS weight
+// [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]"
+func parseZsetOperationRequest(name string, op zsetOperation, args []*RESP, allowWithScores bool) (*zsetOperationRequest, *RESP) {
+	numKeys, err := strconv.Atoi(string(args[0].Data))
+	if err != nil {
+		return nil, SimpleErrorResp("ERR value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return nil, SimpleErrorResp(fmt.Sprintf("ERR at least 1 input key is needed for '%v' command", ToLowerCase(name)))
+	}
+	if numKeys > len(args)-1 {
+		return nil, SimpleErrorResp("ERR syntax error")
+	}
+
+	req := &zsetOperationRequest{
+		keys:    make([]string, 0, numKeys),
+		weights: make([]float64, numKeys),
+	}
+	for i, arg := range args[1 : 1+numKeys] {
+		req.keys = append(req.keys, string(arg.Data))
+		req.weights[i] = 1
+	}
+
+	for i := 1 + numKeys; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i].Data))
+		switch {
+		case opt == "WEIGHTS" && op != zsetDiff:
+			if i+numKeys >= len(args) {
+				return nil, SimpleErrorResp("ERR syntax error")
+			}
+			for j := 0; j < numKeys; j++ {
+				weight, err := strconv.ParseFloat(string(args[i+1+j].Data), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, SimpleErrorResp("ERR weight value is not a float")
+				}
+				req.weights[j] = weight
+			}
+			i += numKeys
+		case opt == "AGGREGATE" && op != zsetDiff:
+			if i+1 >= len(args) {
+				return nil, SimpleErrorResp("ERR syntax error")
+			}
+			switch strings.ToUpper(string(args[i+1].Data)) {
+			case "SUM":
+				req.aggregate = zsetAggregateSum
+			case "MIN":
+				req.aggregate = zsetAggregateMin
+			case "MAX":
+				req.aggregate = zsetAggregateMax
+			default:
+				return nil, SimpleErrorResp("ERR syntax error")
+			}
+			i++
+		case opt == "WITHSCORES" && allowWithScores:
+			req.withScores = true
+		default:
+			return nil, SimpleErrorResp("ERR syntax error")
+		}
+	}
+	return req, nil
+}
+
+func zsetAggregateScores(aggregate zsetAggregate, a, b float64) float64 {
+	switch aggregate {
+	case zsetAggregateMin:
+		return math.Min(a, b)
+	case zsetAggregateMax:
+		return math.Max(a, b)
+	}
+	// +inf and -inf sum up to NaN, redis settles it to zero
+	sum := a + b
+	if math.IsNaN(sum) {
+		return 0
+	}
+	return sum
+}
+
+func computeZsetOperation(memory *Memory, op zsetOperation, req *zsetOperationRequest) (*SortedSet, *RESP) {
+	inputs := make([]map[string]float64, 0, len(req.keys))
+	for i, key := range req.keys {
+		members, errResp := getZsetOrSetMembers(memory, key)
+		if errResp != nil {
+			return nil, errResp
+		}
+		input := make(map[string]float64, len(members))
+		for _, m := range members {
+			score := m.Score * req.weights[i]
+			// inf * 0 is NaN
+			if math.IsNaN(score) {
+				score = 0
+			}
+			input[m.Member] = score
+		}
+		inputs = append(inputs, input)
+	}
+
+	scores := make(map[string]float64)
+	switch op {
+	case zsetUnion:
+		for _, input := range inputs {
+			for member, score := range input {
+				if cur, ok := scores[member]; ok {
+					scores[member] = zsetAggregateScores(req.aggregate, cur, score)
+				} else {
+					scores[member] = score
+				}
+			}
+		}
+	case zsetInter:
+		for member, score := range inputs[0] {
+			inAll := true
+			for _, other := range inputs[1:] {
+				otherScore, ok := other[member]
+				if !ok {
+					inAll = false
+					break
+				}
+				score = zsetAggregateScores(req.aggregate, score, otherScore)
+			}
+			if inAll {
+				scores[member] = score
+			}
+		}
+	case zsetDiff:
+		for member, score := range inputs[0] {
+			inOther := false
+			for _, other := range inputs[1:] {
+				if _, ok := other[member]; ok {
+					inOther = true
+					break
+				}
+			}
+			if !inOther {
+				scores[member] = score
+			}
+		}
+	}
+
+	result := NewSortedSet()
+	for member, score := range scores {
+		result.Add(score, member)
+	}
+	return result, nil
+}
+
+func zsetOperationCmd(memory *Memory, name string, op zsetOperation) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		req, errResp := parseZsetOperationRequest(name, op, resp.Nested[1:], true)
+		if errResp != nil {
+			return errResp, nil
+		}
+		result, errResp := computeZsetOperation(memory, op, req)
+		if errResp != nil {
+			return errResp, nil
+		}
+		return zsetMembersResp(result.Members(), req.withScores), nil
+	}
+}
+
+func zsetOperationStoreCmd(memory *Memory, name string, op zsetOperation) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		dstKey := string(resp.Nested[1].Data)
+		req, errResp := parseZsetOperationRequest(name, op, resp.Nested[2:], false)
+		if errResp != nil {
+			return errResp, nil
+		}
+		result, errResp := computeZsetOperation(memory, op, req)
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		memory.Delete(dstKey)
+		putSortedSet(memory, dstKey, result)
+
+		return IntegerResp(result.Len()), nil
+	}
+}
+
+func zunion(memory *Memory) Executor {
+	return zsetOperationCmd(memory, "ZUNION", zsetUnion)
+}
+
+func zinter(memory *Memory) Executor {
+	return zsetOperationCmd(memory, "ZINTER", zsetInter)
+}
+
+func zdiff(memory *Memory) Executor {
+	return zsetOperationCmd(memory, "ZDIFF", zsetDiff)
+}
+
+func zunionstore(memory *Memory) Executor {
+	return zsetOperationStoreCmd(memory, "ZUNIONSTORE", zsetUnion)
+}
+
+func zinterstore(memory *Memory) Executor {
+	return zsetOperationStoreCmd(memory, "ZINTERSTORE", zsetInter)
+}
+
+func zdiffstore(memory *Memory) Executor {
+	return zsetOperationStoreCmd(memory, "ZDIFFSTORE", zsetDiff)
+}
+
+func zintercard(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for ZINTERCARD")
+		}
+		numKeys, err := strconv.Atoi(string(resp.Nested[1].Data))
+		if err != nil || numKeys <= 0 {
+			return SimpleErrorResp("ERR numkeys should be greater than 0"), nil
+		}
+		if numKeys > len(resp.Nested)-2 {
+			return SimpleErrorResp("ERR Number of keys can't be greater than number of args"), nil
+		}
+
+		req := &zsetOperationRequest{
+			keys:    make([]string, 0, numKeys),
+			weights: make([]float64, 0, numKeys),
+		}
+		for _, arg := range resp.Nested[2 : 2+numKeys] {
+			req.keys = append(req.keys, string(arg.Data))
+			req.weights = append(req.weights, 1)
+		}
+
+		// LIMIT 0 means unlimited
+		limit := 0
+		for i := 2 + numKeys; i < len(resp.Nested); i++ {
+			opt := strings.ToUpper(string(resp.Nested[i].Data))
+			if opt != "LIMIT" || i == len(resp.Nested)-1 {
+				return SimpleErrorResp("ERR syntax error"), nil
+			}
+			limit, err = strconv.Atoi(string(resp.Nested[i+1].Data))
+			if err != nil {
+				return SimpleErrorResp("ERR value is not an integer or out of range"), nil
+			}
+			if limit < 0 {
+				return SimpleErrorResp("ERR LIMIT can't be negative"), nil
+			}
+			i++
+		}
+
+		result, errResp := computeZsetOperation(memory, zsetInter, req)
+		if errResp != nil {
+			return errResp, nil
+		}
+		card := result.Len()
+		if limit > 0 && card > limit {
+			card = limit
+		}
+		return IntegerResp(card), nil
+	}
+}
+
+// zsetPop removes up to count members with the lowest (or highest) scores
+func zsetPop(memory *Memory, key string, zset *SortedSet, count int, max bool) []ZSetMember {
+	count = min(count, zset.Len())
+	var popped []ZSetMember
+	if max {
+		popped = zset.RangeByRank(0, count-1, true)
+	} else {
+		popped = zset.RangeByRank(0, count-1, false)
+	}
+	for _, m := range popped {
+		zset.Remove(m.Member)
+	}
+	putSortedSet(memory, key, zset)
+	return popped
+}
+
+func zpopGeneric(memory *Memory, name string, max bool) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 2 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		key := string(resp.Nested[1].Data)
+		count := 1
+		if len(resp.Nested) > 2 {
+			var err error
+			count, err = strconv.Atoi(string(resp.Nested[2].Data))
+			if err != nil || count < 0 {
+				return SimpleErrorResp("ERR value is out of range, must be positive"), nil
+			}
+		}
+
+		zset, errResp := getSortedSet(memory, key)
+		if errResp != nil {
+			return errResp, nil
+		}
+		if zset == nil || count == 0 {
+			return ArrayResp(), nil
+		}
+		return zsetMembersResp(zsetPop(memory, key, zset, count, max), true), nil
+	}
+}
+
+func zpopmin(memory *Memory) Executor {
+	return zpopGeneric(memory, "ZPOPMIN", false)
+}
+
+func zpopmax(memory *Memory) Executor {
+	return zpopGeneric(memory, "ZPOPMAX", true)
+}
+
+// parseZmpopRequest parses "numkeys key [key ...] MIN|MAX [COUNT count]"
+func parseZmpopRequest(args []*RESP) (keys []string, max bool, count int, errResp *RESP) {
+	numKeys, err := strconv.Atoi(string(args[0].Data))
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, SimpleErrorResp("ERR numkeys should be greater than 0")
+	}
+	// numKeys is not added to so that it can't overflow
+	if numKeys >= len(args)-1 {
+		return nil, false, 0, SimpleErrorResp("ERR syntax error")
+	}
+	keys = make([]string, 0, numKeys)
+	for _, arg := range args[1 : 1+numKeys] {
+		keys = append(keys, string(arg.Data))
+	}
+
+	switch strings.ToUpper(string(args[1+numKeys].Data)) {
+	case "MIN":
+		max = false
+	case "MAX":
+		max = true
+	default:
+		return nil, false, 0, SimpleErrorResp("ERR syntax error")
+	}
+
+	count = 1
+	rest := args[2+numKeys:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(string(rest[0].Data)) != "COUNT" {
+			return nil, false, 0, SimpleErrorResp("ERR syntax error")
+		}
+		count, err = strconv.Atoi(string(rest[1].Data))
+		if err != nil || count <= 0 {
+			return nil, false, 0, SimpleErrorResp("ERR count should be greater than 0")
+		}
+	}
+	return keys, max, count, nil
+}
+
+// zmpopFromKeys pops from the first non empty sorted set, the reply is
+// [key, [[member, score], ...]]. ok is false when all the keys are empty.
+func zmpopFromKeys(memory *Memory, keys []string, max bool, count int) (*RESP, bool) {
+	for _, key := range keys {
+		zset, errResp := getSortedSet(memory, key)
+		if errResp != nil {
+			return errResp, true
+		}
+		if zset == nil {
+			continue
+		}
+		popped := ArrayResp()
+		for _, m := range zsetPop(memory, key, zset, count, max) {
+			popped.Nested = append(popped.Nested, ArrayResp(BulkStringResp(m.Member), BulkStringResp(FormatScore(m.Score))))
+		}
+		return ArrayResp(BulkStringResp(key), popped), true
+	}
+	return nil, false
+}
+
+func zmpop(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 4 {
+			return nil, fmt.Errorf("insufficient arguments for ZMPOP")
+		}
+		keys, max, count, errResp := parseZmpopRequest(resp.Nested[1:])
+		if errResp != nil {
+			return errResp, nil
+		}
+		output, ok := zmpopFromKeys(memory, keys, max, count)
+		if !ok {
+			return NullArrayResp(), nil
+		}
+		return output, nil
+	}
+}
+
+func bzpopGeneric(memory *Memory, name string, max bool) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 3 {
+			return nil, fmt.Errorf("insufficient arguments for %v", name)
+		}
+		timeout, err := ParseTimeout(string(resp.Nested[len(resp.Nested)-1].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		keys := make([]string, 0, len(resp.Nested)-2)
+		for _, arg := range resp.Nested[1 : len(resp.Nested)-1] {
+			keys = append(keys, string(arg.Data))
+		}
+
+		output := blockForKeys(client, memory, keys, timeout, func() (*RESP, bool) {
+			for _, key := range keys {
+				zset, errResp := getSortedSet(memory, key)
+				if errResp != nil {
+					return errResp, true
+				}
+				if zset == nil {
+					continue
+				}
+				m := zsetPop(memory, key, zset, 1, max)[0]
+				return ArrayResp(BulkStringResp(key), BulkStringResp(m.Member), BulkStringResp(FormatScore(m.Score))), true
+			}
+			return nil, false
+		})
+		if output == nil {
+			return NullArrayResp(), nil
+		}
+		return output, nil
+	}
+}
+
+func bzpopmin(memory *Memory) Executor {
+	return bzpopGeneric(memory, "BZPOPMIN", false)
+}
+
+func bzpopmax(memory *Memory) Executor {
+	return bzpopGeneric(memory, "BZPOPMAX", true)
+}
+
+func bzmpop(memory *Memory) Executor {
+	return func(client *Client, resp *RESP) (*RESP, error) {
+		if len(resp.Nested) < 5 {
+			return nil, fmt.Errorf("insufficient arguments for BZMPOP")
+		}
+		timeout, err := ParseTimeout(string(resp.Nested[1].Data))
+		if err != nil {
+			return SimpleErrorResp(err.Error()), nil
+		}
+		keys, max, count, errResp := parseZmpopRequest(resp.Nested[2:])
+		if errResp != nil {
+			return errResp, nil
+		}
+
+		output := blockForKeys(client, memory, keys, timeout, func() (*RESP, bool) {
+			return zmpopFromKeys(memory, keys, max, count)
+		})
+		if output == nil {
+			return NullArrayResp(), nil
+		}
+		return output, nil
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSortedSet_RankAndRange(t *testing.T) {
+	zset := NewSortedSet()
+	expected := make([]ZSetMember, 0)
+	for i := 0; i < 1000; i++ {
+		member := "m" + strconv.Itoa(i)
+		score := float64(rand.Intn(100))
+		zset.Add(score, member)
+		expected = append(expected, ZSetMember{Member: member, Score: score})
+	}
+	// remove every third member
+	kept := make([]ZSetMember, 0)
+	for i, m := range expected {
+		if i%3 == 0 {
+			zset.Remove(m.Member)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Score == kept[j].Score {
+			return kept[i].Member < kept[j].Member
+		}
+		return kept[i].Score < kept[j].Score
+	})
+
+	if zset.Len() != len(kept) {
+		t.Fatalf("expected length %v, but got: %v", len(kept), zset.Len())
+	}
+	for i, m := range kept {
+		rank, ok := zset.Rank(m.Member, false)
+		if !ok || rank != i {
+			t.Fatalf("member %v - expected rank %v, but got: %v", m.Member, i, rank)
+		}
+	}
+	members := zset.RangeByRank(10, 19, false)
+	for i, m := range members {
+		if m != kept[10+i] {
+			t.Errorf("rank %v - expected %v, but got: %v", 10+i, kept[10+i], m)
+		}
+	}
+
+	count := 0
+	for _, m := range kept {
+		if m.Score > 10 && m.Score <= 20 {
+			count++
+		}
+	}
+	spec := zRangeSpec{min: 10, max: 20, minex: true}
+	if zset.CountInRange(spec) != count || len(zset.RangeByScore(spec, false, 0, -1)) != count {
+		t.Errorf("expected %v members in (10, 20]", count)
+	}
+}
+
+func TestProcessor_SortedSet(t *testing.T) {
+	testcases := []struct {
+		name     string
+		args     string
+		expected string
+	}{
+		{
+			name:     "zadd",
+			args:     "*8\r\n$4\r\nZADD\r\n$1\r\nz\r\n$1\r\n1\r\n$1\r\na\r\n$1\r\n2\r\n$1\r\nb\r\n$1\r\n3\r\n$1\r\nc\r\n",
+			expected: ":3\r\n",
+		},
+		{
+			name:     "zadd gt ch",
+			args:     "*8\r\n$4\r\nZADD\r\n$1\r\nz\r\n$2\r\nGT\r\n$2\r\nCH\r\n$1\r\n5\r\n$1\r\na\r\n$1\r\n0\r\n$1\r\nb\r\n",
+			expected: ":1\r\n",
+		},
+		{
+			name:     "zadd nx incr not applied",
+			args:     "*6\r\n$4\r\nZADD\r\n$1\r\nz\r\n$2\r\nNX\r\n$4\r\nINCR\r\n$1\r\n1\r\n$1\r\na\r\n",
+			expected: "$-1\r\n",
+		},
+		{
+			name:     "zincrby",
+			args:     "*4\r\n$7\r\nZINCRBY\r\n$1\r\nz\r\n$3\r\n0.5\r\n$1\r\nc\r\n",
+			expected: "$3\r\n3.5\r\n",
+		},
+		{
+			name:     "zrange withscores",
+			args:     "*5\r\n$6\r\nZRANGE\r\n$1\r\nz\r\n$1\r\n0\r\n$2\r\n-1\r\n$10\r\nWITHSCORES\r\n",
+			expected: "*6\r\n$1\r\nb\r\n$1\r\n2\r\n$1\r\nc\r\n$3\r\n3.5\r\n$1\r\na\r\n$1\r\n5\r\n",
+		},
+		{
+			name:     "zrange byscore rev limit",
+			args:     "*9\r\n$6\r\nZRANGE\r\n$1\r\nz\r\n$4\r\n+inf\r\n$2\r\n(2\r\n$7\r\nBYSCORE\r\n$3\r\nREV\r\n$5\r\nLIMIT\r\n$1\r\n1\r\n$1\r\n1\r\n",
+			expected: "*1\r\n$1\r\nc\r\n",
+		},
+		{
+			name:     "zrevrank withscore",
+			args:     "*4\r\n$8\r\nZREVRANK\r\n$1\r\nz\r\n$1\r\nb\r\n$9\r\nWITHSCORE\r\n",
+			expected: "*2\r\n:2\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "zcount exclusive",
+			args:     "*4\r\n$6\r\nZCOUNT\r\n$1\r\nz\r\n$2\r\n(2\r\n$4\r\n+inf\r\n",
+			expected: ":2\r\n",
+		},
+		{
+			name:     "lex members",
+			args:     "*8\r\n$4\r\nZADD\r\n$1\r\nl\r\n$1\r\n0\r\n$1\r\na\r\n$1\r\n0\r\n$1\r\nb\r\n$1\r\n0\r\n$1\r\nc\r\n",
+			expected: ":3\r\n",
+		},
+		{
+			name:     "zlexcount",
+			args:     "*4\r\n$9\r\nZLEXCOUNT\r\n$1\r\nl\r\n$2\r\n(a\r\n$1\r\n+\r\n",
+			expected: ":2\r\n",
+		},
+		{
+			name:     "zrangestore bylex",
+			args:     "*6\r\n$11\r\nZRANGESTORE\r\n$1\r\nd\r\n$1\r\nl\r\n$1\r\n-\r\n$2\r\n[b\r\n$5\r\nBYLEX\r\n",
+			expected: ":2\r\n",
+		},
+		{
+			name:     "zmscore",
+			args:     "*4\r\n$7\r\nZMSCORE\r\n$1\r\nd\r\n$1\r\nb\r\n$1\r\nc\r\n",
+			expected: "*2\r\n$1\r\n0\r\n$-1\r\n",
+		},
+	}
+
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, []byte(tt.args))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != string(tt.expected) {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, string(tt.expected), string(output))
+		}
+	}
+}
+
+func TestProcessor_SortedSetAggregate(t *testing.T) {
+	testcases := []struct {
+		name     string
+		args     string
+		expected string
+	}{
+		{
+			name:     "zadd a",
+			args:     "*6\r\n$4\r\nZADD\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nx\r\n$1\r\n2\r\n$1\r\ny\r\n",
+			expected: ":2\r\n",
+		},
+		{
+			name:     "sadd b",
+			args:     "*4\r\n$4\r\nSADD\r\n$1\r\nb\r\n$1\r\ny\r\n$1\r\nz\r\n",
+			expected: ":2\r\n",
+		},
+		{
+			name:     "zunion weights",
+			args:     "*8\r\n$6\r\nZUNION\r\n$1\r\n2\r\n$1\r\na\r\n$1\r\nb\r\n$7\r\nWEIGHTS\r\n$1\r\n2\r\n$1\r\n3\r\n$10\r\nWITHSCORES\r\n",
+			expected: "*6\r\n$1\r\nx\r\n$1\r\n2\r\n$1\r\nz\r\n$1\r\n3\r\n$1\r\ny\r\n$1\r\n7\r\n",
+		},
+		{
+			name:     "zinterstore aggregate max",
+			args:     "*7\r\n$11\r\nZINTERSTORE\r\n$1\r\nd\r\n$1\r\n2\r\n$1\r\na\r\n$1\r\nb\r\n$9\r\nAGGREGATE\r\n$3\r\nMAX\r\n",
+			expected: ":1\r\n",
+		},
+		{
+			name:     "zscore aggregated",
+			args:     "*3\r\n$6\r\nZSCORE\r\n$1\r\nd\r\n$1\r\ny\r\n",
+			expected: "$1\r\n2\r\n",
+		},
+		{
+			name:     "zdiff",
+			args:     "*4\r\n$5\r\nZDIFF\r\n$1\r\n2\r\n$1\r\na\r\n$1\r\nb\r\n",
+			expected: "*1\r\n$1\r\nx\r\n",
+		},
+		{
+			name:     "zpopmax",
+			args:     "*2\r\n$7\r\nZPOPMAX\r\n$1\r\na\r\n",
+			expected: "*2\r\n$1\r\ny\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "zmpop huge count",
+			args:     "*6\r\n$5\r\nZMPOP\r\n$1\r\n1\r\n$1\r\nd\r\n$3\r\nMIN\r\n$5\r\nCOUNT\r\n$15\r\n100000000000000\r\n",
+			expected: "*2\r\n$1\r\nd\r\n*1\r\n*2\r\n$1\r\ny\r\n$1\r\n2\r\n",
+		},
+		{
+			name:     "zadd e",
+			args:     "*4\r\n$4\r\nZADD\r\n$1\r\ne\r\n$1\r\n1\r\n$1\r\nm\r\n",
+			expected: ":1\r\n",
+		},
+		{
+			name:     "zpopmin huge count",
+			args:     "*3\r\n$7\r\nZPOPMIN\r\n$1\r\ne\r\n$15\r\n100000000000000\r\n",
+			expected: "*2\r\n$1\r\nm\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "zmpop huge numkeys",
+			args:     "*4\r\n$5\r\nZMPOP\r\n$19\r\n9223372036854775807\r\n$1\r\na\r\n$3\r\nMIN\r\n",
+			expected: "-ERR syntax error\r\n",
+		},
+		{
+			name:     "bzmpop huge numkeys",
+			args:     "*5\r\n$6\r\nBZMPOP\r\n$1\r\n0\r\n$19\r\n9223372036854775807\r\n$1\r\na\r\n$3\r\nMIN\r\n",
+			expected: "-ERR syntax error\r\n",
+		},
+		{
+			name:     "zmpop",
+			args:     "*5\r\n$5\r\nZMPOP\r\n$1\r\n2\r\n$7\r\nmissing\r\n$1\r\na\r\n$3\r\nMIN\r\n",
+			expected: "*2\r\n$1\r\na\r\n*1\r\n*2\r\n$1\r\nx\r\n$1\r\n1\r\n",
+		},
+		{
+			name:     "bzpopmin timeout",
+			args:     "*3\r\n$8\r\nBZPOPMIN\r\n$1\r\na\r\n$4\r\n0.01\r\n",
+			expected: "*-1\r\n",
+		},
+		{
+			name:     "bzpopmin timeout out of range",
+			args:     "*3\r\n$8\r\nBZPOPMIN\r\n$1\r\na\r\n$5\r\n1e300\r\n",
+			expected: "-ERR timeout is out of range\r\n",
+		},
+		{
+			name:     "zmpop empty",
+			args:     "*4\r\n$5\r\nZMPOP\r\n$1\r\n1\r\n$1\r\na\r\n$3\r\nMAX\r\n",
+			expected: "*-1\r\n",
+		},
+		{
+			name:     "bzmpop timeout",
+			args:     "*5\r\n$6\r\nBZMPOP\r\n$4\r\n0.01\r\n$1\r\n1\r\n$1\r\na\r\n$3\r\nMIN\r\n",
+			expected: "*-1\r\n",
+		},
+	}
+
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+	client := processor.Connect("id")
+	for _, tt := range testcases {
+		output, err := processor.Accept(client, []byte(tt.args))
+		if err != nil {
+			t.Errorf("test: %v - unexpected error: %v", tt.name, err)
+		}
+		if string(output) != string(tt.expected) {
+			t.Errorf("test: %v - expected: %q - actual: %q", tt.name, string(tt.expected), string(output))
+		}
+	}
+}
+
+func TestProcessor_BZPopMinWakeUp(t *testing.T) {
+	respParser := NewRESP()
+	memory := NewMemory()
+	processor := NewProcessor(respParser, memory)
+
+	done := make(chan string)
+	go func() {
+		output, _ := processor.Accept(processor.Connect("blocked"), []byte("*3\r\n$8\r\nBZPOPMIN\r\n$4\r\njobs\r\n$1\r\n0\r\n"))
+		done <- string(output)
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	processor.Accept(processor.Connect("writer"), []byte("*4\r\n$4\r\nZADD\r\n$4\r\njobs\r\n$1\r\n5\r\n$4\r\njob1\r\n"))
+
+	select {
+	case output := <-done:
+		expected := "*3\r\n$4\r\njobs\r\n$4\r\njob1\r\n$1\r\n5\r\n"
+		if output != expected {
+			t.Errorf("expected: %q - actual: %q", expected, output)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("BZPOPMIN was not woken up by ZADD")
+	}
+}